@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/avichalp/toy-evm/asm"
+	"github.com/avichalp/toy-evm/evm"
+)
+
+// assemble prints the hex encoded bytecode of the assembly
+// file given as argument. Macro files (.huff) are compiled
+// into their initcode, or their runtime with -runtime.
+func assemble(args []string) {
+	var runtime bool
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	fs.BoolVar(&runtime, "runtime", false, "print the runtime instead of the initcode of a .huff file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: toy-evm asm [-runtime] <file.easm|file.huff>")
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+
+	var (
+		code []byte
+		err  error
+	)
+	if strings.HasSuffix(path, ".huff") {
+		code, err = compileMacroFile(path, runtime)
+	} else {
+		code, err = assembleFile(path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%x\n", code)
+}
+
+func assembleFile(path string) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	evm.Init()
+	code, err := asm.Assemble(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return code, nil
+}
+
+func compileMacroFile(path string, runtime bool) ([]byte, error) {
+	evm.Init()
+	contract, err := asm.CompileFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime {
+		return contract.Runtime, nil
+	}
+	return contract.Initcode, nil
+}
@@ -0,0 +1,266 @@
+// Package asm assembles a textual representation of EVM
+// instructions into bytecode.
+//
+// A program is a list of statements separated by newlines or
+// semicolons. A statement is a mnemonic with an optional
+// immediate, a label definition, or a data directive:
+//
+//	PUSH1 0x04            // explicit PUSH size
+//	loop: JUMPDEST        // label followed by an instruction
+//	PUSH @loop            // smallest PUSH that fits the label
+//	JUMP
+//	msg: .data 0x68656c6c6f
+//
+// Everything after // is a comment. The mnemonics are the
+// names of the evm.InstructionSet, so evm.Init must be called
+// before assembling.
+package asm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+)
+
+var labelRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Error is an assembler error at a given line of the source
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func errorf(line int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// item is a single piece of the output: an opcode, a PUSH
+// with its immediate, or raw data
+type item struct {
+	line   int
+	opcode byte
+	// push is set for PUSH1-PUSH32, size is the number of
+	// bytes of the immediate
+	push bool
+	size int
+	// auto is set when the size of the PUSH is chosen by
+	// the assembler instead of the source
+	auto  bool
+	value *uint256.Int
+	label string
+	data  []byte
+}
+
+func (it *item) len() int {
+	if it.data != nil {
+		return len(it.data)
+	}
+	if it.push {
+		return 1 + it.size
+	}
+	return 1
+}
+
+// Assemble translates the source into bytecode
+func Assemble(src string) ([]byte, error) {
+	mnemonics := make(map[string]byte)
+	for _, inst := range evm.InstructionSet {
+		mnemonics[inst.Name()] = inst.Opcode()
+	}
+
+	items := make([]*item, 0)
+	// labels maps a label to the index of the first item after it
+	labels := make(map[string]int)
+	for i, line := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if idx := strings.Index(stmt, ":"); idx >= 0 {
+				label := strings.TrimSpace(stmt[:idx])
+				if !labelRe.MatchString(label) {
+					return nil, errorf(lineNo, "invalid label %q", label)
+				}
+				if _, ok := labels[label]; ok {
+					return nil, errorf(lineNo, "label %q already defined", label)
+				}
+				labels[label] = len(items)
+				stmt = strings.TrimSpace(stmt[idx+1:])
+			}
+			if stmt == "" {
+				continue
+			}
+			it, err := parseStatement(lineNo, stmt, mnemonics)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+		}
+	}
+
+	for _, it := range items {
+		if _, ok := labels[it.label]; it.label != "" && !ok {
+			return nil, errorf(it.line, "undefined label %q", it.label)
+		}
+	}
+
+	// Grow the automatically sized PUSHes until every label fits.
+	// Sizes only ever increase, so this terminates.
+	offsets := layout(items)
+	for changed := true; changed; {
+		changed = false
+		for _, it := range items {
+			if it.label == "" {
+				continue
+			}
+			size := byteLen(offsets[labels[it.label]])
+			if size <= it.size {
+				continue
+			}
+			if !it.auto {
+				return nil, errorf(it.line, "label %q does not fit in PUSH%d", it.label, it.size)
+			}
+			it.size = size
+			changed = true
+		}
+		offsets = layout(items)
+	}
+
+	code := make([]byte, 0, offsets[len(items)])
+	for _, it := range items {
+		switch {
+		case it.data != nil:
+			code = append(code, it.data...)
+		case it.push:
+			value := it.value
+			if it.label != "" {
+				value = uint256.NewInt(uint64(offsets[labels[it.label]]))
+			}
+			code = append(code, 0x60+byte(it.size-1))
+			code = append(code, value.PaddedBytes(it.size)...)
+		default:
+			code = append(code, it.opcode)
+		}
+	}
+	return code, nil
+}
+
+// layout returns the offset of each item in the code. The
+// last element is the offset right after the last item.
+func layout(items []*item) []int {
+	offsets := make([]int, len(items)+1)
+	for i, it := range items {
+		offsets[i+1] = offsets[i] + it.len()
+	}
+	return offsets
+}
+
+func parseStatement(line int, stmt string, mnemonics map[string]byte) (*item, error) {
+	fields := strings.Fields(stmt)
+	name := strings.ToUpper(fields[0])
+	args := fields[1:]
+
+	if name == ".DATA" {
+		if len(args) != 1 {
+			return nil, errorf(line, ".data takes exactly one hex argument")
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(args[0], "0x"))
+		if err != nil {
+			return nil, errorf(line, "invalid data %q: %v", args[0], err)
+		}
+		return &item{line: line, data: data}, nil
+	}
+
+	if strings.HasPrefix(name, "PUSH") {
+		return parsePush(line, name, args, mnemonics)
+	}
+
+	opcode, ok := mnemonics[name]
+	if !ok {
+		return nil, errorf(line, "unknown instruction %q", fields[0])
+	}
+	if len(args) != 0 {
+		return nil, errorf(line, "%s takes no arguments", name)
+	}
+	return &item{line: line, opcode: opcode}, nil
+}
+
+func parsePush(line int, name string, args []string, mnemonics map[string]byte) (*item, error) {
+	it := &item{line: line, push: true}
+	if name == "PUSH" {
+		it.auto = true
+	} else {
+		if _, ok := mnemonics[name]; !ok {
+			return nil, errorf(line, "unknown instruction %q", name)
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(name, "PUSH"))
+		if err != nil {
+			return nil, errorf(line, "unknown instruction %q", name)
+		}
+		it.size = size
+	}
+	if len(args) != 1 {
+		return nil, errorf(line, "%s takes exactly one argument", name)
+	}
+
+	arg := args[0]
+	if strings.HasPrefix(arg, "@") {
+		it.label = arg[1:]
+		if it.auto {
+			it.size = 1
+		}
+		return it, nil
+	}
+
+	value, err := parseValue(arg)
+	if err != nil {
+		return nil, errorf(line, "invalid value %q: %v", arg, err)
+	}
+	size := 1
+	if value.ByteLen() > size {
+		size = value.ByteLen()
+	}
+	if it.auto {
+		it.size = size
+	} else if size > it.size {
+		return nil, errorf(line, "value %s does not fit in %s", arg, name)
+	}
+	it.value = value
+	return it, nil
+}
+
+// parseValue parses a 0x prefixed hex or a decimal number
+func parseValue(s string) (*uint256.Int, error) {
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok || b.Sign() < 0 {
+		return nil, fmt.Errorf("not a number")
+	}
+	value, overflow := uint256.FromBig(b)
+	if overflow {
+		return nil, fmt.Errorf("larger than 32 bytes")
+	}
+	return value, nil
+}
+
+// byteLen returns the number of bytes needed to encode n,
+// at least one
+func byteLen(n int) int {
+	size := 1
+	for n > 0xff {
+		n >>= 8
+		size++
+	}
+	return size
+}
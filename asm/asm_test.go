@@ -0,0 +1,106 @@
+package asm
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	evm.Init()
+	var tests = []struct {
+		name string
+		src  string
+		code string
+	}{
+		{
+			name: "mnemonics",
+			src:  "PUSH1 0x06; PUSH1 7; MUL",
+			code: "6006600702",
+		},
+		{
+			name: "case insensitive with comments",
+			src:  "push2 0x0102 // two bytes\n\n// nothing here\nstop",
+			code: "61010200",
+		},
+		{
+			name: "auto sized push",
+			src:  "PUSH 0; PUSH 0x0100; PUSH 0xffffff",
+			code: "600061010062ffffff",
+		},
+		{
+			name: "backward label",
+			src:  "loop: JUMPDEST; PUSH @loop; JUMP",
+			code: "5b600056",
+		},
+		{
+			name: "forward label",
+			src:  "PUSH @end; JUMP; end: JUMPDEST",
+			code: "6003565b",
+		},
+		{
+			name: "fixed size label",
+			src:  "PUSH2 @end; JUMP; end: JUMPDEST",
+			code: "610004565b",
+		},
+		{
+			name: "data section",
+			src:  "PUSH @msg\nSTOP\nmsg: .data 0x68656c6c6f",
+			code: "60030068656c6c6f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Assemble(tt.src)
+			assert.NoError(t, err)
+			assert.Equal(t, evm.HexToBytes(tt.code), code)
+		})
+	}
+}
+
+// TestAssembleGrowsLabels checks that a label past 255 bytes
+// makes the PUSH referencing it grow to PUSH2
+func TestAssembleGrowsLabels(t *testing.T) {
+	evm.Init()
+	code, err := Assemble("PUSH @end; JUMP; .data 0x" + strings.Repeat("00", 300) + "; end: JUMPDEST")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x61, 0x01, 0x30, 0x56}, code[:4])
+	assert.Equal(t, byte(0x5b), code[0x130])
+}
+
+func TestAssembleSquare(t *testing.T) {
+	evm.Init()
+	src, err := os.ReadFile("../examples/square.easm")
+	assert.NoError(t, err)
+	code, err := Assemble(string(src))
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToBytes("60048060005b8160125760005360016000f35b8201906001900390600556"), code)
+}
+
+func TestAssembleErrors(t *testing.T) {
+	evm.Init()
+	var tests = []struct {
+		src string
+		err string
+	}{
+		{"STOP\nFOO", `line 2: unknown instruction "FOO"`},
+		{"PUSH1 0x0100", "line 1: value 0x0100 does not fit in PUSH1"},
+		{"PUSH1", "line 1: PUSH1 takes exactly one argument"},
+		{"PUSH1 zz", `line 1: invalid value "zz": not a number`},
+		{"ADD 1", "line 1: ADD takes no arguments"},
+		{"\n\nPUSH @nowhere", `line 3: undefined label "nowhere"`},
+		{"a: STOP\na: STOP", `line 2: label "a" already defined`},
+		{"1a: STOP", `line 1: invalid label "1a"`},
+		{".data 0xabc", `line 1: invalid data "0xabc": encoding/hex: odd length hex string`},
+		{"PUSH1 @end; .data 0x" + strings.Repeat("00", 300) + "; end: STOP", `line 1: label "end" does not fit in PUSH1`},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.src)
+		assert.EqualError(t, err, tt.err)
+	}
+}
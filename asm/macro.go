@@ -0,0 +1,504 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+)
+
+// Contract is the output of the macro assembler
+type Contract struct {
+	// Runtime is the code of the MAIN macro
+	Runtime []byte
+	// Initcode is the CONSTRUCTOR macro, if any, followed by code
+	// that copies the runtime into memory and returns it
+	Initcode []byte
+}
+
+// MacroError is an error at a given line of a macro source file
+type MacroError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *MacroError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokDirective
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	file string
+	line int
+}
+
+func (t token) errorf(format string, args ...interface{}) *MacroError {
+	return &MacroError{File: t.file, Line: t.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+type macro struct {
+	name string
+	body []token
+	// labels defined in the body
+	labels map[string]bool
+}
+
+// compiler holds the definitions collected from the
+// source file and its includes
+type compiler struct {
+	constants map[string]string
+	macros    map[string]*macro
+	included  map[string]bool
+	// freePointer is the next slot handed out by FREE_STORAGE_POINTER()
+	freePointer int
+	// expansions counts the macro invocations, it keeps the
+	// labels of two expansions of the same macro apart
+	expansions int
+	// origins holds the file and line of every generated statement
+	origins []token
+}
+
+// CompileFile compiles a Huff style macro source file.
+//
+// The dialect supports:
+//
+//	#include "other.huff"
+//	#define constant OWNER = 0x01
+//	#define constant BALANCES = FREE_STORAGE_POINTER()
+//	#define macro MAIN() = takes(0) returns(0) {
+//	    0x00 calldataload          // hex literals are pushed
+//	    __FUNC_SIG("transfer(address,uint256)")
+//	    [OWNER] sload              // constants are pushed
+//	    done jumpi                 // labels are pushed
+//	    TRANSFER()                 // macros are inlined
+//	    done:                      // labels emit a JUMPDEST
+//	}
+//
+// The MAIN macro is the runtime code. The initcode runs the
+// optional CONSTRUCTOR macro and then CODECOPYs and RETURNs
+// the runtime. evm.Init must be called before compiling.
+func CompileFile(path string) (*Contract, error) {
+	c := &compiler{
+		constants: make(map[string]string),
+		macros:    make(map[string]*macro),
+		included:  make(map[string]bool),
+	}
+	if err := c.include(path); err != nil {
+		return nil, err
+	}
+
+	main, ok := c.macros["MAIN"]
+	if !ok {
+		return nil, fmt.Errorf("%s: MAIN macro is not defined", path)
+	}
+	runtime, err := c.assemble(main)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy the runtime, appended to the initcode, into
+	// memory and return it
+	ctor := fmt.Sprintf(
+		"PUSH %d\nDUP1\nPUSH @runtime\nPUSH1 0x00\nCODECOPY\nPUSH1 0x00\nRETURN\nruntime: .data 0x%x",
+		len(runtime), runtime,
+	)
+	if m, ok := c.macros["CONSTRUCTOR"]; ok {
+		c.origins = nil
+		statements, err := c.expand(m, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		ctor = strings.Join(statements, "\n") + "\n" + ctor
+	}
+	initcode, err := Assemble(ctor)
+	if err != nil {
+		return nil, c.translate(err)
+	}
+	return &Contract{Runtime: runtime, Initcode: initcode}, nil
+}
+
+func (c *compiler) assemble(m *macro) ([]byte, error) {
+	c.origins = nil
+	statements, err := c.expand(m, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	code, err := Assemble(strings.Join(statements, "\n"))
+	if err != nil {
+		return nil, c.translate(err)
+	}
+	return code, nil
+}
+
+// translate maps an error of the generated assembly
+// back to the macro source it came from
+func (c *compiler) translate(err error) error {
+	var asmErr *Error
+	if errors.As(err, &asmErr) && asmErr.Line <= len(c.origins) {
+		return c.origins[asmErr.Line-1].errorf("%s", asmErr.Msg)
+	}
+	return err
+}
+
+// include parses the file at path and collects its definitions.
+// A file that was already included is skipped.
+func (c *compiler) include(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if c.included[abs] {
+		return nil
+	}
+	c.included[abs] = true
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tokens, err := lex(path, string(src))
+	if err != nil {
+		return err
+	}
+	return c.parse(filepath.Dir(path), tokens)
+}
+
+func (c *compiler) parse(dir string, tokens []token) error {
+	p := &parser{tokens: tokens}
+	for !p.done() {
+		tok := p.next()
+		switch {
+		case tok.kind == tokDirective && tok.text == "#include":
+			file, err := p.expect(tokString, "")
+			if err != nil {
+				return err
+			}
+			if err := c.include(filepath.Join(dir, file.text)); err != nil {
+				return err
+			}
+		case tok.kind == tokDirective && tok.text == "#define":
+			kind, err := p.expect(tokIdent, "")
+			if err != nil {
+				return err
+			}
+			switch kind.text {
+			case "constant":
+				err = c.parseConstant(p)
+			case "macro":
+				err = c.parseMacro(p)
+			default:
+				err = kind.errorf("unsupported definition %q", kind.text)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return tok.errorf("unexpected %q outside of a definition", tok.text)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) parseConstant(p *parser) error {
+	name, err := p.expect(tokIdent, "")
+	if err != nil {
+		return err
+	}
+	if _, err := p.expect(tokPunct, "="); err != nil {
+		return err
+	}
+	if p.done() {
+		return name.errorf("constant %s has no value", name.text)
+	}
+	value := p.next()
+	switch {
+	case value.kind == tokNumber:
+		c.constants[name.text] = value.text
+	case value.kind == tokIdent && value.text == "FREE_STORAGE_POINTER":
+		if _, err := p.expect(tokPunct, "("); err != nil {
+			return err
+		}
+		if _, err := p.expect(tokPunct, ")"); err != nil {
+			return err
+		}
+		c.constants[name.text] = fmt.Sprintf("0x%x", c.freePointer)
+		c.freePointer++
+	default:
+		return value.errorf("invalid value %q for constant %s", value.text, name.text)
+	}
+	return nil
+}
+
+func (c *compiler) parseMacro(p *parser) error {
+	name, err := p.expect(tokIdent, "")
+	if err != nil {
+		return err
+	}
+	if _, ok := c.macros[name.text]; ok {
+		return name.errorf("macro %s already defined", name.text)
+	}
+	for _, punct := range []string{"(", ")", "="} {
+		if _, err := p.expect(tokPunct, punct); err != nil {
+			return err
+		}
+	}
+	// takes(n) returns(m) only document the stack
+	// effect of the macro and are not checked
+	for _, keyword := range []string{"takes", "returns"} {
+		if _, err := p.expect(tokIdent, keyword); err != nil {
+			return err
+		}
+		for _, tt := range []struct {
+			kind tokenKind
+			text string
+		}{{tokPunct, "("}, {tokNumber, ""}, {tokPunct, ")"}} {
+			if _, err := p.expect(tt.kind, tt.text); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := p.expect(tokPunct, "{"); err != nil {
+		return err
+	}
+
+	m := &macro{name: name.text, labels: make(map[string]bool)}
+	for {
+		if p.done() {
+			return name.errorf("macro %s is not closed", name.text)
+		}
+		tok := p.next()
+		if tok.kind == tokPunct && tok.text == "}" {
+			break
+		}
+		if tok.kind == tokIdent && p.peek(tokPunct, ":") {
+			m.labels[tok.text] = true
+		}
+		m.body = append(m.body, tok)
+	}
+	c.macros[name.text] = m
+	return nil
+}
+
+// scope maps the labels of a macro expansion to their unique
+// names in the generated assembly. Labels that are not defined
+// in the macro are looked up in the macro that invoked it.
+type scope struct {
+	labels map[string]string
+	parent *scope
+}
+
+func (s *scope) lookup(label string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if name, ok := s.labels[label]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// expand inlines the body of the macro as assembly statements.
+// stack holds the macros being expanded to detect recursion.
+func (c *compiler) expand(m *macro, parent *scope, stack []string) ([]string, error) {
+	stack = append(stack, m.name)
+
+	c.expansions++
+	sc := &scope{labels: make(map[string]string), parent: parent}
+	for label := range m.labels {
+		sc.labels[label] = fmt.Sprintf("%s_%d_%s", m.name, c.expansions, label)
+	}
+
+	mnemonics := make(map[string]bool)
+	for _, inst := range evm.InstructionSet {
+		mnemonics[inst.Name()] = true
+	}
+
+	statements := make([]string, 0)
+	emit := func(tok token, stmt string) {
+		statements = append(statements, stmt)
+		c.origins = append(c.origins, tok)
+	}
+
+	p := &parser{tokens: m.body}
+	for !p.done() {
+		tok := p.next()
+		switch {
+		case tok.kind == tokNumber:
+			emit(tok, "PUSH "+tok.text)
+
+		case tok.kind == tokPunct && tok.text == "[":
+			name, err := p.expect(tokIdent, "")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokPunct, "]"); err != nil {
+				return nil, err
+			}
+			value, ok := c.constants[name.text]
+			if !ok {
+				return nil, name.errorf("undefined constant %s", name.text)
+			}
+			emit(tok, "PUSH "+value)
+
+		case tok.kind == tokIdent && tok.text == "__FUNC_SIG":
+			if _, err := p.expect(tokPunct, "("); err != nil {
+				return nil, err
+			}
+			sig, err := p.expect(tokString, "")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokPunct, ")"); err != nil {
+				return nil, err
+			}
+			emit(tok, fmt.Sprintf("PUSH4 0x%x", crypto.Keccak256([]byte(sig.text))[:4]))
+
+		case tok.kind == tokIdent && p.peek(tokPunct, ":"):
+			p.next()
+			emit(tok, sc.labels[tok.text]+": JUMPDEST")
+
+		case tok.kind == tokIdent && p.peek(tokPunct, "("):
+			p.next()
+			if _, err := p.expect(tokPunct, ")"); err != nil {
+				return nil, err
+			}
+			invoked, ok := c.macros[tok.text]
+			if !ok {
+				return nil, tok.errorf("undefined macro %s", tok.text)
+			}
+			for _, name := range stack {
+				if name == invoked.name {
+					return nil, tok.errorf("macro %s invokes itself: %s", name, strings.Join(append(stack, name), " -> "))
+				}
+			}
+			body, err := c.expand(invoked, sc, stack)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, body...)
+
+		case tok.kind == tokIdent && mnemonics[strings.ToUpper(tok.text)]:
+			emit(tok, strings.ToUpper(tok.text))
+
+		case tok.kind == tokIdent:
+			label, ok := sc.lookup(tok.text)
+			if !ok {
+				return nil, tok.errorf("unknown instruction or label %q", tok.text)
+			}
+			emit(tok, "PUSH @"+label)
+
+		default:
+			return nil, tok.errorf("unexpected %q", tok.text)
+		}
+	}
+	return statements, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// peek reports whether the next token is of the given kind and text
+func (p *parser) peek(kind tokenKind, text string) bool {
+	return !p.done() && p.tokens[p.pos].kind == kind && p.tokens[p.pos].text == text
+}
+
+// expect returns the next token, it fails if the token is not of
+// the given kind or, when text is not empty, does not match text
+func (p *parser) expect(kind tokenKind, text string) (token, error) {
+	if p.done() {
+		last := token{}
+		if len(p.tokens) > 0 {
+			last = p.tokens[len(p.tokens)-1]
+		}
+		return token{}, last.errorf("unexpected end of file")
+	}
+	tok := p.next()
+	if tok.kind != kind || (text != "" && tok.text != text) {
+		return token{}, tok.errorf("unexpected %q", tok.text)
+	}
+	return tok, nil
+}
+
+// lex splits the source into tokens, dropping comments
+func lex(file, src string) ([]token, error) {
+	tokens := make([]token, 0)
+	line := 1
+	for i := 0; i < len(src); {
+		ch := src[i]
+		start := i
+		switch {
+		case ch == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(ch)):
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, &MacroError{file, line, "comment is not closed"}
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case ch == '"':
+			end := strings.IndexAny(src[i+1:], "\"\n")
+			if end < 0 || src[i+1+end] != '"' {
+				return nil, &MacroError{file, line, "string is not closed"}
+			}
+			tokens = append(tokens, token{tokString, src[i+1 : i+1+end], file, line})
+			i += end + 2
+		case strings.ContainsRune("()[]{}=:", rune(ch)):
+			tokens = append(tokens, token{tokPunct, string(ch), file, line})
+			i++
+		case ch == '#' || ch == '_' || unicode.IsLetter(rune(ch)) || unicode.IsDigit(rune(ch)):
+			i++
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			text := src[start:i]
+			kind := tokIdent
+			switch {
+			case ch == '#':
+				kind = tokDirective
+			case strings.HasPrefix(text, "0x"):
+				kind = tokNumber
+			case unicode.IsDigit(rune(ch)):
+				// a decimal, e.g. in takes(n)
+				kind = tokNumber
+			}
+			tokens = append(tokens, token{kind, text, file, line})
+		default:
+			return nil, &MacroError{file, line, fmt.Sprintf("unexpected character %q", ch)}
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,143 @@
+package asm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	return dir
+}
+
+func TestCompileFile(t *testing.T) {
+	evm.Init()
+	dir := writeFiles(t, map[string]string{
+		"lib.huff": `
+			#define constant OWNER = 0x01
+			#define constant COUNTER = FREE_STORAGE_POINTER()
+			#define constant TOTAL = FREE_STORAGE_POINTER()
+
+			/* push a selector and skip over
+			   the next instruction when it matches */
+			#define macro SKIP() = takes(0) returns(0) {
+				__FUNC_SIG("transfer(address,uint256)") skip jumpi
+				stop
+				skip:
+			}
+		`,
+		"main.huff": `
+			#include "lib.huff"
+			#include "lib.huff" // included only once
+
+			#define macro MAIN() = takes(0) returns(0) {
+				[OWNER] [TOTAL] sstore
+				SKIP()
+				SKIP()
+				0x2a end jump
+				end:
+			}
+		`,
+	})
+
+	contract, err := CompileFile(filepath.Join(dir, "main.huff"))
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToBytes(
+		// PUSH1 0x01 PUSH1 0x01 SSTORE
+		"6001600155"+
+			// first SKIP(): PUSH4 selector PUSH1 0x10 JUMPI STOP JUMPDEST
+			"63a9059cbb"+"600e"+"57"+"00"+"5b"+
+			// second SKIP() has its own label
+			"63a9059cbb"+"6018"+"57"+"00"+"5b"+
+			// PUSH1 0x2a PUSH1 0x20 JUMP JUMPDEST
+			"602a"+"601e"+"56"+"5b",
+	), contract.Runtime)
+
+	// running the initcode returns the runtime
+	ectx := evm.NewExecutionCtx(
+		contract.Initcode,
+		evm.NewCalldata(""),
+		evm.NewStack(),
+		evm.NewMemory(),
+		evm.NewStorage(),
+		1000,
+	)
+	deployed, err := evm.Run(ectx)
+	assert.NoError(t, err)
+	assert.Equal(t, contract.Runtime, deployed)
+}
+
+func TestCompileFileConstructor(t *testing.T) {
+	evm.Init()
+	dir := writeFiles(t, map[string]string{
+		"main.huff": `
+			#define macro CONSTRUCTOR() = takes(0) returns(0) {
+				0x01 0x00 sstore
+			}
+			#define macro MAIN() = takes(0) returns(0) {
+				0x00 sload
+			}
+		`,
+	})
+
+	contract, err := CompileFile(filepath.Join(dir, "main.huff"))
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToBytes("600054"), contract.Runtime)
+	assert.Equal(t, evm.HexToBytes("6001600055"+"6003"+"80"+"6010"+"6000"+"39"+"6000"+"f3"+"600054"), contract.Initcode)
+}
+
+func TestCompileFileErrors(t *testing.T) {
+	evm.Init()
+	var tests = []struct {
+		src string
+		err string
+	}{
+		{
+			"#define macro MAIN() = takes(0) returns(0) {\n  0x01\n  foo\n}",
+			`main.huff:3: unknown instruction or label "foo"`,
+		},
+		{
+			"#define macro MAIN() = takes(0) returns(0) {\n  [NOPE]\n}",
+			"main.huff:2: undefined constant NOPE",
+		},
+		{
+			"#define macro MAIN() = takes(0) returns(0) {\n  A()\n}\n#define macro A() = takes(0) returns(0) {\n  MAIN()\n}",
+			"main.huff:5: macro MAIN invokes itself: MAIN -> A -> MAIN",
+		},
+		{
+			"#define macro MAIN() = takes(0) returns(0) {\n  0x0100000000000000000000000000000000000000000000000000000000000000000\n}",
+			`main.huff:2: invalid value "0x0100000000000000000000000000000000000000000000000000000000000000000": larger than 32 bytes`,
+		},
+		{
+			"#define macro MAIN() = takes(0) returns(0) {\n  0x01",
+			"main.huff:1: macro MAIN is not closed",
+		},
+		{
+			"#define constant X = 0x01",
+			"MAIN macro is not defined",
+		},
+		{
+			"#include \"missing.huff\"",
+			"no such file or directory",
+		},
+		{
+			"stop",
+			`main.huff:1: unexpected "stop" outside of a definition`,
+		},
+	}
+
+	for _, tt := range tests {
+		dir := writeFiles(t, map[string]string{"main.huff": tt.src})
+		_, err := CompileFile(filepath.Join(dir, "main.huff"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
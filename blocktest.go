@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/tests"
+)
+
+// blocktest runs the BlockchainTests fixtures in the files or
+// directories given as arguments and prints a line per test,
+// followed by a summary
+func blocktest(args []string) {
+	var match string
+	flags := flag.NewFlagSet("blocktest", flag.ExitOnError)
+	flags.StringVar(&match, "run", "", "only run the tests whose name matches this regular expression")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: toy-evm blocktest [-run regexp] <file|dir>...")
+		os.Exit(2)
+	}
+	re, err := regexp.Compile(match)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	evm.Init()
+	evm.DebugOutput = io.Discard
+
+	files, err := fixtureFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	passed, failed := 0, 0
+	for _, file := range files {
+		fixtures, err := tests.LoadBlockTests(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		names := make([]string, 0, len(fixtures))
+		for name := range fixtures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if !re.MatchString(name) {
+				continue
+			}
+			if _, err := fixtures[name].Run(); err != nil {
+				fmt.Printf("FAIL %s: %v\n", name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("PASS %s\n", name)
+			passed++
+		}
+	}
+	fmt.Printf("\n%d tests: %d passed, %d failed\n", passed+failed, passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"golang.org/x/exp/slices"
+)
+
+// precompiles are the addresses of the precompiled contracts up to
+// Cancun
+var precompiles = func() []evm.Address {
+	addrs := make([]evm.Address, 0, 10)
+	for i := byte(1); i <= 10; i++ {
+		addrs = append(addrs, evm.BytesToAddress([]byte{i}))
+	}
+	return addrs
+}()
+
+// newAccessSet returns the access set a message starts with: the
+// sender, the recipient, the coinbase (EIP-3651), the precompiles
+// and the entries of the access list of the message are warm
+func newAccessSet(msg *types.Message, to, coinbase evm.Address) *evm.AccessSet {
+	set := evm.NewAccessSet()
+	set.AddAddress(msg.From)
+	set.AddAddress(to)
+	set.AddAddress(coinbase)
+	for _, addr := range precompiles {
+		set.AddAddress(addr)
+	}
+	for _, tuple := range msg.AccessList {
+		set.AddAddress(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			set.AddSlot(tuple.Address, key)
+		}
+	}
+	return set
+}
+
+// AccessListTracer records the addresses and the storage slots
+// accessed by the execution, on top of an access list. The sender,
+// the recipient and the precompiles are always warm, they are left
+// out unless their slots are accessed.
+type AccessListTracer struct {
+	excluded map[evm.Address]bool
+	list     map[evm.Address]map[evm.Hash]bool
+}
+
+// NewAccessListTracer returns a tracer starting from the access list
+// of the message from sender to recipient
+func NewAccessListTracer(list types.AccessList, from, to evm.Address) *AccessListTracer {
+	t := &AccessListTracer{
+		excluded: map[evm.Address]bool{from: true, to: true},
+		list:     make(map[evm.Address]map[evm.Hash]bool),
+	}
+	for _, addr := range precompiles {
+		t.excluded[addr] = true
+	}
+	for _, tuple := range list {
+		if t.excluded[tuple.Address] && len(tuple.StorageKeys) == 0 {
+			continue
+		}
+		t.addAddress(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			t.list[tuple.Address][key] = true
+		}
+	}
+	return t
+}
+
+func (t *AccessListTracer) addAddress(addr evm.Address) {
+	if _, ok := t.list[addr]; !ok {
+		t.list[addr] = make(map[evm.Hash]bool)
+	}
+}
+
+func (t *AccessListTracer) CaptureStart(ctx *evm.ExecutionCtx) {}
+
+func (t *AccessListTracer) CaptureState(ctx *evm.ExecutionCtx, pc uint64, op byte, gas, cost uint64) {
+	if ctx.Stack.Len() == 0 {
+		return
+	}
+	// all of them take the slot or the address from the top of the stack
+	switch op {
+	case 0x54, 0x55: // SLOAD, SSTORE
+		t.addAddress(ctx.Address)
+		t.list[ctx.Address][ctx.Stack.Peek(0).Bytes32()] = true
+	case 0x31, 0x3b, 0x3c, 0x3f: // BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH
+		if addr := evm.Address(ctx.Stack.Peek(0).Bytes20()); !t.excluded[addr] {
+			t.addAddress(addr)
+		}
+	}
+}
+
+func (t *AccessListTracer) CaptureEnter(typ string, from, to evm.Address, input []byte, gas uint64, value *uint256.Int) {
+}
+
+func (t *AccessListTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *AccessListTracer) CaptureEnd(ctx *evm.ExecutionCtx, output []byte, err error) {}
+
+// AccessList returns the access list, the addresses and the storage
+// keys in ascending order
+func (t *AccessListTracer) AccessList() types.AccessList {
+	list := make(types.AccessList, 0, len(t.list))
+	for addr, slots := range t.list {
+		keys := make([]evm.Hash, 0, len(slots))
+		for key := range slots {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		list = append(list, types.AccessTuple{Address: addr, StorageKeys: keys})
+	}
+	sort.Slice(list, func(i, j int) bool { return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0 })
+	return list
+}
+
+// CreateAccessList returns the access list of the message and the
+// result of the call with it applied. The message is called with the
+// list found so far until the list doesn't change, the state is left
+// unchanged. Entries of the access list of the message are kept.
+//
+// The list warms what the message accesses, it lowers the gas used
+// when the cold accesses it saves cost more than its intrinsic gas.
+func CreateAccessList(state *evm.State, msg *types.Message, blockCtx *BlockContext) (types.AccessList, *ExecutionResult, error) {
+	to := CreateAddress(msg.From, msg.Nonce)
+	if msg.To != nil {
+		to = *msg.To
+	}
+	list := msg.AccessList
+	for {
+		tracer := NewAccessListTracer(list, msg.From, to)
+		call, ctx := *msg, *blockCtx
+		call.AccessList, ctx.Tracer = list, tracer
+
+		snapshot := state.Snapshot()
+		result, err := Call(state, &call, &ctx)
+		state.RevertToSnapshot(snapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+		found := tracer.AccessList()
+		if slices.EqualFunc(found, list, func(a, b types.AccessTuple) bool {
+			return a.Address == b.Address && slices.Equal(a.StorageKeys, b.StorageKeys)
+		}) {
+			return found, result, nil
+		}
+		list = found
+	}
+}
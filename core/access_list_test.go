@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessListTracer(t *testing.T) {
+	evm.Init()
+	from, to, other := sender, evm.HexToAddress("0x1000"), evm.HexToAddress("0x2000")
+	tracer := NewAccessListTracer(types.AccessList{
+		{Address: from},
+		{Address: other, StorageKeys: []evm.Hash{evm.HexToHash("0x02")}},
+	}, from, to)
+	// BALANCE of the sender, a precompile and another address, then
+	// SLOAD of slot 3
+	ctx := evm.NewExecutionCtx(nil, nil, evm.NewStack(), evm.NewMemory(), evm.NewStorage(), 0)
+	ctx.Address = to
+	for _, addr := range []evm.Address{from, evm.HexToAddress("0x01"), evm.HexToAddress("0x0100")} {
+		ctx.Stack.Push(new(uint256.Int).SetBytes(addr[:]))
+		tracer.CaptureState(ctx, 0, 0x31, 0, 0)
+		ctx.Stack.Pop()
+	}
+	ctx.Stack.Push(uint256.NewInt(3))
+	tracer.CaptureState(ctx, 0, 0x54, 0, 0)
+
+	assert.Equal(t, types.AccessList{
+		{Address: evm.HexToAddress("0x0100"), StorageKeys: []evm.Hash{}},
+		{Address: to, StorageKeys: []evm.Hash{evm.HexToHash("0x03")}},
+		{Address: other, StorageKeys: []evm.Hash{evm.HexToHash("0x02")}},
+	}, tracer.AccessList())
+}
+
+func TestCreateAccessList(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	// stores n at slot n for n from 20 down to 1
+	//
+	// 60 14
+	// 5b       JUMPDEST
+	// 80 80 55 SSTORE n at n
+	// 60 01 90 03
+	// 80 60 02 57 loop while n-1 isn't zero
+	// 00
+	contract := evm.HexToAddress("0x1000")
+	state.SetCode(contract, evm.HexToBytes("60145b808055600190038060025700"))
+	root := state.Root()
+
+	msg := &types.Message{From: sender, To: &contract, GasLimit: 600000}
+	list, result, err := CreateAccessList(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, contract, list[0].Address)
+	assert.Len(t, list[0].StorageKeys, 20)
+	assert.Equal(t, evm.HexToHash("0x01"), list[0].StorageKeys[0])
+	assert.False(t, result.Failed())
+	assert.Equal(t, root, state.Root())
+
+	// a warm slot saves 2100 on SSTORE and costs 1900, the address
+	// costs 2400
+	without, err := Call(state.Copy(), msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, without.UsedGas-20*(evm.ColdSloadCost-TxAccessListStorageKeyGas)+TxAccessListAddressGas, result.UsedGas)
+	assert.Less(t, result.UsedGas, without.UsedGas)
+
+	// the entries of the message are kept
+	extra := types.AccessTuple{Address: evm.HexToAddress("0x2000"), StorageKeys: []evm.Hash{}}
+	msg.AccessList = types.AccessList{extra}
+	list, _, err = CreateAccessList(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, extra, list[1])
+
+	msg.GasLimit = 21000
+	_, _, err = CreateAccessList(state, msg, blockCtx)
+	assert.ErrorIs(t, err, ErrIntrinsicGas)
+}
+
+func TestCreateAccessListBalance(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	// BALANCE of 0x2000
+	contract := evm.HexToAddress("0x1000")
+	state.SetCode(contract, evm.HexToBytes("6120003100"))
+
+	msg := &types.Message{From: sender, To: &contract, GasLimit: 100000}
+	list, result, err := CreateAccessList(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, types.AccessList{{Address: evm.HexToAddress("0x2000"), StorageKeys: []evm.Hash{}}}, list)
+
+	// the warm account saves 2500 and costs 2400
+	without, err := Call(state.Copy(), msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21000+3+evm.ColdAccountAccessCost), without.UsedGas)
+	assert.Equal(t, without.UsedGas-100, result.UsedGas)
+}
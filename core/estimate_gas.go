@@ -0,0 +1,107 @@
+package core
+
+import (
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// ExecutionError is the error of a message that fails with all the
+// gas it may get
+type ExecutionError struct {
+	*ExecutionResult
+}
+
+// Error returns the error of the execution, with the reason of a
+// revert
+func (e *ExecutionError) Error() string {
+	message := e.Err.Error()
+	if reason, ok := evm.UnpackRevert(e.Revert()); ok {
+		message += ": " + reason
+	}
+	return message
+}
+
+func (e *ExecutionError) Unwrap() error { return e.Err }
+
+// EstimateGas returns the lowest gas limit the message succeeds
+// with. It binary searches between the intrinsic gas and the gas
+// limit of the message, or of the block without one, capped to the
+// gas the sender can pay for. Each run starts from a snapshot of the
+// state, the state is left unchanged. A message failing with the
+// highest limit returns an *ExecutionError.
+//
+// The gas used isn't the answer: the refund is taken off at the end
+// of the execution, and code reading GAS may need more gas than it
+// uses.
+func EstimateGas(state *evm.State, msg *types.Message, blockCtx *BlockContext) (uint64, error) {
+	hi := blockCtx.GasLimit
+	if msg.GasLimit != 0 && msg.GasLimit < hi {
+		hi = msg.GasLimit
+	}
+	price := msg.GasPrice
+	if msg.GasFeeCap != nil {
+		price = msg.GasFeeCap
+	}
+	if price != nil && !price.IsZero() {
+		balance := state.GetBalance(msg.From)
+		if msg.Value != nil {
+			if balance.Lt(msg.Value) {
+				return 0, ErrInsufficientFunds
+			}
+			balance.Sub(balance, msg.Value)
+		}
+		allowance := new(uint256.Int).Div(balance, price)
+		if allowance.IsUint64() && allowance.Uint64() < hi {
+			hi = allowance.Uint64()
+		}
+	}
+
+	result, err := callWithGas(state, msg, blockCtx, hi)
+	if err != nil {
+		return 0, err
+	}
+	if result.Failed() {
+		return 0, &ExecutionError{result}
+	}
+	// the limit is above the gas used before the refund, and the
+	// intrinsic gas
+	lo := result.UsedGas + result.RefundedGas - 1
+	if intrinsic := IntrinsicGas(msg.Data, msg.To == nil, msg.AccessList); intrinsic-1 > lo {
+		lo = intrinsic - 1
+	}
+	// unless the code reads GAS the gas used before the refund is the
+	// answer, try it first to skip the search
+	if optimistic := lo + 1; optimistic < hi {
+		if result, err = callWithGas(state, msg, blockCtx, optimistic); err != nil {
+			return 0, err
+		}
+		if result.Failed() {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		if result, err = callWithGas(state, msg, blockCtx, mid); err != nil {
+			return 0, err
+		}
+		if result.Failed() {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil
+}
+
+// callWithGas calls the message with the gas limit and reverts the
+// changes to the state
+func callWithGas(state *evm.State, msg *types.Message, blockCtx *BlockContext, gas uint64) (*ExecutionResult, error) {
+	snapshot := state.Snapshot()
+	defer state.RevertToSnapshot(snapshot)
+	call := *msg
+	call.GasLimit = gas
+	return Call(state, &call, blockCtx)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateGas(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	// clears slot 0, refunded at the end
+	clearing := evm.HexToAddress("0x1000")
+	state.SetCode(clearing, evm.HexToBytes("600060005500"))
+	state.SetStorage(clearing, uint256.NewInt(0), uint256.NewInt(1))
+	// reverts unless 30000 gas is left, like a call
+	// needing the gas it forwards
+	greedy := evm.HexToAddress("0x2000")
+	state.SetCode(greedy, evm.HexToBytes("6175305a04600c57600080fd5b00"))
+	root := state.Root()
+
+	for _, to := range []evm.Address{clearing, greedy} {
+		to := to
+		msg := &types.Message{From: sender, To: &to}
+		gas, err := EstimateGas(state, msg, blockCtx)
+		assert.NoError(t, err)
+
+		// the lowest limit that succeeds
+		result, err := callWithGas(state, msg, blockCtx, gas)
+		assert.NoError(t, err)
+		assert.False(t, result.Failed())
+		assert.Greater(t, gas, result.UsedGas)
+		result, err = callWithGas(state, msg, blockCtx, gas-1)
+		assert.NoError(t, err)
+		assert.True(t, result.Failed())
+	}
+	assert.Equal(t, root, state.Root())
+
+	// a transfer needs the intrinsic gas
+	to := evm.HexToAddress("0x3000")
+	gas, err := EstimateGas(state, &types.Message{From: sender, To: &to, Value: uint256.NewInt(1)}, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, TxGas, gas)
+
+	// the sender pays for at most 25000 gas
+	_, err = EstimateGas(state, &types.Message{From: sender, To: &greedy, GasPrice: uint256.NewInt(40)}, blockCtx)
+	assert.ErrorIs(t, err, evm.ErrExecutionReverted)
+	_, err = EstimateGas(state, &types.Message{From: sender, To: &to, GasFeeCap: uint256.NewInt(40), Value: uint256.NewInt(2000000)}, blockCtx)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+// runCounter is a tracer counting the executions
+type runCounter struct{ runs int }
+
+func (c *runCounter) CaptureStart(ctx *evm.ExecutionCtx) { c.runs++ }
+
+func (c *runCounter) CaptureState(ctx *evm.ExecutionCtx, pc uint64, op byte, gas, cost uint64) {}
+
+func (c *runCounter) CaptureEnter(typ string, from, to evm.Address, input []byte, gas uint64, value *uint256.Int) {
+}
+
+func (c *runCounter) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (c *runCounter) CaptureEnd(ctx *evm.ExecutionCtx, output []byte, err error) {}
+
+func TestEstimateGasOptimistic(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	clearing := evm.HexToAddress("0x1000")
+	state.SetCode(clearing, evm.HexToBytes("600060005500"))
+	state.SetStorage(clearing, uint256.NewInt(0), uint256.NewInt(1))
+	greedy := evm.HexToAddress("0x2000")
+	state.SetCode(greedy, evm.HexToBytes("6175305a04600c57600080fd5b00"))
+
+	// the gas used before the refund succeeds, the search is skipped
+	counter := &runCounter{}
+	blockCtx.Tracer = counter
+	_, err := EstimateGas(state, &types.Message{From: sender, To: &clearing}, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, counter.runs)
+
+	// it fails for code reading GAS, the search goes on
+	counter.runs = 0
+	_, err = EstimateGas(state, &types.Message{From: sender, To: &greedy}, blockCtx)
+	assert.NoError(t, err)
+	assert.Greater(t, counter.runs, 10)
+}
+
+func TestEstimateGasRevert(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	// reverts with Error("denied")
+	reverting := evm.HexToAddress("0x1000")
+	revert := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000006" +
+		"64656e6965640000000000000000000000000000000000000000000000000000"
+	state.SetCode(reverting, evm.HexToBytes("6064600c6000396064"+"6000fd"+revert))
+
+	_, err := EstimateGas(state, &types.Message{From: sender, To: &reverting}, blockCtx)
+	var execErr *ExecutionError
+	assert.ErrorAs(t, err, &execErr)
+	assert.EqualError(t, err, "execution reverted: denied")
+	assert.Equal(t, evm.HexToBytes(revert), execErr.Revert())
+
+	// the limit of the message caps the search
+	_, err = EstimateGas(state, &types.Message{From: sender, To: &reverting, GasLimit: 20000}, blockCtx)
+	assert.ErrorIs(t, err, ErrIntrinsicGas)
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+var (
+	// BeaconRootsAddress is the contract storing the parent beacon
+	// block roots (EIP-4788)
+	BeaconRootsAddress = evm.HexToAddress("0x000f3df6d732807ef1319fb7b8bb8522d0beac02")
+
+	// historyBufferLength is the number of roots kept by the contract
+	historyBufferLength = uint64(8191)
+)
+
+// Processor executes the blocks of a chain
+type Processor struct {
+	// Signer recovers the senders of the transactions
+	Signer types.Signer
+	// BlockReward is paid to the coinbase with a share per uncle, it
+	// is zero since the merge
+	BlockReward uint64
+	// Tracer, if set, traces the execution of the transactions
+	Tracer evm.Tracer
+	// Senders are the senders of transactions by hash, their
+	// signatures aren't checked. A dev chain sets them for the
+	// transactions of impersonated accounts.
+	Senders map[evm.Hash]evm.Address
+}
+
+// NewProcessor returns a processor of post-merge blocks of the chain
+func NewProcessor(chainID uint64) *Processor {
+	return &Processor{Signer: types.NewSigner(chainID)}
+}
+
+// ProcessResult is the outcome of a block
+type ProcessResult struct {
+	// State is the post-state of the block
+	State     *evm.State
+	Receipts  types.Receipts
+	Logs      []*evm.Log
+	StateRoot evm.Hash
+	GasUsed   uint64
+}
+
+// Process executes the block on a copy of the state of its parent:
+// the beacon root system call, the transactions in order within the
+// gas limit of the block, the rewards and the withdrawals. An
+// invalid transaction makes the block invalid. The result isn't
+// checked against the header, see ValidateState.
+func (p *Processor) Process(block *types.Block, parentState *evm.State) (*ProcessResult, error) {
+	header := block.Header
+	state := parentState.Copy()
+	if header.ParentBeaconRoot != nil {
+		ProcessBeaconBlockRoot(state, *header.ParentBeaconRoot, header.Time)
+	}
+
+	result := &ProcessResult{State: state}
+	blockCtx := &BlockContext{Coinbase: header.Coinbase, BaseFee: header.BaseFee, Tracer: p.Tracer}
+	for i, tx := range block.Transactions {
+		msg, err := p.message(tx)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%s]: %w", i, tx.Hash(), err)
+		}
+		// the gas left in the block
+		blockCtx.GasLimit = header.GasLimit - result.GasUsed
+		receipt, err := ApplyMessage(state, msg, blockCtx)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%s]: %w", i, tx.Hash(), err)
+		}
+		result.GasUsed += receipt.GasUsed
+		receipt.Type, receipt.CumulativeGasUsed = tx.Type, result.GasUsed
+		result.Receipts = append(result.Receipts, receipt)
+		result.Logs = append(result.Logs, receipt.Logs...)
+	}
+
+	p.payRewards(state, block)
+	ProcessWithdrawals(state, block.Withdrawals)
+	result.StateRoot = state.Root()
+	return result, nil
+}
+
+// message returns the transaction as a message of its sender
+func (p *Processor) message(tx *types.Transaction) (*types.Message, error) {
+	if from, ok := p.Senders[tx.Hash()]; ok {
+		return tx.ToMessage(from), nil
+	}
+	return tx.AsMessage(p.Signer)
+}
+
+// payRewards pays the block reward to the coinbase, plus 1/32 of it
+// per uncle, and a share depending on their age to the uncle miners
+func (p *Processor) payRewards(state *evm.State, block *types.Block) {
+	if p.BlockReward == 0 {
+		return
+	}
+	reward := uint256.NewInt(p.BlockReward)
+	for _, uncle := range block.Uncles {
+		uncleReward := uint256.NewInt((uncle.Number + 8 - block.Header.Number) * (p.BlockReward / 8))
+		state.AddBalance(uncle.Coinbase, uncleReward)
+		reward.Add(reward, uint256.NewInt(p.BlockReward/32))
+	}
+	state.AddBalance(block.Header.Coinbase, reward)
+}
+
+// ProcessWithdrawals credits the withdrawn amounts, in gwei (EIP-4895)
+func ProcessWithdrawals(state *evm.State, withdrawals types.Withdrawals) {
+	for _, w := range withdrawals {
+		amount := new(uint256.Int).Mul(uint256.NewInt(w.Amount), uint256.NewInt(1e9))
+		state.AddBalance(w.Address, amount)
+		if account := state.GetAccount(w.Address); account.Empty() {
+			state.DeleteAccount(w.Address)
+		}
+	}
+}
+
+// ProcessBeaconBlockRoot stores the parent beacon block root in the
+// ring buffer of the beacon roots contract, as the system call to it
+// at the start of the block does (EIP-4788). The interpreter lacks
+// the opcodes of the contract so its storage is written directly.
+// Without the contract the call does nothing.
+func ProcessBeaconBlockRoot(state *evm.State, root evm.Hash, time uint64) {
+	if len(state.GetCode(BeaconRootsAddress)) == 0 {
+		return
+	}
+	index := time % historyBufferLength
+	state.SetStorage(BeaconRootsAddress, uint256.NewInt(index), uint256.NewInt(time))
+	state.SetStorage(BeaconRootsAddress, uint256.NewInt(index+historyBufferLength), new(uint256.Int).SetBytes(root[:]))
+}
+
+// ValidateState checks the result of the block against its header:
+// the gas used, the logs bloom, the receipts root and the state root
+func ValidateState(header *types.Header, result *ProcessResult) error {
+	if result.GasUsed != header.GasUsed {
+		return fmt.Errorf("invalid gas used (remote: %d local: %d)", header.GasUsed, result.GasUsed)
+	}
+	if bloom := types.CreateBloom(result.Receipts); bloom != header.Bloom {
+		return fmt.Errorf("invalid bloom (remote: %x local: %x)", header.Bloom, bloom)
+	}
+	receiptsRoot, err := types.DeriveSha(result.Receipts)
+	if err != nil {
+		return err
+	}
+	if receiptsRoot != header.ReceiptHash {
+		return fmt.Errorf("invalid receipt root hash (remote: %s local: %s)", header.ReceiptHash, receiptsRoot)
+	}
+	if result.StateRoot != header.Root {
+		return fmt.Errorf("invalid merkle root (remote: %s local: %s)", header.Root, result.StateRoot)
+	}
+	return nil
+}
+
+// ValidateBody checks that the uncles, transactions and withdrawals
+// of the block match the hashes of its header
+func ValidateBody(block *types.Block) error {
+	header := block.Header
+	if hash := types.CalcUncleHash(block.Uncles); hash != header.UncleHash {
+		return fmt.Errorf("uncle root hash mismatch (header value %s, calculated %s)", header.UncleHash, hash)
+	}
+	txRoot, err := types.DeriveSha(block.Transactions)
+	if err != nil {
+		return err
+	}
+	if txRoot != header.TxHash {
+		return fmt.Errorf("transaction root hash mismatch (header value %s, calculated %s)", header.TxHash, txRoot)
+	}
+	switch {
+	case header.WithdrawalsHash == nil && block.Withdrawals != nil:
+		return fmt.Errorf("withdrawals present in block body")
+	case header.WithdrawalsHash != nil && block.Withdrawals == nil:
+		return fmt.Errorf("missing withdrawals in block body")
+	case header.WithdrawalsHash != nil:
+		root, err := types.DeriveSha(block.Withdrawals)
+		if err != nil {
+			return err
+		}
+		if root != *header.WithdrawalsHash {
+			return fmt.Errorf("withdrawals root hash mismatch (header value %s, calculated %s)", *header.WithdrawalsHash, root)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// the key of sender
+var senderKey = evm.HexToBytes("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+
+func newTestBlock(t *testing.T, gasLimit uint64, txs ...*types.Transaction) *types.Block {
+	signer := types.NewSigner(1)
+	for _, tx := range txs {
+		assert.NoError(t, signer.SignTx(tx, senderKey))
+	}
+	header := &types.Header{
+		Coinbase:   coinbase,
+		Difficulty: uint256.NewInt(0),
+		Number:     1,
+		GasLimit:   gasLimit,
+		Time:       12,
+		BaseFee:    uint256.NewInt(0),
+	}
+	return &types.Block{Header: header, Transactions: txs}
+}
+
+func transferTx(nonce uint64, to evm.Address) *types.Transaction {
+	return &types.Transaction{Type: types.LegacyTxType, Nonce: nonce, GasPrice: uint256.NewInt(1), Gas: 21000, To: &to, Value: uint256.NewInt(1)}
+}
+
+func TestProcess(t *testing.T) {
+	state, _ := newTransitionState(t)
+	contract := evm.HexToAddress("0x1000")
+	// LOG0 of no data
+	state.SetCode(contract, evm.HexToBytes("60006000a000"))
+	to := evm.HexToAddress("0x2000")
+	logTx := &types.Transaction{Type: types.LegacyTxType, Nonce: 1, GasPrice: uint256.NewInt(1), Gas: 30000, To: &contract, Value: uint256.NewInt(0)}
+	block := newTestBlock(t, 100000, transferTx(0, to), logTx)
+
+	result, err := NewProcessor(1).Process(block, state)
+	assert.NoError(t, err)
+	// the parent state is left untouched
+	assert.Equal(t, uint64(0), state.GetNonce(sender))
+	assert.Equal(t, uint64(2), result.State.GetNonce(sender))
+	assert.Equal(t, uint256.NewInt(1), result.State.GetBalance(to))
+
+	logGas := uint64(21000 + 3 + 3 + 375)
+	assert.Len(t, result.Receipts, 2)
+	assert.Equal(t, uint64(21000), result.Receipts[0].CumulativeGasUsed)
+	assert.Equal(t, 21000+logGas, result.Receipts[1].CumulativeGasUsed)
+	assert.Equal(t, 21000+logGas, result.GasUsed)
+	assert.Len(t, result.Logs, 1)
+	assert.Equal(t, result.State.Root(), result.StateRoot)
+
+	// the transactions use the gas left in the block
+	block = newTestBlock(t, 30000, transferTx(0, to), transferTx(1, to))
+	_, err = NewProcessor(1).Process(block, state)
+	assert.ErrorIs(t, err, ErrGasLimitReached)
+	assert.ErrorContains(t, err, "could not apply tx 1")
+
+	// a signature of another chain
+	block = newTestBlock(t, 30000, transferTx(0, to))
+	processor := NewProcessor(5)
+	_, err = processor.Process(block, state)
+	assert.Error(t, err)
+
+	// unless the sender is known
+	processor.Senders = map[evm.Hash]evm.Address{block.Transactions[0].Hash(): sender}
+	_, err = processor.Process(block, state)
+	assert.NoError(t, err)
+}
+
+func TestProcessRewardsAndWithdrawals(t *testing.T) {
+	state, _ := newTransitionState(t)
+	block := newTestBlock(t, 30000)
+	uncle := &types.Header{Coinbase: evm.HexToAddress("0xaa"), Difficulty: uint256.NewInt(0), Number: 0}
+	block.Uncles = []*types.Header{uncle}
+	block.Withdrawals = types.Withdrawals{
+		{Index: 0, Validator: 1, Address: evm.HexToAddress("0xc0ffee"), Amount: 2},
+		{Index: 1, Validator: 2, Address: evm.HexToAddress("0xbeef"), Amount: 0},
+	}
+
+	result, err := (&Processor{Signer: types.NewSigner(1), BlockReward: 64}).Process(block, state)
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(64+2), result.State.GetBalance(coinbase))
+	// an uncle of the parent gets 7/8 of the reward
+	assert.Equal(t, uint256.NewInt(56), result.State.GetBalance(uncle.Coinbase))
+	assert.Equal(t, uint256.NewInt(2e9), result.State.GetBalance(evm.HexToAddress("0xc0ffee")))
+	// a withdrawal of nothing doesn't create the account
+	assert.Nil(t, result.State.GetAccount(evm.HexToAddress("0xbeef")))
+}
+
+func TestProcessBeaconBlockRoot(t *testing.T) {
+	state, _ := newTransitionState(t)
+	root := evm.HexToHash("0x0102")
+
+	// without the contract nothing is stored
+	ProcessBeaconBlockRoot(state, root, 12)
+	assert.Nil(t, state.GetAccount(BeaconRootsAddress))
+
+	state.SetCode(BeaconRootsAddress, []byte{0x00})
+	block := newTestBlock(t, 30000)
+	block.Header.Time = 8191 + 12
+	block.Header.ParentBeaconRoot = &root
+	result, err := NewProcessor(1).Process(block, state)
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(8191+12), result.State.GetStorage(BeaconRootsAddress, *uint256.NewInt(12)))
+	assert.Equal(t, uint256.NewInt(0x0102), result.State.GetStorage(BeaconRootsAddress, *uint256.NewInt(8191 + 12)))
+}
+
+func TestValidateBlock(t *testing.T) {
+	state, _ := newTransitionState(t)
+	block := newTestBlock(t, 30000, transferTx(0, evm.HexToAddress("0x2000")))
+	result, err := NewProcessor(1).Process(block, state)
+	assert.NoError(t, err)
+
+	header := block.Header
+	header.UncleHash = types.EmptyUncleHash
+	header.TxHash, _ = types.DeriveSha(block.Transactions)
+	header.ReceiptHash, _ = types.DeriveSha(result.Receipts)
+	header.GasUsed, header.Root = result.GasUsed, result.StateRoot
+	assert.NoError(t, ValidateBody(block))
+	assert.NoError(t, ValidateState(header, result))
+
+	header.Root = evm.Hash{}
+	assert.ErrorContains(t, ValidateState(header, result), "invalid merkle root")
+	header.ReceiptHash = evm.Hash(trie.EmptyRoot)
+	assert.ErrorContains(t, ValidateState(header, result), "invalid receipt root hash")
+	header.GasUsed = 0
+	assert.EqualError(t, ValidateState(header, result), "invalid gas used (remote: 0 local: 21000)")
+
+	// the body has withdrawals from Shanghai on, even without any
+	block.Withdrawals = types.Withdrawals{}
+	assert.EqualError(t, ValidateBody(block), "withdrawals present in block body")
+	emptyRoot := evm.Hash(trie.EmptyRoot)
+	header.WithdrawalsHash = &emptyRoot
+	assert.NoError(t, ValidateBody(block))
+	block.Withdrawals = nil
+	assert.EqualError(t, ValidateBody(block), "missing withdrawals in block body")
+
+	block.Withdrawals = types.Withdrawals{{Address: evm.HexToAddress("0xc0ffee"), Amount: 1}}
+	assert.ErrorContains(t, ValidateBody(block), "withdrawals root hash mismatch")
+	header.TxHash = evm.Hash(trie.EmptyRoot)
+	assert.ErrorContains(t, ValidateBody(block), "transaction root hash mismatch")
+	header.UncleHash = evm.Hash{}
+	assert.ErrorContains(t, ValidateBody(block), "uncle root hash mismatch")
+}
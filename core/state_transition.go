@@ -0,0 +1,366 @@
+// Package core applies transactions and blocks to the state
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+const (
+	TxGas                     uint64 = 21000
+	TxGasContractCreation     uint64 = 53000
+	TxDataZeroGas             uint64 = 4
+	TxDataNonZeroGas          uint64 = 16
+	TxAccessListAddressGas    uint64 = 2400
+	TxAccessListStorageKeyGas uint64 = 1900
+	InitCodeWordGas           uint64 = 2
+	CreateDataGas             uint64 = 200
+
+	// RefundQuotient caps the refund to a fifth of the gas used (EIP-3529)
+	RefundQuotient = 5
+
+	MaxCodeSize     = 24576
+	MaxInitCodeSize = 2 * MaxCodeSize
+)
+
+var (
+	ErrNonceTooLow          = errors.New("nonce too low")
+	ErrNonceTooHigh         = errors.New("nonce too high")
+	ErrGasLimitReached      = errors.New("gas limit reached")
+	ErrInsufficientFunds    = errors.New("insufficient funds for gas * price + value")
+	ErrIntrinsicGas         = errors.New("intrinsic gas too low")
+	ErrFeeCapTooLow         = errors.New("max fee per gas less than block base fee")
+	ErrTipAboveFeeCap       = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrTxTypeNotSupported   = errors.New("transaction type not supported")
+	ErrSenderNoEOA          = errors.New("sender not an eoa")
+	ErrMaxInitCodeSize      = errors.New("max initcode size exceeded")
+	ErrContractCollision    = errors.New("contract address collision")
+	ErrMaxCodeSizeExceeded  = errors.New("max code size exceeded")
+	ErrInvalidCodeEOFPrefix = errors.New("invalid code: must not begin with 0xef")
+)
+
+// BlockContext is the block the messages are executed in
+type BlockContext struct {
+	Coinbase evm.Address
+	// GasLimit is the gas left in the block for the message
+	GasLimit uint64
+	BaseFee  *uint256.Int
+	// Tracer, if set, traces the execution of the code
+	Tracer evm.Tracer
+}
+
+// ApplyMessage validates the message and executes it on the state:
+// the sender buys the gas at the effective gas price, the call or
+// creation runs, then the gas left and the capped refund go back to
+// the sender. The coinbase receives the priority fee, the base fee
+// is burnt. An error means the message is invalid and the state is
+// left untouched, a failed execution is a receipt with a failed
+// status. The caller sets the type and the cumulative gas used of
+// the receipt. Blob messages (EIP-4844) are invalid, there is no
+// blob gas to buy.
+func ApplyMessage(state *evm.State, msg *types.Message, blockCtx *BlockContext) (*types.Receipt, error) {
+	if msg.BlobFeeCap != nil || msg.BlobHashes != nil {
+		return nil, fmt.Errorf("%w: blob transaction", ErrTxTypeNotSupported)
+	}
+	baseFee := blockCtx.BaseFee
+	if baseFee == nil {
+		baseFee = new(uint256.Int)
+	}
+	price, err := EffectiveGasPrice(msg, baseFee)
+	if err != nil {
+		return nil, err
+	}
+	switch nonce := state.GetNonce(msg.From); {
+	case msg.Nonce < nonce:
+		return nil, ErrNonceTooLow
+	case msg.Nonce > nonce:
+		return nil, ErrNonceTooHigh
+	}
+	if len(state.GetCode(msg.From)) > 0 {
+		return nil, ErrSenderNoEOA
+	}
+	if msg.GasLimit > blockCtx.GasLimit {
+		return nil, ErrGasLimitReached
+	}
+	// the sender must afford the highest price it may pay
+	maxPrice := price
+	if msg.GasFeeCap != nil {
+		maxPrice = msg.GasFeeCap
+	}
+	value := msg.Value
+	if value == nil {
+		value = new(uint256.Int)
+	}
+	cost, overflow := new(uint256.Int).MulOverflow(maxPrice, uint256.NewInt(msg.GasLimit))
+	if _, o := cost.AddOverflow(cost, value); o || overflow || state.GetBalance(msg.From).Lt(cost) {
+		return nil, ErrInsufficientFunds
+	}
+	create := msg.To == nil
+	if create && len(msg.Data) > MaxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %d limit %d", ErrMaxInitCodeSize, len(msg.Data), MaxInitCodeSize)
+	}
+	intrinsic := IntrinsicGas(msg.Data, create, msg.AccessList)
+	if intrinsic > msg.GasLimit {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, msg.GasLimit, intrinsic)
+	}
+
+	txTracer := captureTxStart(state, msg, blockCtx)
+
+	// buy the gas
+	state.SubBalance(msg.From, new(uint256.Int).Mul(price, uint256.NewInt(msg.GasLimit)))
+	state.SetNonce(msg.From, msg.Nonce+1)
+
+	gasLeft, refund, _, logs, err := execute(state, msg, value, msg.GasLimit-intrinsic, blockCtx)
+	gasUsed, gasLeft := applyRefund(msg.GasLimit, gasLeft, refund)
+
+	// return the gas left and pay the tip to the coinbase, the
+	// base fee is burnt
+	state.AddBalance(msg.From, new(uint256.Int).Mul(price, uint256.NewInt(gasLeft)))
+	tip := new(uint256.Int).Sub(price, baseFee)
+	state.AddBalance(blockCtx.Coinbase, tip.Mul(tip, uint256.NewInt(gasUsed)))
+	if account := state.GetAccount(blockCtx.Coinbase); account.Empty() {
+		state.DeleteAccount(blockCtx.Coinbase)
+	}
+	if txTracer != nil {
+		txTracer.CaptureTxEnd()
+	}
+
+	receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: gasUsed, Logs: logs, Bloom: types.LogsBloom(logs)}
+	if err != nil {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	if create {
+		receipt.ContractAddress = CreateAddress(msg.From, msg.Nonce)
+	}
+	return receipt, nil
+}
+
+// ExecutionResult is the outcome of a call
+type ExecutionResult struct {
+	UsedGas uint64
+	// RefundedGas is the refund taken off the gas used
+	RefundedGas uint64
+	// Err is the error of a failed execution, ErrExecutionReverted
+	// if it reverted
+	Err error
+	// ReturnData is the output, or the revert data
+	ReturnData []byte
+	Logs       []*evm.Log
+}
+
+// Failed reports whether the execution failed
+func (r *ExecutionResult) Failed() bool { return r.Err != nil }
+
+// Revert returns the revert data, nil unless the execution reverted
+func (r *ExecutionResult) Revert() []byte {
+	if !errors.Is(r.Err, evm.ErrExecutionReverted) {
+		return nil
+	}
+	return r.ReturnData
+}
+
+// Call executes the message on the state as a transaction that
+// skips the nonce and fee checks and buys no gas, like eth_call. Run
+// it on a copy of the state, the changes are kept. An error means
+// the message can't be executed, a failed execution is in the
+// result.
+func Call(state *evm.State, msg *types.Message, blockCtx *BlockContext) (*ExecutionResult, error) {
+	if msg.GasLimit > blockCtx.GasLimit {
+		return nil, ErrGasLimitReached
+	}
+	value := msg.Value
+	if value == nil {
+		value = new(uint256.Int)
+	}
+	if state.GetBalance(msg.From).Lt(value) {
+		return nil, ErrInsufficientFunds
+	}
+	create := msg.To == nil
+	if create && len(msg.Data) > MaxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %d limit %d", ErrMaxInitCodeSize, len(msg.Data), MaxInitCodeSize)
+	}
+	intrinsic := IntrinsicGas(msg.Data, create, msg.AccessList)
+	if intrinsic > msg.GasLimit {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, msg.GasLimit, intrinsic)
+	}
+	txTracer := captureTxStart(state, msg, blockCtx)
+	state.SetNonce(msg.From, msg.Nonce+1)
+
+	gasLeft, refund, output, logs, err := execute(state, msg, value, msg.GasLimit-intrinsic, blockCtx)
+	gasUsed, refunded := applyRefund(msg.GasLimit, gasLeft, refund)
+	if txTracer != nil {
+		txTracer.CaptureTxEnd()
+	}
+	return &ExecutionResult{UsedGas: gasUsed, RefundedGas: refunded - gasLeft, Err: err, ReturnData: output, Logs: logs}, nil
+}
+
+// captureTxStart tells the tracer of the block context about the
+// message, if it traces transactions, and returns it
+func captureTxStart(state *evm.State, msg *types.Message, blockCtx *BlockContext) evm.TxTracer {
+	tracer, ok := blockCtx.Tracer.(evm.TxTracer)
+	if !ok {
+		return nil
+	}
+	to := CreateAddress(msg.From, msg.Nonce)
+	if msg.To != nil {
+		to = *msg.To
+	}
+	tracer.CaptureTxStart(state, msg.From, to, blockCtx.Coinbase)
+	return tracer
+}
+
+// applyRefund caps the refund to a part of the gas used. It returns
+// the gas used and left after the refund.
+func applyRefund(gasLimit, gasLeft, refund uint64) (uint64, uint64) {
+	gasUsed := gasLimit - gasLeft
+	if maxRefund := gasUsed / RefundQuotient; refund > maxRefund {
+		refund = maxRefund
+	}
+	return gasUsed - refund, gasLeft + refund
+}
+
+// IntrinsicGas returns the gas charged before the execution: the
+// base cost, the data, the access list and, for a creation, the
+// words of the initcode (EIP-3860)
+func IntrinsicGas(data []byte, create bool, accessList types.AccessList) uint64 {
+	gas := TxGas
+	if create {
+		gas = TxGasContractCreation
+	}
+	nonZero := uint64(0)
+	for _, b := range data {
+		if b != 0 {
+			nonZero++
+		}
+	}
+	zero := uint64(len(data)) - nonZero
+	gas += nonZero*TxDataNonZeroGas + zero*TxDataZeroGas
+	if create {
+		gas += (uint64(len(data)) + 31) / 32 * InitCodeWordGas
+	}
+	gas += uint64(len(accessList)) * TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * TxAccessListStorageKeyGas
+	return gas
+}
+
+// EffectiveGasPrice returns the price per gas paid by the sender
+func EffectiveGasPrice(msg *types.Message, baseFee *uint256.Int) (*uint256.Int, error) {
+	if msg.GasPrice != nil {
+		if msg.GasPrice.Lt(baseFee) {
+			return nil, ErrFeeCapTooLow
+		}
+		return msg.GasPrice, nil
+	}
+	if msg.GasFeeCap == nil || msg.GasTipCap == nil {
+		return nil, errors.New("message has no gas price")
+	}
+	if msg.GasTipCap.Gt(msg.GasFeeCap) {
+		return nil, fmt.Errorf("%w: tip %s, fee cap %s", ErrTipAboveFeeCap, msg.GasTipCap.Hex(), msg.GasFeeCap.Hex())
+	}
+	if msg.GasFeeCap.Lt(baseFee) {
+		return nil, ErrFeeCapTooLow
+	}
+	tip := new(uint256.Int).Sub(msg.GasFeeCap, baseFee)
+	if msg.GasTipCap.Lt(tip) {
+		tip = msg.GasTipCap
+	}
+	return new(uint256.Int).Add(baseFee, tip), nil
+}
+
+// CreateAddress returns the address of the contract created by
+// sender with the given nonce
+func CreateAddress(sender evm.Address, nonce uint64) evm.Address {
+	// a list of byte arrays and integers always encodes
+	b, _ := rlp.EncodeToBytes([]interface{}{sender, nonce})
+	return evm.BytesToAddress(crypto.Keccak256(b)[12:])
+}
+
+// execute transfers the value and runs the code of the call or
+// creation with the access set of the message. It returns the gas
+// left, the refund, the output and the logs. All the changes are
+// reverted on error, the output of a revert is kept.
+func execute(state *evm.State, msg *types.Message, value *uint256.Int, gas uint64, blockCtx *BlockContext) (uint64, uint64, []byte, []*evm.Log, error) {
+	snapshot := state.Snapshot()
+
+	var to evm.Address
+	var code, input []byte
+	if msg.To == nil {
+		to = CreateAddress(msg.From, msg.Nonce)
+		if account := state.GetAccount(to); account != nil && (account.Nonce != 0 || len(account.Code) > 0) {
+			state.RevertToSnapshot(snapshot)
+			return 0, 0, nil, nil, ErrContractCollision
+		}
+		state.SetNonce(to, 1)
+		code = msg.Data
+	} else {
+		to = *msg.To
+		code, input = state.GetCode(to), msg.Data
+	}
+	state.SubBalance(msg.From, value)
+	state.AddBalance(to, value)
+
+	ctx := evm.NewExecutionCtx(code, evm.CalldataFromBytes(input), evm.NewStack(), evm.NewMemory(), state.GetAccount(to).Storage, gas)
+	ctx.Caller, ctx.Address, ctx.Value = msg.From, to, value
+	ctx.State, ctx.Accessed = state, newAccessSet(msg, to, blockCtx.Coinbase)
+	tracer := blockCtx.Tracer
+	ctx.Tracer = tracer
+	if len(code) == 0 {
+		// the tracers see the calls without code too
+		if tracer != nil {
+			tracer.CaptureStart(ctx)
+			tracer.CaptureEnd(ctx, nil, nil)
+		}
+		if account := state.GetAccount(to); account.Empty() {
+			state.DeleteAccount(to)
+		}
+		state.DiscardSnapshot(snapshot)
+		return gas, 0, nil, nil, nil
+	}
+
+	output, err := run(ctx)
+
+	if err == nil && msg.To == nil {
+		switch {
+		case len(output) > MaxCodeSize:
+			err = ErrMaxCodeSizeExceeded
+		case len(output) > 0 && output[0] == 0xEF:
+			err = ErrInvalidCodeEOFPrefix
+		case !ctx.UseGas(CreateDataGas * uint64(len(output))):
+			err = evm.ErrOutOfGas
+		default:
+			state.SetCode(to, output)
+		}
+	}
+	switch {
+	case errors.Is(err, evm.ErrExecutionReverted):
+		state.RevertToSnapshot(snapshot)
+		return ctx.Gas, 0, output, nil, err
+	case err != nil:
+		// exceptional halts consume all the gas
+		state.RevertToSnapshot(snapshot)
+		return 0, 0, nil, nil, err
+	}
+	state.DiscardSnapshot(snapshot)
+	if msg.To == nil {
+		// the output of a creation is the code
+		output = nil
+	}
+	return ctx.Gas, ctx.Refund, output, ctx.Logs, nil
+}
+
+// run executes the context. The interpreter panics on invalid
+// code, the panic is returned as an error.
+func run(ctx *evm.ExecutionCtx) (output []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return evm.Run(ctx)
+}
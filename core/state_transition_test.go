@@ -0,0 +1,253 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	sender   = evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	coinbase = evm.HexToAddress("0xc0")
+)
+
+func newTransitionState(t *testing.T) (*evm.State, *BlockContext) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	state := evm.NewState()
+	state.AddBalance(sender, uint256.NewInt(1000000))
+	return state, &BlockContext{Coinbase: coinbase, GasLimit: 1000000, BaseFee: uint256.NewInt(0)}
+}
+
+func TestApplyCreate(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	// initcode returning the single byte 0x01 as code
+	initcode := evm.HexToBytes("600160005360016000f3")
+	msg := &types.Message{From: sender, GasLimit: 100000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(5), Data: initcode}
+	receipt, err := ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+
+	contract := CreateAddress(sender, 0)
+	assert.Equal(t, contract, receipt.ContractAddress)
+	assert.Equal(t, []byte{0x01}, state.GetCode(contract))
+	assert.Equal(t, uint64(1), state.GetNonce(contract))
+	assert.Equal(t, uint256.NewInt(5), state.GetBalance(contract))
+	// 53000, 10 bytes and a word of initcode, 5 instructions and 200
+	// per byte of code
+	gasUsed := uint64(53000 + 2*4 + 8*16 + 2 + 5*3 + 200)
+	assert.Equal(t, gasUsed, receipt.GasUsed)
+	assert.Equal(t, uint256.NewInt(1000000-5-gasUsed), state.GetBalance(sender))
+	assert.Equal(t, uint256.NewInt(gasUsed), state.GetBalance(coinbase))
+
+	// the snapshot of the message is discarded, the next one is the first
+	msg.Nonce, msg.To = 1, &contract
+	_, err = ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, state.Snapshot())
+}
+
+func TestApplyFailures(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	contract := evm.HexToAddress("0x1000")
+	// SSTORE 1 at slot 0 then REVERT
+	state.SetCode(contract, evm.HexToBytes("600160005560006000fd"))
+	// SSTORE 1 at slot 0 then an invalid opcode
+	invalid := evm.HexToAddress("0x2000")
+	state.SetCode(invalid, evm.HexToBytes("60016000550c"))
+
+	msg := &types.Message{From: sender, To: &contract, GasLimit: 50000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}
+	receipt, err := ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, types.ReceiptStatusFailed, receipt.Status)
+	// the SSTORE setting a cold slot
+	assert.Equal(t, uint64(21000+3+3+evm.SstoreSetGas+evm.ColdSloadCost+3+3), receipt.GasUsed)
+	assert.Equal(t, uint256.NewInt(0), state.GetStorage(contract, *uint256.NewInt(0)))
+
+	// exceptional halts consume all the gas
+	msg = &types.Message{From: sender, To: &invalid, Nonce: 1, GasLimit: 50000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}
+	receipt, err = ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, types.ReceiptStatusFailed, receipt.Status)
+	assert.Equal(t, uint64(50000), receipt.GasUsed)
+	assert.Equal(t, uint256.NewInt(0), state.GetStorage(invalid, *uint256.NewInt(0)))
+	assert.Equal(t, uint64(2), state.GetNonce(sender))
+
+	for _, tc := range []struct {
+		msg *types.Message
+		err error
+	}{
+		{&types.Message{From: sender, Nonce: 1, GasLimit: 30000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}, ErrNonceTooLow},
+		{&types.Message{From: sender, Nonce: 3, GasLimit: 30000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}, ErrNonceTooHigh},
+		{&types.Message{From: sender, Nonce: 2, GasLimit: 30000, GasPrice: uint256.NewInt(100), Value: uint256.NewInt(0)}, ErrInsufficientFunds},
+		{&types.Message{From: sender, Nonce: 2, GasLimit: 2000000, GasPrice: uint256.NewInt(0), Value: uint256.NewInt(0)}, ErrGasLimitReached},
+		{&types.Message{From: contract, GasLimit: 30000, GasPrice: uint256.NewInt(0), Value: uint256.NewInt(0)}, ErrSenderNoEOA},
+		{&types.Message{From: sender, Nonce: 2, To: &contract, GasLimit: 21000, GasPrice: uint256.NewInt(0), Value: uint256.NewInt(0), Data: []byte{1}}, ErrIntrinsicGas},
+		{&types.Message{From: sender, Nonce: 2, GasLimit: 900000, GasPrice: uint256.NewInt(0), Value: uint256.NewInt(0), Data: make([]byte, MaxInitCodeSize+1)}, ErrMaxInitCodeSize},
+		{&types.Message{From: sender, Nonce: 2, To: &contract, GasLimit: 30000, GasFeeCap: uint256.NewInt(0), GasTipCap: uint256.NewInt(1), Value: uint256.NewInt(0)}, ErrTipAboveFeeCap},
+		{&types.Message{From: sender, Nonce: 2, To: &contract, GasLimit: 30000, GasFeeCap: uint256.NewInt(0), GasTipCap: uint256.NewInt(0), Value: uint256.NewInt(0), BlobFeeCap: uint256.NewInt(1), BlobHashes: []evm.Hash{{1}}}, ErrTxTypeNotSupported},
+		{&types.Message{From: sender, Nonce: 2, To: &contract, GasLimit: 30000, GasFeeCap: uint256.NewInt(0), GasTipCap: uint256.NewInt(0), Value: uint256.NewInt(0)}, nil},
+	} {
+		_, err := ApplyMessage(state, tc.msg, blockCtx)
+		if tc.err == nil {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.ErrorIs(t, err, tc.err)
+	}
+
+	blockCtx.BaseFee = uint256.NewInt(1)
+	_, err = ApplyMessage(state, &types.Message{From: sender, Nonce: 3, GasLimit: 30000, GasPrice: uint256.NewInt(0), Value: uint256.NewInt(0)}, blockCtx)
+	assert.ErrorIs(t, err, ErrFeeCapTooLow)
+}
+
+func TestApplyRefund(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	contract := evm.HexToAddress("0x1000")
+	// clear slots 0 and 1
+	state.SetCode(contract, evm.HexToBytes("6000600055600060015500"))
+	state.SetStorage(contract, uint256.NewInt(0), uint256.NewInt(1))
+	state.SetStorage(contract, uint256.NewInt(1), uint256.NewInt(1))
+
+	msg := &types.Message{From: sender, To: &contract, GasLimit: 40000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}
+	receipt, err := ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	// the refund of 2*4800 is capped to a fifth of the gas used
+	gasUsed := uint64(21000 + 4*3 + 2*(evm.SstoreResetGas+evm.ColdSloadCost))
+	assert.Equal(t, gasUsed-gasUsed/RefundQuotient, receipt.GasUsed)
+	assert.Equal(t, uint256.NewInt(1000000-receipt.GasUsed), state.GetBalance(sender))
+	assert.Equal(t, uint256.NewInt(0), state.GetStorage(contract, *uint256.NewInt(0)))
+	assert.Equal(t, uint256.NewInt(0), state.GetStorage(contract, *uint256.NewInt(1)))
+}
+
+func TestApplyBurnsBaseFee(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	blockCtx.BaseFee = uint256.NewInt(2)
+	to := evm.HexToAddress("0x1000")
+	msg := &types.Message{From: sender, To: &to, GasLimit: 21000, GasFeeCap: uint256.NewInt(10), GasTipCap: uint256.NewInt(3), Value: uint256.NewInt(7)}
+	receipt, err := ApplyMessage(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21000), receipt.GasUsed)
+	// the sender pays the base fee and the tip, only the tip goes
+	// to the coinbase
+	assert.Equal(t, uint256.NewInt(1000000-7-5*21000), state.GetBalance(sender))
+	assert.Equal(t, uint256.NewInt(3*21000), state.GetBalance(coinbase))
+	assert.Equal(t, uint256.NewInt(7), state.GetBalance(to))
+}
+
+func TestCall(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	contract := evm.HexToAddress("0x1000")
+	// return the word 42
+	state.SetCode(contract, evm.HexToBytes("602a60005260206000f3"))
+	// revert with the word 42
+	reverting := evm.HexToAddress("0x2000")
+	state.SetCode(reverting, evm.HexToBytes("602a60005260206000fd"))
+
+	// the nonce and the fees aren't checked and no gas is bought
+	msg := &types.Message{From: sender, To: &contract, Nonce: 5, GasLimit: 30000, GasPrice: uint256.NewInt(1000)}
+	result, err := Call(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.False(t, result.Failed())
+	assert.Equal(t, uint256.NewInt(42).Bytes32(), [32]byte(evm.BytesToHash(result.ReturnData)))
+	// four pushes and MSTORE, RETURN is free
+	assert.Equal(t, uint64(21000+5*3), result.UsedGas)
+	assert.Equal(t, uint256.NewInt(1000000), state.GetBalance(sender))
+	assert.Nil(t, result.Revert())
+
+	msg.To = &reverting
+	result, err = Call(state, msg, blockCtx)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, result.Err, evm.ErrExecutionReverted)
+	assert.Len(t, result.Revert(), 32)
+
+	msg.Value = uint256.NewInt(2000000)
+	_, err = Call(state, msg, blockCtx)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	assert.Equal(t, uint64(21000), IntrinsicGas(nil, false, nil))
+	assert.Equal(t, uint64(21000+4+16), IntrinsicGas([]byte{0, 1}, false, nil))
+	// two words of initcode
+	assert.Equal(t, uint64(53000+33*4+2*2), IntrinsicGas(make([]byte, 33), true, nil))
+
+	accessList := types.AccessList{
+		{Address: evm.HexToAddress("0x1000"), StorageKeys: []evm.Hash{{}, evm.HexToHash("0x01")}},
+		{Address: evm.HexToAddress("0x2000")},
+	}
+	assert.Equal(t, uint64(21000+2*2400+2*1900+16), IntrinsicGas([]byte{1}, false, accessList))
+}
+
+func TestEffectiveGasPrice(t *testing.T) {
+	msg := &types.Message{GasFeeCap: uint256.NewInt(10), GasTipCap: uint256.NewInt(2)}
+	price, err := EffectiveGasPrice(msg, uint256.NewInt(7))
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(9), price)
+	price, err = EffectiveGasPrice(msg, uint256.NewInt(9))
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(10), price)
+	_, err = EffectiveGasPrice(msg, uint256.NewInt(11))
+	assert.ErrorIs(t, err, ErrFeeCapTooLow)
+
+	msg.GasTipCap = uint256.NewInt(11)
+	_, err = EffectiveGasPrice(msg, uint256.NewInt(7))
+	assert.EqualError(t, err, "max priority fee per gas higher than max fee per gas: tip 0xb, fee cap 0xa")
+}
+
+func TestCreateAddress(t *testing.T) {
+	sender := evm.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	assert.Equal(t, evm.HexToAddress("0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d"), CreateAddress(sender, 0))
+	assert.Equal(t, evm.HexToAddress("0x343c43a37d37dff08ae8c4a11544c718abb4fcf8"), CreateAddress(sender, 1))
+}
+
+func TestApplyPrestateTracer(t *testing.T) {
+	state, blockCtx := newTransitionState(t)
+	contract := evm.HexToAddress("0x1000")
+	// BALANCE of 0x0c, EXTCODESIZE of 0x0d and SSTORE 1 at slot 0
+	state.SetCode(contract, evm.HexToBytes("600c31600d3b600160005500"))
+	state.AddBalance(evm.HexToAddress("0x0c"), uint256.NewInt(7))
+	state.SetCode(evm.HexToAddress("0x0d"), []byte{0})
+	msg := &types.Message{From: sender, To: &contract, GasLimit: 50000, GasPrice: uint256.NewInt(1), Value: uint256.NewInt(0)}
+
+	trace := func(diffMode bool) map[string]interface{} {
+		tracer := evm.NewPrestateTracer(diffMode)
+		blockCtx.Tracer = tracer
+		_, err := ApplyMessage(state.Copy(), msg, blockCtx)
+		assert.NoError(t, err)
+		result, err := tracer.GetResult()
+		assert.NoError(t, err)
+		var out map[string]interface{}
+		assert.NoError(t, json.Unmarshal(result, &out))
+		return out
+	}
+
+	slot := fmt.Sprintf("0x%064x", 0)
+	// the state before the sender buys the gas, the coinbase
+	// didn't exist
+	assert.Equal(t, map[string]interface{}{
+		sender.Hex():                   map[string]interface{}{"balance": "0xf4240"},
+		contract.Hex():                 map[string]interface{}{"balance": "0x0", "code": "0x600c31600d3b600160005500", "storage": map[string]interface{}{slot: slot}},
+		evm.HexToAddress("0x0c").Hex(): map[string]interface{}{"balance": "0x7"},
+		evm.HexToAddress("0x0d").Hex(): map[string]interface{}{"balance": "0x0", "code": "0x00"},
+	}, trace(false))
+
+	gasUsed := 21000 + 4*3 + 2*evm.ColdAccountAccessCost + evm.SstoreSetGas + evm.ColdSloadCost
+	assert.Equal(t, map[string]interface{}{
+		"pre": map[string]interface{}{
+			sender.Hex():   map[string]interface{}{"balance": "0xf4240"},
+			contract.Hex(): map[string]interface{}{"balance": "0x0", "code": "0x600c31600d3b600160005500"},
+		},
+		"post": map[string]interface{}{
+			sender.Hex():   map[string]interface{}{"balance": uint256.NewInt(1000000 - gasUsed).Hex(), "nonce": float64(1)},
+			contract.Hex(): map[string]interface{}{"storage": map[string]interface{}{slot: fmt.Sprintf("0x%064x", 1)}},
+			coinbase.Hex(): map[string]interface{}{"balance": uint256.NewInt(gasUsed).Hex()},
+		},
+	}, trace(true))
+}
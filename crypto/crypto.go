@@ -0,0 +1,15 @@
+// Package crypto holds the hash functions used by Ethereum
+package crypto
+
+import "golang.org/x/crypto/sha3"
+
+// Keccak256 returns the Keccak-256 hash of the concatenated data.
+// This is the original Keccak submission, not the finalised
+// SHA3-256 standard.
+func Keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
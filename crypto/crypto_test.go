@@ -0,0 +1,21 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeccak256(t *testing.T) {
+	assert.Equal(t,
+		"c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		hex.EncodeToString(Keccak256()),
+	)
+	assert.Equal(t,
+		"a9059cbb2ab09eb219583f4a59a5d0623ade346d962bcd4e46b11da047c9049b",
+		hex.EncodeToString(Keccak256([]byte("transfer(address,uint256)"))),
+	)
+	// the data is concatenated
+	assert.Equal(t, Keccak256([]byte("ab")), Keccak256([]byte("a"), []byte("b")))
+}
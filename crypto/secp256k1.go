@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"errors"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/holiman/uint256"
+)
+
+var (
+	ErrInvalidKey       = errors.New("invalid private key")
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// secp256k1N is the order of the curve, secp256k1HalfN its half
+	secp256k1N, _  = uint256.FromHex("0xfffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	secp256k1HalfN = new(uint256.Int).Rsh(secp256k1N, 1)
+)
+
+// Sign signs the 32 byte hash with the private key. The signature
+// is [R || S || V] where V, the recovery id, is 0 or 1. S is in the
+// lower half of the curve order.
+func Sign(hash, key []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("hash must be 32 bytes")
+	}
+	priv, err := privateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	// the compact format is [27 + V || R || S]
+	compact := ecdsa.SignCompact(priv, hash, false)
+	return append(compact[1:], compact[0]-27), nil
+}
+
+// Ecrecover returns the uncompressed public key, 65 bytes starting
+// with 0x04, that created the [R || S || V] signature of hash
+func Ecrecover(hash, sig []byte) ([]byte, error) {
+	if len(hash) != 32 || len(sig) != 65 || sig[64] > 1 {
+		return nil, ErrInvalidSignature
+	}
+	compact := append([]byte{sig[64] + 27}, sig[:64]...)
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return pub.SerializeUncompressed(), nil
+}
+
+// PublicKey returns the uncompressed public key of the private key
+func PublicKey(key []byte) ([]byte, error) {
+	priv, err := privateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PubKey().SerializeUncompressed(), nil
+}
+
+// PublicKeyToAddress returns the address of an uncompressed public
+// key: the last 20 bytes of the hash of its coordinates
+func PublicKeyToAddress(pub []byte) []byte {
+	return Keccak256(pub[1:])[12:]
+}
+
+// ValidateSignatureValues checks that r and s are in [1, N-1]. Since
+// Homestead s must also be in the lower half (EIP-2).
+func ValidateSignatureValues(r, s *uint256.Int, homestead bool) bool {
+	if r.IsZero() || s.IsZero() || !r.Lt(secp256k1N) || !s.Lt(secp256k1N) {
+		return false
+	}
+	return !homestead || !s.Gt(secp256k1HalfN)
+}
+
+func privateKey(key []byte) (*secp256k1.PrivateKey, error) {
+	var scalar secp256k1.ModNScalar
+	if len(key) != 32 || scalar.SetByteSlice(key) || scalar.IsZero() {
+		return nil, ErrInvalidKey
+	}
+	return secp256k1.NewPrivateKey(&scalar), nil
+}
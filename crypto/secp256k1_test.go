@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestPublicKeyToAddress(t *testing.T) {
+	for key, addr := range map[string]string{
+		"45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8": "a94f5374fce5edbc8e2a8697c15331677e6ebf0b",
+		"0000000000000000000000000000000000000000000000000000000000000001": "7e5f4552091a69125d5dfcb7b8c2659029395bdf",
+	} {
+		pub, err := PublicKey(unhex(key))
+		assert.NoError(t, err)
+		assert.Len(t, pub, 65)
+		assert.Equal(t, addr, hex.EncodeToString(PublicKeyToAddress(pub)))
+	}
+
+	for _, key := range []string{
+		"",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+	} {
+		_, err := PublicKey(unhex(key))
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
+
+func TestSignAndRecover(t *testing.T) {
+	// the example of EIP-155
+	key := unhex("4646464646464646464646464646464646464646464646464646464646464646")
+	hash := unhex("daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53")
+	sig, err := Sign(hash, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276"+
+		"67cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"+"00", hex.EncodeToString(sig))
+
+	pub, err := Ecrecover(hash, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, "9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", hex.EncodeToString(PublicKeyToAddress(pub)))
+
+	// the other recovery id gives another key
+	sig[64] = 1
+	other, err := Ecrecover(hash, sig)
+	if err == nil {
+		assert.NotEqual(t, pub, other)
+	}
+
+	sig[64] = 2
+	_, err = Ecrecover(hash, sig)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = Ecrecover(hash, make([]byte, 65))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = Sign(hash[:31], key)
+	assert.Error(t, err)
+}
+
+func TestValidateSignatureValues(t *testing.T) {
+	one := uint256.NewInt(1)
+	assert.True(t, ValidateSignatureValues(one, one, true))
+	assert.False(t, ValidateSignatureValues(uint256.NewInt(0), one, false))
+	assert.False(t, ValidateSignatureValues(one, uint256.NewInt(0), false))
+	assert.False(t, ValidateSignatureValues(secp256k1N, one, false))
+
+	// a high s is only valid before Homestead
+	highS := new(uint256.Int).Add(secp256k1HalfN, one)
+	assert.True(t, ValidateSignatureValues(one, highS, false))
+	assert.False(t, ValidateSignatureValues(one, highS, true))
+	assert.True(t, ValidateSignatureValues(one, secp256k1HalfN, true))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/avichalp/toy-evm/debugger"
+	"github.com/avichalp/toy-evm/evm"
+	"golang.org/x/term"
+)
+
+// debug starts an interactive debugger on the given code
+func debug(args []string) {
+	var (
+		code     string
+		calldata string
+		gas      uint64
+		tui      bool
+	)
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	fs.StringVar(&code, "code", "", "hex data of the code to debug, or a .easm file to assemble")
+	fs.StringVar(&calldata, "calldata", "", "hex data to use as input")
+	fs.Uint64Var(&gas, "gas", 1000000, "gas available to the execution")
+	fs.BoolVar(&tui, "tui", false, "show the code, stack, memory and storage in a full screen terminal UI")
+	fs.Parse(args)
+
+	evm.Init()
+	evm.DebugOutput = io.Discard
+
+	var bytecode []byte
+	if strings.HasSuffix(code, ".easm") {
+		var err error
+		if bytecode, err = assembleFile(code); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		bytecode = evm.HexToBytes(strings.TrimPrefix(code, "0x"))
+	}
+
+	d := debugger.New(bytecode, evm.NewCalldata(calldata), evm.NewStorage(), gas, os.Stdout)
+	if tui {
+		runTUI(d)
+		return
+	}
+	d.Run(os.Stdin)
+}
+
+// runTUI switches the terminal to raw mode and an alternate
+// screen for the duration of the TUI
+func runTUI(d *debugger.Debugger) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "-tui needs a terminal")
+		os.Exit(1)
+	}
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		width, height = 120, 40
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	debugger.NewTUI(d, width, height).Run(os.Stdin, os.Stdout)
+}
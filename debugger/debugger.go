@@ -0,0 +1,465 @@
+// Package debugger drives the interpreter one instruction at a
+// time from an interactive prompt.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+)
+
+const help = `commands:
+  step, s [n]          execute the next n instructions (default 1)
+  next, n [n]          like step, there is no CALL to step over
+  continue, c          execute until a breakpoint is hit or the execution halts
+  break, b pc <n>      break before the instruction at pc n
+  break, b op <NAME>   break before every NAME instruction
+  break, b sstore      break before every SSTORE
+  break, b slot <n>    break before every SLOAD or SSTORE of slot n
+  breakpoints, bl      list the breakpoints
+  delete, d <id>       delete a breakpoint
+  print, p <what>      print the stack, memory or storage
+  set stack <i> <v>    replace the i-th stack element (0 is the top)
+  back, bk [n]         go back n instructions (default 1)
+  goto, g <n>          go forward or back to step n
+  last slot <n>        print the step that last wrote storage slot n
+  last mem <offset>    print the step that last wrote the memory byte at offset
+  help, h              print this help
+  quit, q              exit the debugger
+An empty line repeats the last command.`
+
+var errHalted = errors.New("execution has halted")
+
+type breakpoint struct {
+	kind string
+	pc   uint64
+	op   string
+	slot *uint256.Int
+}
+
+func (b breakpoint) String() string {
+	switch b.kind {
+	case "pc":
+		return fmt.Sprintf("pc %d", b.pc)
+	case "op":
+		return "op " + b.op
+	case "slot":
+		return "slot " + b.slot.Hex()
+	}
+	return b.kind
+}
+
+// hit reports whether executing op at the current pc triggers the breakpoint
+func (b breakpoint) hit(ctx *evm.ExecutionCtx, op string) bool {
+	switch b.kind {
+	case "pc":
+		return ctx.PC() == b.pc
+	case "op":
+		return op == b.op
+	case "sstore":
+		return op == "SSTORE"
+	case "slot":
+		return (op == "SLOAD" || op == "SSTORE") && ctx.Stack.Len() > 0 && ctx.Stack.Peek(0).Eq(b.slot)
+	}
+	return false
+}
+
+// Debugger records every executed instruction in an
+// evm.History, which is how it steps backwards
+type Debugger struct {
+	code []byte
+	// storage is the storage before the execution
+	storage *evm.Storage
+	ctx     *evm.ExecutionCtx
+	history *evm.History
+	// err is the error that halted the execution, if any
+	err         error
+	breakpoints []*breakpoint
+	disasm      map[uint64]evm.DisasmInstruction
+	out         io.Writer
+}
+
+// New returns a debugger paused before the first instruction.
+// The storage is copied and left untouched by the debugger.
+// evm.Init must be called first.
+func New(code []byte, calldata *evm.Calldata, storage *evm.Storage, gas uint64, out io.Writer) *Debugger {
+	d := &Debugger{
+		code:    code,
+		storage: storage.Copy(),
+		ctx:     evm.NewExecutionCtx(code, calldata, evm.NewStack(), evm.NewMemory(), storage.Copy(), gas),
+		disasm:  make(map[uint64]evm.DisasmInstruction),
+		out:     out,
+	}
+	d.ctx.ValidJumpDestination()
+	d.history = evm.NewHistory(d.ctx)
+	for _, inst := range evm.Disassemble(code) {
+		d.disasm[inst.Pc] = inst
+	}
+	return d
+}
+
+// Ctx returns the execution context being debugged
+func (d *Debugger) Ctx() *evm.ExecutionCtx {
+	return d.ctx
+}
+
+func (d *Debugger) halted() bool {
+	return d.ctx.Stopped || d.err != nil
+}
+
+// nextOp returns the name of the instruction at pc
+func (d *Debugger) nextOp() string {
+	if d.ctx.PC() >= uint64(len(d.code)) {
+		return "STOP"
+	}
+	if inst, ok := d.disasm[d.ctx.PC()]; ok && !inst.Unknown {
+		return inst.Mnemonic
+	}
+	return ""
+}
+
+// step executes a single instruction. The interpreter panics
+// on invalid code, the panic halts the execution like an error.
+func (d *Debugger) step() (err error) {
+	if d.halted() {
+		return errHalted
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+			d.err = err
+		}
+	}()
+	if err := d.history.Step(); err != nil {
+		d.err = err
+		return err
+	}
+	return nil
+}
+
+// Run reads commands from in until it is exhausted or quit is entered
+func (d *Debugger) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	last := ""
+	d.printLocation()
+	for {
+		fmt.Fprint(d.out, "(evm) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		if d.Exec(line) {
+			return
+		}
+	}
+}
+
+// Exec executes a single command. It returns true when the
+// debugger should exit.
+func (d *Debugger) Exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	cmd, args := fields[0], fields[1:]
+
+	var err error
+	switch cmd {
+	case "step", "s", "next", "n":
+		// without CALL there is no nested execution for next to
+		// step over
+		err = d.cmdStep(args)
+	case "continue", "c":
+		err = d.cmdContinue()
+	case "break", "b":
+		err = d.cmdBreak(args)
+	case "breakpoints", "bl":
+		for i, b := range d.breakpoints {
+			if b != nil {
+				fmt.Fprintf(d.out, "%d: %s\n", i+1, b)
+			}
+		}
+	case "delete", "d":
+		err = d.cmdDelete(args)
+	case "print", "p":
+		err = d.cmdPrint(args)
+	case "set":
+		err = d.cmdSet(args)
+	case "back", "bk":
+		err = d.cmdBack(args)
+	case "goto", "g":
+		err = d.cmdGoto(args)
+	case "last":
+		err = d.cmdLast(args)
+	case "help", "h":
+		fmt.Fprintln(d.out, help)
+	case "quit", "q":
+		return true
+	default:
+		err = fmt.Errorf("unknown command %q, type help for a list of commands", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(d.out, "error:", err)
+	}
+	return false
+}
+
+func (d *Debugger) cmdStep(args []string) error {
+	n, err := countArg(args)
+	if err != nil {
+		return err
+	}
+	if d.halted() {
+		return errHalted
+	}
+	for i := uint64(0); i < n; i++ {
+		if err := d.step(); err != nil {
+			break
+		}
+	}
+	d.printLocation()
+	return nil
+}
+
+func (d *Debugger) cmdContinue() error {
+	if d.halted() {
+		return errHalted
+	}
+	for !d.halted() {
+		if err := d.step(); err != nil {
+			break
+		}
+		if id, b := d.breakpointHit(); b != nil {
+			fmt.Fprintf(d.out, "breakpoint %d: %s\n", id, b)
+			break
+		}
+	}
+	d.printLocation()
+	return nil
+}
+
+func (d *Debugger) breakpointHit() (int, *breakpoint) {
+	if d.halted() {
+		return 0, nil
+	}
+	op := d.nextOp()
+	for i, b := range d.breakpoints {
+		if b != nil && b.hit(d.ctx, op) {
+			return i + 1, b
+		}
+	}
+	return 0, nil
+}
+
+func (d *Debugger) cmdBreak(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: break pc <n> | op <NAME> | sstore | slot <n>")
+	}
+	b := &breakpoint{kind: args[0]}
+	switch {
+	case b.kind == "sstore" && len(args) == 1:
+	case b.kind == "pc" && len(args) == 2:
+		pc, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid pc %q", args[1])
+		}
+		b.pc = pc
+	case b.kind == "op" && len(args) == 2:
+		b.op = strings.ToUpper(args[1])
+		if !isMnemonic(b.op) {
+			return fmt.Errorf("unknown instruction %q", args[1])
+		}
+	case b.kind == "slot" && len(args) == 2:
+		slot, err := parseWord(args[1])
+		if err != nil {
+			return err
+		}
+		b.slot = slot
+	default:
+		return errors.New("usage: break pc <n> | op <NAME> | sstore | slot <n>")
+	}
+	d.breakpoints = append(d.breakpoints, b)
+	fmt.Fprintf(d.out, "breakpoint %d: %s\n", len(d.breakpoints), b)
+	return nil
+}
+
+func (d *Debugger) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: delete <id>")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 || id > len(d.breakpoints) || d.breakpoints[id-1] == nil {
+		return fmt.Errorf("no breakpoint %s", args[0])
+	}
+	// keep the ids of the other breakpoints stable
+	d.breakpoints[id-1] = nil
+	return nil
+}
+
+func (d *Debugger) cmdPrint(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: print stack | memory | storage")
+	}
+	switch args[0] {
+	case "stack":
+		for i := 0; i < d.ctx.Stack.Len(); i++ {
+			fmt.Fprintf(d.out, "%d: %s\n", i, d.ctx.Stack.Peek(uint16(i)).Hex())
+		}
+	case "memory":
+		data := d.ctx.Memory.Data()
+		for offset := 0; offset < len(data); offset += 32 {
+			fmt.Fprintf(d.out, "%04x: %x\n", offset, data[offset:offset+32])
+		}
+	case "storage":
+		fmt.Fprint(d.out, d.ctx.Storage)
+	default:
+		return fmt.Errorf("cannot print %q", args[0])
+	}
+	return nil
+}
+
+func (d *Debugger) cmdSet(args []string) error {
+	if len(args) != 3 || args[0] != "stack" {
+		return errors.New("usage: set stack <i> <value>")
+	}
+	i, err := strconv.ParseUint(args[1], 10, 16)
+	if err != nil || int(i) >= d.ctx.Stack.Len() {
+		return fmt.Errorf("invalid stack index %q", args[1])
+	}
+	value, err := parseWord(args[2])
+	if err != nil {
+		return err
+	}
+	// recorded so that back undoes it
+	d.history.SetStack(uint16(i), value)
+	return nil
+}
+
+// cmdBack undoes the last n instructions
+func (d *Debugger) cmdBack(args []string) error {
+	n, err := countArg(args)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n && d.history.Back(); i++ {
+		d.err = nil
+	}
+	d.printLocation()
+	return nil
+}
+
+// cmdGoto moves the execution to the given step, going
+// backwards or forwards from the current one
+func (d *Debugger) cmdGoto(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: goto <step>")
+	}
+	target, err := strconv.Atoi(args[0])
+	if err != nil || target < 0 {
+		return fmt.Errorf("invalid step %q", args[0])
+	}
+	for d.history.Len() > target && d.history.Back() {
+		d.err = nil
+	}
+	for d.history.Len() < target {
+		if err := d.step(); err != nil {
+			break
+		}
+	}
+	d.printLocation()
+	return nil
+}
+
+// cmdLast prints when a storage slot or a memory byte was
+// last written
+func (d *Debugger) cmdLast(args []string) error {
+	if len(args) != 2 || (args[0] != "slot" && args[0] != "mem") {
+		return errors.New("usage: last slot <n> | mem <offset>")
+	}
+	var (
+		step int
+		pc   uint64
+		ok   bool
+	)
+	if args[0] == "slot" {
+		slot, err := parseWord(args[1])
+		if err != nil {
+			return err
+		}
+		step, pc, ok = d.history.LastStorageWrite(*slot)
+	} else {
+		offset, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid offset %q", args[1])
+		}
+		step, pc, ok = d.history.LastMemoryWrite(offset)
+	}
+	if !ok {
+		fmt.Fprintf(d.out, "%s %s was not written\n", args[0], args[1])
+		return nil
+	}
+	fmt.Fprintf(d.out, "%s %s was last written at step %d by %s\n", args[0], args[1], step, d.disasm[pc])
+	return nil
+}
+
+// printLocation prints the instruction that executes next
+func (d *Debugger) printLocation() {
+	switch {
+	case d.err != nil:
+		fmt.Fprintf(d.out, "[step %d] halted: %v\n", d.history.Len(), d.err)
+	case d.ctx.Stopped:
+		fmt.Fprintf(d.out, "[step %d] stopped, return data 0x%x\n", d.history.Len(), d.ctx.Returndata)
+	default:
+		inst, ok := d.disasm[d.ctx.PC()]
+		location := fmt.Sprintf("%04x: STOP", d.ctx.PC())
+		if ok {
+			location = inst.String()
+		}
+		fmt.Fprintf(d.out, "[step %d] %s  (gas %d)\n", d.history.Len(), location, d.ctx.Gas)
+	}
+}
+
+func countArg(args []string) (uint64, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
+// parseWord parses a 0x prefixed hex or a decimal number
+func parseWord(s string) (*uint256.Int, error) {
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok || b.Sign() < 0 {
+		return nil, fmt.Errorf("invalid value %q", s)
+	}
+	value, overflow := uint256.FromBig(b)
+	if overflow {
+		return nil, fmt.Errorf("value %q is larger than 32 bytes", s)
+	}
+	return value, nil
+}
+
+func isMnemonic(name string) bool {
+	for _, inst := range evm.InstructionSet {
+		if inst.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package debugger
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+// square calculates 4^2 in a loop, see examples/square.easm
+const square = "60048060005b8160125760005360016000f35b8201906001900390600556"
+
+func newDebugger(t *testing.T, code string) (*Debugger, *bytes.Buffer) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	var out bytes.Buffer
+	d := New(evm.HexToBytes(code), evm.NewCalldata(""), evm.NewStorage(), 100000, &out)
+	return d, &out
+}
+
+func TestStepAndBack(t *testing.T) {
+	d, out := newDebugger(t, square)
+	d.Run(strings.NewReader("step 3\np stack\nback\n\nprint stack\nq\n"))
+
+	assert.Equal(t, strings.Join([]string{
+		"[step 0] 0000: PUSH1 0x04  (gas 100000)",
+		"(evm) [step 3] 0005: JUMPDEST <- jumpdest  (gas 99991)",
+		"(evm) 0: 0x0",
+		"1: 0x4",
+		"2: 0x4",
+		"(evm) [step 2] 0003: PUSH1 0x00  (gas 99994)",
+		// an empty line repeats back
+		"(evm) [step 1] 0002: DUP1  (gas 99997)",
+		"(evm) 0: 0x4",
+		"(evm) ",
+	}, "\n"), out.String())
+}
+
+func TestBreakpoints(t *testing.T) {
+	d, out := newDebugger(t, square)
+	d.Exec("break op JUMPI")
+	d.Exec("b pc 0x12")
+	d.Exec("continue")
+	assert.Equal(t, uint64(9), d.Ctx().PC())
+	d.Exec("c")
+	assert.Equal(t, uint64(0x12), d.Ctx().PC())
+
+	d.Exec("delete 1")
+	d.Exec("delete 2")
+	d.Exec("bl")
+	d.Exec("c")
+	assert.True(t, d.Ctx().Stopped)
+	assert.Equal(t, []byte{16}, d.Ctx().Returndata)
+
+	assert.Contains(t, out.String(), "breakpoint 1: op JUMPI\nbreakpoint 2: pc 18\n")
+	assert.Contains(t, out.String(), "breakpoint 1: op JUMPI\n[step 6] 0009: JUMPI")
+	assert.Contains(t, out.String(), "breakpoint 2: pc 18\n[step 7] 0012: JUMPDEST")
+	assert.Contains(t, out.String(), "stopped, return data 0x10")
+
+	d.Exec("step")
+	assert.Contains(t, out.String(), "error: execution has halted")
+}
+
+func TestStorageBreakpoints(t *testing.T) {
+	// SSTORE 1 at slot 0, SLOAD slot 1, SSTORE 2 at slot 1
+	d, out := newDebugger(t, "6001600055600154600260015500")
+	d.Exec("break slot 1")
+	d.Exec("c")
+	assert.Equal(t, uint64(7), d.Ctx().PC())
+	d.Exec("c")
+	assert.Equal(t, uint64(12), d.Ctx().PC())
+
+	d.Exec("back 100")
+	d.Exec("delete 1")
+	d.Exec("break sstore")
+	d.Exec("c")
+	assert.Equal(t, uint64(4), d.Ctx().PC())
+
+	d.Exec("c")
+	d.Exec("c")
+	d.Exec("print storage")
+	assert.Contains(t, out.String(), "storage: \n0: 1\n1: 2\n")
+}
+
+func TestSetStack(t *testing.T) {
+	d, out := newDebugger(t, "600660070260005360016000f3")
+	d.Exec("step 2")
+	d.Exec("set stack 0 0x10")
+	d.Exec("c")
+	assert.Equal(t, []byte{0x60}, d.Ctx().Returndata)
+	assert.Equal(t, 0, d.Ctx().Stack.Len())
+
+	d.Exec("set stack 5 1")
+	assert.Contains(t, out.String(), `error: invalid stack index "5"`)
+
+	// going back over the step before the edit undoes it
+	d, _ = newDebugger(t, "600660070260005360016000f3")
+	d.Exec("next 2")
+	d.Exec("set stack 0 0x10")
+	d.Exec("back")
+	assert.Equal(t, "0x6", d.Ctx().Stack.Peek(0).Hex())
+	d.Exec("n")
+	assert.Equal(t, "0x7", d.Ctx().Stack.Peek(0).Hex())
+	d.Exec("c")
+	assert.Equal(t, []byte{42}, d.Ctx().Returndata)
+}
+
+func TestInvalidCode(t *testing.T) {
+	d, out := newDebugger(t, "600101")
+	d.Exec("c")
+	assert.Contains(t, out.String(), "halted: stack underflow")
+
+	d.Exec("frobnicate")
+	d.Exec("break op FOO")
+	assert.Contains(t, out.String(), `error: unknown command "frobnicate"`)
+	assert.Contains(t, out.String(), `error: unknown instruction "FOO"`)
+}
+
+func TestPrintMemory(t *testing.T) {
+	d, out := newDebugger(t, "602a600053")
+	d.Exec("s 3")
+	d.Exec("p memory")
+	assert.Contains(t, out.String(), "0000: 2a00000000000000000000000000000000000000000000000000000000000000\n")
+}
+
+func TestGotoAndLastWrite(t *testing.T) {
+	d, out := newDebugger(t, "6001600055600260005560ff60015200")
+	d.Exec("goto 8")
+	assert.Equal(t, uint64(14), d.Ctx().PC())
+	d.Exec("last slot 0")
+	d.Exec("last slot 1")
+	d.Exec("last mem 0x20")
+	d.Exec("g 100")
+	assert.True(t, d.Ctx().Stopped)
+	d.Exec("last mem 0x20")
+	d.Exec("goto 3")
+	d.Exec("print storage")
+
+	assert.Contains(t, out.String(), "slot 0 was last written at step 6 by 0009: SSTORE\n")
+	assert.Contains(t, out.String(), "slot 1 was not written\n")
+	assert.Contains(t, out.String(), "mem 0x20 was not written\n")
+	assert.Contains(t, out.String(), "mem 0x20 was last written at step 9 by 000e: MSTORE\n")
+	assert.Contains(t, out.String(), "[step 3] 0005: PUSH1 0x02  (gas 79994)\nstorage: \n0: 1\n")
+}
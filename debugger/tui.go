@@ -0,0 +1,348 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+)
+
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	bold        = "\x1b[1m"
+	green       = "\x1b[32m"
+	yellow      = "\x1b[33m"
+	reset       = "\x1b[0m"
+
+	tuiHelp = "s/→ step  b/← back  c continue  ↑/↓ move  space breakpoint  q quit"
+)
+
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]")
+
+// TUI is a full screen front end of the Debugger. It shows the
+// disassembly next to the stack, memory and storage panes.
+type TUI struct {
+	d             *Debugger
+	width, height int
+	// cursor is the index of the selected line of the disassembly
+	cursor int
+	lines  []evm.DisasmInstruction
+	// memory before the step that led to the current pc, to
+	// highlight what it wrote
+	prevMemory []byte
+	message    string
+}
+
+// NewTUI returns a TUI for a screen of the given size. The
+// output of the debugger is discarded, the panes replace it.
+func NewTUI(d *Debugger, width, height int) *TUI {
+	d.out = io.Discard
+	t := &TUI{d: d, width: width, height: height, lines: evm.Disassemble(d.code)}
+	t.follow()
+	return t
+}
+
+// follow moves the cursor to the instruction at pc
+func (t *TUI) follow() {
+	for i, inst := range t.lines {
+		if inst.Pc == t.d.ctx.PC() {
+			t.cursor = i
+		}
+	}
+}
+
+// Run draws the screen and handles key presses until q is pressed
+// or in is exhausted. The terminal must be in raw mode.
+func (t *TUI) Run(in io.Reader, out io.Writer) {
+	r := bufio.NewReader(in)
+	for {
+		fmt.Fprint(out, clearScreen+strings.ReplaceAll(t.Render(), "\n", "\r\n"))
+		key, err := readKey(r)
+		if err != nil || !t.HandleKey(key) {
+			return
+		}
+	}
+}
+
+// HandleKey executes the command bound to the key. It returns
+// false when the TUI should exit.
+func (t *TUI) HandleKey(key string) bool {
+	t.message = ""
+	steps, memory := t.d.history.Len(), append([]byte{}, t.d.ctx.Memory.Data()...)
+	defer func() {
+		// the highlight stays until the execution moves
+		if t.d.history.Len() != steps {
+			t.prevMemory = memory
+		}
+	}()
+	var err error
+	switch key {
+	case "s", "n", "right":
+		err = t.d.cmdStep(nil)
+		t.follow()
+	case "b", "left":
+		err = t.d.cmdBack(nil)
+		t.follow()
+	case "c":
+		err = t.d.cmdContinue()
+		if id, b := t.d.breakpointHit(); b != nil {
+			t.message = fmt.Sprintf("breakpoint %d: %s", id, b)
+		}
+		t.follow()
+	case "up", "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "down", "j":
+		if t.cursor < len(t.lines)-1 {
+			t.cursor++
+		}
+	case " ":
+		t.toggleBreakpoint()
+	case "q", "\x03":
+		return false
+	}
+	if err != nil {
+		t.message = err.Error()
+	}
+	return true
+}
+
+// toggleBreakpoint adds or removes a breakpoint at the selected line
+func (t *TUI) toggleBreakpoint() {
+	if len(t.lines) == 0 {
+		return
+	}
+	pc := t.lines[t.cursor].Pc
+	for i, b := range t.d.breakpoints {
+		if b != nil && b.kind == "pc" && b.pc == pc {
+			t.d.breakpoints[i] = nil
+			return
+		}
+	}
+	t.d.breakpoints = append(t.d.breakpoints, &breakpoint{kind: "pc", pc: pc})
+}
+
+func (t *TUI) hasBreakpoint(pc uint64) bool {
+	for _, b := range t.d.breakpoints {
+		if b != nil && b.kind == "pc" && b.pc == pc {
+			return true
+		}
+	}
+	return false
+}
+
+// Render returns the screen as lines separated by \n
+func (t *TUI) Render() string {
+	leftWidth := t.width / 2
+	rightWidth := t.width - leftWidth - 1
+	// leave room for the status line and the help line
+	rows := t.height - 2
+
+	left := t.codePane(rows)
+	right := t.stackPane()
+	right = append(right, t.memoryPane()...)
+	right = append(right, t.storagePane()...)
+	right = append(right, t.callStackPane()...)
+
+	var sb strings.Builder
+	for i := 0; i < rows; i++ {
+		l, r := "", ""
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		sb.WriteString(pad(l, leftWidth) + "│" + pad(r, rightWidth) + "\n")
+	}
+
+	status := fmt.Sprintf("step %d  gas %d", t.d.history.Len(), t.d.ctx.Gas)
+	switch {
+	case t.d.err != nil:
+		status += "  halted: " + t.d.err.Error()
+	case t.d.ctx.Stopped:
+		status += fmt.Sprintf("  stopped, return data 0x%x", t.d.ctx.Returndata)
+	}
+	if t.message != "" {
+		status += "  (" + t.message + ")"
+	}
+	sb.WriteString(reverse + pad(status, t.width) + reset + "\n")
+	sb.WriteString(pad(tuiHelp, t.width))
+	return sb.String()
+}
+
+// codePane shows the disassembly around the cursor. The next
+// instruction is highlighted and breakpoints are marked with *.
+func (t *TUI) codePane(rows int) []string {
+	lines := []string{bold + "code" + reset}
+	start := t.cursor - (rows-1)/2
+	if start > len(t.lines)-(rows-1) {
+		start = len(t.lines) - (rows - 1)
+	}
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(t.lines) && len(lines) < rows; i++ {
+		inst := t.lines[i]
+		marker := "  "
+		if t.hasBreakpoint(inst.Pc) {
+			marker = "* "
+		}
+		if i == t.cursor {
+			marker = marker[:1] + ">"
+		}
+		line := marker + inst.String()
+		if inst.Pc == t.d.ctx.PC() && !t.d.halted() {
+			line = reverse + line + reset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// stackPane lists the stack, the top element first
+func (t *TUI) stackPane() []string {
+	lines := []string{bold + "stack" + reset}
+	stack := t.d.ctx.Stack
+	for i := 0; i < stack.Len(); i++ {
+		lines = append(lines, fmt.Sprintf("%3d: %s", i, stack.Peek(uint16(i)).Hex()))
+	}
+	return append(lines, "")
+}
+
+// memoryPane is a hexdump of the memory, 16 bytes per line.
+// The bytes changed by the last command are highlighted, the
+// memory it expanded counts as zeros.
+func (t *TUI) memoryPane() []string {
+	lines := []string{bold + "memory" + reset}
+	data := t.d.ctx.Memory.Data()
+	for offset := 0; offset < len(data); offset += 16 {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%04x:", offset)
+		for i := offset; i < offset+16 && i < len(data); i++ {
+			b := fmt.Sprintf(" %02x", data[i])
+			var prev byte
+			if i < len(t.prevMemory) {
+				prev = t.prevMemory[i]
+			}
+			if prev != data[i] {
+				b = " " + yellow + b[1:] + reset
+			}
+			sb.WriteString(b)
+		}
+		lines = append(lines, sb.String())
+	}
+	return append(lines, "")
+}
+
+// storagePane lists the slots, the ones changed by the
+// execution are shown with their original value
+func (t *TUI) storagePane() []string {
+	lines := []string{bold + "storage" + reset}
+	current, initial := t.d.ctx.Storage, t.d.storage
+	slots := current.Slots()
+	seen := make(map[string]bool)
+	for _, slot := range slots {
+		seen[slot.Hex()] = true
+	}
+	// slots may only exist in the initial storage after
+	// stepping back
+	for _, slot := range initial.Slots() {
+		if !seen[slot.Hex()] {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Lt(&slots[j]) })
+
+	for _, slot := range slots {
+		value, before := current.Get(slot), initial.Get(slot)
+		line := fmt.Sprintf("%s: %s", slot.Hex(), value.Hex())
+		if !value.Eq(before) {
+			line = green + line + reset + fmt.Sprintf(" (was %s)", before.Hex())
+		}
+		lines = append(lines, line)
+	}
+	return append(lines, "")
+}
+
+// callStackPane shows the frames being executed, the
+// interpreter runs a single frame
+func (t *TUI) callStackPane() []string {
+	ctx := t.d.ctx
+	return []string{
+		bold + "call stack" + reset,
+		fmt.Sprintf("  1: %s", ctx.Address.Hex()),
+		fmt.Sprintf("     caller %s", ctx.Caller.Hex()),
+	}
+}
+
+// readKey reads a key press, arrow keys are returned as
+// "up", "down", "left" and "right"
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if b != 0x1b {
+		return string(b), nil
+	}
+	// arrow keys are sent as ESC [ A-D
+	if next, err := r.ReadByte(); err != nil || next != '[' {
+		return "esc", nil
+	}
+	code, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch code {
+	case 'A':
+		return "up", nil
+	case 'B':
+		return "down", nil
+	case 'C':
+		return "right", nil
+	case 'D':
+		return "left", nil
+	}
+	return "esc", nil
+}
+
+func visibleLen(s string) int {
+	return len([]rune(ansiRe.ReplaceAllString(s, "")))
+}
+
+// pad pads or truncates s to exactly width visible characters
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-visibleLen(s))
+}
+
+// truncate cuts s to width visible characters, it keeps the
+// escape sequences so the colors are reset properly
+func truncate(s string, width int) string {
+	if visibleLen(s) <= width {
+		return s
+	}
+	var sb strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if loc := ansiRe.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			sb.WriteString(s[i : i+loc[1]])
+			i += loc[1]
+			continue
+		}
+		r := []rune(s[i:])[0]
+		if visible < width {
+			sb.WriteRune(r)
+			visible++
+		}
+		i += len(string(r))
+	}
+	return sb.String()
+}
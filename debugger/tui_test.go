@@ -0,0 +1,126 @@
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// plain strips the escape sequences from the screen
+func plain(s string) string {
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+func TestTUIRender(t *testing.T) {
+	d, _ := newDebugger(t, square)
+	tui := NewTUI(d, 120, 20)
+	screen := tui.Render()
+
+	lines := strings.Split(screen, "\n")
+	assert.Len(t, lines, 20)
+	for _, line := range lines {
+		assert.Equal(t, 120, visibleLen(line), line)
+	}
+	// the next instruction is highlighted
+	assert.Contains(t, screen, reverse+" >0000: PUSH1 0x04"+reset)
+	assert.Contains(t, plain(screen), "step 0  gas 100000")
+	assert.Contains(t, plain(screen), "  1: 0x0000000000000000000000000000000000000000")
+	assert.Contains(t, plain(screen), "     caller 0x0000000000000000000000000000000000000000")
+
+	tui.HandleKey("s")
+	tui.HandleKey("right")
+	assert.Contains(t, plain(tui.Render()), "  0: 0x4 ")
+	assert.Contains(t, plain(tui.Render()), "  1: 0x4")
+	assert.Contains(t, plain(tui.Render()), " >0003: PUSH1 0x00")
+
+	tui.HandleKey("left")
+	assert.Contains(t, plain(tui.Render()), " >0002: DUP1")
+	assert.Contains(t, plain(tui.Render()), "step 1  gas 99997")
+}
+
+func TestTUIBreakpoint(t *testing.T) {
+	d, _ := newDebugger(t, square)
+	tui := NewTUI(d, 80, 30)
+	for i := 0; i < 6; i++ {
+		tui.HandleKey("down")
+	}
+	tui.HandleKey(" ")
+	assert.Contains(t, plain(tui.Render()), "*>0009: JUMPI")
+
+	tui.HandleKey("c")
+	assert.Equal(t, uint64(9), d.Ctx().PC())
+	assert.Contains(t, plain(tui.Render()), "(breakpoint 1: pc 9)")
+
+	// pressing space again removes the breakpoint
+	tui.HandleKey(" ")
+	tui.HandleKey("c")
+	assert.True(t, d.Ctx().Stopped)
+	assert.Contains(t, plain(tui.Render()), "stopped, return data 0x10")
+
+	tui.HandleKey("s")
+	assert.Contains(t, plain(tui.Render()), "(execution has halted)")
+}
+
+func TestTUIMemoryAndStorage(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	storage := evm.NewStorage()
+	storage.Put(uint256.NewInt(0), uint256.NewInt(7))
+	storage.Put(uint256.NewInt(1), uint256.NewInt(8))
+	// MSTORE8 0x2a at 1, SSTORE 2 at slot 1
+	d := New(evm.HexToBytes("602a6001536002600155"), evm.NewCalldata(""), storage, 100000, &bytes.Buffer{})
+	tui := NewTUI(d, 120, 30)
+
+	tui.HandleKey("s")
+	tui.HandleKey("s")
+	tui.HandleKey("s")
+	screen := tui.Render()
+	// the byte written by MSTORE8 is highlighted
+	assert.Contains(t, screen, "0000: 00 "+yellow+"2a"+reset+" 00")
+	// moving the cursor keeps it
+	tui.HandleKey("down")
+	tui.HandleKey("up")
+	assert.Contains(t, tui.Render(), "0000: 00 "+yellow+"2a"+reset+" 00")
+
+	tui.HandleKey("c")
+	screen = plain(tui.Render())
+	assert.Contains(t, screen, "0x0: 0x7 ")
+	assert.Contains(t, screen, "0x1: 0x2 (was 0x8)")
+	// no longer highlighted, continue did not write memory
+	assert.NotContains(t, tui.Render(), yellow)
+}
+
+func TestTUIRun(t *testing.T) {
+	d, _ := newDebugger(t, square)
+	tui := NewTUI(d, 80, 20)
+	var out bytes.Buffer
+	// down, step, step, right arrow, quit
+	tui.Run(strings.NewReader("\x1b[Bss\x1b[Cq"), &out)
+	assert.Equal(t, 3, d.history.Len())
+	assert.Equal(t, 5, strings.Count(out.String(), clearScreen))
+	// raw mode needs \r\n line endings
+	assert.Equal(t, strings.Count(out.String(), "\n"), strings.Count(out.String(), "\r\n"))
+}
+
+func TestReadKey(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("a\x1b[A\x1b[D\x1bx"))
+	for _, want := range []string{"a", "up", "left", "esc"} {
+		key, err := readKey(r)
+		assert.NoError(t, err)
+		assert.Equal(t, want, key)
+	}
+	_, err := readKey(r)
+	assert.Error(t, err)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, green+"ab"+reset, truncate(green+"abc"+reset, 2))
+	assert.Equal(t, "│ab  ", pad("│ab", 5))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/node"
+)
+
+// devnode serves the JSON-RPC API of a local chain that mines a
+// block per transaction
+func devnode(args []string) {
+	var (
+		addr      string
+		allocFile string
+		baseFee   string
+		config    = node.DefaultConfig()
+	)
+	flags := flag.NewFlagSet("node", flag.ExitOnError)
+	flags.StringVar(&addr, "http.addr", "127.0.0.1:8545", "address the JSON-RPC server listens on")
+	flags.StringVar(&allocFile, "alloc", "", "genesis alloc file of the accounts of the chain")
+	flags.Uint64Var(&config.ChainID, "chainid", config.ChainID, "chain id of the transactions")
+	flags.Uint64Var(&config.GasLimit, "gaslimit", config.GasLimit, "gas limit of the blocks")
+	flags.StringVar(&baseFee, "basefee", "0", "base fee of the blocks in wei")
+	flags.Parse(args)
+
+	fee, err := evm.ParseWord(baseFee)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	config.BaseFee = fee
+	if allocFile != "" {
+		if config.Alloc, err = evm.ReadAlloc(allocFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "dev accounts:")
+	for _, account := range config.Accounts {
+		fmt.Fprintf(os.Stderr, "  %s\n", account.Hex())
+	}
+	fmt.Fprintf(os.Stderr, "chain %d listening on http://%s\n", config.ChainID, addr)
+	if err := http.ListenAndServe(addr, node.New(config)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+)
+
+// disasm prints the instructions of the hex encoded code
+// given as the first argument, one per line
+func disasm(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: toy-evm disasm <hex code>")
+		os.Exit(2)
+	}
+
+	evm.Init()
+	code := evm.HexToBytes(strings.TrimPrefix(args[0], "0x"))
+	for _, inst := range evm.Disassemble(code) {
+		fmt.Println(inst)
+	}
+}
@@ -0,0 +1,107 @@
+package evm
+
+// see geth: params/protocol_params.go
+// Gas costs of the accesses to storage and accounts (EIP-2929)
+const (
+	ColdSloadCost         uint64 = 2100
+	ColdAccountAccessCost uint64 = 2600
+	WarmStorageReadCost   uint64 = 100
+)
+
+// AccessSet holds the addresses and the storage slots accessed by a
+// transaction (EIP-2929). The first access of each is cold and pays
+// more, the later ones are warm.
+type AccessSet struct {
+	addresses map[Address]bool
+	slots     map[Address]map[Hash]bool
+	// onAdd is called with what is warmed, slot is nil for an
+	// address
+	onAdd func(addr Address, slot *Hash)
+}
+
+func NewAccessSet() *AccessSet {
+	return &AccessSet{
+		addresses: make(map[Address]bool),
+		slots:     make(map[Address]map[Hash]bool),
+	}
+}
+
+// AddAddress warms the address. It reports whether it was cold.
+func (s *AccessSet) AddAddress(addr Address) bool {
+	if s.addresses[addr] {
+		return false
+	}
+	s.addresses[addr] = true
+	if s.onAdd != nil {
+		s.onAdd(addr, nil)
+	}
+	return true
+}
+
+// AddSlot warms the slot of the address, and the address. It reports
+// whether the slot was cold.
+func (s *AccessSet) AddSlot(addr Address, slot Hash) bool {
+	s.AddAddress(addr)
+	if s.slots[addr][slot] {
+		return false
+	}
+	if s.slots[addr] == nil {
+		s.slots[addr] = make(map[Hash]bool)
+	}
+	s.slots[addr][slot] = true
+	if s.onAdd != nil {
+		s.onAdd(addr, &slot)
+	}
+	return true
+}
+
+// remove makes the address, or its slot if slot isn't nil, cold
+// again
+func (s *AccessSet) remove(addr Address, slot *Hash) {
+	if slot == nil {
+		delete(s.addresses, addr)
+		return
+	}
+	delete(s.slots[addr], *slot)
+	if len(s.slots[addr]) == 0 {
+		delete(s.slots, addr)
+	}
+}
+
+// ContainsAddress reports whether the address is warm
+func (s *AccessSet) ContainsAddress(addr Address) bool {
+	return s.addresses[addr]
+}
+
+// ContainsSlot reports whether the slot of the address is warm
+func (s *AccessSet) ContainsSlot(addr Address, slot Hash) bool {
+	return s.slots[addr][slot]
+}
+
+// accessGas returns the gas an access pays on top of its constant
+// gas when what it accesses is cold, and warms it. SLOAD, BALANCE and
+// EXTCODE* pay the difference between the cold and the warm cost,
+// SSTORE pays the cold cost of its slot. Without an access set
+// nothing is cold.
+func accessGas(ctx *ExecutionCtx, op byte) uint64 {
+	if ctx.Accessed == nil || ctx.Stack.Len() == 0 {
+		// an empty stack fails when the instruction runs
+		return 0
+	}
+	top := ctx.Stack.Peek(0)
+	switch op {
+	case 0x54: // SLOAD
+		if ctx.Accessed.AddSlot(ctx.Address, top.Bytes32()) {
+			return ColdSloadCost - WarmStorageReadCost
+		}
+	case 0x55: // SSTORE
+		if ctx.Accessed.AddSlot(ctx.Address, top.Bytes32()) {
+			return ColdSloadCost
+		}
+	case 0x31, 0x3b, 0x3c, 0x3f: // BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH
+		if ctx.Accessed.AddAddress(top.Bytes20()) {
+			return ColdAccountAccessCost - WarmStorageReadCost
+		}
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessSet(t *testing.T) {
+	set := NewAccessSet()
+	addr := HexToAddress("0x1000")
+	assert.False(t, set.ContainsAddress(addr))
+	assert.True(t, set.AddAddress(addr))
+	assert.False(t, set.AddAddress(addr))
+	assert.True(t, set.ContainsAddress(addr))
+
+	// warming a slot warms its address
+	other := HexToAddress("0x2000")
+	slot := Hash{31: 1}
+	assert.True(t, set.AddSlot(other, slot))
+	assert.False(t, set.AddSlot(other, slot))
+	assert.True(t, set.ContainsSlot(other, slot))
+	assert.True(t, set.ContainsAddress(other))
+	assert.False(t, set.ContainsSlot(addr, slot))
+}
+
+func TestAccessGas(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// load slot 0 twice
+	//
+	// 60 00
+	// 54
+	// 60 00
+	// 54
+	// 00
+	code := HexToBytes("60005460005400")
+	run := func(accessed *AccessSet) uint64 {
+		ectx := NewExecutionCtx(code, NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 10000)
+		ectx.Accessed = accessed
+		_, err := Run(ectx)
+		assert.NoError(t, err)
+		return 10000 - ectx.Gas
+	}
+
+	// only the first load is cold
+	assert.Equal(t, 2*(3+WarmStorageReadCost), run(nil))
+	assert.Equal(t, 3+ColdSloadCost+3+WarmStorageReadCost, run(NewAccessSet()))
+
+	// a slot of the access list is warm
+	warm := NewAccessSet()
+	warm.AddSlot(Address{}, Hash{})
+	assert.Equal(t, 2*(3+WarmStorageReadCost), run(warm))
+}
+
+func TestOpExtAccount(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	state := NewState()
+	addr := HexToAddress("0x1000")
+	state.GetOrNewAccount(addr).Balance = uint256.NewInt(5)
+	state.SetCode(addr, HexToBytes("6001"))
+
+	// balance, code size, code hash and code of 0x1000, then the
+	// code hash of the empty 0x2000
+	//
+	// 61 1000 31
+	// 61 1000 3b
+	// 61 1000 3f
+	// 60 02 60 00 60 00 61 1000 3c
+	// 61 2000 3f
+	// 00
+	ectx := NewExecutionCtx(
+		HexToBytes("611000316110003b6110003f6002600060006110003c6120003f00"),
+		NewCalldata(""),
+		NewStack(),
+		NewMemory(),
+		NewStorage(),
+		10000,
+	)
+	ectx.State = state
+	ectx.Accessed = NewAccessSet()
+	_, err := Run(ectx)
+	assert.NoError(t, err)
+
+	codeHash := state.GetAccount(addr).CodeHash()
+	assert.Equal(t, uint256.NewInt(0), ectx.Stack.Pop())
+	assert.Equal(t, new(uint256.Int).SetBytes(codeHash[:]), ectx.Stack.Pop())
+	assert.Equal(t, uint256.NewInt(2), ectx.Stack.Pop())
+	assert.Equal(t, uint256.NewInt(5), ectx.Stack.Pop())
+	assert.Equal(t, HexToBytes("6001"), ectx.Memory.LoadRange(0, 2))
+
+	// 0x1000 and 0x2000 are cold once, EXTCODECOPY copies a word
+	assert.Equal(t, 2*ColdAccountAccessCost+3*WarmStorageReadCost+8*3+CopyGas+MemoryGas, 10000-ectx.Gas)
+
+	// the accounts are empty without a state
+	ectx = NewExecutionCtx(HexToBytes("6110003100"), NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 10000)
+	_, err = Run(ectx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(0), ectx.Stack.Pop())
+	assert.Equal(t, 3+WarmStorageReadCost, 10000-ectx.Gas)
+}
@@ -0,0 +1,197 @@
+package evm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/holiman/uint256"
+)
+
+// GenesisAccount is an account of a pre-state in the JSON format
+// used by geth and the Ethereum tests
+type GenesisAccount struct {
+	Balance *uint256.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[uint256.Int]uint256.Int
+}
+
+// GenesisAlloc is a pre-state, the accounts by their address
+type GenesisAlloc map[Address]GenesisAccount
+
+type genesisAccountJSON struct {
+	Balance string            `json:"balance"`
+	Nonce   string            `json:"nonce"`
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// UnmarshalJSON decodes an account. Numbers may be hex with
+// leading zeros or decimal, all fields are optional.
+func (a *GenesisAccount) UnmarshalJSON(input []byte) error {
+	var dec genesisAccountJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	balance, err := ParseWord(dec.Balance)
+	if err != nil {
+		return fmt.Errorf("balance: %w", err)
+	}
+	nonce, err := ParseWord(dec.Nonce)
+	if err != nil || !nonce.IsUint64() {
+		return fmt.Errorf("invalid nonce %q", dec.Nonce)
+	}
+	code, err := ParseBytes(dec.Code)
+	if err != nil {
+		return fmt.Errorf("code: %w", err)
+	}
+	a.Balance, a.Nonce, a.Code = balance, nonce.Uint64(), code
+	a.Storage = make(map[uint256.Int]uint256.Int, len(dec.Storage))
+	for k, v := range dec.Storage {
+		slot, err := ParseWord(k)
+		if err != nil {
+			return fmt.Errorf("storage slot: %w", err)
+		}
+		value, err := ParseWord(v)
+		if err != nil {
+			return fmt.Errorf("storage value: %w", err)
+		}
+		a.Storage[*slot] = *value
+	}
+	return nil
+}
+
+// ReadAlloc reads a pre-state from a JSON alloc file
+func ReadAlloc(path string) (GenesisAlloc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var alloc GenesisAlloc
+	if err := json.Unmarshal(data, &alloc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return alloc, nil
+}
+
+// WriteAlloc writes the alloc as indented JSON, the accounts and
+// the storage slots in ascending order, so that the same state is
+// always the same file
+func WriteAlloc(w io.Writer, alloc GenesisAlloc) error {
+	data, err := json.MarshalIndent(alloc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ToState returns a world state holding the accounts
+func (alloc GenesisAlloc) ToState() *State {
+	state := NewState()
+	for addr, a := range alloc {
+		account := NewAccount()
+		if a.Balance != nil {
+			account.Balance = a.Balance.Clone()
+		}
+		account.Nonce = a.Nonce
+		account.Code = a.Code
+		account.Storage = a.ToStorage()
+		state.SetAccount(addr, account)
+	}
+	return state
+}
+
+// ToStorage returns the storage of the account
+func (a GenesisAccount) ToStorage() *Storage {
+	storage := NewStorage()
+	for slot, value := range a.Storage {
+		slot, value := slot, value
+		storage.Put(&slot, &value)
+	}
+	return storage
+}
+
+// ParseWord parses a 0x prefixed hex number, leading zeros are
+// allowed, or a decimal number. The empty string is zero.
+func ParseWord(s string) (*uint256.Int, error) {
+	if s == "" {
+		return uint256.NewInt(0), nil
+	}
+	b, ok := new(big.Int), false
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		if len(s) == 2 {
+			return uint256.NewInt(0), nil
+		}
+		b, ok = b.SetString(s[2:], 16)
+	} else {
+		b, ok = b.SetString(s, 10)
+	}
+	if !ok || b.Sign() < 0 {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	value, overflow := uint256.FromBig(b)
+	if overflow {
+		return nil, fmt.Errorf("number %q is larger than 256 bits", s)
+	}
+	return value, nil
+}
+
+// ParseBytes parses an optionally 0x prefixed hex string
+func ParseBytes(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex %q", s)
+	}
+	return b, nil
+}
+
+// MarshalJSON encodes the account with hex numbers. The storage
+// is sorted by slot and zero values are left out.
+func (a GenesisAccount) MarshalJSON() ([]byte, error) {
+	enc := genesisAccountJSON{
+		Balance: "0x0",
+		Nonce:   fmt.Sprintf("0x%x", a.Nonce),
+	}
+	if a.Balance != nil {
+		enc.Balance = a.Balance.Hex()
+	}
+	if len(a.Code) > 0 {
+		enc.Code = "0x" + hex.EncodeToString(a.Code)
+	}
+	for slot, value := range a.Storage {
+		if value.IsZero() {
+			continue
+		}
+		if enc.Storage == nil {
+			enc.Storage = make(map[string]string)
+		}
+		slot, value := slot, value
+		enc.Storage[slotHex(&slot)] = slotHex(&value)
+	}
+	// encoding/json sorts the keys of maps
+	return json.Marshal(enc)
+}
+
+// Dump returns the accounts of the state as a GenesisAlloc
+func (s *State) Dump() GenesisAlloc {
+	alloc := make(GenesisAlloc, len(s.accounts))
+	for addr, account := range s.accounts {
+		storage := make(map[uint256.Int]uint256.Int)
+		for _, slot := range account.Storage.Slots() {
+			storage[slot] = *account.Storage.Get(slot)
+		}
+		alloc[addr] = GenesisAccount{
+			Balance: account.Balance.Clone(),
+			Nonce:   account.Nonce,
+			Code:    account.Code,
+			Storage: storage,
+		}
+	}
+	return alloc
+}
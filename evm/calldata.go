@@ -41,3 +41,9 @@ func NewCalldata(calldataHex string) *Calldata {
 		data: HexToBytes(calldataHex),
 	}
 }
+
+// CalldataFromBytes returns a calldata object holding data,
+// which can have any length
+func CalldataFromBytes(data []byte) *Calldata {
+	return &Calldata{data: data}
+}
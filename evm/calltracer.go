@@ -0,0 +1,175 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+)
+
+// revertSelector is the 4 byte selector of Error(string),
+// the ABI encoding solidity uses for revert reasons
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// CallFrame is the frame recorded by the CallTracer. It marshals
+// to the same JSON as geth's `callTracer`.
+type CallFrame struct {
+	Type         string      `json:"type"`
+	From         Address     `json:"from"`
+	To           Address     `json:"to"`
+	Value        string      `json:"value,omitempty"`
+	Gas          string      `json:"gas"`
+	GasUsed      string      `json:"gasUsed"`
+	Input        string      `json:"input"`
+	Output       string      `json:"output,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	RevertReason string      `json:"revertReason,omitempty"`
+	Calls        []CallFrame `json:"calls,omitempty"`
+	Logs         []CallLog   `json:"logs,omitempty"`
+
+	gas uint64
+}
+
+// CallLog is a log emitted inside a call frame. Position is
+// the number of sub calls made by the frame before the log.
+type CallLog struct {
+	Address  Address  `json:"address"`
+	Topics   []string `json:"topics"`
+	Data     string   `json:"data"`
+	Position string   `json:"position"`
+}
+
+// CallTracer is a Tracer that records the call frame of the code
+// run by Run. The interpreter has no CALL or CREATE, so the result
+// is that single frame: its calls are always empty.
+type CallTracer struct {
+	withLog   bool
+	callstack []CallFrame
+	// logs is the number of logs of the context already recorded
+	logs int
+}
+
+// NewCallTracer returns a call tracer. When withLog is set
+// the logs emitted by each frame are recorded as well.
+func NewCallTracer(withLog bool) *CallTracer {
+	return &CallTracer{withLog: withLog}
+}
+
+func (t *CallTracer) CaptureStart(ctx *ExecutionCtx) {
+	var input []byte
+	if ctx.Calldata != nil {
+		input = ctx.Calldata.data
+	}
+	t.callstack = []CallFrame{newCallFrame("CALL", ctx.Caller, ctx.Address, input, ctx.Gas, ctx.Value)}
+}
+
+func (t *CallTracer) CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64) {
+	t.captureLogs(ctx)
+}
+
+// captureLogs records the logs emitted since the last step. They
+// are taken from the context once the LOG instruction has run, the
+// tracer never reads the memory before its gas is charged.
+func (t *CallTracer) captureLogs(ctx *ExecutionCtx) {
+	if !t.withLog || len(ctx.Logs) <= t.logs {
+		return
+	}
+	frame := &t.callstack[len(t.callstack)-1]
+	for _, log := range ctx.Logs[t.logs:] {
+		topics := make([]string, 0, len(log.Topics))
+		for _, topic := range log.Topics {
+			topics = append(topics, topic.Hex())
+		}
+		frame.Logs = append(frame.Logs, CallLog{
+			Address:  log.Address,
+			Topics:   topics,
+			Data:     fmt.Sprintf("0x%x", log.Data),
+			Position: fmt.Sprintf("0x%x", len(frame.Calls)),
+		})
+	}
+	t.logs = len(ctx.Logs)
+}
+
+func (t *CallTracer) CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) {
+	t.callstack = append(t.callstack, newCallFrame(typ, from, to, input, gas, value))
+}
+
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.callstack)
+	if size <= 1 {
+		return
+	}
+	frame := t.callstack[size-1]
+	t.callstack = t.callstack[:size-1]
+	frame.processOutput(output, gasUsed, err)
+
+	parent := &t.callstack[size-2]
+	parent.Calls = append(parent.Calls, frame)
+}
+
+func (t *CallTracer) CaptureEnd(ctx *ExecutionCtx, output []byte, err error) {
+	t.captureLogs(ctx)
+	frame := &t.callstack[0]
+	frame.processOutput(output, frame.gas-ctx.Gas, err)
+}
+
+// GetResult returns the call tree as JSON
+func (t *CallTracer) GetResult() (json.RawMessage, error) {
+	if len(t.callstack) != 1 {
+		return nil, errors.New("incorrect number of top-level calls")
+	}
+	return json.Marshal(t.callstack[0])
+}
+
+func newCallFrame(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) CallFrame {
+	frame := CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    to,
+		Gas:   fmt.Sprintf("0x%x", gas),
+		Input: fmt.Sprintf("0x%x", input),
+		gas:   gas,
+	}
+	if value != nil {
+		frame.Value = value.Hex()
+	}
+	return frame
+}
+
+func (f *CallFrame) processOutput(output []byte, gasUsed uint64, err error) {
+	f.GasUsed = fmt.Sprintf("0x%x", gasUsed)
+	if len(output) > 0 {
+		f.Output = fmt.Sprintf("0x%x", output)
+	}
+	if err == nil {
+		return
+	}
+	f.Error = err.Error()
+	if errors.Is(err, ErrExecutionReverted) {
+		if reason, ok := UnpackRevert(output); ok {
+			f.RevertReason = reason
+		}
+	}
+}
+
+// UnpackRevert decodes the ABI encoded Error(string) returned
+// by a reverted execution
+func UnpackRevert(output []byte) (string, bool) {
+	if len(output) < 4+64 || !bytes.Equal(output[:4], revertSelector) {
+		return "", false
+	}
+	data := output[4:]
+	// the first word is the offset of the string, followed by its length
+	offset := new(uint256.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return "", false
+	}
+	start := offset.Uint64()
+	length := new(uint256.Int).SetBytes(data[start : start+32])
+	if !length.IsUint64() || length.Uint64() > uint64(len(data))-start-32 {
+		return "", false
+	}
+	return string(data[start+32 : start+32+length.Uint64()]), true
+}
@@ -0,0 +1,180 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeRevert(reason string) []byte {
+	out := append([]byte{}, revertSelector...)
+	offset := make([]byte, 32)
+	offset[31] = 32
+	length := make([]byte, 32)
+	length[31] = byte(len(reason))
+	data := make([]byte, 32)
+	copy(data, reason)
+	out = append(out, offset...)
+	out = append(out, length...)
+	return append(out, data...)
+}
+
+func TestCallTracer(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// store 1 in memory and revert with it
+	//
+	// 60 01
+	// 60 00
+	// 53
+	// 60 01
+	// 60 00
+	// fd
+	ectx := NewExecutionCtx(
+		HexToBytes("600160005360016000fd"),
+		NewCalldata(""),
+		NewStack(),
+		NewMemory(),
+		NewStorage(),
+		100,
+	)
+	ectx.Caller = HexToAddress("0x00000000000000000000000000000000000000aa")
+	ectx.Address = HexToAddress("0x00000000000000000000000000000000000000bb")
+	ectx.Value = uint256.NewInt(1)
+	tracer := NewCallTracer(false)
+	ectx.Tracer = tracer
+	_, err := Run(ectx)
+	assert.ErrorIs(t, err, ErrExecutionReverted)
+
+	result, err := tracer.GetResult()
+	assert.NoError(t, err)
+	var frame map[string]interface{}
+	assert.NoError(t, json.Unmarshal(result, &frame))
+	assert.Equal(t, "CALL", frame["type"])
+	assert.Equal(t, "0x00000000000000000000000000000000000000aa", frame["from"])
+	assert.Equal(t, "0x00000000000000000000000000000000000000bb", frame["to"])
+	assert.Equal(t, "0x1", frame["value"])
+	assert.Equal(t, "0x64", frame["gas"])
+	assert.Equal(t, "0xf", frame["gasUsed"])
+	assert.Equal(t, "0x", frame["input"])
+	assert.Equal(t, "0x01", frame["output"])
+	assert.Equal(t, "execution reverted", frame["error"])
+	assert.NotContains(t, frame, "calls")
+}
+
+// the interpreter never enters a frame, the hooks are called by
+// hand to check the tracer keeps to the Tracer interface
+func TestCallTracerFrameHooks(t *testing.T) {
+	a := HexToAddress("0x0a")
+	b := HexToAddress("0x0b")
+	c := HexToAddress("0x0c")
+	ectx := &ExecutionCtx{Caller: a, Address: b, Calldata: NewCalldata(""), Gas: 1000}
+
+	tracer := NewCallTracer(false)
+	tracer.CaptureStart(ectx)
+	tracer.CaptureEnter("CALL", b, c, []byte{1, 2}, 500, uint256.NewInt(0))
+	tracer.CaptureEnter("STATICCALL", c, a, nil, 200, nil)
+	tracer.CaptureExit(nil, 10, nil)
+	tracer.CaptureExit(encodeRevert("nope"), 100, ErrExecutionReverted)
+	tracer.CaptureEnter("DELEGATECALL", b, a, nil, 300, nil)
+	tracer.CaptureExit(nil, 0, errors.New("out of gas"))
+	ectx.Gas = 400
+	tracer.CaptureEnd(ectx, []byte{0xff}, nil)
+
+	result, err := tracer.GetResult()
+	assert.NoError(t, err)
+	var frame CallFrame
+	assert.NoError(t, json.Unmarshal(result, &frame))
+	assert.Equal(t, "0x258", frame.GasUsed)
+	assert.Equal(t, "0xff", frame.Output)
+	assert.Len(t, frame.Calls, 2)
+
+	call := frame.Calls[0]
+	assert.Equal(t, "CALL", call.Type)
+	assert.Equal(t, "0x0102", call.Input)
+	assert.Equal(t, "0x0", call.Value)
+	assert.Equal(t, "execution reverted", call.Error)
+	assert.Equal(t, "nope", call.RevertReason)
+	assert.Len(t, call.Calls, 1)
+	assert.Equal(t, "STATICCALL", call.Calls[0].Type)
+	assert.Equal(t, "0xa", call.Calls[0].GasUsed)
+
+	assert.Equal(t, "DELEGATECALL", frame.Calls[1].Type)
+	assert.Equal(t, "out of gas", frame.Calls[1].Error)
+}
+
+func TestCallTracerLogs(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// store 0xab at 0 and LOG1 2 bytes from 0 with topic 7
+	//
+	// 60 ab
+	// 60 00
+	// 53
+	// 60 07
+	// 60 02
+	// 60 00
+	// a1
+	ectx := NewExecutionCtx(HexToBytes("60ab600053600760026000a1"), NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 1000)
+	tracer := NewCallTracer(true)
+	ectx.Tracer = tracer
+	_, err := Run(ectx)
+	assert.NoError(t, err)
+
+	logs := tracer.callstack[0].Logs
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "0xab00", logs[0].Data)
+	assert.Equal(t, []string{"0x0000000000000000000000000000000000000000000000000000000000000007"}, logs[0].Topics)
+	assert.Equal(t, "0x0", logs[0].Position)
+}
+
+func TestCallTracerLogOutOfGas(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// LOG0 of a huge size runs out of gas before the log is read
+	//
+	// 7f ff..ff
+	// 60 00
+	// a0
+	ectx := NewExecutionCtx(HexToBytes("7f"+strings.Repeat("ff", 32)+"6000a0"), NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 10)
+	tracer := NewCallTracer(true)
+	ectx.Tracer = tracer
+	_, err := Run(ectx)
+	assert.ErrorIs(t, err, ErrOutOfGas)
+	assert.Empty(t, tracer.callstack[0].Logs)
+}
+
+func TestUnpackRevert(t *testing.T) {
+	reason, ok := UnpackRevert(encodeRevert("insufficient balance"))
+	assert.True(t, ok)
+	assert.Equal(t, "insufficient balance", reason)
+
+	_, ok = UnpackRevert([]byte{1, 2, 3})
+	assert.False(t, ok)
+
+	data := encodeRevert("denied")
+	_, ok = UnpackRevert(append([]byte{0, 0, 0, 0}, data[4:]...))
+	assert.False(t, ok)
+	// an offset that doesn't fit in 64 bits
+	data[4] = 0x01
+	_, ok = UnpackRevert(data)
+	assert.False(t, ok)
+	// a length past the end of the data
+	data = encodeRevert("denied")
+	data[4+63] = 0x61
+	_, ok = UnpackRevert(data)
+	assert.False(t, ok)
+}
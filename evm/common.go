@@ -2,9 +2,14 @@ package evm
 
 import (
 	"encoding/hex"
+	"fmt"
 	"regexp"
+	"strings"
 )
 
+// Address is the 20 byte identifier of an account
+type Address [20]byte
+
 // HexToBytes convert a hex string to a byte sequence.
 // The hex string can have spaces between bytes.
 func HexToBytes(s string) []byte {
@@ -17,3 +22,94 @@ func HexToBytes(s string) []byte {
 
 	return b[:]
 }
+
+// BytesToAddress returns the Address represented by b.
+// If b is longer than 20 bytes only the last 20 bytes are used.
+func BytesToAddress(b []byte) Address {
+	var a Address
+	if len(b) > len(a) {
+		b = b[len(b)-len(a):]
+	}
+	copy(a[len(a)-len(b):], b)
+	return a
+}
+
+// HexToAddress returns the Address represented by the
+// (optionally 0x prefixed) hex string s
+func HexToAddress(s string) Address {
+	return BytesToAddress(HexToBytes(strings.TrimPrefix(s, "0x")))
+}
+
+// Hex returns the 0x prefixed hex encoding of the address
+func (a Address) Hex() string {
+	return "0x" + hex.EncodeToString(a[:])
+}
+
+func (a Address) String() string {
+	return a.Hex()
+}
+
+// MarshalText encodes the address as hex in JSON
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+// UnmarshalText decodes a hex encoded address from JSON
+func (a *Address) UnmarshalText(input []byte) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(string(input), "0x"))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(a) {
+		return fmt.Errorf("invalid address length %d", len(b))
+	}
+	copy(a[:], b)
+	return nil
+}
+
+// Hash is a 32 byte Keccak-256 digest
+type Hash [32]byte
+
+// BytesToHash returns the Hash represented by b.
+// If b is longer than 32 bytes only the last 32 bytes are used.
+func BytesToHash(b []byte) Hash {
+	var h Hash
+	if len(b) > len(h) {
+		b = b[len(b)-len(h):]
+	}
+	copy(h[len(h)-len(b):], b)
+	return h
+}
+
+// HexToHash returns the Hash represented by the
+// (optionally 0x prefixed) hex string s
+func HexToHash(s string) Hash {
+	return BytesToHash(HexToBytes(strings.TrimPrefix(s, "0x")))
+}
+
+// Hex returns the 0x prefixed hex encoding of the hash
+func (h Hash) Hex() string {
+	return "0x" + hex.EncodeToString(h[:])
+}
+
+func (h Hash) String() string {
+	return h.Hex()
+}
+
+// MarshalText encodes the hash as hex in JSON
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// UnmarshalText decodes a hex encoded hash from JSON
+func (h *Hash) UnmarshalText(input []byte) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(string(input), "0x"))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(h) {
+		return fmt.Errorf("invalid hash length %d", len(b))
+	}
+	copy(h[:], b)
+	return nil
+}
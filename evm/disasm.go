@@ -0,0 +1,73 @@
+package evm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DisasmInstruction is a single decoded instruction of the bytecode
+type DisasmInstruction struct {
+	Pc       uint64
+	Opcode   byte
+	Mnemonic string
+	// Immediate holds the data following PUSH1-PUSH32
+	Immediate []byte
+	// Unknown is set when the opcode is not in the InstructionSet
+	Unknown bool
+	// Truncated is set when the code ends before all the
+	// bytes of a PUSH instruction could be read
+	Truncated bool
+}
+
+// Disassemble decodes the bytecode into instructions using the
+// names in the InstructionSet, so Init must be called first.
+// Like ValidJumpDestination, the data of PUSH1-PUSH32 is skipped
+// over and never decoded as an instruction.
+func Disassemble(code []byte) []DisasmInstruction {
+	insts := make([]DisasmInstruction, 0)
+	pc := uint64(0)
+	for pc < uint64(len(code)) {
+		op := code[pc]
+		disasm := DisasmInstruction{Pc: pc, Opcode: op}
+		if inst, ok := InstructionSet[op]; ok {
+			disasm.Mnemonic = inst.name
+		} else {
+			disasm.Unknown = true
+		}
+
+		pc += 1
+		if op >= 0x60 && op <= 0x7F {
+			size := uint64(op) - 0x60 + 1
+			end := pc + size
+			if end > uint64(len(code)) {
+				end = uint64(len(code))
+				disasm.Truncated = true
+			}
+			disasm.Immediate = code[pc:end]
+			pc += size
+		}
+		insts = append(insts, disasm)
+	}
+	return insts
+}
+
+// String formats the instruction as `0000: PUSH1 0x06`
+func (i DisasmInstruction) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%04x: ", i.Pc)
+	if i.Unknown {
+		fmt.Fprintf(&sb, "UNKNOWN 0x%02x", i.Opcode)
+	} else {
+		sb.WriteString(i.Mnemonic)
+	}
+	if i.Immediate != nil {
+		fmt.Fprintf(&sb, " 0x%x", i.Immediate)
+	}
+	if i.Opcode == 0x5B {
+		sb.WriteString(" <- jumpdest")
+	}
+	if i.Truncated {
+		fmt.Fprintf(&sb, " (truncated, %d of %d bytes)", len(i.Immediate), i.Opcode-0x60+1)
+	}
+	return sb.String()
+}
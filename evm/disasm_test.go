@@ -0,0 +1,42 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	insts := Disassemble(HexToBytes("6006 5b 61 0102 0c 62 03"))
+	assert.Equal(t, []DisasmInstruction{
+		{Pc: 0, Opcode: 0x60, Mnemonic: "PUSH1", Immediate: []byte{0x06}},
+		{Pc: 2, Opcode: 0x5B, Mnemonic: "JUMPDEST"},
+		{Pc: 3, Opcode: 0x61, Mnemonic: "PUSH2", Immediate: []byte{0x01, 0x02}},
+		{Pc: 6, Opcode: 0x0c, Unknown: true},
+		{Pc: 7, Opcode: 0x62, Mnemonic: "PUSH3", Immediate: []byte{0x03}, Truncated: true},
+	}, insts)
+
+	assert.Equal(t, "0000: PUSH1 0x06", insts[0].String())
+	assert.Equal(t, "0002: JUMPDEST <- jumpdest", insts[1].String())
+	assert.Equal(t, "0003: PUSH2 0x0102", insts[2].String())
+	assert.Equal(t, "0006: UNKNOWN 0x0c", insts[3].String())
+	assert.Equal(t, "0007: PUSH3 0x03 (truncated, 1 of 3 bytes)", insts[4].String())
+}
+
+func TestDisassembleEmptyPush(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// PUSH1 as the very last byte has no data at all
+	insts := Disassemble([]byte{0x60})
+	assert.Len(t, insts, 1)
+	assert.True(t, insts[0].Truncated)
+	assert.Equal(t, "0000: PUSH1 0x (truncated, 0 of 1 bytes)", insts[0].String())
+}
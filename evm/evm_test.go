@@ -81,7 +81,7 @@ func TestRunSuccess(t *testing.T) {
 			// 60 00
 			// 54
 			code: HexToBytes("6001600055600054"),
-			gas:  60, // should go out of gas
+			gas:  20110,
 			expected: expected{
 				stack:      []*uint256.Int{uint256.NewInt(1)},
 				memory:     []byte{},
@@ -262,3 +262,12 @@ func TestHexToBytes(t *testing.T) {
 	)
 
 }
+
+func TestHexToAddress(t *testing.T) {
+	addr := HexToAddress("0x00000000000000000000000000000000000000ff")
+	assert.Equal(t, byte(0xff), addr[19])
+	assert.Equal(t, "0x00000000000000000000000000000000000000ff", addr.Hex())
+
+	// short inputs are left padded
+	assert.Equal(t, addr, HexToAddress("ff"))
+}
@@ -3,19 +3,53 @@ package evm
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
+
+	"github.com/holiman/uint256"
+)
+
+var (
+	// ErrOutOfGas is returned when the gas is exhausted
+	ErrOutOfGas = errors.New("out of gas")
+	// ErrExecutionReverted is returned by Run when the code
+	// halts with the REVERT instruction
+	ErrExecutionReverted = errors.New("execution reverted")
 )
 
+// DebugOutput receives the messages the interpreter prints
+// while it executes. Set it to io.Discard to silence them.
+var DebugOutput io.Writer = os.Stdout
+
 type ExecutionCtx struct {
 	code       []byte
 	pc         uint64
+	Caller     Address
+	Address    Address
+	Value      *uint256.Int
 	Stack      *Stack
 	Memory     *Memory
 	Storage    *Storage
 	Calldata   *Calldata
 	Returndata []byte
+	Logs       []*Log
 	Jumpdests  map[uint64]uint64
 	Gas        uint64
-	Stopped    bool
+	// Refund is the gas refunded to the sender at the end of the
+	// transaction, capped by the state transition
+	Refund   uint64
+	Stopped  bool
+	Reverted bool
+	Tracer   Tracer
+	// State is read by BALANCE and EXTCODE*, without one the other
+	// accounts are empty
+	State *State
+	// Accessed is the access set of the transaction, without one
+	// all the accesses are warm
+	Accessed *AccessSet
+	// originals are the values of the slots before their first
+	// SSTORE, the execution is the whole transaction
+	originals map[uint256.Int]*uint256.Int
 }
 
 func NewExecutionCtx(code []byte, calldata *Calldata, stack *Stack, memory *Memory, storage *Storage, gas uint64) *ExecutionCtx {
@@ -36,7 +70,7 @@ func NewExecutionCtx(code []byte, calldata *Calldata, stack *Stack, memory *Memo
 // decodeOpcode decodes the bytecode @ PC using
 // the InstructionSet
 func decodeOpcode(ctx *ExecutionCtx) Instruction {
-	fmt.Println("decoding opcode")
+	fmt.Fprintln(DebugOutput, "decoding opcode")
 	// Yellow paper section 9.4.1 (Machine State)
 	if ctx.pc >= uint64(len(ctx.code)) {
 		inst, ok := InstructionSet[0]
@@ -47,7 +81,7 @@ func decodeOpcode(ctx *ExecutionCtx) Instruction {
 	}
 
 	opcode := ctx.ReadCode(1)
-	fmt.Println("finding instruction for opcode", opcode)
+	fmt.Fprintln(DebugOutput, "finding instruction for opcode", opcode)
 	inst, ok := InstructionSet[opcode]
 	if !ok {
 		panic(fmt.Errorf("inst not found for opcode %d", opcode))
@@ -73,26 +107,56 @@ func (ectx *ExecutionCtx) UseGas(gas uint64) bool {
 func Run(ectx *ExecutionCtx) ([]byte, error) {
 
 	ectx.ValidJumpDestination()
-	fmt.Printf("set valid jump destination %v \n", ectx.Jumpdests)
+	fmt.Fprintf(DebugOutput, "set valid jump destination %v \n", ectx.Jumpdests)
+
+	if ectx.Tracer != nil {
+		ectx.Tracer.CaptureStart(ectx)
+	}
 
 	for !ectx.Stopped {
-		pcBefore := ectx.pc
-		inst := decodeOpcode(ectx)
-
-		// deduct gas from the budget before executing
-		if ok := ectx.UseGas(inst.constantGas); !ok {
-			// without gas we can't proceed
-			ectx.Stopped = true
-			return nil, errors.New("out of gas")
+		if err := Step(ectx); err != nil {
+			if ectx.Tracer != nil {
+				ectx.Tracer.CaptureEnd(ectx, nil, err)
+			}
+			return nil, err
 		}
+	}
+
+	var err error
+	if ectx.Reverted {
+		err = ErrExecutionReverted
+	}
+	if ectx.Tracer != nil {
+		ectx.Tracer.CaptureEnd(ectx, ectx.Returndata, err)
+	}
+	return ectx.Returndata, err
+}
 
-		// todo: use dynamic gas
+// Step executes the instruction at pc. ValidJumpDestination must
+// have been called on the context before the first step.
+func Step(ectx *ExecutionCtx) error {
+	pcBefore := ectx.pc
+	inst := decodeOpcode(ectx)
 
-		inst.executeFn(ectx)
-		fmt.Printf("%s @ pc=%d\n", inst.name, pcBefore)
+	cost := inst.constantGas
+	extra, ok := dynamicGas(ectx, inst.opcode)
+	if ok {
+		cost += extra
+	}
+	if ectx.Tracer != nil {
+		ectx.Tracer.CaptureState(ectx, pcBefore, inst.opcode, ectx.Gas, cost)
 	}
 
-	return ectx.Returndata, nil
+	// deduct gas from the budget before executing
+	if !ok || !ectx.UseGas(cost) {
+		// without gas we can't proceed
+		ectx.Gas, ectx.Stopped = 0, true
+		return ErrOutOfGas
+	}
+
+	inst.executeFn(ectx)
+	fmt.Fprintf(DebugOutput, "%s @ pc=%d\n", inst.name, pcBefore)
+	return nil
 }
 
 // Stop stops the execution of the bytecode in the VM
@@ -131,7 +195,7 @@ func (ctx *ExecutionCtx) ValidJumpDestination() {
 func (ctx *ExecutionCtx) ReadCode(numBytes uint64) byte {
 	codeSegment := ctx.code[ctx.pc : ctx.pc+numBytes]
 	codeHex := fmt.Sprintf("0x%x", ctx.code)
-	fmt.Printf("reading code: %s, bytes: %d, segment: %s\n", codeHex, numBytes, codeSegment)
+	fmt.Fprintf(DebugOutput, "reading code: %s, bytes: %d, segment: %s\n", codeHex, numBytes, codeSegment)
 	ctx.pc += numBytes
 	return codeSegment[0]
 
@@ -145,6 +209,23 @@ func (ctx *ExecutionCtx) SetReturnData(offset, length uint64) {
 	ctx.Stopped = true
 }
 
+// Revert sets the return data like SetReturnData but
+// marks the execution as reverted
+func (ctx *ExecutionCtx) Revert(offset, length uint64) {
+	ctx.SetReturnData(offset, length)
+	ctx.Reverted = true
+}
+
+// PC returns the program counter
+func (ctx *ExecutionCtx) PC() uint64 {
+	return ctx.pc
+}
+
+// Code returns the bytecode being executed
+func (ctx *ExecutionCtx) Code() []byte {
+	return ctx.code
+}
+
 // SetProgramCounter sets the PC in the execution context
 func (ctx *ExecutionCtx) SetProgramCounter(pc uint64) {
 	ctx.pc = pc
@@ -0,0 +1,51 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/holiman/uint256"
+)
+
+// FourByteTracer counts the 4 byte selectors of the calls with the
+// size of their arguments. It marshals to the same JSON as geth's
+// `4byteTracer`: "0x<selector>-<size>" mapped to the count.
+type FourByteTracer struct {
+	ids map[string]int
+}
+
+func NewFourByteTracer() *FourByteTracer {
+	return &FourByteTracer{ids: make(map[string]int)}
+}
+
+func (t *FourByteTracer) store(input []byte) {
+	if len(input) < 4 {
+		return
+	}
+	t.ids[fmt.Sprintf("0x%x-%d", input[:4], len(input)-4)]++
+}
+
+func (t *FourByteTracer) CaptureStart(ctx *ExecutionCtx) {
+	if ctx.Calldata != nil {
+		t.store(ctx.Calldata.data)
+	}
+}
+
+func (t *FourByteTracer) CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64) {}
+
+func (t *FourByteTracer) CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) {
+	// the input of a creation is code
+	if typ == "CREATE" || typ == "CREATE2" {
+		return
+	}
+	t.store(input)
+}
+
+func (t *FourByteTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *FourByteTracer) CaptureEnd(ctx *ExecutionCtx, output []byte, err error) {}
+
+// GetResult returns the counts of the selectors as JSON
+func (t *FourByteTracer) GetResult() (json.RawMessage, error) {
+	return json.Marshal(t.ids)
+}
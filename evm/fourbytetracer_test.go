@@ -0,0 +1,30 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFourByteTracer(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	tracer := NewFourByteTracer()
+	ectx := NewExecutionCtx(HexToBytes("00"), CalldataFromBytes(HexToBytes("a9059cbb"+"0000000000000000000000000000000000000000000000000000000000000001")), NewStack(), NewMemory(), NewStorage(), 100)
+	ectx.Tracer = tracer
+	_, err := Run(ectx)
+	assert.NoError(t, err)
+
+	to := HexToAddress("0x01")
+	tracer.CaptureEnter("CALL", to, to, HexToBytes("a9059cbb"+"0000000000000000000000000000000000000000000000000000000000000002"), 0, nil)
+	tracer.CaptureEnter("STATICCALL", to, to, HexToBytes("70a08231"), 0, nil)
+	tracer.CaptureEnter("CREATE", to, to, HexToBytes("6080604052"), 0, nil)
+	tracer.CaptureEnter("CALL", to, to, HexToBytes("0102"), 0, nil)
+
+	result, err := tracer.GetResult()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"0xa9059cbb-32":2,"0x70a08231-0":1}`, string(result))
+}
@@ -0,0 +1,91 @@
+package evm
+
+import "github.com/holiman/uint256"
+
+// see geth: params/protocol_params.go
+// Gas costs of the memory and of the copies
+const (
+	MemoryGas    uint64 = 3
+	QuadCoeffDiv uint64 = 512
+	CopyGas      uint64 = 3
+)
+
+// maxMemorySize bounds the memory an instruction may expand to, the
+// cost of a larger memory doesn't fit a uint64
+const maxMemorySize = 0x1FFFFFFFE0
+
+// dynamicGas returns the gas the instruction pays on top of its
+// constant gas. It reports false when the instruction can't be paid
+// for, because the gas doesn't fit a uint64 or SSTORE is left with
+// too little gas, it runs out of gas then.
+func dynamicGas(ctx *ExecutionCtx, op byte) (uint64, bool) {
+	switch op {
+	case 0x54, 0x31, 0x3b, 0x3f: // SLOAD, BALANCE, EXTCODESIZE, EXTCODEHASH
+		return accessGas(ctx, op), true
+	case 0x55: // SSTORE
+		if ctx.Stack.Len() < 2 {
+			return 0, true
+		}
+		if ctx.Gas <= SstoreSentryGas {
+			return 0, false
+		}
+		return sstoreGas(ctx) + accessGas(ctx, op), true
+	case 0x39: // CODECOPY
+		if ctx.Stack.Len() < 3 {
+			// the instruction fails when it runs
+			return 0, true
+		}
+		return copyGas(ctx, ctx.Stack.Peek(0), ctx.Stack.Peek(2))
+	case 0x3c: // EXTCODECOPY
+		if ctx.Stack.Len() < 4 {
+			return 0, true
+		}
+		gas, ok := copyGas(ctx, ctx.Stack.Peek(1), ctx.Stack.Peek(3))
+		if !ok {
+			return 0, false
+		}
+		return gas + accessGas(ctx, op), true
+	}
+	return 0, true
+}
+
+// copyGas returns the gas of copying size bytes to the memory at
+// offset: the words copied and the expansion of the memory. It is
+// charged before the copy allocates anything.
+func copyGas(ctx *ExecutionCtx, offset, size *uint256.Int) (uint64, bool) {
+	if size.IsZero() {
+		return 0, true
+	}
+	expansion, ok := memoryExpansionGas(ctx.Memory, offset, size)
+	if !ok {
+		return 0, false
+	}
+	return CopyGas*toWords(size.Uint64()) + expansion, true
+}
+
+// memoryExpansionGas returns the cost of expanding the memory to
+// hold size bytes at offset, zero if it is large enough. Only the
+// copies pay for the memory, the other instructions expand it for
+// free.
+func memoryExpansionGas(mem *Memory, offset, size *uint256.Int) (uint64, bool) {
+	end, overflow := new(uint256.Int).AddOverflow(offset, size)
+	if overflow || !end.IsUint64() || end.Uint64() > maxMemorySize {
+		return 0, false
+	}
+	words, active := toWords(end.Uint64()), mem.ActiveWords()
+	if words <= active {
+		return 0, true
+	}
+	return memoryGas(words) - memoryGas(active), true
+}
+
+// memoryGas is the cost of a memory of the given words, linear
+// then quadratic
+func memoryGas(words uint64) uint64 {
+	return words*MemoryGas + words*words/QuadCoeffDiv
+}
+
+// toWords returns the number of words holding size bytes
+func toWords(size uint64) uint64 {
+	return (size + 31) / 32
+}
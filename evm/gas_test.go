@@ -0,0 +1,88 @@
+package evm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyGas(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	run := func(code string, gas uint64) (*ExecutionCtx, error) {
+		ectx := NewExecutionCtx(HexToBytes(code), NewCalldata(""), NewStack(), NewMemory(), NewStorage(), gas)
+		_, err := Run(ectx)
+		return ectx, err
+	}
+
+	// copy 3 bytes of the code to the memory at 4
+	//
+	// 60 03
+	// 60 01
+	// 60 04
+	// 39
+	// 00
+	ectx, err := run("600360016004390000", 100)
+	assert.NoError(t, err)
+	// a word copied and a word of memory
+	assert.Equal(t, uint64(100-3*3-GasFastestStep-CopyGas-MemoryGas), ectx.Gas)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0x03, 0x60, 0x01}, ectx.Memory.Data()[:7])
+
+	// the memory already expanded is not paid again
+	//
+	// 60 01
+	// 60 40
+	// 53
+	// 60 20
+	// 60 00
+	// 60 00
+	// 39
+	ectx, err = run("60016040536020600060003900", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100-6*3-GasFastestStep-CopyGas), ectx.Gas)
+
+	// sizes too large to allocate run out of gas
+	for _, size := range []string{
+		"7f" + strings.Repeat("ff", 32), // PUSH32 2^256-1
+		"65010000000000",                // PUSH6 2^40
+		"671000000000000000",            // PUSH8 2^60
+		"6340000000",                    // PUSH4 2^30, within the limit
+	} {
+		ectx, err := run(size+"6000600039", 1000000)
+		assert.ErrorIs(t, err, ErrOutOfGas, size)
+		assert.Equal(t, uint64(0), ectx.Gas)
+		assert.Empty(t, ectx.Memory.Data())
+
+		// EXTCODECOPY of the code of 0x00
+		ectx, err = run(size+"6000600060003c", 1000000)
+		assert.ErrorIs(t, err, ErrOutOfGas, size)
+		assert.Empty(t, ectx.Memory.Data())
+	}
+
+	// an offset past the memory limit too
+	//
+	// 60 01
+	// 60 00
+	// 64 ffffffffff
+	// 39
+	_, err = run("6001600064ffffffffff39", 1000000)
+	assert.ErrorIs(t, err, ErrOutOfGas)
+
+	// nothing is copied for a zero size
+	ectx, err = run("60006000"+"7f"+strings.Repeat("ff", 32)+"39", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100-3*3-GasFastestStep), ectx.Gas)
+}
+
+func TestMemoryGas(t *testing.T) {
+	assert.Equal(t, uint64(0), memoryGas(0))
+	assert.Equal(t, uint64(3), memoryGas(1))
+	// the quadratic part starts at 23 words
+	assert.Equal(t, uint64(22*3), memoryGas(22))
+	assert.Equal(t, uint64(23*3+1), memoryGas(23))
+	assert.Equal(t, uint64(1024*3+2048), memoryGas(1024))
+}
@@ -0,0 +1,221 @@
+package evm
+
+import "github.com/holiman/uint256"
+
+type memoryWrite struct {
+	offset uint64
+	old    []byte
+}
+
+type storageWrite struct {
+	slot    uint256.Int
+	old     uint256.Int
+	existed bool
+}
+
+// accessAdd is an address, or a slot of it, warmed by a step
+type accessAdd struct {
+	addr Address
+	slot *Hash
+}
+
+// stepDelta holds what is needed to undo one instruction: the
+// state before it and the values it overwrote
+type stepDelta struct {
+	pc         uint64
+	gas        uint64
+	refund     uint64
+	stopped    bool
+	reverted   bool
+	returndata []byte
+	logs       int
+	// the stack below stackBase is untouched by the step,
+	// stack holds the elements it had from stackBase up
+	stackBase int
+	stack     []uint256.Int
+	memSize   int
+	memory    []memoryWrite
+	storage   []storageWrite
+	accessed  []accessAdd
+	// originals is the number of slots whose original value was
+	// recorded before the step
+	originals int
+}
+
+// stackEdit is a stack item set between two steps
+type stackEdit struct {
+	// step is the number of steps recorded before the edit
+	step  int
+	index uint16
+	old   uint256.Int
+}
+
+// History executes the code one instruction at a time and
+// records a delta of every step, so the execution can be
+// rewound without running it again from the start.
+type History struct {
+	ctx     *ExecutionCtx
+	steps   []stepDelta
+	current *stepDelta
+	edits   []stackEdit
+}
+
+// NewHistory records the steps executed on ctx through Step.
+// ValidJumpDestination must have been called on ctx.
+func NewHistory(ctx *ExecutionCtx) *History {
+	h := &History{ctx: ctx}
+	ctx.Memory.onWrite = func(offset uint64, old []byte) {
+		if h.current != nil {
+			h.current.memory = append(h.current.memory, memoryWrite{offset, old})
+		}
+	}
+	ctx.Storage.onWrite = func(slot uint256.Int, old *uint256.Int, existed bool) {
+		if h.current != nil {
+			w := storageWrite{slot: slot, existed: existed}
+			if existed {
+				w.old = *old
+			}
+			h.current.storage = append(h.current.storage, w)
+		}
+	}
+	if ctx.Accessed != nil {
+		ctx.Accessed.onAdd = func(addr Address, slot *Hash) {
+			if h.current != nil {
+				h.current.accessed = append(h.current.accessed, accessAdd{addr, slot})
+			}
+		}
+	}
+	return h
+}
+
+// Len returns the number of recorded steps
+func (h *History) Len() int {
+	return len(h.steps)
+}
+
+// Step executes the next instruction and records its delta. The
+// delta is recorded even when the instruction panics.
+func (h *History) Step() error {
+	ctx := h.ctx
+	delta := stepDelta{
+		pc:         ctx.pc,
+		gas:        ctx.Gas,
+		refund:     ctx.Refund,
+		stopped:    ctx.Stopped,
+		reverted:   ctx.Reverted,
+		returndata: ctx.Returndata,
+		logs:       len(ctx.Logs),
+		memSize:    len(ctx.Memory.data),
+		originals:  len(ctx.originals),
+	}
+	before := make([]uint256.Int, len(ctx.Stack.data))
+	for i, item := range ctx.Stack.data {
+		before[i] = *item
+	}
+
+	h.current = &delta
+	defer func() {
+		h.current = nil
+		// only keep the part of the stack the step changed
+		after := ctx.Stack.data
+		base := 0
+		for base < len(before) && base < len(after) && before[base].Eq(after[base]) {
+			base++
+		}
+		delta.stackBase = base
+		delta.stack = before[base:]
+		h.steps = append(h.steps, delta)
+	}()
+	return Step(ctx)
+}
+
+// SetStack replaces the i-th item of the stack from the top. The
+// edit is recorded, going back over the last step undoes the edits
+// made after it too.
+func (h *History) SetStack(i uint16, value *uint256.Int) {
+	h.edits = append(h.edits, stackEdit{len(h.steps), i, *h.ctx.Stack.Peek(i)})
+	h.ctx.Stack.Set(i, value)
+}
+
+// Back undoes the last recorded step. It returns false
+// when there is nothing left to undo.
+func (h *History) Back() bool {
+	if len(h.steps) == 0 {
+		return false
+	}
+	ctx := h.ctx
+	for len(h.edits) > 0 && h.edits[len(h.edits)-1].step == len(h.steps) {
+		e := h.edits[len(h.edits)-1]
+		h.edits = h.edits[:len(h.edits)-1]
+		ctx.Stack.Set(e.index, &e.old)
+	}
+	delta := h.steps[len(h.steps)-1]
+	h.steps = h.steps[:len(h.steps)-1]
+
+	ctx.pc = delta.pc
+	ctx.Gas = delta.gas
+	ctx.Refund = delta.refund
+	ctx.Stopped = delta.stopped
+	ctx.Reverted = delta.reverted
+	ctx.Returndata = delta.returndata
+	ctx.Logs = ctx.Logs[:delta.logs]
+
+	// undo the writes newest first, a step may write the same
+	// location more than once
+	for i := len(delta.storage) - 1; i >= 0; i-- {
+		w := delta.storage[i]
+		if w.existed {
+			old := w.old
+			ctx.Storage.data[w.slot] = &old
+		} else {
+			delete(ctx.Storage.data, w.slot)
+		}
+	}
+	// the original of the slot the step wrote first
+	if len(ctx.originals) > delta.originals {
+		for _, w := range delta.storage {
+			delete(ctx.originals, w.slot)
+		}
+	}
+	for _, a := range delta.accessed {
+		ctx.Accessed.remove(a.addr, a.slot)
+	}
+	for i := len(delta.memory) - 1; i >= 0; i-- {
+		w := delta.memory[i]
+		copy(ctx.Memory.data[w.offset:], w.old)
+	}
+	ctx.Memory.data = ctx.Memory.data[:delta.memSize]
+
+	ctx.Stack.data = ctx.Stack.data[:delta.stackBase]
+	for i := range delta.stack {
+		item := delta.stack[i]
+		ctx.Stack.data = append(ctx.Stack.data, &item)
+	}
+	return true
+}
+
+// LastStorageWrite returns the step number (starting at 1) and
+// the pc of the last recorded instruction that wrote the slot
+func (h *History) LastStorageWrite(slot uint256.Int) (step int, pc uint64, ok bool) {
+	for i := len(h.steps) - 1; i >= 0; i-- {
+		for _, w := range h.steps[i].storage {
+			if w.slot.Eq(&slot) {
+				return i + 1, h.steps[i].pc, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// LastMemoryWrite returns the step number (starting at 1) and the
+// pc of the last recorded instruction that wrote the memory byte
+func (h *History) LastMemoryWrite(offset uint64) (step int, pc uint64, ok bool) {
+	for i := len(h.steps) - 1; i >= 0; i-- {
+		for _, w := range h.steps[i].memory {
+			if offset >= w.offset && offset < w.offset+uint64(len(w.old)) {
+				return i + 1, h.steps[i].pc, true
+			}
+		}
+	}
+	return 0, 0, false
+}
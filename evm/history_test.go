@@ -0,0 +1,116 @@
+package evm
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshot captures the state of the context as a string
+func snapshot(ctx *ExecutionCtx) string {
+	originals := make(map[string]string)
+	for slot, value := range ctx.originals {
+		originals[slot.Hex()] = value.Hex()
+	}
+	return fmt.Sprintf("pc=%d gas=%d refund=%d stopped=%v %s %x %s ret=%x originals=%v accessed=%v %v",
+		ctx.pc, ctx.Gas, ctx.Refund, ctx.Stopped, ctx.Stack, ctx.Memory.data, ctx.Storage, ctx.Returndata,
+		originals, ctx.Accessed.addresses, ctx.Accessed.slots)
+}
+
+func TestHistoryBack(t *testing.T) {
+	Init()
+	DebugOutput = io.Discard
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	var tests = []string{
+		// calculate 4^2 in a loop and return it
+		"60048060005b8160125760005360016000f35b8201906001900390600556",
+		// overwrite slot 0 twice, MSTORE a word, then MSTORE8 in it
+		"6001600055600260005560ff6001526002600053600054",
+		// clear slot 0 and write it again, then warm slot 1 and
+		// an address
+		"6000600055600160005560015460103100",
+	}
+	for _, code := range tests {
+		t.Run(code, func(t *testing.T) {
+			storage := NewStorage()
+			storage.Put(uint256.NewInt(0), uint256.NewInt(7))
+			ctx := NewExecutionCtx(HexToBytes(code), NewCalldata(""), NewStack(), NewMemory(), storage, 100000)
+			ctx.ValidJumpDestination()
+			ctx.Accessed = NewAccessSet()
+			history := NewHistory(ctx)
+
+			snapshots := []string{snapshot(ctx)}
+			for !ctx.Stopped {
+				assert.NoError(t, history.Step())
+				snapshots = append(snapshots, snapshot(ctx))
+			}
+			assert.Equal(t, len(snapshots)-1, history.Len())
+
+			for i := len(snapshots) - 2; i >= 0; i-- {
+				assert.True(t, history.Back())
+				assert.Equal(t, snapshots[i], snapshot(ctx))
+			}
+			assert.False(t, history.Back())
+		})
+	}
+}
+
+func TestHistoryLastWrite(t *testing.T) {
+	Init()
+	DebugOutput = io.Discard
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// 1: PUSH1 1, 2: PUSH1 0, 3: SSTORE, 4: PUSH1 0xff, 5: PUSH1 1,
+	// 6: MSTORE, 7: PUSH1 2, 8: PUSH1 0, 9: MSTORE8
+	code := HexToBytes("600160005560ff600152600260005300")
+	ctx := NewExecutionCtx(code, NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 100000)
+	ctx.ValidJumpDestination()
+	history := NewHistory(ctx)
+	for !ctx.Stopped {
+		assert.NoError(t, history.Step())
+	}
+
+	step, pc, ok := history.LastStorageWrite(*uint256.NewInt(0))
+	assert.True(t, ok)
+	assert.Equal(t, 3, step)
+	assert.Equal(t, uint64(4), pc)
+	_, _, ok = history.LastStorageWrite(*uint256.NewInt(1))
+	assert.False(t, ok)
+
+	step, _, ok = history.LastMemoryWrite(0)
+	assert.True(t, ok)
+	assert.Equal(t, 9, step)
+	step, pc, ok = history.LastMemoryWrite(32)
+	assert.True(t, ok)
+	assert.Equal(t, 6, step)
+	assert.Equal(t, uint64(9), pc)
+	_, _, ok = history.LastMemoryWrite(33)
+	assert.False(t, ok)
+
+	// an edit of the stack is undone with the step before it,
+	// even below what the step pushed
+	for history.Len() > 8 {
+		history.Back()
+	}
+	history.SetStack(1, uint256.NewInt(9))
+	history.SetStack(1, uint256.NewInt(10))
+	assert.True(t, history.Back())
+	assert.Equal(t, 1, ctx.Stack.Len())
+	assert.Equal(t, uint256.NewInt(2), ctx.Stack.Peek(0))
+
+	// undoing the SSTORE removes the slot again
+	for history.Len() > 2 {
+		history.Back()
+	}
+	assert.Equal(t, "storage: \n", ctx.Storage.String())
+	_, _, ok = history.LastStorageWrite(*uint256.NewInt(0))
+	assert.False(t, ok)
+}
@@ -13,11 +13,17 @@ type Instruction struct {
 	name        string
 	executeFn   ExecuteFn
 	constantGas uint64
-	// todo: dynamicGas
+	// the gas depending on the operands is added by dynamicGas
 }
 
 var InstructionSet map[byte]Instruction
 
+// Name returns the mnemonic of the instruction
+func (i Instruction) Name() string { return i.name }
+
+// Opcode returns the byte encoding the instruction
+func (i Instruction) Opcode() byte { return i.opcode }
+
 // see geth: core/vm/gas.go
 // Gas costs
 const (
@@ -39,14 +45,15 @@ func Init() {
 		0x08: {0x08, "ADDMOD", opAddMod, GasMidStep},
 		0x09: {0x09, "MULMOD", opMulMod, GasMidStep},
 		0x06: {0x06, "MOD", opMod, GasFastStep},
-		0x60: {0x60, "PUSH1", opPush1, GasFastestStep},
+		0x60: {0x60, "PUSH1", makePush(1), GasFastestStep},
 		0xF3: {0xF3, "RETURN", opReturn, 0},
+		0xFD: {0xFD, "REVERT", opRevert, 0},
 		0x56: {0x56, "JUMP", opJump, GasMidStep},
 		0x57: {0x57, "JUMPI", opJumpi, GasSlowStep},
 		0x51: {0x51, "MLOAD", opMload, GasFastestStep},
 		0x52: {0x52, "MSTORE", opMstore, GasFastestStep},
 		0x53: {0x53, "MSTORE8", opMstore8, GasFastestStep},
-		0x54: {0x54, "SLOAD", opSload, 50},
+		0x54: {0x54, "SLOAD", opSload, WarmStorageReadCost},
 		0x55: {0x55, "SSTORE", opSstore, 0},
 		0x58: {0x58, "PC", opProgramCounter, GasQuickStep},
 		0x59: {0x59, "MSIZE", opMsize, GasQuickStep},
@@ -59,14 +66,39 @@ func Init() {
 		0x35: {0x35, "CALLDATALOAD", opCalldataLoad, GasFastestStep},
 		0x36: {0x36, "CALLDATASIZE", opCalldataSize, GasQuickStep},
 		0x38: {0x38, "CODESIZE", opCodeSize, GasQuickStep},
+		0x39: {0x39, "CODECOPY", opCodeCopy, GasFastestStep},
+		0x31: {0x31, "BALANCE", opBalance, WarmStorageReadCost},
+		0x3b: {0x3b, "EXTCODESIZE", opExtCodeSize, WarmStorageReadCost},
+		0x3c: {0x3c, "EXTCODECOPY", opExtCodeCopy, WarmStorageReadCost},
+		0x3f: {0x3f, "EXTCODEHASH", opExtCodeHash, WarmStorageReadCost},
+	}
+
+	// PUSH2-PUSH32
+	for size := 2; size <= 32; size++ {
+		opcode := byte(0x60 + size - 1)
+		InstructionSet[opcode] = Instruction{opcode, fmt.Sprintf("PUSH%d", size), makePush(uint64(size)), GasFastestStep}
 	}
 
+	// LOG0-LOG4
+	for topics := 0; topics <= 4; topics++ {
+		opcode := byte(0xA0 + topics)
+		InstructionSet[opcode] = Instruction{opcode, fmt.Sprintf("LOG%d", topics), makeLog(topics), logGas(topics)}
+	}
 }
 
 func opStop(ctx *ExecutionCtx) { ctx.Stop() }
 
-func opPush1(ctx *ExecutionCtx) {
-	ctx.Stack.Push(uint256.NewInt(uint64(ctx.ReadCode(1))))
+// makePush returns the execute function of PUSH1-PUSH32. Bytes
+// past the end of the code are read as zeros.
+func makePush(size uint64) ExecuteFn {
+	return func(ctx *ExecutionCtx) {
+		data := make([]byte, size)
+		if ctx.pc < uint64(len(ctx.code)) {
+			copy(data, ctx.code[ctx.pc:])
+		}
+		ctx.pc += size
+		ctx.Stack.Push(uint256.NewInt(0).SetBytes(data))
+	}
 }
 
 func opAdd(ctx *ExecutionCtx) {
@@ -124,9 +156,14 @@ func opReturn(ctx *ExecutionCtx) {
 	ctx.SetReturnData(op1.Uint64(), op2.Uint64())
 }
 
+func opRevert(ctx *ExecutionCtx) {
+	op1, op2 := ctx.Stack.Pop(), ctx.Stack.Pop()
+	ctx.Revert(op1.Uint64(), op2.Uint64())
+}
+
 func opJump(ctx *ExecutionCtx) {
 	pc := ctx.Stack.Pop().Uint64()
-	fmt.Printf("valid jump dests: %v\n", ctx.Jumpdests)
+	fmt.Fprintf(DebugOutput, "valid jump dests: %v\n", ctx.Jumpdests)
 	if _, ok := ctx.Jumpdests[pc]; !ok {
 		panic(fmt.Errorf("invalid jump destination %d", pc))
 	}
@@ -167,11 +204,93 @@ func opSload(ctx *ExecutionCtx) {
 	ctx.Stack.Push(value)
 }
 
+// see geth: params/protocol_params.go
+// Gas costs of SSTORE (EIP-2200, EIP-2929)
+const (
+	// SstoreSentryGas is the gas SSTORE needs to be left with
+	SstoreSentryGas uint64 = 2300
+	// SstoreSetGas is paid to set a clean zero slot
+	SstoreSetGas uint64 = 20000
+	// SstoreResetGas is paid to change a clean nonzero slot, the
+	// cold cost is charged apart
+	SstoreResetGas uint64 = 5000 - ColdSloadCost
+)
+
+// sstoreClearsRefund is refunded for clearing a slot (EIP-3529)
+const sstoreClearsRefund = 4800
+
+// sstoreGas returns the warm gas of SSTORE (EIP-2200): setting or
+// changing a slot that still holds its original value is paid in
+// full, the other writes cost a warm read
+func sstoreGas(ctx *ExecutionCtx) uint64 {
+	slot, value := ctx.Stack.Peek(0), ctx.Stack.Peek(1)
+	current, original := ctx.Storage.Get(*slot), ctx.original(*slot)
+	switch {
+	case current.Eq(value), !original.Eq(current):
+		// a no-op, or a slot already written by the transaction
+		return WarmStorageReadCost
+	case original.IsZero():
+		return SstoreSetGas
+	default:
+		return SstoreResetGas
+	}
+}
+
+// original returns the value of the slot at the start of the
+// execution
+func (ctx *ExecutionCtx) original(slot uint256.Int) *uint256.Int {
+	if value, ok := ctx.originals[slot]; ok {
+		return value
+	}
+	return ctx.Storage.Get(slot)
+}
+
 func opSstore(ctx *ExecutionCtx) {
 	slot, value := ctx.Stack.Pop(), ctx.Stack.Pop()
+	current, original := ctx.Storage.Get(*slot), ctx.original(*slot)
+	// the first write of the slot keeps its original value
+	if _, ok := ctx.originals[*slot]; !ok {
+		if ctx.originals == nil {
+			ctx.originals = make(map[uint256.Int]*uint256.Int)
+		}
+		ctx.originals[*slot] = original.Clone()
+	}
+	if !current.Eq(value) {
+		sstoreRefund(ctx, original, current, value)
+	}
 	ctx.Storage.Put(slot, value)
 }
 
+// sstoreRefund updates the refund of a write changing the slot (net
+// gas metering, EIP-2200 with the amounts of EIP-3529): clearing a
+// slot that was nonzero at the start of the execution is refunded,
+// until it is written again, and restoring the original value
+// refunds what the first write paid above a warm read
+func sstoreRefund(ctx *ExecutionCtx, original, current, value *uint256.Int) {
+	if original.Eq(current) {
+		if !original.IsZero() && value.IsZero() {
+			ctx.Refund += sstoreClearsRefund
+		}
+		return
+	}
+	if !original.IsZero() {
+		switch {
+		case current.IsZero():
+			// the slot cleared earlier is written again
+			ctx.Refund -= sstoreClearsRefund
+		case value.IsZero():
+			ctx.Refund += sstoreClearsRefund
+		}
+	}
+	if original.Eq(value) {
+		if original.IsZero() {
+			ctx.Refund += SstoreSetGas - WarmStorageReadCost
+		} else {
+			ctx.Refund += SstoreResetGas - WarmStorageReadCost
+		}
+	}
+}
+
 func opProgramCounter(ctx *ExecutionCtx) {
 	ctx.Stack.Push(uint256.NewInt(ctx.pc))
 }
@@ -217,3 +336,66 @@ func opGas(ctx *ExecutionCtx) {
 func opCodeSize(ctx *ExecutionCtx) {
 	ctx.Stack.Push(uint256.NewInt(uint64(len(ctx.code))))
 }
+
+// opCodeCopy copies the code to the memory, its gas bounds the size
+func opCodeCopy(ctx *ExecutionCtx) {
+	destOffset, offset, size := ctx.Stack.Pop().Uint64(), ctx.Stack.Pop(), ctx.Stack.Pop().Uint64()
+	ctx.Memory.Store(destOffset, copyCode(ctx.code, offset, size))
+}
+
+// copyCode returns size bytes of the code from offset, the bytes
+// past the end of the code are zeros
+func copyCode(code []byte, offset *uint256.Int, size uint64) []byte {
+	data := make([]byte, size)
+	if offset.IsUint64() && offset.Uint64() < uint64(len(code)) {
+		copy(data, code[offset.Uint64():])
+	}
+	return data
+}
+
+// account returns the account at addr, nil if it doesn't exist
+func (ctx *ExecutionCtx) account(addr Address) *Account {
+	if ctx.State == nil {
+		return nil
+	}
+	return ctx.State.GetAccount(addr)
+}
+
+func opBalance(ctx *ExecutionCtx) {
+	balance := uint256.NewInt(0)
+	if account := ctx.account(ctx.Stack.Pop().Bytes20()); account != nil {
+		balance.Set(account.Balance)
+	}
+	ctx.Stack.Push(balance)
+}
+
+func opExtCodeSize(ctx *ExecutionCtx) {
+	size := uint256.NewInt(0)
+	if account := ctx.account(ctx.Stack.Pop().Bytes20()); account != nil {
+		size.SetUint64(uint64(len(account.Code)))
+	}
+	ctx.Stack.Push(size)
+}
+
+// opExtCodeCopy copies the code of the account to the memory, its gas
+// bounds the size like for CODECOPY
+func opExtCodeCopy(ctx *ExecutionCtx) {
+	addr := Address(ctx.Stack.Pop().Bytes20())
+	destOffset, offset, size := ctx.Stack.Pop().Uint64(), ctx.Stack.Pop(), ctx.Stack.Pop().Uint64()
+	var code []byte
+	if account := ctx.account(addr); account != nil {
+		code = account.Code
+	}
+	ctx.Memory.Store(destOffset, copyCode(code, offset, size))
+}
+
+// opExtCodeHash pushes the hash of the code of the account, zero
+// for an empty account (EIP-1052)
+func opExtCodeHash(ctx *ExecutionCtx) {
+	hash := uint256.NewInt(0)
+	if account := ctx.account(ctx.Stack.Pop().Bytes20()); account != nil && !account.Empty() {
+		codeHash := account.CodeHash()
+		hash.SetBytes(codeHash[:])
+	}
+	ctx.Stack.Push(hash)
+}
@@ -231,6 +231,50 @@ func TestOpSstore(t *testing.T) {
 	ctx.Stack.Push(uint256.NewInt(1))
 	opSstore(ctx)
 	assert.Equal(t, uint256.NewInt(42), ctx.Storage.Get(*uint256.NewInt(1)))
+	assert.Equal(t, uint64(0), ctx.Refund)
+
+	// restoring the original zero refunds the set but a warm read
+	ctx.Stack.Push(uint256.NewInt(0))
+	ctx.Stack.Push(uint256.NewInt(1))
+	opSstore(ctx)
+	assert.Equal(t, uint256.NewInt(0), ctx.Storage.Get(*uint256.NewInt(1)))
+	assert.Equal(t, SstoreSetGas-WarmStorageReadCost, ctx.Refund)
+}
+
+func TestSstoreRefund(t *testing.T) {
+	// the refunds of the writes of a slot holding original, see
+	// the table of EIP-2200 with the amounts of EIP-3529
+	for _, tc := range []struct {
+		original uint64
+		writes   []uint64
+		refund   uint64
+	}{
+		{0, []uint64{0}, 0},
+		{0, []uint64{1}, 0},
+		{0, []uint64{1, 0}, 19900},
+		{0, []uint64{1, 2}, 0},
+		{0, []uint64{1, 2, 0}, 19900},
+		{1, []uint64{0}, 4800},
+		{1, []uint64{2}, 0},
+		{1, []uint64{1}, 0},
+		{1, []uint64{0, 0}, 4800},
+		// the slot cleared is written again
+		{1, []uint64{0, 2}, 0},
+		{1, []uint64{0, 1}, 2800},
+		{1, []uint64{2, 0}, 4800},
+		{1, []uint64{2, 1}, 2800},
+		{1, []uint64{2, 0, 1}, 2800},
+	} {
+		ctx := &ExecutionCtx{Stack: NewStack(), Storage: NewStorage()}
+		ctx.Storage.Put(uint256.NewInt(0), uint256.NewInt(tc.original))
+		for _, value := range tc.writes {
+			ctx.Stack.Push(uint256.NewInt(value))
+			ctx.Stack.Push(uint256.NewInt(0))
+			opSstore(ctx)
+		}
+		assert.Equal(t, tc.refund, ctx.Refund, "%d %v", tc.original, tc.writes)
+		assert.Equal(t, uint256.NewInt(tc.original), ctx.original(*uint256.NewInt(0)))
+	}
 }
 
 func TestOpProgramCounter(t *testing.T) {
@@ -308,3 +352,52 @@ func TestOpCodeSize(t *testing.T) {
 	opCodeSize(ctx)
 	assert.Equal(t, uint256.NewInt(0), ctx.Stack.Pop())
 }
+
+func TestOpRevert(t *testing.T) {
+	ctx := &ExecutionCtx{
+		Stack:  NewStack(),
+		Memory: NewMemory(),
+	}
+	ctx.Stack.Push(uint256.NewInt(42))
+	ctx.Stack.Push(uint256.NewInt(0))
+	opMstore8(ctx)
+
+	ctx.Stack.Push(uint256.NewInt(1))
+	ctx.Stack.Push(uint256.NewInt(0))
+	opRevert(ctx)
+	assert.Equal(t, []byte{42}, ctx.Returndata)
+	assert.True(t, ctx.Stopped)
+	assert.True(t, ctx.Reverted)
+}
+
+func TestOpPush(t *testing.T) {
+	ctx := &ExecutionCtx{
+		Stack: NewStack(),
+		code:  []byte{0x61, 0x01, 0x02, 0x62, 0x03},
+		pc:    1,
+	}
+	makePush(2)(ctx)
+	assert.Equal(t, uint256.NewInt(0x0102), ctx.Stack.Pop())
+	assert.Equal(t, uint64(3), ctx.pc)
+
+	// truncated push data is padded with zeros
+	ctx.pc = 4
+	makePush(3)(ctx)
+	assert.Equal(t, uint256.NewInt(0x030000), ctx.Stack.Pop())
+	assert.Equal(t, uint64(7), ctx.pc)
+}
+
+func TestOpCodeCopy(t *testing.T) {
+	ctx := &ExecutionCtx{
+		Stack:  NewStack(),
+		Memory: NewMemory(),
+		code:   []byte{0x01, 0x02, 0x03},
+	}
+	// copy 3 bytes from code offset 1 to memory offset 4
+	ctx.Stack.Push(uint256.NewInt(3))
+	ctx.Stack.Push(uint256.NewInt(1))
+	ctx.Stack.Push(uint256.NewInt(4))
+	opCodeCopy(ctx)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0x02, 0x03, 0}, ctx.Memory.data[:7])
+	assert.Equal(t, uint64(1), ctx.Memory.ActiveWords())
+}
@@ -0,0 +1,86 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/holiman/uint256"
+)
+
+// JSONLogger is a Tracer that writes an EIP-3155 trace: one JSON
+// object per executed instruction followed by a summary line.
+// The output can be diffed line by line against the traces
+// emitted by other clients (e.g. geth's `evm --json run`).
+//
+// https://eips.ethereum.org/EIPS/eip-3155
+type JSONLogger struct {
+	encoder  *json.Encoder
+	startGas uint64
+}
+
+// jsonStep is a single line of the EIP-3155 trace
+type jsonStep struct {
+	Pc         uint64   `json:"pc"`
+	Op         byte     `json:"op"`
+	Gas        string   `json:"gas"`
+	GasCost    string   `json:"gasCost"`
+	MemSize    int      `json:"memSize"`
+	Stack      []string `json:"stack"`
+	Depth      int      `json:"depth"`
+	ReturnData string   `json:"returnData"`
+	Refund     uint64   `json:"refund"`
+	OpName     string   `json:"opName"`
+}
+
+// jsonSummary is the last line of the EIP-3155 trace
+type jsonSummary struct {
+	Output  string `json:"output"`
+	GasUsed string `json:"gasUsed"`
+	Error   string `json:"error,omitempty"`
+}
+
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{encoder: json.NewEncoder(w)}
+}
+
+func (l *JSONLogger) CaptureStart(ctx *ExecutionCtx) {
+	l.startGas = ctx.Gas
+}
+
+func (l *JSONLogger) CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64) {
+	// the stack is written bottom first, same as geth
+	stack := make([]string, 0, len(ctx.Stack.data))
+	for _, item := range ctx.Stack.data {
+		stack = append(stack, item.Hex())
+	}
+
+	l.encoder.Encode(jsonStep{
+		Pc:         pc,
+		Op:         op,
+		Gas:        fmt.Sprintf("0x%x", gas),
+		GasCost:    fmt.Sprintf("0x%x", cost),
+		MemSize:    len(ctx.Memory.data),
+		Stack:      stack,
+		Depth:      1,
+		ReturnData: fmt.Sprintf("0x%x", ctx.Returndata),
+		Refund:     ctx.Refund,
+		OpName:     InstructionSet[op].name,
+	})
+}
+
+func (l *JSONLogger) CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) {
+}
+
+func (l *JSONLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (l *JSONLogger) CaptureEnd(ctx *ExecutionCtx, output []byte, err error) {
+	summary := jsonSummary{
+		Output:  fmt.Sprintf("%x", output),
+		GasUsed: fmt.Sprintf("0x%x", l.startGas-ctx.Gas),
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	l.encoder.Encode(summary)
+}
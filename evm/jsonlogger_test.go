@@ -0,0 +1,78 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runWithJSONLogger(t *testing.T, code string, gas uint64) []map[string]interface{} {
+	var buf bytes.Buffer
+	ectx := NewExecutionCtx(
+		HexToBytes(code),
+		NewCalldata(""),
+		NewStack(),
+		NewMemory(),
+		NewStorage(),
+		gas,
+	)
+	ectx.Tracer = NewJSONLogger(&buf)
+	Run(ectx)
+
+	lines := make([]map[string]interface{}, 0)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var obj map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &obj))
+		lines = append(lines, obj)
+	}
+	return lines
+}
+
+func TestJSONLogger(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// Muliply 6 * 7 and return the result
+	lines := runWithJSONLogger(t, "600660070260005360016000f3", 24)
+	// 8 instructions and the summary
+	assert.Len(t, lines, 9)
+
+	first := lines[0]
+	assert.Equal(t, float64(0), first["pc"])
+	assert.Equal(t, float64(0x60), first["op"])
+	assert.Equal(t, "PUSH1", first["opName"])
+	assert.Equal(t, "0x18", first["gas"])
+	assert.Equal(t, "0x3", first["gasCost"])
+	assert.Equal(t, float64(1), first["depth"])
+	assert.Equal(t, []interface{}{}, first["stack"])
+
+	mul := lines[2]
+	assert.Equal(t, "MUL", mul["opName"])
+	assert.Equal(t, []interface{}{"0x6", "0x7"}, mul["stack"])
+
+	ret := lines[7]
+	assert.Equal(t, "RETURN", ret["opName"])
+	assert.Equal(t, float64(32), ret["memSize"])
+
+	summary := lines[8]
+	assert.Equal(t, "2a", summary["output"])
+	assert.Equal(t, "0x17", summary["gasUsed"])
+	assert.NotContains(t, summary, "error")
+}
+
+func TestJSONLoggerOutOfGas(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	lines := runWithJSONLogger(t, "5b600056", 13)
+	summary := lines[len(lines)-1]
+	assert.Equal(t, "out of gas", summary["error"])
+	assert.Equal(t, "0xd", summary["gasUsed"])
+}
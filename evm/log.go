@@ -0,0 +1,29 @@
+package evm
+
+// Log is an event emitted by the LOG0-LOG4 instructions
+type Log struct {
+	Address Address
+	Topics  []Hash
+	Data    []byte
+}
+
+// makeLog returns the execute function of LOG0-LOG4
+func makeLog(topics int) ExecuteFn {
+	return func(ctx *ExecutionCtx) {
+		offset, size := ctx.Stack.Pop().Uint64(), ctx.Stack.Pop().Uint64()
+		log := &Log{Address: ctx.Address, Topics: make([]Hash, topics)}
+		for i := range log.Topics {
+			log.Topics[i] = ctx.Stack.Pop().Bytes32()
+		}
+		if size > 0 {
+			log.Data = append([]byte{}, ctx.Memory.LoadRange(offset, size)...)
+		}
+		ctx.Logs = append(ctx.Logs, log)
+	}
+}
+
+// logGas is the constant part of the gas of a LOG instruction,
+// the data costs are not charged
+func logGas(topics int) uint64 {
+	return 375 + 375*uint64(topics)
+}
@@ -0,0 +1,53 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpLog(t *testing.T) {
+	ctx := &ExecutionCtx{
+		Address: HexToAddress("0xaa"),
+		Stack:   NewStack(),
+		Memory:  NewMemory(),
+	}
+	ctx.Memory.StoreWord(0, *uint256.NewInt(0xbeef))
+	ctx.Stack.Push(uint256.NewInt(2))
+	ctx.Stack.Push(uint256.NewInt(1))
+	ctx.Stack.Push(uint256.NewInt(2))
+	ctx.Stack.Push(uint256.NewInt(30))
+	makeLog(2)(ctx)
+
+	// LOG0 without data
+	ctx.Stack.Push(uint256.NewInt(0))
+	ctx.Stack.Push(uint256.NewInt(0))
+	makeLog(0)(ctx)
+
+	assert.Equal(t, []*Log{
+		{
+			Address: HexToAddress("0xaa"),
+			Topics:  []Hash{HexToHash("0x01"), HexToHash("0x02")},
+			Data:    []byte{0xbe, 0xef},
+		},
+		{Address: HexToAddress("0xaa"), Topics: []Hash{}},
+	}, ctx.Logs)
+	assert.Equal(t, 0, ctx.Stack.Len())
+}
+
+func TestLogUndo(t *testing.T) {
+	Init()
+	t.Cleanup(func() { InstructionSet = make(map[byte]Instruction) })
+
+	// LOG0 with 1 byte of data, STOP
+	ctx := NewExecutionCtx(HexToBytes("60016000a000"), NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 1000)
+	ctx.ValidJumpDestination()
+	h := NewHistory(ctx)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, h.Step())
+	}
+	assert.Len(t, ctx.Logs, 1)
+	h.Back()
+	assert.Len(t, ctx.Logs, 0)
+}
@@ -16,6 +16,9 @@ var zeroWord = []byte{
 
 type Memory struct {
 	data []uint8
+	// onWrite, when set, is called before a write with the
+	// offset and the bytes that are about to be overwritten
+	onWrite func(offset uint64, old []byte)
 }
 
 func NewMemory() *Memory {
@@ -52,16 +55,39 @@ func (m *Memory) expandIfNeeded(offset uint64) {
 	}
 }
 
+// notifyWrite calls onWrite with a copy of the
+// length bytes starting at offset
+func (m *Memory) notifyWrite(offset, length uint64) {
+	if m.onWrite == nil {
+		return
+	}
+	old := make([]byte, length)
+	copy(old, m.data[offset:offset+length])
+	m.onWrite(offset, old)
+}
+
 func (m *Memory) StoreByte(offset uint64, value uint8) {
 	m.expandIfNeeded(offset)
+	m.notifyWrite(offset, 1)
 	m.data[offset] = value
 }
 
 func (m *Memory) StoreWord(offset uint64, value uint256.Int) {
 	m.expandIfNeeded(offset + 31)
+	m.notifyWrite(offset, 32)
 	value.WriteToSlice(m.data[offset : offset+32])
 }
 
+// Store copies data into the memory starting at offset
+func (m *Memory) Store(offset uint64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	m.expandIfNeeded(offset + uint64(len(data)) - 1)
+	m.notifyWrite(offset, uint64(len(data)))
+	copy(m.data[offset:], data)
+}
+
 func (m *Memory) LoadRange(offset uint64, length uint64) []byte {
 	m.expandIfNeeded(offset + length - 1)
 	return m.data[offset : offset+length]
@@ -71,6 +97,11 @@ func (m *Memory) LoadWord(offset uint64) *uint256.Int {
 	return uint256.NewInt(0).SetBytes(m.LoadRange(offset, 32))
 }
 
+// Data returns the memory without expanding it
+func (m *Memory) Data() []byte {
+	return m.data
+}
+
 func (m *Memory) ActiveWords() uint64 {
 	return uint64(len(m.data) / 32)
 }
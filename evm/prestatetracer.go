@@ -0,0 +1,208 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/holiman/uint256"
+)
+
+// PrestateAccount is the state of an account as reported by the
+// PrestateTracer. Slots are keyed by their 32 byte hex encoding.
+type PrestateAccount struct {
+	Balance string            `json:"balance,omitempty"`
+	Nonce   uint64            `json:"nonce,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// PrestateTracer records every account and storage slot touched
+// by the execution: the sender, the recipient, the coinbase, the
+// accounts read by BALANCE and EXTCODE* and the slots read or
+// written. It marshals to the same JSON as geth's `prestateTracer`.
+//
+// In the default mode the result is the state before the
+// execution. In diff mode the result has a "pre" and a "post"
+// section containing only the accounts and slots that changed.
+// The accounts that didn't exist before are left out of "pre".
+//
+// Balances, nonces and code are read from the state, the tracer
+// only has the code and storage of the executed account without
+// one.
+type PrestateTracer struct {
+	diffMode bool
+	// tx is set when the tracer is told about the transaction,
+	// the result is then complete at CaptureTxEnd
+	tx      bool
+	state   *State
+	address Address
+	storage *Storage
+	// slots holds the values the touched slots of address had
+	// before the execution
+	slots map[uint256.Int]uint256.Int
+	pre   map[Address]*PrestateAccount
+	post  map[Address]*PrestateAccount
+	// empty holds the accounts that didn't exist before
+	empty map[Address]bool
+}
+
+func NewPrestateTracer(diffMode bool) *PrestateTracer {
+	return &PrestateTracer{
+		diffMode: diffMode,
+		slots:    make(map[uint256.Int]uint256.Int),
+		pre:      make(map[Address]*PrestateAccount),
+		empty:    make(map[Address]bool),
+	}
+}
+
+// CaptureTxStart records the accounts the transaction changes
+// before the execution: the sender buys the gas and the recipient
+// receives the value before the first instruction.
+func (t *PrestateTracer) CaptureTxStart(state *State, from, to, coinbase Address) {
+	t.tx, t.state = true, state
+	for _, addr := range []Address{from, to, coinbase} {
+		t.lookup(addr)
+	}
+}
+
+// CaptureTxEnd completes the result once the fees are paid
+func (t *PrestateTracer) CaptureTxEnd() {
+	t.finish()
+}
+
+func (t *PrestateTracer) CaptureStart(ctx *ExecutionCtx) {
+	if t.state == nil {
+		t.state = ctx.State
+	}
+	t.address, t.storage = ctx.Address, ctx.Storage
+	t.lookup(ctx.Caller)
+	t.lookup(ctx.Address)
+	if account := t.pre[ctx.Address]; t.state == nil && len(ctx.code) > 0 {
+		account.Code = fmt.Sprintf("0x%x", ctx.code)
+	}
+}
+
+func (t *PrestateTracer) CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64) {
+	if ctx.Stack.Len() == 0 {
+		return
+	}
+	switch op {
+	case 0x54, 0x55: // SLOAD, SSTORE
+		slot := *ctx.Stack.Peek(0)
+		if _, ok := t.slots[slot]; !ok {
+			t.slots[slot] = *ctx.Storage.Get(slot)
+			t.pre[t.address].Storage[slotHex(&slot)] = slotHex(ctx.Storage.Get(slot))
+		}
+	case 0x31, 0x3b, 0x3c, 0x3f: // BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH
+		t.lookup(ctx.Stack.Peek(0).Bytes20())
+	}
+}
+
+func (t *PrestateTracer) CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) {
+}
+
+func (t *PrestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *PrestateTracer) CaptureEnd(ctx *ExecutionCtx, output []byte, err error) {
+	if !t.tx {
+		t.finish()
+	}
+}
+
+// lookup records the account as it is before the transaction
+// changes it, the first time it is touched
+func (t *PrestateTracer) lookup(addr Address) {
+	if _, ok := t.pre[addr]; ok {
+		return
+	}
+	account := &PrestateAccount{Storage: make(map[string]string)}
+	t.pre[addr] = account
+	if t.state == nil {
+		return
+	}
+	if !t.state.Exist(addr) {
+		t.empty[addr] = true
+	}
+	account.Balance = t.state.GetBalance(addr).Hex()
+	account.Nonce = t.state.GetNonce(addr)
+	if code := t.state.GetCode(addr); len(code) > 0 {
+		account.Code = fmt.Sprintf("0x%x", code)
+	}
+}
+
+// finish keeps only the changes in diff mode, and drops the
+// accounts that didn't exist before from the pre-state
+func (t *PrestateTracer) finish() {
+	if t.diffMode {
+		t.post = make(map[Address]*PrestateAccount)
+		for addr, pre := range t.pre {
+			if post, modified := t.diff(addr, pre); modified {
+				t.post[addr] = post
+			} else {
+				delete(t.pre, addr)
+			}
+		}
+	}
+	for addr := range t.empty {
+		delete(t.pre, addr)
+	}
+}
+
+// diff returns the fields of the account that changed, and
+// removes the slots that didn't change from pre. A slot that is
+// zero before or after is omitted from that side.
+func (t *PrestateTracer) diff(addr Address, pre *PrestateAccount) (*PrestateAccount, bool) {
+	post := &PrestateAccount{Storage: make(map[string]string)}
+	modified := false
+	if t.state != nil {
+		if balance := t.state.GetBalance(addr).Hex(); balance != pre.Balance {
+			post.Balance, modified = balance, true
+		}
+		if nonce := t.state.GetNonce(addr); nonce != pre.Nonce {
+			post.Nonce, modified = nonce, true
+		}
+		if code := t.state.GetCode(addr); pre.Code != "" || len(code) > 0 {
+			if hex := fmt.Sprintf("0x%x", code); hex != pre.Code {
+				post.Code, modified = hex, true
+			}
+		}
+	}
+	if addr != t.address {
+		return post, modified
+	}
+	for slot, value := range t.slots {
+		slot, value := slot, value
+		key := slotHex(&slot)
+		newValue := t.storage.Get(slot)
+		if t.state != nil {
+			newValue = t.state.GetStorage(addr, slot)
+		}
+		if newValue.Eq(&value) {
+			delete(pre.Storage, key)
+			continue
+		}
+		modified = true
+		if value.IsZero() {
+			delete(pre.Storage, key)
+		}
+		if !newValue.IsZero() {
+			post.Storage[key] = slotHex(newValue)
+		}
+	}
+	return post, modified
+}
+
+// GetResult returns the touched accounts as JSON
+func (t *PrestateTracer) GetResult() (json.RawMessage, error) {
+	if t.diffMode {
+		return json.Marshal(struct {
+			Pre  map[Address]*PrestateAccount `json:"pre"`
+			Post map[Address]*PrestateAccount `json:"post"`
+		}{t.pre, t.post})
+	}
+	return json.Marshal(t.pre)
+}
+
+func slotHex(v *uint256.Int) string {
+	return fmt.Sprintf("0x%x", v.Bytes32())
+}
@@ -0,0 +1,89 @@
+package evm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func runWithPrestateTracer(t *testing.T, diffMode bool) map[string]interface{} {
+	// load slot 0, set slot 1 to 2 and rewrite slot 2 with its current value
+	//
+	// 60 00
+	// 54
+	// 60 02
+	// 60 01
+	// 55
+	// 60 03
+	// 60 02
+	// 55
+	// 00
+	storage := NewStorage()
+	storage.Put(uint256.NewInt(0), uint256.NewInt(5))
+	storage.Put(uint256.NewInt(2), uint256.NewInt(3))
+	ectx := NewExecutionCtx(
+		HexToBytes("6000546002600155600360025500"),
+		NewCalldata(""),
+		NewStack(),
+		NewMemory(),
+		storage,
+		100000,
+	)
+	ectx.Caller = HexToAddress("0x0a")
+	ectx.Address = HexToAddress("0x0b")
+	tracer := NewPrestateTracer(diffMode)
+	ectx.Tracer = tracer
+	_, err := Run(ectx)
+	assert.NoError(t, err)
+
+	result, err := tracer.GetResult()
+	assert.NoError(t, err)
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(result, &out))
+	return out
+}
+
+func TestPrestateTracer(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	out := runWithPrestateTracer(t, false)
+	assert.Len(t, out, 2)
+	assert.Equal(t, map[string]interface{}{}, out[HexToAddress("0x0a").Hex()])
+	assert.Equal(t, map[string]interface{}{
+		"code": "0x6000546002600155600360025500",
+		"storage": map[string]interface{}{
+			"0x0000000000000000000000000000000000000000000000000000000000000000": "0x0000000000000000000000000000000000000000000000000000000000000005",
+			"0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"0x0000000000000000000000000000000000000000000000000000000000000002": "0x0000000000000000000000000000000000000000000000000000000000000003",
+		},
+	}, out[HexToAddress("0x0b").Hex()])
+}
+
+func TestPrestateTracerDiffMode(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	out := runWithPrestateTracer(t, true)
+	contract := HexToAddress("0x0b").Hex()
+	// slot 1 was zero before the execution so it is only in post,
+	// slots 0 and 2 are unchanged and omitted from both sides
+	assert.Equal(t, map[string]interface{}{
+		contract: map[string]interface{}{
+			"code": "0x6000546002600155600360025500",
+		},
+	}, out["pre"])
+	assert.Equal(t, map[string]interface{}{
+		contract: map[string]interface{}{
+			"storage": map[string]interface{}{
+				"0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000002",
+			},
+		},
+	}, out["post"])
+}
@@ -0,0 +1,208 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+)
+
+var emptyCodeHash = BytesToHash(crypto.Keccak256(nil))
+
+// AccountProof proves an account and some of its storage slots
+// against the state root, as returned by eth_getProof (EIP-1186)
+type AccountProof struct {
+	Address      Address
+	AccountProof [][]byte
+	Balance      *uint256.Int
+	CodeHash     Hash
+	Nonce        uint64
+	StorageHash  Hash
+	StorageProof []StorageProof
+}
+
+// StorageProof proves the value of a slot against the storage root
+type StorageProof struct {
+	Key   uint256.Int
+	Value *uint256.Int
+	Proof [][]byte
+}
+
+// GetProof returns the proof of the account and the slots. The
+// proofs of a missing account or slot prove their absence.
+func (s *State) GetProof(addr Address, slots []uint256.Int) *AccountProof {
+	proof := &AccountProof{
+		Address:      addr,
+		AccountProof: s.stateTrie().Prove(crypto.Keccak256(addr[:])),
+		Balance:      uint256.NewInt(0),
+		CodeHash:     emptyCodeHash,
+		StorageHash:  trie.EmptyRoot,
+		StorageProof: []StorageProof{},
+	}
+	storage := NewStorage()
+	if account := s.GetAccount(addr); account != nil {
+		proof.Balance = account.Balance.Clone()
+		proof.CodeHash = account.CodeHash()
+		proof.Nonce = account.Nonce
+		proof.StorageHash = account.Storage.Root()
+		storage = account.Storage
+	}
+	storageTrie := storage.storageTrie()
+	for _, slot := range slots {
+		key := slot.Bytes32()
+		proof.StorageProof = append(proof.StorageProof, StorageProof{
+			Key:   slot,
+			Value: storage.Get(slot).Clone(),
+			Proof: storageTrie.Prove(crypto.Keccak256(key[:])),
+		})
+	}
+	return proof
+}
+
+// Verify checks the account and storage proofs against the state
+// root and that they prove the values of the fields
+func (p *AccountProof) Verify(root Hash) error {
+	enc, err := trie.VerifyProof(root, crypto.Keccak256(p.Address[:]), p.AccountProof)
+	if err != nil {
+		return err
+	}
+	// a missing account has the fields of an empty one
+	account := accountRLP{Balance: uint256.NewInt(0), StorageRoot: trie.EmptyRoot, CodeHash: emptyCodeHash}
+	if enc != nil {
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return fmt.Errorf("invalid account: %w", err)
+		}
+	}
+	if account.Nonce != p.Nonce || !account.Balance.Eq(p.Balance) ||
+		account.StorageRoot != p.StorageHash || account.CodeHash != p.CodeHash {
+		return errors.New("account proof doesn't match the account fields")
+	}
+
+	for _, sp := range p.StorageProof {
+		key := sp.Key.Bytes32()
+		enc, err := trie.VerifyProof(p.StorageHash, crypto.Keccak256(key[:]), sp.Proof)
+		if err != nil {
+			return fmt.Errorf("slot %s: %w", sp.Key.Hex(), err)
+		}
+		value := new(uint256.Int)
+		if enc != nil {
+			if err := rlp.DecodeBytes(enc, value); err != nil {
+				return fmt.Errorf("slot %s: invalid value: %w", sp.Key.Hex(), err)
+			}
+		}
+		if !value.Eq(sp.Value) {
+			return fmt.Errorf("slot %s: proof doesn't match the value %s", sp.Key.Hex(), sp.Value.Hex())
+		}
+	}
+	return nil
+}
+
+type accountProofJSON struct {
+	Address      Address            `json:"address"`
+	AccountProof []string           `json:"accountProof"`
+	Balance      string             `json:"balance"`
+	CodeHash     Hash               `json:"codeHash"`
+	Nonce        string             `json:"nonce"`
+	StorageHash  Hash               `json:"storageHash"`
+	StorageProof []storageProofJSON `json:"storageProof"`
+}
+
+type storageProofJSON struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Proof []string `json:"proof"`
+}
+
+// MarshalJSON encodes the proof in the format of eth_getProof
+func (p *AccountProof) MarshalJSON() ([]byte, error) {
+	enc := accountProofJSON{
+		Address:      p.Address,
+		AccountProof: hexNodes(p.AccountProof),
+		Balance:      p.Balance.Hex(),
+		CodeHash:     p.CodeHash,
+		Nonce:        fmt.Sprintf("0x%x", p.Nonce),
+		StorageHash:  p.StorageHash,
+		StorageProof: []storageProofJSON{},
+	}
+	for _, sp := range p.StorageProof {
+		key := sp.Key
+		enc.StorageProof = append(enc.StorageProof, storageProofJSON{
+			Key:   key.Hex(),
+			Value: sp.Value.Hex(),
+			Proof: hexNodes(sp.Proof),
+		})
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes a proof in the format of eth_getProof
+func (p *AccountProof) UnmarshalJSON(input []byte) error {
+	var dec accountProofJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	balance, err := ParseWord(dec.Balance)
+	if err != nil {
+		return err
+	}
+	nonce, err := ParseWord(dec.Nonce)
+	if err != nil {
+		return err
+	}
+	if !nonce.IsUint64() {
+		return fmt.Errorf("nonce %q doesn't fit 64 bits", dec.Nonce)
+	}
+	accountProof, err := parseNodes(dec.AccountProof)
+	if err != nil {
+		return err
+	}
+	*p = AccountProof{
+		Address:      dec.Address,
+		AccountProof: accountProof,
+		Balance:      balance,
+		CodeHash:     dec.CodeHash,
+		Nonce:        nonce.Uint64(),
+		StorageHash:  dec.StorageHash,
+		StorageProof: []StorageProof{},
+	}
+	for _, sp := range dec.StorageProof {
+		key, err := ParseWord(sp.Key)
+		if err != nil {
+			return err
+		}
+		value, err := ParseWord(sp.Value)
+		if err != nil {
+			return err
+		}
+		proof, err := parseNodes(sp.Proof)
+		if err != nil {
+			return err
+		}
+		p.StorageProof = append(p.StorageProof, StorageProof{Key: *key, Value: value, Proof: proof})
+	}
+	return nil
+}
+
+func hexNodes(nodes [][]byte) []string {
+	strs := make([]string, len(nodes))
+	for i, n := range nodes {
+		strs[i] = fmt.Sprintf("0x%x", n)
+	}
+	return strs
+}
+
+func parseNodes(strs []string) ([][]byte, error) {
+	nodes := make([][]byte, len(strs))
+	for i, s := range strs {
+		n, err := ParseBytes(s)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
@@ -0,0 +1,104 @@
+package evm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func proofState() *State {
+	s := NewState()
+	for i := 0; i < 50; i++ {
+		s.AddBalance(BytesToAddress([]byte{byte(i), 0xee}), uint256.NewInt(uint64(i)))
+	}
+	bridge := HexToAddress("0x0b1d9e")
+	s.SetNonce(bridge, 1)
+	s.SetCode(bridge, HexToBytes("6000"))
+	for i := uint64(0); i < 20; i++ {
+		s.SetStorage(bridge, uint256.NewInt(i), uint256.NewInt(i*1000))
+	}
+	return s
+}
+
+func TestGetProof(t *testing.T) {
+	s := proofState()
+	root := s.Root()
+	bridge := HexToAddress("0x0b1d9e")
+
+	proof := s.GetProof(bridge, []uint256.Int{*uint256.NewInt(3), *uint256.NewInt(0), *uint256.NewInt(100)})
+	assert.NoError(t, proof.Verify(root))
+	assert.Equal(t, uint64(1), proof.Nonce)
+	assert.Equal(t, s.GetAccount(bridge).CodeHash(), proof.CodeHash)
+	assert.Equal(t, s.GetAccount(bridge).Storage.Root(), proof.StorageHash)
+	assert.Equal(t, uint256.NewInt(3000), proof.StorageProof[0].Value)
+	// slot 0 is zero, slot 100 isn't set
+	assert.Equal(t, uint256.NewInt(0), proof.StorageProof[1].Value)
+	assert.Equal(t, uint256.NewInt(0), proof.StorageProof[2].Value)
+
+	// a missing account
+	proof = s.GetProof(HexToAddress("0xdead"), []uint256.Int{*uint256.NewInt(1)})
+	assert.NoError(t, proof.Verify(root))
+	assert.Equal(t, Hash(trie.EmptyRoot), proof.StorageHash)
+	assert.NotEmpty(t, proof.AccountProof)
+}
+
+func TestGetProofTampered(t *testing.T) {
+	s := proofState()
+	root := s.Root()
+	bridge := HexToAddress("0x0b1d9e")
+	slots := []uint256.Int{*uint256.NewInt(5)}
+
+	proof := s.GetProof(bridge, slots)
+	proof.Balance = uint256.NewInt(1)
+	assert.EqualError(t, proof.Verify(root), "account proof doesn't match the account fields")
+
+	proof = s.GetProof(bridge, slots)
+	proof.StorageProof[0].Value = uint256.NewInt(1)
+	assert.EqualError(t, proof.Verify(root), "slot 0x5: proof doesn't match the value 0x1")
+
+	proof = s.GetProof(bridge, slots)
+	last := proof.StorageProof[0].Proof[len(proof.StorageProof[0].Proof)-1]
+	last[len(last)-1] ^= 0x01
+	assert.ErrorIs(t, proof.Verify(root), trie.ErrInvalidProof)
+
+	proof = s.GetProof(bridge, slots)
+	proof.AccountProof[0][5] ^= 0x01
+	assert.ErrorIs(t, proof.Verify(root), trie.ErrInvalidProof)
+
+	// the proof of the current state doesn't verify an older root
+	proof = s.GetProof(bridge, slots)
+	s.SetStorage(bridge, uint256.NewInt(5), uint256.NewInt(6))
+	assert.NoError(t, proof.Verify(root))
+	assert.Error(t, s.GetProof(bridge, slots).Verify(root))
+	assert.NoError(t, s.GetProof(bridge, slots).Verify(s.Root()))
+}
+
+func TestAccountProofJSON(t *testing.T) {
+	s := NewState()
+	a := HexToAddress("0xaa")
+	s.AddBalance(a, uint256.NewInt(16))
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(2))
+
+	data, err := json.Marshal(s.GetProof(a, []uint256.Int{*uint256.NewInt(1)}))
+	assert.NoError(t, err)
+	var dec map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &dec))
+	assert.Equal(t, "0x00000000000000000000000000000000000000aa", dec["address"])
+	assert.Equal(t, "0x10", dec["balance"])
+	assert.Equal(t, "0x0", dec["nonce"])
+	assert.Equal(t, "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", dec["codeHash"])
+	assert.Len(t, dec["accountProof"], 1)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"key":   "0x1",
+		"value": "0x2",
+		"proof": dec["storageProof"].([]interface{})[0].(map[string]interface{})["proof"],
+	}}, dec["storageProof"])
+
+	var proof AccountProof
+	assert.NoError(t, json.Unmarshal(data, &proof))
+	assert.Equal(t, s.GetProof(a, []uint256.Int{*uint256.NewInt(1)}), &proof)
+	assert.NoError(t, proof.Verify(s.Root()))
+}
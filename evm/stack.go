@@ -47,6 +47,22 @@ func (s *Stack) Peek(i uint16) (item *uint256.Int) {
 	return s.data[length-1-i]
 }
 
+// Set replaces a stack element, eg: Set(0, x)
+// will replace the top of the stack with x
+func (s *Stack) Set(i uint16, item *uint256.Int) {
+	length := uint16(len(s.data))
+	if i >= length {
+		panic(fmt.Errorf("invalid set index %d", i))
+	}
+
+	s.data[length-1-i] = item
+}
+
+// Len returns the number of elements on the stack
+func (s *Stack) Len() int {
+	return len(s.data)
+}
+
 // Swap the top of the stack with the i+1th element
 func (s *Stack) Swap(i uint16) {
 	if i == 0 {
@@ -79,6 +79,20 @@ func TestPeek(t *testing.T) {
 	})
 }
 
+func TestSet(t *testing.T) {
+	stack := NewStack()
+	stack.Push(uint256.NewInt(1))
+	stack.Push(uint256.NewInt(2))
+	stack.Set(1, uint256.NewInt(3))
+	assert.Equal(t, 2, stack.Len())
+	assert.Equal(t, uint256.NewInt(2), stack.Peek(0))
+	assert.Equal(t, uint256.NewInt(3), stack.Peek(1))
+
+	assert.PanicsWithError(t, "invalid set index 2", func() {
+		stack.Set(2, uint256.NewInt(4))
+	})
+}
+
 func TestStackString(t *testing.T) {
 	stack := NewStack()
 	item1 := uint256.NewInt(1)
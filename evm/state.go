@@ -0,0 +1,282 @@
+package evm
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+)
+
+// Account is an entry of the world state
+type Account struct {
+	Nonce   uint64
+	Balance *uint256.Int
+	Code    []byte
+	Storage *Storage
+}
+
+func NewAccount() *Account {
+	return &Account{
+		Balance: uint256.NewInt(0),
+		Storage: NewStorage(),
+	}
+}
+
+// Empty reports whether the account has no nonce, balance or code (EIP-161)
+func (a *Account) Empty() bool {
+	return a.Nonce == 0 && a.Balance.IsZero() && len(a.Code) == 0
+}
+
+// Copy returns a deep copy of the account
+func (a *Account) Copy() *Account {
+	return &Account{
+		Nonce:   a.Nonce,
+		Balance: a.Balance.Clone(),
+		Code:    append([]byte{}, a.Code...),
+		Storage: a.Storage.Copy(),
+	}
+}
+
+// CodeHash returns the Keccak-256 hash of the code
+func (a *Account) CodeHash() Hash {
+	return BytesToHash(crypto.Keccak256(a.Code))
+}
+
+// accountRLP is the encoding of an account in the state trie
+type accountRLP struct {
+	Nonce       uint64
+	Balance     *uint256.Int
+	StorageRoot Hash
+	CodeHash    Hash
+}
+
+// State is the world state: the accounts by their address
+type State struct {
+	accounts map[Address]*Account
+	// journal undoes the changes made while there are snapshots,
+	// newest last, and snapshots are the lengths of the journal
+	// when they were taken
+	journal   []func()
+	snapshots []int
+}
+
+func NewState() *State {
+	return &State{
+		accounts: make(map[Address]*Account),
+	}
+}
+
+// Exist reports whether the account is in the state
+func (s *State) Exist(addr Address) bool {
+	_, ok := s.accounts[addr]
+	return ok
+}
+
+// GetAccount returns the account or nil if it doesn't exist. The
+// account may be changed in place, its changes are journaled.
+func (s *State) GetAccount(addr Address) *Account {
+	account, ok := s.accounts[addr]
+	if ok {
+		s.journalAccount(account)
+	}
+	return account
+}
+
+// GetOrNewAccount returns the account, creating it if needed
+func (s *State) GetOrNewAccount(addr Address) *Account {
+	account, ok := s.accounts[addr]
+	if !ok {
+		account = NewAccount()
+		s.setAccount(addr, account)
+	}
+	s.journalAccount(account)
+	return account
+}
+
+// SetAccount replaces the account at addr
+func (s *State) SetAccount(addr Address, account *Account) {
+	s.setAccount(addr, account)
+}
+
+// DeleteAccount removes the account from the state
+func (s *State) DeleteAccount(addr Address) {
+	s.setAccount(addr, nil)
+}
+
+// setAccount replaces or, if account is nil, removes the account
+func (s *State) setAccount(addr Address, account *Account) {
+	if len(s.snapshots) > 0 {
+		prev, existed := s.accounts[addr]
+		s.journal = append(s.journal, func() {
+			if existed {
+				s.accounts[addr] = prev
+			} else {
+				delete(s.accounts, addr)
+			}
+		})
+	}
+	if account == nil {
+		delete(s.accounts, addr)
+		return
+	}
+	s.accounts[addr] = account
+}
+
+// journalAccount records the fields of an account handed out to be
+// changed in place, and hooks the writes of its storage
+func (s *State) journalAccount(account *Account) {
+	if account.Storage.journal == nil {
+		storage := account.Storage
+		storage.journal = func(slot uint256.Int, old *uint256.Int, existed bool) {
+			if len(s.snapshots) == 0 {
+				return
+			}
+			if existed {
+				// the values may be shared with the stack
+				old = old.Clone()
+			}
+			s.journal = append(s.journal, func() {
+				if existed {
+					storage.data[slot] = old
+				} else {
+					delete(storage.data, slot)
+				}
+			})
+		}
+	}
+	if len(s.snapshots) == 0 {
+		return
+	}
+	nonce, balance, code := account.Nonce, account.Balance.Clone(), account.Code
+	s.journal = append(s.journal, func() {
+		account.Nonce, account.Balance, account.Code = nonce, balance, code
+	})
+}
+
+// GetBalance returns the balance, zero if the account doesn't exist
+func (s *State) GetBalance(addr Address) *uint256.Int {
+	if account, ok := s.accounts[addr]; ok {
+		return account.Balance.Clone()
+	}
+	return uint256.NewInt(0)
+}
+
+func (s *State) AddBalance(addr Address, amount *uint256.Int) {
+	account := s.GetOrNewAccount(addr)
+	account.Balance = new(uint256.Int).Add(account.Balance, amount)
+}
+
+func (s *State) SubBalance(addr Address, amount *uint256.Int) {
+	account := s.GetOrNewAccount(addr)
+	account.Balance = new(uint256.Int).Sub(account.Balance, amount)
+}
+
+// GetNonce returns the nonce, zero if the account doesn't exist
+func (s *State) GetNonce(addr Address) uint64 {
+	if account, ok := s.accounts[addr]; ok {
+		return account.Nonce
+	}
+	return 0
+}
+
+func (s *State) SetNonce(addr Address, nonce uint64) {
+	s.GetOrNewAccount(addr).Nonce = nonce
+}
+
+// GetCode returns the code, nil if the account doesn't exist
+func (s *State) GetCode(addr Address) []byte {
+	if account, ok := s.accounts[addr]; ok {
+		return account.Code
+	}
+	return nil
+}
+
+func (s *State) SetCode(addr Address, code []byte) {
+	s.GetOrNewAccount(addr).Code = code
+}
+
+// GetStorage returns the value of the slot, zero if the
+// account doesn't exist
+func (s *State) GetStorage(addr Address, slot uint256.Int) *uint256.Int {
+	if account, ok := s.accounts[addr]; ok {
+		return account.Storage.Get(slot)
+	}
+	return uint256.NewInt(0)
+}
+
+func (s *State) SetStorage(addr Address, slot, value *uint256.Int) {
+	s.GetOrNewAccount(addr).Storage.Put(slot, value)
+}
+
+// Addresses returns the addresses of the accounts in ascending order
+func (s *State) Addresses() []Address {
+	addrs := make([]Address, 0, len(s.accounts))
+	for addr := range s.accounts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	return addrs
+}
+
+// Root returns the state root: the root of the trie mapping the
+// Keccak-256 hash of each address to the RLP encoded account
+func (s *State) Root() Hash {
+	return s.stateTrie().Hash()
+}
+
+func (s *State) stateTrie() *trie.Trie {
+	t := trie.New()
+	for addr, account := range s.accounts {
+		// accounts always encode
+		enc, _ := rlp.EncodeToBytes(&accountRLP{
+			Nonce:       account.Nonce,
+			Balance:     account.Balance,
+			StorageRoot: account.Storage.Root(),
+			CodeHash:    account.CodeHash(),
+		})
+		t.Put(crypto.Keccak256(addr[:]), enc)
+	}
+	return t
+}
+
+// Copy returns a deep copy of the state
+func (s *State) Copy() *State {
+	cpy := NewState()
+	for addr, account := range s.accounts {
+		cpy.accounts[addr] = account.Copy()
+	}
+	return cpy
+}
+
+// Snapshot marks the state and returns its id, RevertToSnapshot
+// restores it. The changes made after the mark are journaled, a
+// snapshot costs the changes made while it is kept rather than a
+// copy of the state.
+func (s *State) Snapshot() int {
+	s.snapshots = append(s.snapshots, len(s.journal))
+	return len(s.snapshots) - 1
+}
+
+// RevertToSnapshot restores the state marked by Snapshot. The
+// snapshots taken after it are discarded.
+func (s *State) RevertToSnapshot(id int) {
+	mark := s.snapshots[id]
+	for i := len(s.journal) - 1; i >= mark; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:mark]
+	s.snapshots = s.snapshots[:id]
+}
+
+// DiscardSnapshot drops the snapshot and the ones taken after it,
+// the state is kept as is
+func (s *State) DiscardSnapshot(id int) {
+	s.snapshots = s.snapshots[:id]
+	if id == 0 {
+		// nothing is left to revert
+		s.journal = nil
+	}
+}
@@ -0,0 +1,218 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	s := NewState()
+	a, b := HexToAddress("0xaa"), HexToAddress("0xbb")
+	assert.False(t, s.Exist(a))
+	assert.Equal(t, uint256.NewInt(0), s.GetBalance(a))
+	assert.Equal(t, uint256.NewInt(0), s.GetStorage(a, *uint256.NewInt(1)))
+
+	s.AddBalance(b, uint256.NewInt(10))
+	s.SubBalance(b, uint256.NewInt(3))
+	s.SetNonce(a, 2)
+	s.SetCode(a, []byte{0x00})
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(5))
+
+	assert.Equal(t, []Address{a, b}, s.Addresses())
+	assert.Equal(t, uint256.NewInt(7), s.GetBalance(b))
+	assert.Equal(t, uint64(2), s.GetNonce(a))
+	assert.Equal(t, []byte{0x00}, s.GetCode(a))
+	assert.Equal(t, uint256.NewInt(5), s.GetStorage(a, *uint256.NewInt(1)))
+
+	s.DeleteAccount(b)
+	assert.False(t, s.Exist(b))
+}
+
+func TestStateCopy(t *testing.T) {
+	s := NewState()
+	a := HexToAddress("0xaa")
+	s.AddBalance(a, uint256.NewInt(1))
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(5))
+
+	cpy := s.Copy()
+	cpy.AddBalance(a, uint256.NewInt(1))
+	cpy.SetStorage(a, uint256.NewInt(1), uint256.NewInt(6))
+	cpy.SetNonce(HexToAddress("0xbb"), 1)
+
+	assert.Equal(t, uint256.NewInt(1), s.GetBalance(a))
+	assert.Equal(t, uint256.NewInt(5), s.GetStorage(a, *uint256.NewInt(1)))
+	assert.Equal(t, []Address{a}, s.Addresses())
+}
+
+func TestAccountEmpty(t *testing.T) {
+	account := NewAccount()
+	assert.True(t, account.Empty())
+	account.Storage.Put(uint256.NewInt(1), uint256.NewInt(1))
+	assert.True(t, account.Empty())
+	account.Nonce = 1
+	assert.False(t, account.Empty())
+}
+
+func TestStateSnapshot(t *testing.T) {
+	s := NewState()
+	a := HexToAddress("0xaa")
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(5))
+
+	first := s.Snapshot()
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(6))
+	second := s.Snapshot()
+	s.SetNonce(a, 1)
+
+	s.RevertToSnapshot(second)
+	assert.Equal(t, uint64(0), s.GetNonce(a))
+	assert.Equal(t, uint256.NewInt(6), s.GetStorage(a, *uint256.NewInt(1)))
+	s.RevertToSnapshot(first)
+	assert.Equal(t, uint256.NewInt(5), s.GetStorage(a, *uint256.NewInt(1)))
+}
+
+func TestSnapshotJournal(t *testing.T) {
+	s := NewState()
+	a, b := HexToAddress("0xaa"), HexToAddress("0xbb")
+	s.AddBalance(a, uint256.NewInt(1))
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(5))
+	root := s.Root()
+
+	id := s.Snapshot()
+	assert.Empty(t, s.journal)
+	// the changes made in place through the account are reverted
+	account := s.GetAccount(a)
+	account.Balance = uint256.NewInt(2)
+	account.Storage.Put(uint256.NewInt(1), uint256.NewInt(6))
+	account.Storage.Put(uint256.NewInt(2), uint256.NewInt(7))
+	s.SetCode(b, []byte{1})
+	s.DeleteAccount(a)
+	s.RevertToSnapshot(id)
+	assert.Equal(t, root, s.Root())
+	assert.Equal(t, uint256.NewInt(1), s.GetBalance(a))
+	assert.Equal(t, uint256.NewInt(0), s.GetStorage(a, *uint256.NewInt(2)))
+	assert.False(t, s.Exist(b))
+	assert.Empty(t, s.journal)
+
+	// without snapshots nothing is journaled
+	s.Snapshot()
+	s.SetNonce(a, 1)
+	s.DiscardSnapshot(0)
+	s.SetNonce(a, 2)
+	assert.Empty(t, s.journal)
+}
+
+func TestDiscardSnapshot(t *testing.T) {
+	s := NewState()
+	a := HexToAddress("0xaa")
+	first := s.Snapshot()
+	s.SetNonce(a, 1)
+	second := s.Snapshot()
+	s.SetNonce(a, 2)
+
+	s.DiscardSnapshot(second)
+	assert.Equal(t, uint64(2), s.GetNonce(a))
+	assert.Len(t, s.snapshots, 1)
+	s.RevertToSnapshot(first)
+	assert.False(t, s.Exist(a))
+	assert.Empty(t, s.snapshots)
+}
+
+func TestDump(t *testing.T) {
+	s := NewState()
+	a := HexToAddress("0xaa")
+	s.AddBalance(a, uint256.NewInt(16))
+	s.SetCode(a, []byte{0x00})
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(5))
+	s.SetStorage(a, uint256.NewInt(2), uint256.NewInt(0))
+	s.SetNonce(HexToAddress("0x0b"), 1)
+
+	data, err := json.Marshal(s.Dump())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"0x000000000000000000000000000000000000000b":{"balance":"0x0","nonce":"0x1"},`+
+		`"0x00000000000000000000000000000000000000aa":{"balance":"0x10","nonce":"0x0","code":"0x00","storage":{`+
+		`"0x0000000000000000000000000000000000000000000000000000000000000001":"0x0000000000000000000000000000000000000000000000000000000000000005"}}}`, string(data))
+
+	var alloc GenesisAlloc
+	assert.NoError(t, json.Unmarshal(data, &alloc))
+	assert.Equal(t, uint256.NewInt(5), alloc.ToState().GetStorage(a, *uint256.NewInt(1)))
+}
+
+func TestReadWriteAlloc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alloc.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"0x00000000000000000000000000000000000000aa":{"balance":"0x10","code":"0x00","storage":{"0x02":"0x07","0x01":"0x05"}},`+
+		`"0x000000000000000000000000000000000000000b":{"balance":"0x0","nonce":"0x1"}}`), 0o644))
+	alloc, err := ReadAlloc(path)
+	assert.NoError(t, err)
+	storage := alloc[HexToAddress("0xaa")].ToStorage()
+	assert.Equal(t, uint256.NewInt(7), storage.Get(*uint256.NewInt(2)))
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteAlloc(&out, alloc.ToState().Dump()))
+	assert.Equal(t, `{
+  "0x000000000000000000000000000000000000000b": {
+    "balance": "0x0",
+    "nonce": "0x1"
+  },
+  "0x00000000000000000000000000000000000000aa": {
+    "balance": "0x10",
+    "nonce": "0x0",
+    "code": "0x00",
+    "storage": {
+      "0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000005",
+      "0x0000000000000000000000000000000000000000000000000000000000000002": "0x0000000000000000000000000000000000000000000000000000000000000007"
+    }
+  }
+}
+`, out.String())
+
+	_, err = ReadAlloc(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("[]"), 0o644))
+	_, err = ReadAlloc(path)
+	assert.ErrorContains(t, err, path)
+}
+
+func TestStateRoot(t *testing.T) {
+	s := NewState()
+	assert.Equal(t, Hash(trie.EmptyRoot), s.Root())
+
+	a := HexToAddress("0xaa")
+	s.SetNonce(a, 1)
+	s.AddBalance(a, uint256.NewInt(1000))
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(1))
+
+	// an account is the list of its nonce, balance, storage
+	// root and code hash
+	storageRoot := s.GetAccount(a).Storage.Root()
+	enc := append([]byte{0xf8, 0x46, 0x01, 0x82, 0x03, 0xe8, 0xa0}, storageRoot[:]...)
+	enc = append(enc, 0xa0)
+	enc = append(enc, HexToBytes("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")...)
+	want := trie.New()
+	want.Put(crypto.Keccak256(a[:]), enc)
+	assert.Equal(t, Hash(want.Hash()), s.Root())
+
+	// the root commits to the code and the storage
+	root := s.Root()
+	s.SetCode(a, []byte{0x00})
+	assert.NotEqual(t, root, s.Root())
+	root = s.Root()
+	s.SetStorage(a, uint256.NewInt(1), uint256.NewInt(2))
+	assert.NotEqual(t, root, s.Root())
+
+	// empty accounts are part of the state
+	root = s.Root()
+	s.GetOrNewAccount(HexToAddress("0xbb"))
+	assert.NotEqual(t, root, s.Root())
+}
+
+func TestCodeHash(t *testing.T) {
+	assert.Equal(t, HexToHash("0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"), NewAccount().CodeHash())
+}
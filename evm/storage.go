@@ -2,13 +2,23 @@ package evm
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
 	"github.com/holiman/uint256"
 )
 
 type Storage struct {
 	data map[uint256.Int]*uint256.Int
+	// onWrite, when set, is called before a write with the
+	// slot, its current value and whether the slot was set
+	onWrite func(slot uint256.Int, old *uint256.Int, existed bool)
+	// journal is set by the state holding the storage, it records
+	// the writes its snapshots revert
+	journal func(slot uint256.Int, old *uint256.Int, existed bool)
 }
 
 func NewStorage() *Storage {
@@ -27,13 +37,63 @@ func (s *Storage) Get(slot uint256.Int) *uint256.Int {
 }
 
 func (s *Storage) Put(slot *uint256.Int, value *uint256.Int) {
+	old, ok := s.data[*slot]
+	if s.onWrite != nil {
+		s.onWrite(*slot, old, ok)
+	}
+	if s.journal != nil {
+		s.journal(*slot, old, ok)
+	}
 	s.data[*slot] = value
 }
 
+// Copy returns a deep copy of the storage
+func (s *Storage) Copy() *Storage {
+	cpy := NewStorage()
+	for k, v := range s.data {
+		cpy.data[k] = v.Clone()
+	}
+	return cpy
+}
+
+// Slots returns the slots that have been set in ascending order
+func (s *Storage) Slots() []uint256.Int {
+	slots := make([]uint256.Int, 0, len(s.data))
+	for k := range s.data {
+		slots = append(slots, k)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Lt(&slots[j]) })
+	return slots
+}
+
+// Root returns the root of the storage trie, which maps the
+// Keccak-256 hash of each slot to its RLP encoded value. Zero
+// values are not in the trie.
+func (s *Storage) Root() Hash {
+	return s.storageTrie().Hash()
+}
+
+func (s *Storage) storageTrie() *trie.Trie {
+	t := trie.New()
+	for slot, value := range s.data {
+		if value.IsZero() {
+			continue
+		}
+		key := slot.Bytes32()
+		// a word always encodes
+		enc, _ := rlp.EncodeToBytes(value)
+		t.Put(crypto.Keccak256(key[:]), enc)
+	}
+	return t
+}
+
+// String prints the slots in ascending order. Slots
+// and values are printed in full as decimal numbers.
 func (s *Storage) String() string {
 	strs := []string{"storage: \n"}
-	for k, v := range s.data {
-		strs = append(strs, fmt.Sprintf("%d: %d\n", k.Uint64(), v))
+	for _, k := range s.Slots() {
+		k := k
+		strs = append(strs, fmt.Sprintf("%s: %s\n", k.ToBig(), s.data[k].ToBig()))
 	}
 	return strings.Join(strs, "")
 }
@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/trie"
 	"github.com/holiman/uint256"
 	"github.com/stretchr/testify/assert"
 )
@@ -28,3 +30,53 @@ func TestStorageString(t *testing.T) {
 	assert.True(t, strings.Contains(storage.String(), "1: 2"))
 	assert.True(t, strings.Contains(storage.String(), "2: 3"))
 }
+
+func TestStorageStringLargeValues(t *testing.T) {
+	storage := NewStorage()
+	slot, _ := uint256.FromHex("0x10000000000000000")
+	value, _ := uint256.FromHex("0xffffffffffffffffffffffffffffffff")
+	storage.Put(slot, value)
+	storage.Put(uint256.NewInt(1), uint256.NewInt(1))
+
+	assert.Equal(
+		t,
+		"storage: \n1: 1\n18446744073709551616: 340282366920938463463374607431768211455\n",
+		storage.String(),
+	)
+}
+
+func TestStorageCopy(t *testing.T) {
+	storage := NewStorage()
+	storage.Put(uint256.NewInt(0), uint256.NewInt(1))
+	cpy := storage.Copy()
+	cpy.Put(uint256.NewInt(0), uint256.NewInt(2))
+	storage.Get(*uint256.NewInt(0)).SetUint64(3)
+
+	assert.Equal(t, uint256.NewInt(3), storage.Get(*uint256.NewInt(0)))
+	assert.Equal(t, uint256.NewInt(2), cpy.Get(*uint256.NewInt(0)))
+}
+
+func TestStorageSlots(t *testing.T) {
+	storage := NewStorage()
+	storage.Put(uint256.NewInt(2), uint256.NewInt(1))
+	storage.Put(uint256.NewInt(0), uint256.NewInt(1))
+	assert.Equal(t, []uint256.Int{*uint256.NewInt(0), *uint256.NewInt(2)}, storage.Slots())
+}
+
+func TestStorageRoot(t *testing.T) {
+	storage := NewStorage()
+	assert.Equal(t, Hash(trie.EmptyRoot), storage.Root())
+
+	storage.Put(uint256.NewInt(1), uint256.NewInt(0x0102))
+	// the key is the hash of the 32 byte slot, the value the
+	// encoded word without leading zeros
+	want := trie.New()
+	want.Put(crypto.Keccak256(make([]byte, 31), []byte{1}), []byte{0x82, 0x01, 0x02})
+	assert.Equal(t, Hash(want.Hash()), storage.Root())
+
+	// zero values are left out
+	storage.Put(uint256.NewInt(2), uint256.NewInt(0))
+	assert.Equal(t, Hash(want.Hash()), storage.Root())
+	storage.Put(uint256.NewInt(1), uint256.NewInt(0))
+	assert.Equal(t, Hash(trie.EmptyRoot), storage.Root())
+}
@@ -0,0 +1,126 @@
+package evm
+
+import (
+	"fmt"
+
+	"github.com/holiman/uint256"
+)
+
+// LogConfig selects what the StructLogger records with each step
+type LogConfig struct {
+	DisableStack     bool `json:"disableStack"`
+	DisableStorage   bool `json:"disableStorage"`
+	EnableMemory     bool `json:"enableMemory"`
+	EnableReturnData bool `json:"enableReturnData"`
+}
+
+// StructLog is a step of the trace of the StructLogger. It marshals
+// to the same JSON as the steps of geth's default tracer: the memory
+// in 32 byte words and the storage by slot, both without the 0x
+// prefix.
+type StructLog struct {
+	Pc         uint64             `json:"pc"`
+	Op         string             `json:"op"`
+	Gas        uint64             `json:"gas"`
+	GasCost    uint64             `json:"gasCost"`
+	Depth      int                `json:"depth"`
+	Error      string             `json:"error,omitempty"`
+	Stack      *[]string          `json:"stack,omitempty"`
+	ReturnData string             `json:"returnData,omitempty"`
+	Memory     *[]string          `json:"memory,omitempty"`
+	Storage    *map[string]string `json:"storage,omitempty"`
+	Refund     uint64             `json:"refund,omitempty"`
+}
+
+// StructLogger is a Tracer that records every executed instruction
+// with the stack, and optionally the memory, the storage and the
+// return data. The storage is the slots read or written so far, it
+// is recorded on SLOAD and SSTORE only.
+type StructLogger struct {
+	config  LogConfig
+	logs    []StructLog
+	storage map[string]string
+	output  []byte
+}
+
+func NewStructLogger(config *LogConfig) *StructLogger {
+	l := &StructLogger{storage: make(map[string]string)}
+	if config != nil {
+		l.config = *config
+	}
+	return l
+}
+
+func (l *StructLogger) CaptureStart(ctx *ExecutionCtx) {}
+
+func (l *StructLogger) CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64) {
+	log := StructLog{
+		Pc:      pc,
+		Op:      InstructionSet[op].name,
+		Gas:     gas,
+		GasCost: cost,
+		Depth:   1,
+		Refund:  ctx.Refund,
+	}
+	if !l.config.DisableStack {
+		// the stack is written bottom first, same as geth
+		stack := make([]string, 0, len(ctx.Stack.data))
+		for _, item := range ctx.Stack.data {
+			stack = append(stack, item.Hex())
+		}
+		log.Stack = &stack
+	}
+	if l.config.EnableMemory {
+		memory := make([]string, 0, len(ctx.Memory.data)/32)
+		for i := 0; i+32 <= len(ctx.Memory.data); i += 32 {
+			memory = append(memory, fmt.Sprintf("%x", ctx.Memory.data[i:i+32]))
+		}
+		log.Memory = &memory
+	}
+	if l.config.EnableReturnData && len(ctx.Returndata) > 0 {
+		log.ReturnData = fmt.Sprintf("0x%x", ctx.Returndata)
+	}
+	// SLOAD and SSTORE both take the slot from the top of the stack,
+	// SSTORE the value below it
+	if !l.config.DisableStorage && (op == 0x54 || op == 0x55) && len(ctx.Stack.data) > int(op-0x54) {
+		slot := *ctx.Stack.Peek(0)
+		value := ctx.Storage.Get(slot)
+		if op == 0x55 {
+			value = ctx.Stack.Peek(1)
+		}
+		l.storage[storageHex(&slot)] = storageHex(value)
+		storage := make(map[string]string, len(l.storage))
+		for k, v := range l.storage {
+			storage[k] = v
+		}
+		log.Storage = &storage
+	}
+	l.logs = append(l.logs, log)
+}
+
+func (l *StructLogger) CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int) {
+}
+
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (l *StructLogger) CaptureEnd(ctx *ExecutionCtx, output []byte, err error) {
+	l.output = output
+	// the error of an exceptional halt belongs to the last step
+	if err != nil && err != ErrExecutionReverted && len(l.logs) > 0 {
+		l.logs[len(l.logs)-1].Error = err.Error()
+	}
+}
+
+// StructLogs returns the steps of the execution
+func (l *StructLogger) StructLogs() []StructLog {
+	return l.logs
+}
+
+// Output returns the output of the execution, or its revert data
+func (l *StructLogger) Output() []byte {
+	return l.output
+}
+
+func storageHex(v *uint256.Int) string {
+	return fmt.Sprintf("%x", v.Bytes32())
+}
@@ -0,0 +1,69 @@
+package evm
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStructLogger(t *testing.T) {
+	Init()
+	t.Cleanup(func() {
+		InstructionSet = make(map[byte]Instruction)
+	})
+
+	// store 2 at slot 1, then store 1 in memory and return it
+	//
+	// 60 02
+	// 60 01
+	// 55
+	// 60 01
+	// 60 00
+	// 52
+	// 60 20
+	// 60 00
+	// f3
+	code := HexToBytes("600260015560016000526020" + "6000f3")
+	newCtx := func(tracer Tracer) *ExecutionCtx {
+		ectx := NewExecutionCtx(code, NewCalldata(""), NewStack(), NewMemory(), NewStorage(), 100000)
+		ectx.Tracer = tracer
+		return ectx
+	}
+
+	logger := NewStructLogger(nil)
+	output, err := Run(newCtx(logger))
+	assert.NoError(t, err)
+	assert.Equal(t, output, logger.Output())
+	logs := logger.StructLogs()
+	assert.Len(t, logs, 9)
+	assert.Equal(t, StructLog{Pc: 0, Op: "PUSH1", Gas: 100000, GasCost: 3, Depth: 1, Stack: &[]string{}}, logs[0])
+	assert.Equal(t, &[]string{"0x2", "0x1"}, logs[2].Stack)
+	assert.Equal(t, &map[string]string{
+		"0000000000000000000000000000000000000000000000000000000000000001": "0000000000000000000000000000000000000000000000000000000000000002",
+	}, logs[2].Storage)
+	assert.Nil(t, logs[3].Storage)
+	assert.Nil(t, logs[8].Memory)
+
+	logger = NewStructLogger(&LogConfig{DisableStack: true, DisableStorage: true, EnableMemory: true})
+	_, err = Run(newCtx(logger))
+	assert.NoError(t, err)
+	logs = logger.StructLogs()
+	assert.Nil(t, logs[0].Stack)
+	assert.Nil(t, logs[2].Storage)
+	assert.Equal(t, &[]string{}, logs[0].Memory)
+	assert.Equal(t, &[]string{"0000000000000000000000000000000000000000000000000000000000000001"}, logs[8].Memory)
+
+	// the error of an exceptional halt is on the last step
+	logger = NewStructLogger(nil)
+	ectx := newCtx(logger)
+	ectx.Gas = 20008
+	_, err = Run(ectx)
+	assert.ErrorIs(t, err, ErrOutOfGas)
+	logs = logger.StructLogs()
+	assert.Len(t, logs, 4)
+	assert.Equal(t, ErrOutOfGas.Error(), logs[3].Error)
+
+	b, err := json.Marshal(logs[0])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"pc":0,"op":"PUSH1","gas":20008,"gasCost":3,"depth":1,"stack":[]}`, string(b))
+}
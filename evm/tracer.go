@@ -0,0 +1,32 @@
+package evm
+
+import "github.com/holiman/uint256"
+
+// Tracer is notified by the interpreter while it executes the
+// bytecode. It can be attached to an ExecutionCtx to observe
+// every step without changing the outcome of the execution.
+type Tracer interface {
+	// CaptureStart is called once, before the first instruction
+	CaptureStart(ctx *ExecutionCtx)
+	// CaptureState is called before each instruction is executed
+	// with the pc of the instruction, its opcode, the gas available
+	// and the gas the instruction is going to cost
+	CaptureState(ctx *ExecutionCtx, pc uint64, op byte, gas, cost uint64)
+	// CaptureEnter and CaptureExit are meant to wrap a call frame
+	// opened by CALL or CREATE. The interpreter has neither, it runs
+	// a single frame and never calls them.
+	CaptureEnter(typ string, from, to Address, input []byte, gas uint64, value *uint256.Int)
+	CaptureExit(output []byte, gasUsed uint64, err error)
+	// CaptureEnd is called once, when the execution halts
+	CaptureEnd(ctx *ExecutionCtx, output []byte, err error)
+}
+
+// TxTracer is a Tracer that is also told about the transaction
+// around the execution. CaptureTxStart is called before the sender
+// buys the gas, with the state before the transaction, and
+// CaptureTxEnd once the fees are paid.
+type TxTracer interface {
+	Tracer
+	CaptureTxStart(state *State, from, to, coinbase Address)
+	CaptureTxEnd()
+}
@@ -3,42 +3,185 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "disasm":
+			disasm(os.Args[2:])
+			return
+		case "asm":
+			assemble(os.Args[2:])
+			return
+		case "debug":
+			debug(os.Args[2:])
+			return
+		case "statetest":
+			statetest(os.Args[2:])
+			return
+		case "blocktest":
+			blocktest(os.Args[2:])
+			return
+		case "t8n":
+			t8n(os.Args[2:])
+			return
+		case "node":
+			devnode(os.Args[2:])
+			return
+		}
+	}
+	run()
+}
+
+func run() {
 	var (
 		code     string
 		calldata string
 		gas      uint64
+		jsonOut  bool
+		rawTx    string
+		chainID  uint64
+		prestate string
+		address  string
+		dump     string
 	)
-	flag.StringVar(&code, "code", "0x0", "hex data of the code to run")
+	flag.StringVar(&code, "code", "0x0", "hex data of the code to run, or a .easm file to assemble")
 	flag.StringVar(&calldata, "calldata", "0x0", "hex data to use as input")
 	flag.Uint64Var(&gas, "gas", 5, "number of steps the VM will execute")
+	flag.BoolVar(&jsonOut, "json", false, "write an EIP-3155 JSON trace to stderr")
+	flag.StringVar(&rawTx, "tx", "", "hex encoded signed transaction, replaces the calldata and gas")
+	flag.Uint64Var(&chainID, "chainid", 1, "chain id of the transaction")
+	flag.StringVar(&prestate, "prestate", "", "JSON alloc file of the accounts, the code runs with the storage of its address")
+	flag.StringVar(&address, "address", "0x0000000000000000000000000000000000000000", "address of the code, the recipient of the transaction by default")
+	flag.StringVar(&dump, "dump", "", "file the post-state is written to as a JSON alloc, or stdout")
 	flag.Parse()
-	fmt.Printf("code: %s, calldata %s, gas %d\n", code, calldata, gas)
+	// the post-state alone goes to stdout with -dump stdout
+	var out io.Writer = os.Stdout
+	if dump == "stdout" {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "code: %s, calldata %s, gas %d\n", code, calldata, gas)
 
 	evm.Init()
-	fmt.Printf("\n")
+	evm.DebugOutput = out
+	fmt.Fprintf(out, "\n")
+
+	var bytecode []byte
+	if strings.HasSuffix(code, ".easm") {
+		var err error
+		if bytecode, err = assembleFile(code); err != nil {
+			panic(err)
+		}
+	} else if code != "0x0" {
+		bytecode = evm.HexToBytes(code)
+	}
+
+	var input *evm.Calldata
+	var msg *types.Message
+	if rawTx == "" {
+		input = evm.NewCalldata(calldata)
+	} else {
+		var tx *types.Transaction
+		var err error
+		if tx, msg, err = decodeTx(rawTx, chainID); err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(out, "tx %s from %s\n\n", tx.Hash(), msg.From)
+		input, gas = evm.CalldataFromBytes(msg.Data), msg.GasLimit
+		// a contract creation runs its data as code
+		if msg.To == nil {
+			input = evm.CalldataFromBytes(nil)
+			if code == "0x0" {
+				bytecode = msg.Data
+			}
+		}
+	}
+
+	alloc := evm.GenesisAlloc{}
+	if prestate != "" {
+		var err error
+		if alloc, err = evm.ReadAlloc(prestate); err != nil {
+			panic(err)
+		}
+	}
+	addr := evm.HexToAddress(address)
+	if msg != nil && msg.To != nil {
+		addr = *msg.To
+	}
+	state := alloc.ToState()
+	account := state.GetOrNewAccount(addr)
+	// without a code the code of the account runs
+	if code == "0x0" && len(account.Code) > 0 && (msg == nil || msg.To != nil) {
+		bytecode = account.Code
+	}
 
 	ectx := evm.NewExecutionCtx(
-		evm.HexToBytes(code),
-		evm.NewCalldata(calldata),
+		bytecode,
+		input,
 		evm.NewStack(),
 		evm.NewMemory(),
-		evm.NewStorage(),
+		account.Storage,
 		gas,
 	)
+	ectx.Address, ectx.State = addr, state
+	if msg != nil {
+		ectx.Caller, ectx.Value = msg.From, msg.Value
+	}
+	if jsonOut {
+		ectx.Tracer = evm.NewJSONLogger(os.Stderr)
+	}
 	returnData, err := evm.Run(ectx)
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("\n%s                      %s\n\n", ectx.Stack, ectx.Memory)
-	fmt.Printf("%s\n\n", ectx.Storage)
-	fmt.Printf("Gas left: %d\n\n", ectx.Gas)
+	fmt.Fprintf(out, "\n%s                      %s\n\n", ectx.Stack, ectx.Memory)
+	fmt.Fprintf(out, "%s\n\n", ectx.Storage)
+	fmt.Fprintf(out, "Gas left: %d\n\n", ectx.Gas)
 
-	fmt.Println("return data", returnData)
+	fmt.Fprintln(out, "return data", returnData)
 
+	if dump != "" {
+		if err := writeAlloc(dump, state.Dump()); err != nil {
+			panic(err)
+		}
+	}
+
+}
+
+// decodeTx decodes a signed transaction and recovers its sender
+func decodeTx(raw string, chainID uint64) (*types.Transaction, *types.Message, error) {
+	b, err := evm.ParseBytes(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+	msg, err := tx.AsMessage(types.NewSigner(chainID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, msg, nil
+}
+
+// writeAlloc writes the alloc to the file, or to stdout
+func writeAlloc(path string, alloc evm.GenesisAlloc) error {
+	if path == "stdout" {
+		return evm.WriteAlloc(os.Stdout, alloc)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return evm.WriteAlloc(f, alloc)
 }
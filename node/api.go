@@ -0,0 +1,616 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"golang.org/x/exp/slices"
+)
+
+// methods are the RPC methods by name
+var methods = map[string]method{
+	"web3_clientVersion": func(*Node, json.RawMessage) (interface{}, error) { return ClientVersion, nil },
+	"net_version":        netVersion,
+	"net_listening":      func(*Node, json.RawMessage) (interface{}, error) { return true, nil },
+
+	"eth_chainId":              chainID,
+	"eth_blockNumber":          blockNumber,
+	"eth_syncing":              func(*Node, json.RawMessage) (interface{}, error) { return false, nil },
+	"eth_accounts":             accounts,
+	"eth_gasPrice":             gasPrice,
+	"eth_maxPriorityFeePerGas": func(*Node, json.RawMessage) (interface{}, error) { return "0x0", nil },
+
+	"eth_getBalance":          getBalance,
+	"eth_getTransactionCount": getTransactionCount,
+	"eth_getCode":             getCode,
+	"eth_getStorageAt":        getStorageAt,
+	"eth_getProof":            getProof,
+
+	"eth_call":               call,
+	"eth_estimateGas":        estimateGas,
+	"eth_createAccessList":   createAccessList,
+	"eth_sendRawTransaction": sendRawTransaction,
+
+	"eth_getBlockByNumber":      getBlockByNumber,
+	"eth_getBlockByHash":        getBlockByHash,
+	"eth_getTransactionByHash":  getTransactionByHash,
+	"eth_getTransactionReceipt": getTransactionReceipt,
+	"eth_getLogs":               getLogs,
+
+	// the tracing of debug.go
+	"debug_traceCall":        traceCall,
+	"debug_traceTransaction": traceTransaction,
+
+	// the test helpers of dev.go
+	"eth_sendTransaction":            sendTransaction,
+	"evm_snapshot":                   snapshot,
+	"evm_revert":                     revert,
+	"evm_mine":                       mineBlock,
+	"evm_increaseTime":               increaseTime,
+	"evm_setNextBlockTimestamp":      setNextBlockTimestamp,
+	"anvil_setBalance":               setBalance,
+	"anvil_setCode":                  setCode,
+	"anvil_setStorageAt":             setStorageAt,
+	"anvil_impersonateAccount":       impersonateAccount,
+	"anvil_stopImpersonatingAccount": stopImpersonatingAccount,
+}
+
+func netVersion(n *Node, _ json.RawMessage) (interface{}, error) {
+	return fmt.Sprint(n.config.ChainID), nil
+}
+
+func chainID(n *Node, _ json.RawMessage) (interface{}, error) {
+	return hexUint(n.config.ChainID), nil
+}
+
+func blockNumber(n *Node, _ json.RawMessage) (interface{}, error) {
+	return hexUint(n.head().Header.Number), nil
+}
+
+// gasPrice returns the base fee, the tip isn't needed to be mined
+func gasPrice(n *Node, _ json.RawMessage) (interface{}, error) {
+	return n.head().Header.BaseFee.Hex(), nil
+}
+
+// accounts returns the dev accounts and then the impersonated ones
+func accounts(n *Node, params json.RawMessage) (interface{}, error) {
+	accounts := append([]evm.Address{}, n.config.Accounts...)
+	var impersonated []evm.Address
+	for addr := range n.impersonated {
+		if !slices.Contains(accounts, addr) {
+			impersonated = append(impersonated, addr)
+		}
+	}
+	slices.SortFunc(impersonated, func(a, b evm.Address) bool { return bytes.Compare(a[:], b[:]) < 0 })
+	return append(accounts, impersonated...), nil
+}
+
+func getBalance(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	tag := latest
+	if err := parseParams(params, 1, &addr, &tag); err != nil {
+		return nil, err
+	}
+	state, _, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	return state.GetBalance(addr).Hex(), nil
+}
+
+func getTransactionCount(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	tag := latest
+	if err := parseParams(params, 1, &addr, &tag); err != nil {
+		return nil, err
+	}
+	state, _, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	return hexUint(state.GetNonce(addr)), nil
+}
+
+func getCode(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	tag := latest
+	if err := parseParams(params, 1, &addr, &tag); err != nil {
+		return nil, err
+	}
+	state, _, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	return hexBytes(state.GetCode(addr)), nil
+}
+
+func getStorageAt(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	var slot string
+	tag := latest
+	if err := parseParams(params, 2, &addr, &slot, &tag); err != nil {
+		return nil, err
+	}
+	key, err := evm.ParseWord(slot)
+	if err != nil {
+		return nil, invalidParams("invalid storage slot: %v", err)
+	}
+	state, _, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	value := state.GetStorage(addr, *key).Bytes32()
+	return hexBytes(value[:]), nil
+}
+
+// getProof returns the proof of the account and of its slots
+// against the state root of the block (EIP-1186)
+func getProof(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	var keys []string
+	tag := latest
+	if err := parseParams(params, 2, &addr, &keys, &tag); err != nil {
+		return nil, err
+	}
+	slots := make([]uint256.Int, len(keys))
+	for i, k := range keys {
+		key, err := evm.ParseWord(k)
+		if err != nil {
+			return nil, invalidParams("invalid storage slot: %v", err)
+		}
+		slots[i] = *key
+	}
+	state, _, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	return state.GetProof(addr, slots), nil
+}
+
+// call executes the call on the state of the block without mining
+// it and returns its output
+func call(n *Node, params json.RawMessage) (interface{}, error) {
+	var args callArgs
+	tag := latest
+	if err := parseParams(params, 1, &args, &tag); err != nil {
+		return nil, err
+	}
+	state, header, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	state = state.Copy()
+	msg, err := args.toMessage(state, header)
+	if err != nil {
+		return nil, err
+	}
+	result, err := core.Call(state, msg, n.blockContext(header))
+	if err != nil {
+		return nil, err
+	}
+	if result.Failed() {
+		return nil, executionError(result)
+	}
+	return hexBytes(result.ReturnData), nil
+}
+
+// estimateGas returns the lowest gas limit the call succeeds with on
+// the state of the block
+func estimateGas(n *Node, params json.RawMessage) (interface{}, error) {
+	var args callArgs
+	tag := latest
+	if err := parseParams(params, 1, &args, &tag); err != nil {
+		return nil, err
+	}
+	state, header, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := n.estimate(state, header, &args)
+	if err != nil {
+		return nil, err
+	}
+	return hexUint(gas), nil
+}
+
+// estimate returns the gas estimate of the call on the state
+func (n *Node) estimate(state *evm.State, header *types.Header, args *callArgs) (uint64, error) {
+	state = state.Copy()
+	msg, err := args.toMessage(state, header)
+	if err != nil {
+		return 0, err
+	}
+	gas, err := core.EstimateGas(state, msg, n.blockContext(header))
+	var execErr *core.ExecutionError
+	if errors.As(err, &execErr) {
+		return 0, executionError(execErr.ExecutionResult)
+	}
+	return gas, err
+}
+
+// accessListResult is the result of eth_createAccessList, with the
+// error of a failed call
+type accessListResult struct {
+	AccessList types.AccessList `json:"accessList"`
+	GasUsed    string           `json:"gasUsed"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// createAccessList returns the access list of the call on the state
+// of the block and the gas it uses with the list
+func createAccessList(n *Node, params json.RawMessage) (interface{}, error) {
+	var args callArgs
+	tag := latest
+	if err := parseParams(params, 1, &args, &tag); err != nil {
+		return nil, err
+	}
+	state, header, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	state = state.Copy()
+	msg, err := args.toMessage(state, header)
+	if err != nil {
+		return nil, err
+	}
+	list, result, err := core.CreateAccessList(state, msg, n.blockContext(header))
+	if err != nil {
+		return nil, err
+	}
+	enc := &accessListResult{AccessList: list, GasUsed: hexUint(result.UsedGas)}
+	if result.Failed() {
+		enc.Error = executionError(result).Error()
+	}
+	return enc, nil
+}
+
+// executionError returns the error of a failed call, with the
+// revert data and reason for a revert
+func executionError(result *core.ExecutionResult) error {
+	revert := result.Revert()
+	if revert == nil {
+		return result.Err
+	}
+	message := (&core.ExecutionError{ExecutionResult: result}).Error()
+	return &rpcError{Code: errCodeReverted, Message: message, Data: hexBytes(revert)}
+}
+
+func sendRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var input string
+	if err := parseParams(params, 1, &input); err != nil {
+		return nil, err
+	}
+	b, err := evm.ParseBytes(input)
+	if err != nil {
+		return nil, invalidParams("%v", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(b); err != nil {
+		return nil, invalidParams("invalid transaction: %v", err)
+	}
+	if _, err := n.mine(types.Transactions{tx}); err != nil {
+		return nil, err
+	}
+	return tx.Hash(), nil
+}
+
+func getBlockByNumber(n *Node, params json.RawMessage) (interface{}, error) {
+	var tag blockTag
+	var fullTx bool
+	if err := parseParams(params, 1, &tag, &fullTx); err != nil {
+		return nil, err
+	}
+	block, err := n.blockByTag(tag)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return n.marshalBlock(block, fullTx), nil
+}
+
+func getBlockByHash(n *Node, params json.RawMessage) (interface{}, error) {
+	var hash evm.Hash
+	var fullTx bool
+	if err := parseParams(params, 1, &hash, &fullTx); err != nil {
+		return nil, err
+	}
+	block := n.blockByHash(hash)
+	if block == nil {
+		return nil, nil
+	}
+	return n.marshalBlock(block, fullTx), nil
+}
+
+func getTransactionByHash(n *Node, params json.RawMessage) (interface{}, error) {
+	var hash evm.Hash
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+	lookup, ok := n.txLookup[hash]
+	if !ok {
+		return nil, nil
+	}
+	return n.marshalTransaction(n.blocks[lookup.block], lookup.index), nil
+}
+
+func getTransactionReceipt(n *Node, params json.RawMessage) (interface{}, error) {
+	var hash evm.Hash
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+	lookup, ok := n.txLookup[hash]
+	if !ok {
+		return nil, nil
+	}
+	return n.marshalReceipt(lookup.block, lookup.index), nil
+}
+
+func getLogs(n *Node, params json.RawMessage) (interface{}, error) {
+	var query filterQuery
+	if err := parseParams(params, 1, &query); err != nil {
+		return nil, err
+	}
+	from, to, err := n.filterRange(&query)
+	if err != nil {
+		return nil, err
+	}
+	logs := []*rpcLog{}
+	for number := from; number <= to; number++ {
+		for _, log := range n.blockLogs(number) {
+			if query.matches(log) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// filterRange returns the range of blocks of the query, clamped to
+// the head. The range is empty, from past to, when it starts after
+// the head.
+func (n *Node) filterRange(query *filterQuery) (uint64, uint64, error) {
+	if query.BlockHash != nil {
+		number, ok := n.blockNumbers[*query.BlockHash]
+		if !ok {
+			return 0, 0, errUnknownBlock
+		}
+		return number, number, nil
+	}
+	head := n.head().Header.Number
+	from, err := n.resolveNumber(query.FromBlock, head)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := n.resolveNumber(query.ToBlock, head)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch {
+	case from > head:
+		// no blocks yet, like the other nodes
+		return from, head, nil
+	case from > to:
+		return 0, 0, invalidParams("invalid block range")
+	case to > head:
+		to = head
+	}
+	return from, to, nil
+}
+
+// blockTag is a block number, a tag like latest, or a block hash.
+// The object of EIP-1898 is accepted too.
+type blockTag string
+
+const latest blockTag = "latest"
+
+func (t *blockTag) UnmarshalJSON(input []byte) error {
+	var s string
+	if err := json.Unmarshal(input, &s); err == nil {
+		*t = blockTag(s)
+		return nil
+	}
+	var obj struct {
+		BlockNumber string `json:"blockNumber"`
+		BlockHash   string `json:"blockHash"`
+	}
+	if err := json.Unmarshal(input, &obj); err != nil {
+		return err
+	}
+	if obj.BlockHash != "" {
+		*t = blockTag(obj.BlockHash)
+	} else {
+		*t = blockTag(obj.BlockNumber)
+	}
+	return nil
+}
+
+// isHash reports whether the tag is a block hash
+func (t blockTag) isHash() bool {
+	return len(t) == 2+2*len(evm.Hash{}) && strings.HasPrefix(string(t), "0x")
+}
+
+// resolveNumber returns the number of the block of the tag, the
+// head for the empty tag. The block may not exist.
+func (n *Node) resolveNumber(tag blockTag, head uint64) (uint64, error) {
+	switch tag {
+	case "", "latest", "pending", "safe", "finalized":
+		return head, nil
+	case "earliest":
+		return 0, nil
+	}
+	if tag.isHash() {
+		number, ok := n.blockNumbers[evm.HexToHash(string(tag))]
+		if !ok {
+			return 0, errUnknownBlock
+		}
+		return number, nil
+	}
+	number, err := evm.ParseWord(string(tag))
+	if err != nil || !strings.HasPrefix(string(tag), "0x") || !number.IsUint64() {
+		return 0, invalidParams("invalid block number %q", tag)
+	}
+	return number.Uint64(), nil
+}
+
+// blockByTag returns the block of the tag, nil if it doesn't exist
+func (n *Node) blockByTag(tag blockTag) (*types.Block, error) {
+	number, err := n.resolveNumber(tag, n.head().Header.Number)
+	if errors.Is(err, errUnknownBlock) || number >= uint64(len(n.blocks)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n.blocks[number], nil
+}
+
+// stateAt returns the post-state and the header of the block of
+// the tag
+func (n *Node) stateAt(tag blockTag) (*evm.State, *types.Header, error) {
+	block, err := n.blockByTag(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, errUnknownBlock
+	}
+	return n.states[block.Header.Number], block.Header, nil
+}
+
+// callArgs are the fields of the call object of eth_call
+type callArgs struct {
+	From                 *evm.Address     `json:"from"`
+	To                   *evm.Address     `json:"to"`
+	Gas                  string           `json:"gas"`
+	GasPrice             string           `json:"gasPrice"`
+	MaxFeePerGas         string           `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string           `json:"maxPriorityFeePerGas"`
+	Value                string           `json:"value"`
+	Nonce                string           `json:"nonce"`
+	Data                 string           `json:"data"`
+	Input                string           `json:"input"`
+	AccessList           types.AccessList `json:"accessList"`
+}
+
+// toMessage returns the call as a message. The sender defaults to the
+// zero address, the gas to the gas limit of the block and the nonce
+// to the one of the sender.
+func (args *callArgs) toMessage(state *evm.State, header *types.Header) (*types.Message, error) {
+	msg := &types.Message{To: args.To, GasLimit: header.GasLimit, AccessList: args.AccessList}
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	if args.Input != "" && args.Data != "" && args.Input != args.Data {
+		return nil, invalidParams(`both "data" and "input" are set and not equal`)
+	}
+	input := args.Input
+	if input == "" {
+		input = args.Data
+	}
+	data, err := evm.ParseBytes(input)
+	if err != nil {
+		return nil, invalidParams("invalid input: %v", err)
+	}
+	msg.Data = data
+
+	words := make([]*uint256.Int, 6)
+	for i, s := range []string{args.Gas, args.Nonce, args.Value, args.GasPrice, args.MaxFeePerGas, args.MaxPriorityFeePerGas} {
+		if s == "" {
+			continue
+		}
+		if words[i], err = evm.ParseWord(s); err != nil {
+			return nil, invalidParams("%v", err)
+		}
+	}
+	if words[0] != nil {
+		if !words[0].IsUint64() {
+			return nil, invalidParams("gas %s is too large", args.Gas)
+		}
+		msg.GasLimit = words[0].Uint64()
+	}
+	msg.Nonce = state.GetNonce(msg.From)
+	if words[1] != nil {
+		if !words[1].IsUint64() {
+			return nil, invalidParams("nonce %s is too large", args.Nonce)
+		}
+		msg.Nonce = words[1].Uint64()
+	}
+	msg.Value, msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = words[2], words[3], words[4], words[5]
+	return msg, nil
+}
+
+// filterQuery is the filter object of eth_getLogs. Addresses and
+// topics may be single values or lists of alternatives, an empty
+// topic position matches any topic.
+type filterQuery struct {
+	FromBlock blockTag
+	ToBlock   blockTag
+	BlockHash *evm.Hash
+	Addresses []evm.Address
+	Topics    [][]evm.Hash
+}
+
+func (q *filterQuery) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		FromBlock blockTag          `json:"fromBlock"`
+		ToBlock   blockTag          `json:"toBlock"`
+		BlockHash *evm.Hash         `json:"blockHash"`
+		Address   json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.BlockHash != nil && (dec.FromBlock != "" || dec.ToBlock != "") {
+		return errors.New("cannot specify both blockHash and fromBlock/toBlock")
+	}
+	q.FromBlock, q.ToBlock, q.BlockHash = dec.FromBlock, dec.ToBlock, dec.BlockHash
+	if err := unmarshalOneOrMany(dec.Address, &q.Addresses); err != nil {
+		return fmt.Errorf("address: %w", err)
+	}
+	q.Topics = make([][]evm.Hash, len(dec.Topics))
+	for i, topic := range dec.Topics {
+		if err := unmarshalOneOrMany(topic, &q.Topics[i]); err != nil {
+			return fmt.Errorf("topic %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalOneOrMany decodes a value or a list of values, null is
+// the empty list
+func unmarshalOneOrMany[T any](input json.RawMessage, values *[]T) error {
+	if len(input) == 0 || string(input) == "null" {
+		return nil
+	}
+	if input[0] == '[' {
+		return json.Unmarshal(input, values)
+	}
+	var value T
+	if err := json.Unmarshal(input, &value); err != nil {
+		return err
+	}
+	*values = []T{value}
+	return nil
+}
+
+func (q *filterQuery) matches(log *rpcLog) bool {
+	if len(q.Addresses) > 0 && !slices.Contains(q.Addresses, log.Address) {
+		return false
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, alternatives := range q.Topics {
+		if len(alternatives) > 0 && !slices.Contains(alternatives, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,303 @@
+package node
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendStore sends a transaction storing the value with the contract
+// through the server
+func sendStore(t *testing.T, server *httptest.Server, nonce, value uint64) evm.Hash {
+	b, err := signedTx(t, nonce, &contract, uint256.NewInt(value).PaddedBytes(32)).MarshalBinary()
+	assert.NoError(t, err)
+	var hash evm.Hash
+	assert.Nil(t, rpcCall(t, server, &hash, "eth_sendRawTransaction", fmt.Sprintf("0x%x", b)))
+	return hash
+}
+
+func TestStateMethods(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+
+	var result string
+	assert.Nil(t, rpcCall(t, server, &result, "eth_blockNumber"))
+	assert.Equal(t, "0x1", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_chainId"))
+	assert.Equal(t, "0x7a69", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_gasPrice"))
+	assert.Equal(t, "0x7", result)
+
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getTransactionCount", sender, "latest"))
+	assert.Equal(t, "0x1", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getTransactionCount", sender, "earliest"))
+	assert.Equal(t, "0x0", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getBalance", sender, "0x0"))
+	assert.Equal(t, "0xde0b6b3a7640000", result)
+
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getStorageAt", contract, "0x0", "latest"))
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000005", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getCode", contract))
+	assert.Equal(t, "0x"+contractCode, result)
+
+	// the state of a block by its hash (EIP-1898)
+	var block rpcBlock
+	assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", "0x0", false))
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getStorageAt", contract, "0x0", map[string]string{"blockHash": block.Hash.Hex()}))
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000000", result)
+
+	err := rpcCall(t, server, &result, "eth_getBalance", sender, "0x5")
+	assert.Equal(t, "unknown block", err.Message)
+	err = rpcCall(t, server, &result, "eth_getBalance", sender, "pendingx")
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestGetProof(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+
+	for _, tag := range []string{"0x0", "0x1"} {
+		var block rpcBlock
+		assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", tag, false))
+		var proof evm.AccountProof
+		assert.Nil(t, rpcCall(t, server, &proof, "eth_getProof", contract, []string{"0x0", "0x1"}, tag))
+		assert.NoError(t, proof.Verify(block.StateRoot))
+		assert.Equal(t, contract, proof.Address)
+		assert.Len(t, proof.StorageProof, 2)
+		assert.True(t, proof.StorageProof[1].Value.IsZero())
+	}
+	var proof evm.AccountProof
+	assert.Nil(t, rpcCall(t, server, &proof, "eth_getProof", contract, []string{"0x0"}))
+	assert.Equal(t, uint64(5), proof.StorageProof[0].Value.Uint64())
+
+	// the proof doesn't hold against the root of another block
+	var genesis rpcBlock
+	assert.Nil(t, rpcCall(t, server, &genesis, "eth_getBlockByNumber", "0x0", false))
+	assert.Error(t, proof.Verify(genesis.StateRoot))
+
+	// a missing account is proved absent
+	assert.Nil(t, rpcCall(t, server, &proof, "eth_getProof", evm.HexToAddress("0xdead"), []string{}, "latest"))
+	var block rpcBlock
+	assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", "latest", false))
+	assert.NoError(t, proof.Verify(block.StateRoot))
+	assert.True(t, proof.Balance.IsZero())
+
+	err := rpcCall(t, server, &proof, "eth_getProof", contract, []string{"0xzz"})
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestCall(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+
+	var result string
+	assert.Nil(t, rpcCall(t, server, &result, "eth_call", map[string]interface{}{"to": contract}, "latest"))
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000005", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_call", map[string]interface{}{"to": contract}, "earliest"))
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000000", result)
+
+	// a call changes nothing
+	assert.Nil(t, rpcCall(t, server, &result, "eth_call", map[string]interface{}{"from": sender, "to": contract, "input": "0x" + fmt.Sprintf("%064x", 9)}))
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getStorageAt", contract, "0x0"))
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000005", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getTransactionCount", sender))
+	assert.Equal(t, "0x1", result)
+
+	// the code of a creation reverting with Error("denied")
+	revert := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000006" +
+		"64656e6965640000000000000000000000000000000000000000000000000000"
+	err := rpcCall(t, server, &result, "eth_call", map[string]interface{}{"data": "0x6064600c6000396064" + "6000fd" + revert})
+	assert.Equal(t, errCodeReverted, err.Code)
+	assert.Equal(t, "execution reverted: denied", err.Message)
+	assert.Equal(t, "0x"+revert, err.Data)
+
+	err = rpcCall(t, server, &result, "eth_call", map[string]interface{}{"to": contract, "gas": "0x100"})
+	assert.Equal(t, errCodeServer, err.Code)
+	assert.Contains(t, err.Message, "intrinsic gas too low")
+	err = rpcCall(t, server, &result, "eth_call", map[string]interface{}{"to": contract, "data": "0x01", "input": "0x02"})
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestEstimateGas(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	store := map[string]interface{}{"from": sender, "to": contract, "data": fmt.Sprintf("0x%064x", 5)}
+	var gas string
+	assert.Nil(t, rpcCall(t, server, &gas, "eth_estimateGas", store))
+	// the store uses all the gas it needs
+	hash := sendStore(t, server, 0, 5)
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Equal(t, receipt.GasUsed, gas)
+
+	assert.Nil(t, rpcCall(t, server, &gas, "eth_estimateGas", map[string]interface{}{"to": evm.HexToAddress("0x2000")}, "earliest"))
+	assert.Equal(t, "0x5208", gas)
+
+	// the code of a creation reverting with Error("denied")
+	revert := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000006" +
+		"64656e6965640000000000000000000000000000000000000000000000000000"
+	err := rpcCall(t, server, &gas, "eth_estimateGas", map[string]interface{}{"data": "0x6064600c6000396064" + "6000fd" + revert})
+	assert.Equal(t, errCodeReverted, err.Code)
+	assert.Equal(t, "execution reverted: denied", err.Message)
+	assert.Equal(t, "0x"+revert, err.Data)
+
+	// the sender can't pay for the gas of the store
+	store["gasPrice"] = "0xde0b6b3a7640000"
+	err = rpcCall(t, server, &gas, "eth_estimateGas", store)
+	assert.Equal(t, errCodeServer, err.Code)
+	assert.Contains(t, err.Message, "intrinsic gas too low")
+}
+
+func TestCreateAccessList(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	var result accessListResult
+	assert.Nil(t, rpcCall(t, server, &result, "eth_createAccessList", map[string]interface{}{"from": sender, "to": contract, "data": fmt.Sprintf("0x%064x", 5)}))
+	assert.Equal(t, types.AccessList{{Address: contract, StorageKeys: []evm.Hash{{}}}}, result.AccessList)
+	assert.Empty(t, result.Error)
+
+	// the list applied to the transaction
+	tx := signedTx(t, 0, &contract, uint256.NewInt(5).PaddedBytes(32))
+	tx.Type, tx.ChainID, tx.AccessList = types.AccessListTxType, uint256.NewInt(DefaultConfig().ChainID), result.AccessList
+	assert.NoError(t, types.NewSigner(DefaultConfig().ChainID).SignTx(tx, senderKey))
+	b, err := tx.MarshalBinary()
+	assert.NoError(t, err)
+	var hash evm.Hash
+	assert.Nil(t, rpcCall(t, server, &hash, "eth_sendRawTransaction", fmt.Sprintf("0x%x", b)))
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Equal(t, result.GasUsed, receipt.GasUsed)
+
+	// a failed call has the error in the result
+	revert := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000006" +
+		"64656e6965640000000000000000000000000000000000000000000000000000"
+	assert.Nil(t, rpcCall(t, server, &result, "eth_createAccessList", map[string]interface{}{"data": "0x6064600c6000396064" + "6000fd" + revert}))
+	assert.Equal(t, types.AccessList{}, result.AccessList)
+	assert.Equal(t, "execution reverted: denied", result.Error)
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	var hash evm.Hash
+	err := rpcCall(t, server, &hash, "eth_sendRawTransaction", "0x01")
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+
+	b, _ := signedTx(t, 3, &contract, nil).MarshalBinary()
+	err = rpcCall(t, server, &hash, "eth_sendRawTransaction", fmt.Sprintf("0x%x", b))
+	assert.Equal(t, errCodeServer, err.Code)
+	assert.Contains(t, err.Message, "nonce too high")
+
+	var number string
+	assert.Nil(t, rpcCall(t, server, &number, "eth_blockNumber"))
+	assert.Equal(t, "0x0", number)
+}
+
+func TestBlocksAndReceipts(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	hash := sendStore(t, server, 0, 5)
+
+	var block rpcBlock
+	assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", "latest", false))
+	assert.Equal(t, "0x1", block.Number)
+	assert.Equal(t, []interface{}{hash.Hex()}, block.Transactions)
+	assert.Equal(t, "0x7", block.BaseFeePerGas)
+	assert.Equal(t, &[]*rpcWithdrawal{}, block.Withdrawals)
+
+	var byHash rpcBlock
+	assert.Nil(t, rpcCall(t, server, &byHash, "eth_getBlockByHash", block.Hash, true))
+	assert.Equal(t, block.StateRoot, byHash.StateRoot)
+	full := byHash.Transactions[0].(map[string]interface{})
+	assert.Equal(t, sender.Hex(), full["from"])
+	assert.Equal(t, hash.Hex(), full["hash"])
+
+	var tx rpcTransaction
+	assert.Nil(t, rpcCall(t, server, &tx, "eth_getTransactionByHash", hash))
+	assert.Equal(t, block.Hash, tx.BlockHash)
+	assert.Equal(t, "0x0", tx.TransactionIndex)
+	assert.Equal(t, "0xa", tx.GasPrice)
+	assert.Equal(t, &contract, tx.To)
+	assert.Equal(t, "0x0", tx.Type)
+
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Equal(t, "0x1", receipt.Status)
+	assert.Equal(t, block.GasUsed, receipt.GasUsed)
+	assert.Equal(t, "0xa", receipt.EffectiveGasPrice)
+	assert.Nil(t, receipt.ContractAddress)
+	assert.Len(t, receipt.Logs, 1)
+	assert.Equal(t, block.LogsBloom, receipt.LogsBloom)
+	assert.Equal(t, hash, receipt.Logs[0].TransactionHash)
+
+	var missing *rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &missing, "eth_getTransactionReceipt", evm.Hash{}))
+	assert.Nil(t, missing)
+}
+
+func TestGetLogs(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+	sendStore(t, server, 1, 6)
+
+	var logs []*rpcLog
+	assert.Nil(t, rpcCall(t, server, &logs, "eth_getLogs", map[string]interface{}{"fromBlock": "earliest"}))
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "0x2", logs[1].BlockNumber)
+	assert.Equal(t, fmt.Sprintf("0x%064x", 6), logs[1].Data)
+	assert.Equal(t, []evm.Hash{evm.HexToHash("0xaa")}, logs[1].Topics)
+
+	// the latest block by default
+	assert.Nil(t, rpcCall(t, server, &logs, "eth_getLogs", map[string]interface{}{}))
+	assert.Len(t, logs, 1)
+
+	for _, tc := range []struct {
+		query map[string]interface{}
+		logs  int
+	}{
+		{map[string]interface{}{"fromBlock": "0x1", "toBlock": "0x1"}, 1},
+		{map[string]interface{}{"fromBlock": "0x0", "address": contract}, 2},
+		{map[string]interface{}{"fromBlock": "0x0", "address": []evm.Address{evm.HexToAddress("0x2000")}}, 0},
+		{map[string]interface{}{"fromBlock": "0x0", "topics": []interface{}{"0x" + fmt.Sprintf("%064x", 0xaa)}}, 2},
+		{map[string]interface{}{"fromBlock": "0x0", "topics": []interface{}{[]interface{}{evm.Hash{}, evm.HexToHash("0xaa")}}}, 2},
+		{map[string]interface{}{"fromBlock": "0x0", "topics": []interface{}{evm.Hash{}}}, 0},
+		{map[string]interface{}{"fromBlock": "0x0", "topics": []interface{}{nil, nil}}, 0},
+		{map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x100"}, 2},
+		{map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x0"}, 0},
+		// past the head
+		{map[string]interface{}{"fromBlock": "0x3"}, 0},
+		{map[string]interface{}{"fromBlock": "0x3", "toBlock": "0x100"}, 0},
+	} {
+		assert.Nil(t, rpcCall(t, server, &logs, "eth_getLogs", tc.query))
+		assert.Len(t, logs, tc.logs, "%v", tc.query)
+	}
+
+	var block rpcBlock
+	assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", "0x1", false))
+	assert.Nil(t, rpcCall(t, server, &logs, "eth_getLogs", map[string]interface{}{"blockHash": block.Hash}))
+	assert.Len(t, logs, 1)
+	assert.Equal(t, block.Hash, logs[0].BlockHash)
+
+	err := rpcCall(t, server, &logs, "eth_getLogs", map[string]interface{}{"fromBlock": "0x2", "toBlock": "0x1"})
+	assert.Equal(t, "invalid block range", err.Message)
+	err = rpcCall(t, server, &logs, "eth_getLogs", map[string]interface{}{"fromBlock": "0x1", "blockHash": block.Hash})
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
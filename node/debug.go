@@ -0,0 +1,169 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+)
+
+// traceConfig are the options of the tracing methods. The default
+// tracer is the struct logger, configured by the flags of LogConfig.
+type traceConfig struct {
+	evm.LogConfig
+	Tracer       string          `json:"tracer"`
+	TracerConfig json.RawMessage `json:"tracerConfig"`
+	// Timeout is ignored, an execution is never stopped
+	Timeout string `json:"timeout"`
+}
+
+// structLoggerResult is the result of the struct logger, the output
+// without the 0x prefix
+type structLoggerResult struct {
+	Gas         uint64          `json:"gas"`
+	Failed      bool            `json:"failed"`
+	ReturnValue string          `json:"returnValue"`
+	StructLogs  []evm.StructLog `json:"structLogs"`
+}
+
+// traceCall traces the call on the state of the block
+func traceCall(n *Node, params json.RawMessage) (interface{}, error) {
+	var args callArgs
+	var config traceConfig
+	tag := latest
+	if err := parseParams(params, 1, &args, &tag, &config); err != nil {
+		return nil, err
+	}
+	tracer, err := newTracer(&config)
+	if err != nil {
+		return nil, err
+	}
+	state, header, err := n.stateAt(tag)
+	if err != nil {
+		return nil, err
+	}
+	state = state.Copy()
+	msg, err := args.toMessage(state, header)
+	if err != nil {
+		return nil, err
+	}
+	blockCtx := n.blockContext(header)
+	blockCtx.Tracer = tracer
+	result, err := core.Call(state, msg, blockCtx)
+	if err != nil {
+		return nil, err
+	}
+	return traceResult(tracer, msg, result.UsedGas, result.Failed())
+}
+
+// traceTransaction replays the block of the transaction on the state
+// of its parent and traces the transaction
+func traceTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var hash evm.Hash
+	var config traceConfig
+	if err := parseParams(params, 1, &hash, &config); err != nil {
+		return nil, err
+	}
+	tracer, err := newTracer(&config)
+	if err != nil {
+		return nil, err
+	}
+	lookup, ok := n.txLookup[hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", hash.Hex())
+	}
+	block := n.blocks[lookup.block]
+	state := n.states[lookup.block-1].Copy()
+	gasUsed := uint64(0)
+	for i, tx := range block.Transactions[:lookup.index+1] {
+		blockCtx := n.blockContext(block.Header)
+		blockCtx.GasLimit -= gasUsed
+		if i == lookup.index {
+			blockCtx.Tracer = tracer
+		}
+		msg := tx.ToMessage(n.sender(tx))
+		receipt, err := core.ApplyMessage(state, msg, blockCtx)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if i == lookup.index {
+			return traceResult(tracer, msg, receipt.GasUsed, receipt.Status == types.ReceiptStatusFailed)
+		}
+		gasUsed += receipt.GasUsed
+	}
+	return nil, nil
+}
+
+// newTracer returns the tracer of the config
+func newTracer(config *traceConfig) (evm.Tracer, error) {
+	switch config.Tracer {
+	case "":
+		return evm.NewStructLogger(&config.LogConfig), nil
+	case "callTracer":
+		// the calls don't nest, onlyTopCall changes nothing
+		var tracerConfig struct {
+			OnlyTopCall bool `json:"onlyTopCall"`
+			WithLog     bool `json:"withLog"`
+		}
+		if err := unmarshalTracerConfig(config.TracerConfig, &tracerConfig); err != nil {
+			return nil, err
+		}
+		return evm.NewCallTracer(tracerConfig.WithLog), nil
+	case "prestateTracer":
+		var tracerConfig struct {
+			DiffMode bool `json:"diffMode"`
+		}
+		if err := unmarshalTracerConfig(config.TracerConfig, &tracerConfig); err != nil {
+			return nil, err
+		}
+		return evm.NewPrestateTracer(tracerConfig.DiffMode), nil
+	case "4byteTracer":
+		return evm.NewFourByteTracer(), nil
+	}
+	return nil, invalidParams("unknown tracer %q", config.Tracer)
+}
+
+func unmarshalTracerConfig(input json.RawMessage, v interface{}) error {
+	if len(input) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(input, v); err != nil {
+		return invalidParams("invalid tracer config: %v", err)
+	}
+	return nil
+}
+
+// traceResult returns the result of the tracer of the message
+func traceResult(tracer evm.Tracer, msg *types.Message, gasUsed uint64, failed bool) (interface{}, error) {
+	switch t := tracer.(type) {
+	case *evm.StructLogger:
+		logs := t.StructLogs()
+		if logs == nil {
+			logs = []evm.StructLog{}
+		}
+		return &structLoggerResult{Gas: gasUsed, Failed: failed, ReturnValue: fmt.Sprintf("%x", t.Output()), StructLogs: logs}, nil
+	case *evm.CallTracer:
+		result, err := t.GetResult()
+		if err != nil {
+			return nil, err
+		}
+		// the frame of the tracer starts after the intrinsic gas and
+		// is always a call
+		var frame evm.CallFrame
+		if err := json.Unmarshal(result, &frame); err != nil {
+			return nil, err
+		}
+		frame.Gas, frame.GasUsed = hexUint(msg.GasLimit), hexUint(gasUsed)
+		if msg.To == nil {
+			frame.Type, frame.Input = "CREATE", hexBytes(msg.Data)
+		}
+		return &frame, nil
+	case *evm.PrestateTracer:
+		return t.GetResult()
+	case *evm.FourByteTracer:
+		return t.GetResult()
+	}
+	return nil, fmt.Errorf("tracer %T has no result", tracer)
+}
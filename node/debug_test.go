@@ -0,0 +1,113 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceTransaction(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+	hash := sendStore(t, server, 1, 6)
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+
+	var logs structLoggerResult
+	assert.Nil(t, rpcCall(t, server, &logs, "debug_traceTransaction", hash))
+	assert.Equal(t, receipt.GasUsed, hexUint(logs.Gas))
+	assert.False(t, logs.Failed)
+	assert.Equal(t, "", logs.ReturnValue)
+	// the store branch of the contract
+	assert.Len(t, logs.StructLogs, 16)
+	assert.Equal(t, "CALLDATASIZE", logs.StructLogs[0].Op)
+	assert.Equal(t, &[]string{}, logs.StructLogs[0].Stack)
+	assert.Nil(t, logs.StructLogs[0].Memory)
+	sstore := logs.StructLogs[8]
+	assert.Equal(t, "SSTORE", sstore.Op)
+	assert.Equal(t, &map[string]string{fmt.Sprintf("%064x", 0): fmt.Sprintf("%064x", 6)}, sstore.Storage)
+
+	var configured structLoggerResult
+	config := map[string]interface{}{"disableStack": true, "enableMemory": true}
+	assert.Nil(t, rpcCall(t, server, &configured, "debug_traceTransaction", hash, config))
+	assert.Nil(t, configured.StructLogs[0].Stack)
+	assert.Equal(t, &[]string{fmt.Sprintf("%064x", 6)}, configured.StructLogs[15].Memory)
+
+	var frame evm.CallFrame
+	config = map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]interface{}{"withLog": true}}
+	assert.Nil(t, rpcCall(t, server, &frame, "debug_traceTransaction", hash, config))
+	assert.Equal(t, "CALL", frame.Type)
+	assert.Equal(t, sender, frame.From)
+	assert.Equal(t, contract, frame.To)
+	assert.Equal(t, "0x186a0", frame.Gas)
+	assert.Equal(t, receipt.GasUsed, frame.GasUsed)
+	assert.Len(t, frame.Logs, 1)
+
+	var prestate map[evm.Address]*evm.PrestateAccount
+	assert.Nil(t, rpcCall(t, server, &prestate, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "prestateTracer"}))
+	// the state before the transaction
+	assert.Equal(t, map[string]string{fmt.Sprintf("0x%064x", 0): fmt.Sprintf("0x%064x", 5)}, prestate[contract].Storage)
+	assert.Equal(t, "0x"+contractCode, prestate[contract].Code)
+	// the sender before it bought the gas, and the coinbase paid
+	// by the first transaction
+	assert.Equal(t, uint64(1), prestate[sender].Nonce)
+	var balance string
+	assert.Nil(t, rpcCall(t, server, &balance, "eth_getBalance", sender, "0x1"))
+	assert.Equal(t, balance, prestate[sender].Balance)
+	assert.Contains(t, prestate, DefaultConfig().Coinbase)
+
+	var ids map[string]int
+	assert.Nil(t, rpcCall(t, server, &ids, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "4byteTracer"}))
+	assert.Equal(t, map[string]int{"0x00000000-28": 1}, ids)
+
+	err := rpcCall(t, server, &logs, "debug_traceTransaction", evm.Hash{})
+	assert.Contains(t, err.Message, "not found")
+	err = rpcCall(t, server, &logs, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "noopTracer"})
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+	err = rpcCall(t, server, &logs, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "callTracer", "tracerConfig": true})
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestTraceCall(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	// a transfer runs no code
+	var frame evm.CallFrame
+	to := evm.HexToAddress("0x2000")
+	callTracer := map[string]interface{}{"tracer": "callTracer"}
+	assert.Nil(t, rpcCall(t, server, &frame, "debug_traceCall", map[string]interface{}{"from": sender, "to": to, "value": "0x1", "gas": "0x5208"}, "latest", callTracer))
+	assert.Equal(t, "CALL", frame.Type)
+	assert.Equal(t, to, frame.To)
+	assert.Equal(t, "0x1", frame.Value)
+	assert.Equal(t, "0x5208", frame.GasUsed)
+
+	// the code of a creation reverting with Error("denied")
+	revert := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000006" +
+		"64656e6965640000000000000000000000000000000000000000000000000000"
+	create := map[string]interface{}{"data": "0x6064600c6000396064" + "6000fd" + revert}
+	var logs structLoggerResult
+	assert.Nil(t, rpcCall(t, server, &logs, "debug_traceCall", create))
+	assert.True(t, logs.Failed)
+	assert.Equal(t, revert, logs.ReturnValue)
+	assert.Equal(t, "REVERT", logs.StructLogs[len(logs.StructLogs)-1].Op)
+
+	assert.Nil(t, rpcCall(t, server, &frame, "debug_traceCall", create, "latest", callTracer))
+	assert.Equal(t, "CREATE", frame.Type)
+	assert.Equal(t, "execution reverted", frame.Error)
+	assert.Equal(t, "denied", frame.RevertReason)
+
+	// the call changes nothing
+	var raw json.RawMessage
+	assert.Nil(t, rpcCall(t, server, &raw, "debug_traceCall", map[string]interface{}{"from": sender, "to": contract, "data": fmt.Sprintf("0x%064x", 9)}))
+	var slot string
+	assert.Nil(t, rpcCall(t, server, &slot, "eth_getStorageAt", contract, "0x0"))
+	assert.Equal(t, fmt.Sprintf("0x%064x", 0), slot)
+}
@@ -0,0 +1,269 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"golang.org/x/exp/slices"
+)
+
+// The test helpers of the Hardhat and Anvil dev nodes. The setters
+// change the state of the head in place, the next block commits to
+// it.
+
+// chainSnapshot is the chain saved by evm_snapshot: the head, the
+// snapshot of its state and the clock
+type chainSnapshot struct {
+	head          uint64
+	state         int
+	timeOffset    int64
+	nextTimestamp uint64
+}
+
+// quantity is an integer given as a JSON number or a hex string
+type quantity uint64
+
+func (q *quantity) UnmarshalJSON(input []byte) error {
+	var u uint64
+	if err := json.Unmarshal(input, &u); err == nil {
+		*q = quantity(u)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	w, err := evm.ParseWord(s)
+	if err != nil {
+		return err
+	}
+	if !w.IsUint64() {
+		return fmt.Errorf("quantity %s is too large", s)
+	}
+	*q = quantity(w.Uint64())
+	return nil
+}
+
+// snapshot saves the chain and returns the id of the snapshot
+func snapshot(n *Node, _ json.RawMessage) (interface{}, error) {
+	head := len(n.states) - 1
+	n.snapshots = append(n.snapshots, &chainSnapshot{
+		head:          uint64(head),
+		state:         n.states[head].Snapshot(),
+		timeOffset:    n.timeOffset,
+		nextTimestamp: n.nextTimestamp,
+	})
+	return hexUint(uint64(len(n.snapshots) - 1)), nil
+}
+
+// revert restores the chain saved by the snapshot, the snapshot and
+// the ones taken after it are discarded. It returns false for an
+// unknown snapshot.
+func revert(n *Node, params json.RawMessage) (interface{}, error) {
+	var id quantity
+	if err := parseParams(params, 1, &id); err != nil {
+		return nil, err
+	}
+	if uint64(id) >= uint64(len(n.snapshots)) {
+		return false, nil
+	}
+	snap := n.snapshots[id]
+	n.truncate(snap.head)
+	n.states[snap.head].RevertToSnapshot(snap.state)
+	n.timeOffset, n.nextTimestamp = snap.timeOffset, snap.nextTimestamp
+	n.snapshots = n.snapshots[:id]
+	return true, nil
+}
+
+// mineBlock mines an empty block, at the timestamp if given
+func mineBlock(n *Node, params json.RawMessage) (interface{}, error) {
+	var timestamp *quantity
+	if err := parseParams(params, 0, &timestamp); err != nil {
+		return nil, err
+	}
+	if timestamp != nil {
+		if err := n.setNextTimestamp(uint64(*timestamp)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := n.mine(nil); err != nil {
+		return nil, err
+	}
+	return "0x0", nil
+}
+
+// increaseTime moves the clock forward by the seconds and returns
+// the total offset of the clock
+func increaseTime(n *Node, params json.RawMessage) (interface{}, error) {
+	var seconds quantity
+	if err := parseParams(params, 1, &seconds); err != nil {
+		return nil, err
+	}
+	n.timeOffset += int64(seconds)
+	return n.timeOffset, nil
+}
+
+func setNextBlockTimestamp(n *Node, params json.RawMessage) (interface{}, error) {
+	var timestamp quantity
+	if err := parseParams(params, 1, &timestamp); err != nil {
+		return nil, err
+	}
+	return nil, n.setNextTimestamp(uint64(timestamp))
+}
+
+// setNextTimestamp sets the timestamp of the next block, it must be
+// after the head
+func (n *Node) setNextTimestamp(timestamp uint64) error {
+	if head := n.head().Header.Time; timestamp <= head {
+		return invalidParams("timestamp %d is not after the timestamp %d of the latest block", timestamp, head)
+	}
+	n.nextTimestamp = timestamp
+	return nil
+}
+
+func setBalance(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	var balance string
+	if err := parseParams(params, 2, &addr, &balance); err != nil {
+		return nil, err
+	}
+	value, err := evm.ParseWord(balance)
+	if err != nil {
+		return nil, invalidParams("invalid balance: %v", err)
+	}
+	n.states[len(n.states)-1].GetOrNewAccount(addr).Balance = value
+	return nil, nil
+}
+
+func setCode(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	var input string
+	if err := parseParams(params, 2, &addr, &input); err != nil {
+		return nil, err
+	}
+	code, err := evm.ParseBytes(input)
+	if err != nil {
+		return nil, invalidParams("invalid code: %v", err)
+	}
+	n.states[len(n.states)-1].SetCode(addr, code)
+	return nil, nil
+}
+
+func setStorageAt(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	var slot, value string
+	if err := parseParams(params, 3, &addr, &slot, &value); err != nil {
+		return nil, err
+	}
+	key, err := evm.ParseWord(slot)
+	if err != nil {
+		return nil, invalidParams("invalid storage slot: %v", err)
+	}
+	word, err := evm.ParseWord(value)
+	if err != nil {
+		return nil, invalidParams("invalid storage value: %v", err)
+	}
+	n.states[len(n.states)-1].SetStorage(addr, key, word)
+	return true, nil
+}
+
+func impersonateAccount(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	if err := parseParams(params, 1, &addr); err != nil {
+		return nil, err
+	}
+	n.impersonated[addr] = true
+	return nil, nil
+}
+
+func stopImpersonatingAccount(n *Node, params json.RawMessage) (interface{}, error) {
+	var addr evm.Address
+	if err := parseParams(params, 1, &addr); err != nil {
+		return nil, err
+	}
+	delete(n.impersonated, addr)
+	return nil, nil
+}
+
+// sendTransaction mines an unsigned transaction of a dev or an
+// impersonated account, with the estimated gas by default
+func sendTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var args callArgs
+	if err := parseParams(params, 1, &args); err != nil {
+		return nil, err
+	}
+	if args.From == nil {
+		return nil, invalidParams(`missing "from"`)
+	}
+	if !n.impersonated[*args.From] && !slices.Contains(n.config.Accounts, *args.From) {
+		return nil, fmt.Errorf("unknown account %s", args.From.Hex())
+	}
+	head := n.head().Header
+	msg, err := args.toMessage(n.states[head.Number], head)
+	if err != nil {
+		return nil, err
+	}
+	if args.Gas == "" {
+		if msg.GasLimit, err = n.estimate(n.states[head.Number], head, &args); err != nil {
+			return nil, err
+		}
+	}
+	tx := n.unsignedTx(msg)
+	hash := tx.Hash()
+	if _, ok := n.txLookup[hash]; ok {
+		return nil, errors.New("already known")
+	}
+	n.processor.Senders[hash] = msg.From
+	if _, err := n.mine(types.Transactions{tx}); err != nil {
+		delete(n.processor.Senders, hash)
+		return nil, err
+	}
+	return hash, nil
+}
+
+// unsignedTx returns the message as a transaction: a dynamic fee
+// transaction if it has fee caps, else a legacy or access list one
+// at the base fee by default. It has no signature, R holds the
+// sender so that the transactions of different senders don't share
+// a hash.
+func (n *Node) unsignedTx(msg *types.Message) *types.Transaction {
+	tx := &types.Transaction{
+		Type:       types.LegacyTxType,
+		ChainID:    uint256.NewInt(n.config.ChainID),
+		Nonce:      msg.Nonce,
+		GasPrice:   msg.GasPrice,
+		Gas:        msg.GasLimit,
+		To:         msg.To,
+		Value:      orZero(msg.Value),
+		Data:       msg.Data,
+		AccessList: msg.AccessList,
+		V:          new(uint256.Int),
+		R:          new(uint256.Int).SetBytes(msg.From[:]),
+		S:          new(uint256.Int),
+	}
+	switch {
+	case msg.GasFeeCap != nil || msg.GasTipCap != nil:
+		tx.Type, tx.GasPrice = types.DynamicFeeTxType, nil
+		tx.GasFeeCap, tx.GasTipCap = msg.GasFeeCap, orZero(msg.GasTipCap)
+		if tx.GasFeeCap == nil {
+			tx.GasFeeCap = new(uint256.Int).Add(n.config.BaseFee, tx.GasTipCap)
+		}
+	case len(msg.AccessList) > 0:
+		tx.Type = types.AccessListTxType
+	}
+	if tx.Type != types.DynamicFeeTxType && tx.GasPrice == nil {
+		tx.GasPrice = n.config.BaseFee.Clone()
+	}
+	return tx
+}
+
+func orZero(w *uint256.Int) *uint256.Int {
+	if w == nil {
+		return new(uint256.Int)
+	}
+	return w
+}
@@ -0,0 +1,214 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantity(t *testing.T) {
+	var q quantity
+	assert.NoError(t, json.Unmarshal([]byte("12"), &q))
+	assert.Equal(t, quantity(12), q)
+	assert.NoError(t, json.Unmarshal([]byte(`"0x10"`), &q))
+	assert.Equal(t, quantity(16), q)
+	assert.Error(t, json.Unmarshal([]byte(`"0x10000000000000000"`), &q))
+	assert.Error(t, json.Unmarshal([]byte(`true`), &q))
+}
+
+func TestSnapshotAndRevert(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	sendStore(t, server, 0, 5)
+
+	var id string
+	assert.Nil(t, rpcCall(t, server, &id, "evm_snapshot"))
+	assert.Equal(t, "0x0", id)
+	hash := sendStore(t, server, 1, 6)
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_setBalance", sender, "0x1"))
+	assert.Nil(t, rpcCall(t, server, &id, "evm_snapshot"))
+	assert.Equal(t, "0x1", id)
+
+	var ok bool
+	assert.Nil(t, rpcCall(t, server, &ok, "evm_revert", "0x0"))
+	assert.True(t, ok)
+	var result string
+	assert.Nil(t, rpcCall(t, server, &result, "eth_blockNumber"))
+	assert.Equal(t, "0x1", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getStorageAt", contract, "0x0"))
+	assert.Equal(t, fmt.Sprintf("0x%064x", 5), result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getBalance", sender))
+	assert.NotEqual(t, "0x1", result)
+	var receipt *rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Nil(t, receipt)
+
+	// the reverted snapshot and the later ones are gone
+	assert.Nil(t, rpcCall(t, server, &ok, "evm_revert", "0x1"))
+	assert.False(t, ok)
+	assert.Nil(t, rpcCall(t, server, &ok, "evm_revert", 0))
+	assert.False(t, ok)
+
+	// the chain goes on from the snapshot
+	sendStore(t, server, 1, 7)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getStorageAt", contract, "0x0"))
+	assert.Equal(t, fmt.Sprintf("0x%064x", 7), result)
+}
+
+func TestTimeWarp(t *testing.T) {
+	n := newTestNode(t)
+	// the clock stands still at the genesis
+	genesis := n.head().Header.Time
+	n.now = func() time.Time { return time.Unix(int64(genesis), 0) }
+	server := httptest.NewServer(n)
+	defer server.Close()
+
+	var offset int64
+	assert.Nil(t, rpcCall(t, server, &offset, "evm_increaseTime", 100))
+	assert.Nil(t, rpcCall(t, server, &offset, "evm_increaseTime", "0x10"))
+	assert.Equal(t, int64(116), offset)
+	var result string
+	assert.Nil(t, rpcCall(t, server, &result, "evm_mine"))
+	assert.Equal(t, "0x0", result)
+	assert.Equal(t, genesis+116, n.head().Header.Time)
+	assert.Empty(t, n.head().Transactions)
+
+	assert.Nil(t, rpcCall(t, server, nil, "evm_setNextBlockTimestamp", genesis+1000))
+	sendStore(t, server, 0, 5)
+	assert.Equal(t, genesis+1000, n.head().Header.Time)
+	// the clock goes on from there
+	n.now = func() time.Time { return time.Unix(int64(genesis)+10, 0) }
+	assert.Nil(t, rpcCall(t, server, &result, "evm_mine"))
+	assert.Equal(t, genesis+1010, n.head().Header.Time)
+
+	assert.Nil(t, rpcCall(t, server, &result, "evm_mine", fmt.Sprintf("0x%x", genesis+2000)))
+	assert.Equal(t, genesis+2000, n.head().Header.Time)
+	err := rpcCall(t, server, nil, "evm_setNextBlockTimestamp", genesis+2000)
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestSetters(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+	other := evm.HexToAddress("0x2000")
+
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_setBalance", other, "0x64"))
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_setCode", other, "0x"+contractCode))
+	var ok bool
+	assert.Nil(t, rpcCall(t, server, &ok, "anvil_setStorageAt", other, "0x0", fmt.Sprintf("0x%064x", 9)))
+	assert.True(t, ok)
+
+	var result string
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getBalance", other))
+	assert.Equal(t, "0x64", result)
+	assert.Nil(t, rpcCall(t, server, &result, "eth_call", map[string]interface{}{"to": other}))
+	assert.Equal(t, fmt.Sprintf("0x%064x", 9), result)
+
+	// the next block commits to the changes
+	sendStore(t, server, 0, 5)
+	var block rpcBlock
+	assert.Nil(t, rpcCall(t, server, &block, "eth_getBlockByNumber", "latest", false))
+	assert.Nil(t, rpcCall(t, server, &result, "eth_getBalance", other, block.Number))
+	assert.Equal(t, "0x64", result)
+
+	err := rpcCall(t, server, nil, "anvil_setStorageAt", other, "0x0", "0xzz")
+	assert.Equal(t, errCodeInvalidParams, err.Code)
+}
+
+func TestImpersonateAccount(t *testing.T) {
+	n := newTestNode(t)
+	server := httptest.NewServer(n)
+	defer server.Close()
+	whale := evm.HexToAddress("0x3000")
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_setBalance", whale, "0xde0b6b3a7640000"))
+
+	args := map[string]interface{}{"from": whale, "to": contract, "data": fmt.Sprintf("0x%064x", 5)}
+	var hash evm.Hash
+	err := rpcCall(t, server, &hash, "eth_sendTransaction", args)
+	assert.Contains(t, err.Message, "unknown account")
+
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_impersonateAccount", whale))
+	assert.Nil(t, rpcCall(t, server, &hash, "eth_sendTransaction", args))
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Equal(t, "0x1", receipt.Status)
+	assert.Equal(t, whale, receipt.From)
+	var tx rpcTransaction
+	assert.Nil(t, rpcCall(t, server, &tx, "eth_getTransactionByHash", hash))
+	assert.Equal(t, whale, tx.From)
+	assert.Equal(t, "0x7", tx.GasPrice)
+	// the gas is estimated
+	assert.Equal(t, receipt.GasUsed, tx.Gas)
+
+	// a dynamic fee transaction of another account
+	other := evm.HexToAddress("0x4000")
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_setBalance", other, "0xde0b6b3a7640000"))
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_impersonateAccount", other))
+	args["from"], args["maxPriorityFeePerGas"] = other, "0x1"
+	var otherHash evm.Hash
+	assert.Nil(t, rpcCall(t, server, &otherHash, "eth_sendTransaction", args))
+	assert.NotEqual(t, hash, otherHash)
+	assert.Nil(t, rpcCall(t, server, &tx, "eth_getTransactionByHash", otherHash))
+	assert.Equal(t, "0x2", tx.Type)
+	assert.Equal(t, "0x8", tx.MaxFeePerGas)
+
+	// a failed transaction forgets its sender
+	args["nonce"] = "0x5"
+	err = rpcCall(t, server, &hash, "eth_sendTransaction", args)
+	assert.Contains(t, err.Message, "nonce too high")
+	assert.Len(t, n.processor.Senders, 2)
+
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_stopImpersonatingAccount", whale))
+	args["from"] = whale
+	delete(args, "nonce")
+	err = rpcCall(t, server, &hash, "eth_sendTransaction", args)
+	assert.Contains(t, err.Message, "unknown account")
+}
+
+func TestDevAccounts(t *testing.T) {
+	n := newTestNode(t)
+	server := httptest.NewServer(n)
+	defer server.Close()
+
+	var accounts []evm.Address
+	assert.Nil(t, rpcCall(t, server, &accounts, "eth_accounts"))
+	assert.Equal(t, DevAccounts, accounts)
+	var balance string
+	assert.Nil(t, rpcCall(t, server, &balance, "eth_getBalance", DevAccounts[0], "earliest"))
+	assert.Equal(t, "0x21e19e0c9bab2400000", balance)
+	// the accounts of the alloc keep their balance
+	assert.Nil(t, rpcCall(t, server, &balance, "eth_getBalance", sender, "earliest"))
+	assert.Equal(t, "0xde0b6b3a7640000", balance)
+
+	// a dev account sends without a signature
+	args := map[string]interface{}{"from": DevAccounts[1], "to": contract, "data": fmt.Sprintf("0x%064x", 5)}
+	var hash evm.Hash
+	assert.Nil(t, rpcCall(t, server, &hash, "eth_sendTransaction", args))
+	var receipt rpcReceipt
+	assert.Nil(t, rpcCall(t, server, &receipt, "eth_getTransactionReceipt", hash))
+	assert.Equal(t, "0x1", receipt.Status)
+	assert.Equal(t, DevAccounts[1], receipt.From)
+
+	// the impersonated accounts follow, sorted
+	for _, addr := range []evm.Address{evm.HexToAddress("0x4000"), evm.HexToAddress("0x3000"), evm.HexToAddress("0x4000")} {
+		assert.Nil(t, rpcCall(t, server, nil, "anvil_impersonateAccount", addr))
+	}
+	assert.Nil(t, rpcCall(t, server, nil, "anvil_impersonateAccount", DevAccounts[2]))
+	assert.Nil(t, rpcCall(t, server, &accounts, "eth_accounts"))
+	assert.Equal(t, append(DevAccounts[:len(DevAccounts):len(DevAccounts)], evm.HexToAddress("0x3000"), evm.HexToAddress("0x4000")), accounts)
+
+	// a chain without dev accounts
+	config := DefaultConfig()
+	config.Accounts = nil
+	server2 := httptest.NewServer(New(config))
+	defer server2.Close()
+	assert.Nil(t, rpcCall(t, server2, &accounts, "eth_accounts"))
+	assert.Empty(t, accounts)
+	assert.Nil(t, rpcCall(t, server2, &balance, "eth_getBalance", DevAccounts[0]))
+	assert.Equal(t, "0x0", balance)
+}
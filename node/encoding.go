@@ -0,0 +1,257 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+)
+
+// rpcBlock is a block in the format of the JSON-RPC API
+type rpcBlock struct {
+	Number           string            `json:"number"`
+	Hash             evm.Hash          `json:"hash"`
+	ParentHash       evm.Hash          `json:"parentHash"`
+	Nonce            string            `json:"nonce"`
+	MixHash          evm.Hash          `json:"mixHash"`
+	UncleHash        evm.Hash          `json:"sha3Uncles"`
+	LogsBloom        types.Bloom       `json:"logsBloom"`
+	TransactionsRoot evm.Hash          `json:"transactionsRoot"`
+	StateRoot        evm.Hash          `json:"stateRoot"`
+	ReceiptsRoot     evm.Hash          `json:"receiptsRoot"`
+	Miner            evm.Address       `json:"miner"`
+	Difficulty       string            `json:"difficulty"`
+	TotalDifficulty  string            `json:"totalDifficulty"`
+	ExtraData        string            `json:"extraData"`
+	GasLimit         string            `json:"gasLimit"`
+	GasUsed          string            `json:"gasUsed"`
+	Timestamp        string            `json:"timestamp"`
+	BaseFeePerGas    string            `json:"baseFeePerGas,omitempty"`
+	WithdrawalsRoot  *evm.Hash         `json:"withdrawalsRoot,omitempty"`
+	Withdrawals      *[]*rpcWithdrawal `json:"withdrawals,omitempty"`
+	// Transactions are hashes or rpcTransactions
+	Transactions []interface{} `json:"transactions"`
+	Uncles       []evm.Hash    `json:"uncles"`
+}
+
+type rpcWithdrawal struct {
+	Index          string      `json:"index"`
+	ValidatorIndex string      `json:"validatorIndex"`
+	Address        evm.Address `json:"address"`
+	Amount         string      `json:"amount"`
+}
+
+// rpcTransaction is a transaction included in a block. The fields
+// that don't belong to its type are left out.
+type rpcTransaction struct {
+	BlockHash            evm.Hash          `json:"blockHash"`
+	BlockNumber          string            `json:"blockNumber"`
+	TransactionIndex     string            `json:"transactionIndex"`
+	Hash                 evm.Hash          `json:"hash"`
+	Type                 string            `json:"type"`
+	ChainID              string            `json:"chainId,omitempty"`
+	From                 evm.Address       `json:"from"`
+	To                   *evm.Address      `json:"to"`
+	Nonce                string            `json:"nonce"`
+	Gas                  string            `json:"gas"`
+	GasPrice             string            `json:"gasPrice"`
+	MaxFeePerGas         string            `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string            `json:"maxPriorityFeePerGas,omitempty"`
+	Value                string            `json:"value"`
+	Input                string            `json:"input"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	MaxFeePerBlobGas     string            `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes  []evm.Hash        `json:"blobVersionedHashes,omitempty"`
+	V                    string            `json:"v"`
+	R                    string            `json:"r"`
+	S                    string            `json:"s"`
+}
+
+type rpcReceipt struct {
+	TransactionHash   evm.Hash     `json:"transactionHash"`
+	TransactionIndex  string       `json:"transactionIndex"`
+	BlockHash         evm.Hash     `json:"blockHash"`
+	BlockNumber       string       `json:"blockNumber"`
+	From              evm.Address  `json:"from"`
+	To                *evm.Address `json:"to"`
+	Type              string       `json:"type"`
+	Status            string       `json:"status"`
+	CumulativeGasUsed string       `json:"cumulativeGasUsed"`
+	GasUsed           string       `json:"gasUsed"`
+	EffectiveGasPrice string       `json:"effectiveGasPrice"`
+	ContractAddress   *evm.Address `json:"contractAddress"`
+	Logs              []*rpcLog    `json:"logs"`
+	LogsBloom         types.Bloom  `json:"logsBloom"`
+}
+
+type rpcLog struct {
+	Address          evm.Address `json:"address"`
+	Topics           []evm.Hash  `json:"topics"`
+	Data             string      `json:"data"`
+	BlockNumber      string      `json:"blockNumber"`
+	BlockHash        evm.Hash    `json:"blockHash"`
+	TransactionHash  evm.Hash    `json:"transactionHash"`
+	TransactionIndex string      `json:"transactionIndex"`
+	LogIndex         string      `json:"logIndex"`
+	Removed          bool        `json:"removed"`
+}
+
+func (n *Node) marshalBlock(block *types.Block, fullTx bool) *rpcBlock {
+	header := block.Header
+	enc := &rpcBlock{
+		Number:           hexUint(header.Number),
+		Hash:             block.Hash(),
+		ParentHash:       header.ParentHash,
+		Nonce:            hexBytes(header.Nonce[:]),
+		MixHash:          header.MixDigest,
+		UncleHash:        header.UncleHash,
+		LogsBloom:        header.Bloom,
+		TransactionsRoot: header.TxHash,
+		StateRoot:        header.Root,
+		ReceiptsRoot:     header.ReceiptHash,
+		Miner:            header.Coinbase,
+		Difficulty:       header.Difficulty.Hex(),
+		TotalDifficulty:  "0x0",
+		ExtraData:        hexBytes(header.Extra),
+		GasLimit:         hexUint(header.GasLimit),
+		GasUsed:          hexUint(header.GasUsed),
+		Timestamp:        hexUint(header.Time),
+		WithdrawalsRoot:  header.WithdrawalsHash,
+		Transactions:     []interface{}{},
+		Uncles:           []evm.Hash{},
+	}
+	if header.BaseFee != nil {
+		enc.BaseFeePerGas = header.BaseFee.Hex()
+	}
+	// the withdrawals are left out before Shanghai
+	if block.Withdrawals != nil {
+		withdrawals := make([]*rpcWithdrawal, len(block.Withdrawals))
+		for i, w := range block.Withdrawals {
+			withdrawals[i] = &rpcWithdrawal{
+				Index:          hexUint(w.Index),
+				ValidatorIndex: hexUint(w.Validator),
+				Address:        w.Address,
+				Amount:         hexUint(w.Amount),
+			}
+		}
+		enc.Withdrawals = &withdrawals
+	}
+	for i, tx := range block.Transactions {
+		if fullTx {
+			enc.Transactions = append(enc.Transactions, n.marshalTransaction(block, i))
+		} else {
+			enc.Transactions = append(enc.Transactions, tx.Hash())
+		}
+	}
+	for _, uncle := range block.Uncles {
+		enc.Uncles = append(enc.Uncles, uncle.Hash())
+	}
+	return enc
+}
+
+// marshalTransaction encodes the transaction at the index of the
+// block
+func (n *Node) marshalTransaction(block *types.Block, index int) *rpcTransaction {
+	tx := block.Transactions[index]
+	from := n.sender(tx)
+	enc := &rpcTransaction{
+		BlockHash:        block.Hash(),
+		BlockNumber:      hexUint(block.Header.Number),
+		TransactionIndex: hexUint(uint64(index)),
+		Hash:             tx.Hash(),
+		Type:             hexUint(uint64(tx.Type)),
+		From:             from,
+		To:               tx.To,
+		Nonce:            hexUint(tx.Nonce),
+		Gas:              hexUint(tx.Gas),
+		Value:            tx.Value.Hex(),
+		Input:            hexBytes(tx.Data),
+		V:                tx.V.Hex(),
+		R:                tx.R.Hex(),
+		S:                tx.S.Hex(),
+	}
+	if tx.Type != types.LegacyTxType {
+		enc.ChainID = tx.ChainID.Hex()
+		enc.AccessList = &tx.AccessList
+	}
+	if price, err := core.EffectiveGasPrice(tx.ToMessage(from), block.Header.BaseFee); err == nil {
+		enc.GasPrice = price.Hex()
+	}
+	if tx.GasFeeCap != nil && tx.Type >= types.DynamicFeeTxType {
+		enc.MaxFeePerGas, enc.MaxPriorityFeePerGas = tx.GasFeeCap.Hex(), tx.GasTipCap.Hex()
+	}
+	if tx.Type == types.BlobTxType {
+		enc.MaxFeePerBlobGas, enc.BlobVersionedHashes = tx.BlobFeeCap.Hex(), tx.BlobHashes
+	}
+	return enc
+}
+
+// marshalReceipt encodes the receipt of the transaction at the
+// index of the block
+func (n *Node) marshalReceipt(number uint64, index int) *rpcReceipt {
+	block := n.blocks[number]
+	tx, receipt := block.Transactions[index], n.receipts[number][index]
+	from := n.sender(tx)
+	enc := &rpcReceipt{
+		TransactionHash:   tx.Hash(),
+		TransactionIndex:  hexUint(uint64(index)),
+		BlockHash:         block.Hash(),
+		BlockNumber:       hexUint(number),
+		From:              from,
+		To:                tx.To,
+		Type:              hexUint(uint64(receipt.Type)),
+		Status:            hexUint(receipt.Status),
+		CumulativeGasUsed: hexUint(receipt.CumulativeGasUsed),
+		GasUsed:           hexUint(receipt.GasUsed),
+		Logs:              n.blockLogs(number)[n.logIndex(number, index):][:len(receipt.Logs)],
+		LogsBloom:         receipt.Bloom,
+	}
+	if price, err := core.EffectiveGasPrice(tx.ToMessage(from), block.Header.BaseFee); err == nil {
+		enc.EffectiveGasPrice = price.Hex()
+	}
+	if tx.To == nil {
+		contract := receipt.ContractAddress
+		enc.ContractAddress = &contract
+	}
+	return enc
+}
+
+// blockLogs returns the logs of the block, in order
+func (n *Node) blockLogs(number uint64) []*rpcLog {
+	block := n.blocks[number]
+	logs := []*rpcLog{}
+	for i, receipt := range n.receipts[number] {
+		for _, log := range receipt.Logs {
+			logs = append(logs, &rpcLog{
+				Address:          log.Address,
+				Topics:           log.Topics,
+				Data:             hexBytes(log.Data),
+				BlockNumber:      hexUint(number),
+				BlockHash:        block.Hash(),
+				TransactionHash:  block.Transactions[i].Hash(),
+				TransactionIndex: hexUint(uint64(i)),
+				LogIndex:         hexUint(uint64(len(logs))),
+			})
+		}
+	}
+	return logs
+}
+
+// logIndex returns the index in the block of the first log of the
+// transaction at the index
+func (n *Node) logIndex(number uint64, index int) int {
+	count := 0
+	for _, receipt := range n.receipts[number][:index] {
+		count += len(receipt.Logs)
+	}
+	return count
+}
+
+func hexUint(u uint64) string {
+	return fmt.Sprintf("0x%x", u)
+}
+
+func hexBytes(b []byte) string {
+	return fmt.Sprintf("0x%x", b)
+}
@@ -0,0 +1,253 @@
+// Package node is a local development chain served over JSON-RPC.
+// The world state is kept in memory and every transaction is mined
+// in a block of its own.
+package node
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// ClientVersion is returned by web3_clientVersion
+const ClientVersion = "toy-evm/v0.1.0"
+
+var errUnknownBlock = errors.New("unknown block")
+
+// Config is the genesis and the parameters of the chain
+type Config struct {
+	ChainID  uint64
+	Alloc    evm.GenesisAlloc
+	GasLimit uint64
+	Coinbase evm.Address
+	// BaseFee is the base fee of every block
+	BaseFee *uint256.Int
+	// Accounts are the dev accounts returned by eth_accounts,
+	// eth_sendTransaction sends from them without a signature. The
+	// ones missing from the alloc get DevBalance at genesis.
+	Accounts []evm.Address
+}
+
+// DevBalance is the genesis balance of the dev accounts, 10000 ether
+var DevBalance = new(uint256.Int).Mul(uint256.NewInt(10000), uint256.NewInt(1e18))
+
+// DevAccounts are the accounts of the Hardhat and Anvil dev nodes,
+// derived from the mnemonic "test test test test test test test
+// test test test test junk". Their keys are public, wallets import
+// them to sign transactions.
+var DevAccounts = []evm.Address{
+	evm.HexToAddress("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"),
+	evm.HexToAddress("0x70997970c51812dc3a010c7d01b50e0d17dc79c8"),
+	evm.HexToAddress("0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc"),
+	evm.HexToAddress("0x90f79bf6eb2c4f870365e785982e1f101e93b906"),
+	evm.HexToAddress("0x15d34aaf54267db7d7c367839aaf71a00a2c6a65"),
+	evm.HexToAddress("0x9965507d1a55bcc2695c58ba16fb37d819b0a4dc"),
+	evm.HexToAddress("0x976ea74026e726554db657fa54763abd0c3a0aa9"),
+	evm.HexToAddress("0x14dc79964da2c08b23698b3d3cc7ca32193d9955"),
+	evm.HexToAddress("0x23618e81e3f5cdf7f54c3d65f7fbc0abf5b21e8f"),
+	evm.HexToAddress("0xa0ee7a142d267c1f36714e4a8f75612f20a79720"),
+}
+
+// DefaultConfig returns the config of an empty chain with the chain
+// id, the gas limit and the accounts of the Hardhat and Anvil dev
+// nodes
+func DefaultConfig() *Config {
+	return &Config{
+		ChainID:  31337,
+		GasLimit: 30000000,
+		BaseFee:  new(uint256.Int),
+		Accounts: append([]evm.Address(nil), DevAccounts...),
+	}
+}
+
+// Node is an in-memory chain. It keeps the blocks with their
+// receipts and post-states, all of them are never pruned.
+type Node struct {
+	// mu serializes the requests
+	mu        sync.Mutex
+	config    *Config
+	processor *core.Processor
+	now       func() time.Time
+
+	blocks   []*types.Block
+	receipts []types.Receipts
+	states   []*evm.State
+
+	blockNumbers map[evm.Hash]uint64
+	txLookup     map[evm.Hash]txLookup
+
+	// the state of the test helpers, see dev.go
+	snapshots     []*chainSnapshot
+	timeOffset    int64
+	nextTimestamp uint64
+	impersonated  map[evm.Address]bool
+}
+
+// txLookup is the position of a transaction in the chain
+type txLookup struct {
+	block uint64
+	index int
+}
+
+// New returns a node with the genesis block of the config
+func New(config *Config) *Node {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	if config.BaseFee == nil {
+		config.BaseFee = new(uint256.Int)
+	}
+
+	n := &Node{
+		config:       config,
+		processor:    core.NewProcessor(config.ChainID),
+		now:          time.Now,
+		blockNumbers: make(map[evm.Hash]uint64),
+		txLookup:     make(map[evm.Hash]txLookup),
+		impersonated: make(map[evm.Address]bool),
+	}
+	n.processor.Senders = make(map[evm.Hash]evm.Address)
+	state := config.Alloc.ToState()
+	for _, addr := range config.Accounts {
+		if _, ok := config.Alloc[addr]; !ok {
+			state.AddBalance(addr, DevBalance)
+		}
+	}
+	emptyRoot := evm.Hash(trie.EmptyRoot)
+	genesis := &types.Header{
+		UncleHash:       types.EmptyUncleHash,
+		Coinbase:        config.Coinbase,
+		Root:            state.Root(),
+		TxHash:          emptyRoot,
+		ReceiptHash:     emptyRoot,
+		Difficulty:      new(uint256.Int),
+		GasLimit:        config.GasLimit,
+		Time:            uint64(n.now().Unix()),
+		BaseFee:         config.BaseFee.Clone(),
+		WithdrawalsHash: &emptyRoot,
+	}
+	n.insert(&types.Block{Header: genesis, Withdrawals: types.Withdrawals{}}, nil, state)
+	return n
+}
+
+// SendTransaction mines a block with the signed transaction, the
+// transaction is rejected if it's invalid on the latest state
+func (n *Node) SendTransaction(tx *types.Transaction) (evm.Hash, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.mine(types.Transactions{tx}); err != nil {
+		return evm.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// head returns the latest block
+func (n *Node) head() *types.Block {
+	return n.blocks[len(n.blocks)-1]
+}
+
+// mine processes the transactions in a new block on top of the head
+// and inserts it
+func (n *Node) mine(txs types.Transactions) (*types.Block, error) {
+	parent := n.head().Header
+	emptyRoot := evm.Hash(trie.EmptyRoot)
+	header := &types.Header{
+		ParentHash:      parent.Hash(),
+		UncleHash:       types.EmptyUncleHash,
+		Coinbase:        n.config.Coinbase,
+		Difficulty:      new(uint256.Int),
+		Number:          parent.Number + 1,
+		GasLimit:        n.config.GasLimit,
+		Time:            n.timestamp(parent),
+		BaseFee:         n.config.BaseFee.Clone(),
+		WithdrawalsHash: &emptyRoot,
+	}
+	block := &types.Block{Header: header, Transactions: txs, Withdrawals: types.Withdrawals{}}
+	result, err := n.processor.Process(block, n.states[len(n.states)-1])
+	if err != nil {
+		return nil, err
+	}
+	if header.TxHash, err = types.DeriveSha(txs); err != nil {
+		return nil, err
+	}
+	if header.ReceiptHash, err = types.DeriveSha(result.Receipts); err != nil {
+		return nil, err
+	}
+	header.Root, header.GasUsed = result.StateRoot, result.GasUsed
+	header.Bloom = types.CreateBloom(result.Receipts)
+	n.insert(block, result.Receipts, result.State)
+	// the clock goes on from the timestamp set for the block
+	if n.nextTimestamp != 0 {
+		n.timeOffset = int64(n.nextTimestamp) - n.now().Unix()
+		n.nextTimestamp = 0
+	}
+	return block, nil
+}
+
+// timestamp returns the time of the child of parent: the timestamp
+// set for it, else the shifted clock but at least a second after
+// parent
+func (n *Node) timestamp(parent *types.Header) uint64 {
+	if n.nextTimestamp != 0 {
+		return n.nextTimestamp
+	}
+	t := uint64(n.now().Unix() + n.timeOffset)
+	if t <= parent.Time {
+		t = parent.Time + 1
+	}
+	return t
+}
+
+func (n *Node) insert(block *types.Block, receipts types.Receipts, state *evm.State) {
+	number := block.Header.Number
+	n.blocks = append(n.blocks, block)
+	n.receipts = append(n.receipts, receipts)
+	n.states = append(n.states, state)
+	n.blockNumbers[block.Hash()] = number
+	for i, tx := range block.Transactions {
+		n.txLookup[tx.Hash()] = txLookup{number, i}
+	}
+}
+
+// truncate removes the blocks after the number
+func (n *Node) truncate(number uint64) {
+	for _, block := range n.blocks[number+1:] {
+		delete(n.blockNumbers, block.Hash())
+		for _, tx := range block.Transactions {
+			delete(n.txLookup, tx.Hash())
+			delete(n.processor.Senders, tx.Hash())
+		}
+	}
+	n.blocks, n.receipts, n.states = n.blocks[:number+1], n.receipts[:number+1], n.states[:number+1]
+}
+
+// sender returns the sender of the transaction of the chain
+func (n *Node) sender(tx *types.Transaction) evm.Address {
+	if from, ok := n.processor.Senders[tx.Hash()]; ok {
+		return from
+	}
+	// the senders of the other transactions were recovered
+	from, _ := n.processor.Signer.Sender(tx)
+	return from
+}
+
+// blockByHash returns the block with the hash, nil if unknown
+func (n *Node) blockByHash(hash evm.Hash) *types.Block {
+	number, ok := n.blockNumbers[hash]
+	if !ok {
+		return nil
+	}
+	return n.blocks[number]
+}
+
+// blockContext returns the context of the messages executed on top
+// of the block
+func (n *Node) blockContext(header *types.Header) *core.BlockContext {
+	return &core.BlockContext{Coinbase: header.Coinbase, GasLimit: header.GasLimit, BaseFee: header.BaseFee}
+}
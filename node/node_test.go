@@ -0,0 +1,81 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	senderKey = evm.HexToBytes("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+	sender    = evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	// returns the word at slot 0 without calldata, else stores the
+	// first word of the calldata at slot 0 and logs it with the
+	// topic 0xaa
+	contractCode = "36600f5760005460005260206000f35b" + "6000358060005560005260aa60206000a100"
+	contract     = evm.HexToAddress("0x1000")
+)
+
+func newTestNode(t *testing.T) *Node {
+	config := DefaultConfig()
+	config.BaseFee = uint256.NewInt(7)
+	config.Alloc = evm.GenesisAlloc{
+		sender:   {Balance: uint256.NewInt(1e18)},
+		contract: {Balance: new(uint256.Int), Code: evm.HexToBytes(contractCode)},
+	}
+	n := New(config)
+	n.now = func() time.Time { return time.Unix(1000, 0) }
+	return n
+}
+
+// signedTx signs a legacy transaction of the sender
+func signedTx(t *testing.T, nonce uint64, to *evm.Address, data []byte) *types.Transaction {
+	tx := &types.Transaction{
+		Type:     types.LegacyTxType,
+		Nonce:    nonce,
+		GasPrice: uint256.NewInt(10),
+		Gas:      100000,
+		To:       to,
+		Value:    new(uint256.Int),
+		Data:     data,
+	}
+	assert.NoError(t, types.NewSigner(DefaultConfig().ChainID).SignTx(tx, senderKey))
+	return tx
+}
+
+func TestSendTransaction(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.head()
+	assert.Equal(t, uint64(0), genesis.Header.Number)
+	assert.Equal(t, n.states[0].Root(), genesis.Header.Root)
+
+	tx := signedTx(t, 0, &contract, uint256.NewInt(5).PaddedBytes(32))
+	hash, err := n.SendTransaction(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, tx.Hash(), hash)
+
+	// a block per transaction
+	block := n.head()
+	assert.Equal(t, uint64(1), block.Header.Number)
+	assert.Equal(t, genesis.Hash(), block.Header.ParentHash)
+	assert.Equal(t, n.states[1].Root(), block.Header.Root)
+	assert.Len(t, n.receipts[1], 1)
+	assert.Equal(t, n.receipts[1][0].GasUsed, block.Header.GasUsed)
+	assert.Equal(t, txLookup{1, 0}, n.txLookup[hash])
+	assert.Equal(t, uint64(1), n.blockNumbers[block.Hash()])
+	// the clock stands still, the blocks are a second apart
+	assert.Equal(t, genesis.Header.Time+1, block.Header.Time)
+
+	// the states of the earlier blocks are kept
+	assert.Equal(t, uint256.NewInt(5), n.states[1].GetStorage(contract, *uint256.NewInt(0)))
+	assert.Equal(t, uint256.NewInt(0), n.states[0].GetStorage(contract, *uint256.NewInt(0)))
+
+	// an invalid transaction mines no block
+	_, err = n.SendTransaction(tx)
+	assert.ErrorContains(t, err, "nonce too low")
+	assert.Equal(t, uint64(1), n.head().Header.Number)
+}
@@ -0,0 +1,163 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// the error codes of JSON-RPC 2.0 and of the Ethereum clients
+const (
+	errCodeParse          = -32700
+	errCodeInvalidRequest = -32600
+	errCodeMethodNotFound = -32601
+	errCodeInvalidParams  = -32602
+	errCodeServer         = -32000
+	// errCodeReverted is the code of a call that reverted
+	errCodeReverted = 3
+)
+
+// maxRequestSize is the maximum size of a request body
+const maxRequestSize = 5 * 1024 * 1024
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error object of a response
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+func invalidParams(format string, a ...interface{}) *rpcError {
+	return &rpcError{Code: errCodeInvalidParams, Message: fmt.Sprintf(format, a...)}
+}
+
+// method is the handler of an RPC method, it's called with the
+// node locked
+type method func(n *Node, params json.RawMessage) (interface{}, error)
+
+// ServeHTTP serves JSON-RPC requests, single or batched, POSTed to
+// any path
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var response interface{}
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			response = errorResponse(nil, &rpcError{Code: errCodeParse, Message: err.Error()})
+		} else if len(batch) == 0 {
+			response = errorResponse(nil, &rpcError{Code: errCodeInvalidRequest, Message: "empty batch"})
+		} else {
+			responses := make([]*rpcResponse, len(batch))
+			for i, req := range batch {
+				responses[i] = n.handle(req)
+			}
+			response = responses
+		}
+	} else {
+		response = n.handle(body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handle executes a single request
+func (n *Node) handle(body []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return errorResponse(nil, &rpcError{Code: errCodeParse, Message: err.Error()})
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, &rpcError{Code: errCodeInvalidRequest, Message: "invalid request"})
+	}
+	handler, ok := methods[req.Method]
+	if !ok {
+		return errorResponse(req.ID, &rpcError{Code: errCodeMethodNotFound, Message: fmt.Sprintf("the method %s does not exist/is not available", req.Method)})
+	}
+
+	// a panicking handler fails the request, the node is unlocked
+	result, err := func() (result interface{}, err error) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		defer func() {
+			if r := recover(); r != nil {
+				err = &rpcError{Code: errCodeServer, Message: fmt.Sprintf("method handler crashed: %v", r)}
+			}
+		}()
+		return handler(n, req.Params)
+	}()
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: errCodeServer, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, &rpcError{Code: errCodeServer, Message: err.Error()})
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: encoded}
+}
+
+func errorResponse(id json.RawMessage, err *rpcError) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+// parseParams decodes the positional params into args, the first
+// ones are required. Missing optional params and nulls leave their
+// args as they are.
+func parseParams(params json.RawMessage, required int, args ...interface{}) error {
+	var values []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &values); err != nil {
+			return invalidParams("non-array params")
+		}
+	}
+	if len(values) > len(args) {
+		return invalidParams("too many arguments, want at most %d", len(args))
+	}
+	if len(values) < required {
+		return invalidParams("missing value for required argument %d", len(values))
+	}
+	for i, value := range values {
+		if string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, args[i]); err != nil {
+			return invalidParams("invalid argument %d: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// post sends the body to the server and decodes the response into v
+func post(t *testing.T, server *httptest.Server, body string, v interface{}) {
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+// rpcCall calls the method and decodes its result into result,
+// unless it's nil
+func rpcCall(t *testing.T, server *httptest.Server, result interface{}, method string, params ...interface{}) *rpcError {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	assert.NoError(t, err)
+	var resp rpcResponse
+	post(t, server, string(body), &resp)
+	assert.Equal(t, json.RawMessage("1"), resp.ID)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil {
+		assert.NoError(t, json.Unmarshal(resp.Result, result))
+	}
+	return nil
+}
+
+func TestServeHTTP(t *testing.T) {
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	var version string
+	assert.Nil(t, rpcCall(t, server, &version, "web3_clientVersion"))
+	assert.Equal(t, ClientVersion, version)
+
+	var resp rpcResponse
+	post(t, server, `{"jsonrpc":"2.0","id":"a","method":"eth_foo"}`, &resp)
+	assert.Equal(t, json.RawMessage(`"a"`), resp.ID)
+	assert.Equal(t, errCodeMethodNotFound, resp.Error.Code)
+	assert.Nil(t, resp.Result)
+
+	resp = rpcResponse{}
+	post(t, server, `{"jsonrpc":"2.0","id":1,"method":`, &resp)
+	assert.Equal(t, errCodeParse, resp.Error.Code)
+	assert.Equal(t, json.RawMessage("null"), resp.ID)
+
+	resp = rpcResponse{}
+	post(t, server, `{"id":1,"method":"eth_chainId"}`, &resp)
+	assert.Equal(t, errCodeInvalidRequest, resp.Error.Code)
+
+	// a null result is kept
+	resp = rpcResponse{}
+	post(t, server, `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x10",false]}`, &resp)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, json.RawMessage("null"), resp.Result)
+
+	var batch []rpcResponse
+	post(t, server, `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"2.0","id":2,"method":"net_version"},{"jsonrpc":"2.0","id":3,"method":"eth_getBalance"}]`, &batch)
+	assert.Len(t, batch, 3)
+	assert.Equal(t, json.RawMessage(`"0x7a69"`), batch[0].Result)
+	assert.Equal(t, json.RawMessage(`"31337"`), batch[1].Result)
+	assert.Equal(t, errCodeInvalidParams, batch[2].Error.Code)
+
+	resp = rpcResponse{}
+	post(t, server, `[]`, &resp)
+	assert.Equal(t, errCodeInvalidRequest, resp.Error.Code)
+
+	get, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	get.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, get.StatusCode)
+}
+
+func TestHandlePanic(t *testing.T) {
+	methods["test_panic"] = func(*Node, json.RawMessage) (interface{}, error) { panic("boom") }
+	t.Cleanup(func() { delete(methods, "test_panic") })
+	server := httptest.NewServer(newTestNode(t))
+	defer server.Close()
+
+	err := rpcCall(t, server, nil, "test_panic")
+	assert.Equal(t, &rpcError{Code: errCodeServer, Message: "method handler crashed: boom"}, err)
+	// the node isn't left locked
+	var version string
+	assert.Nil(t, rpcCall(t, server, &version, "web3_clientVersion"))
+}
+
+func TestParseParams(t *testing.T) {
+	var a string
+	b := 7
+	assert.NoError(t, parseParams(json.RawMessage(`["x"]`), 1, &a, &b))
+	assert.Equal(t, "x", a)
+	assert.Equal(t, 7, b)
+	assert.NoError(t, parseParams(json.RawMessage(`["y", null]`), 1, &a, &b))
+	assert.Equal(t, 7, b)
+	assert.NoError(t, parseParams(json.RawMessage(`["y", 8]`), 1, &a, &b))
+	assert.Equal(t, 8, b)
+
+	assert.EqualError(t, parseParams(nil, 1, &a), "missing value for required argument 0")
+	assert.EqualError(t, parseParams(json.RawMessage(`["x", 1]`), 1, &a), "too many arguments, want at most 1")
+	assert.EqualError(t, parseParams(json.RawMessage(`{}`), 0, &a), "non-array params")
+	assert.ErrorContains(t, parseParams(json.RawMessage(`[1]`), 1, &a), "invalid argument 0")
+}
@@ -0,0 +1,350 @@
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/holiman/uint256"
+)
+
+// Decoder is implemented by types with a custom decoding. DecodeRLP
+// receives the encoding of a single value.
+type Decoder interface {
+	DecodeRLP([]byte) error
+}
+
+var decoderType = reflect.TypeOf((*Decoder)(nil)).Elem()
+
+// Decode reads a single value from r and decodes it into val,
+// which must be a non-nil pointer. See DecodeBytes.
+func Decode(r io.Reader, val interface{}) error {
+	b, err := readValue(r)
+	if err != nil {
+		return err
+	}
+	return DecodeBytes(b, val)
+}
+
+// DecodeBytes decodes b, which must hold exactly one value, into
+// val, a non-nil pointer. It accepts the types of Encode, an empty
+// interface receives a []byte or a []interface{}. Only canonical
+// encodings are accepted: integers without leading zeros, single
+// bytes below 0x80 encoded as themselves and minimal sizes.
+func DecodeBytes(b []byte, val interface{}) error {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("rlp: decode target must be a non-nil pointer, got %T", val)
+	}
+	rest, err := decodeValue(b, v.Elem())
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return ErrMoreThanOneValue
+	}
+	return nil
+}
+
+// readValue reads the encoding of the next value of r, which is
+// validated by the decoder
+func readValue(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 1)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	var size uint64
+	var n byte
+	switch p := prefix[0]; {
+	case p < 0x80:
+		return prefix, nil
+	case p < 0xB8:
+		size = uint64(p - 0x80)
+	case p < 0xC0:
+		n = p - 0xB7
+	case p < 0xF8:
+		size = uint64(p - 0xC0)
+	default:
+		n = p - 0xF7
+	}
+	length := make([]byte, n)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	for _, x := range length {
+		size = size<<8 | uint64(x)
+	}
+	// the buffer grows with the input rather than the claimed size
+	buf := bytes.NewBuffer(append(prefix, length...))
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func decodeValue(b []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	switch {
+	case t == rawValueType:
+		_, offset, size, err := readHeader(b)
+		if err != nil {
+			return b, err
+		}
+		v.SetBytes(append([]byte{}, b[:offset+size]...))
+		return b[offset+size:], nil
+	case t == bigIntType:
+		content, rest, err := splitInt(b, t)
+		if err != nil {
+			return b, err
+		}
+		v.Addr().Interface().(*big.Int).SetBytes(content)
+		return rest, nil
+	case t == uint256Type:
+		content, rest, err := splitInt(b, t)
+		if err != nil {
+			return b, err
+		}
+		if len(content) > 32 {
+			return b, fmt.Errorf("%w for %v", ErrUintOverflow, t)
+		}
+		v.Addr().Interface().(*uint256.Int).SetBytes(content)
+		return rest, nil
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(decoderType):
+		_, offset, size, err := readHeader(b)
+		if err != nil {
+			return b, err
+		}
+		if err := v.Addr().Interface().(Decoder).DecodeRLP(b[:offset+size]); err != nil {
+			return b, err
+		}
+		return b[offset+size:], nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeValue(b, v.Elem())
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		value, rest, err := decodeInterface(b)
+		if err != nil {
+			return b, err
+		}
+		v.Set(reflect.ValueOf(value))
+		return rest, nil
+	case reflect.Bool:
+		content, rest, err := splitInt(b, t)
+		if err != nil {
+			return b, err
+		}
+		switch {
+		case len(content) == 0:
+			v.SetBool(false)
+		case len(content) == 1 && content[0] == 1:
+			v.SetBool(true)
+		default:
+			return b, fmt.Errorf("rlp: invalid boolean value %x", content)
+		}
+		return rest, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		content, rest, err := splitInt(b, t)
+		if err != nil {
+			return b, err
+		}
+		if len(content) > int(t.Size()) {
+			return b, fmt.Errorf("%w for %v", ErrUintOverflow, t)
+		}
+		var u uint64
+		for _, x := range content {
+			u = u<<8 | uint64(x)
+		}
+		v.SetUint(u)
+		return rest, nil
+	case reflect.String:
+		content, rest, err := splitString(b, t)
+		if err != nil {
+			return b, err
+		}
+		v.SetString(string(content))
+		return rest, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			content, rest, err := splitString(b, t)
+			if err != nil {
+				return b, err
+			}
+			v.SetBytes(append([]byte{}, content...))
+			return rest, nil
+		}
+		content, rest, err := splitList(b, t)
+		if err != nil {
+			return b, err
+		}
+		slice := reflect.MakeSlice(t, 0, 0)
+		for len(content) > 0 {
+			elem := reflect.New(t.Elem()).Elem()
+			if content, err = decodeValue(content, elem); err != nil {
+				return b, err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+		return rest, nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			content, rest, err := splitString(b, t)
+			if err != nil {
+				return b, err
+			}
+			if len(content) != t.Len() {
+				return b, fmt.Errorf("rlp: input string of length %d for %v", len(content), t)
+			}
+			reflect.Copy(v, reflect.ValueOf(content))
+			return rest, nil
+		}
+		content, rest, err := splitList(b, t)
+		if err != nil {
+			return b, err
+		}
+		for i := 0; i < t.Len(); i++ {
+			if len(content) == 0 {
+				return b, fmt.Errorf("%w for %v", ErrTooFewElements, t)
+			}
+			if content, err = decodeValue(content, v.Index(i)); err != nil {
+				return b, err
+			}
+		}
+		if len(content) > 0 {
+			return b, fmt.Errorf("%w for %v", ErrTooManyElements, t)
+		}
+		return rest, nil
+	case reflect.Struct:
+		fields, err := structFields(t)
+		if err != nil {
+			return b, err
+		}
+		content, rest, err := splitList(b, t)
+		if err != nil {
+			return b, err
+		}
+		for _, f := range fields {
+			field := v.Field(f.index)
+			if len(content) == 0 {
+				if !f.optional {
+					return b, fmt.Errorf("%w for %v", ErrTooFewElements, t)
+				}
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			if content, err = decodeValue(content, field); err != nil {
+				return b, err
+			}
+		}
+		if len(content) > 0 {
+			return b, fmt.Errorf("%w for %v", ErrTooManyElements, t)
+		}
+		return rest, nil
+	}
+	return b, fmt.Errorf("rlp: type %v is not RLP-serializable", t)
+}
+
+// decodeInterface decodes strings to []byte and lists to []interface{}
+func decodeInterface(b []byte) (interface{}, []byte, error) {
+	k, content, rest, err := Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if k != List {
+		return append([]byte{}, content...), rest, nil
+	}
+	list := []interface{}{}
+	for len(content) > 0 {
+		var value interface{}
+		if value, content, err = decodeInterface(content); err != nil {
+			return nil, b, err
+		}
+		list = append(list, value)
+	}
+	return list, rest, nil
+}
+
+func splitString(b []byte, t reflect.Type) ([]byte, []byte, error) {
+	content, rest, err := SplitString(b)
+	if errors.Is(err, ErrExpectedString) {
+		return nil, b, fmt.Errorf("%w for %v", err, t)
+	}
+	return content, rest, err
+}
+
+func splitList(b []byte, t reflect.Type) ([]byte, []byte, error) {
+	content, rest, err := SplitList(b)
+	if errors.Is(err, ErrExpectedList) {
+		return nil, b, fmt.Errorf("%w for %v", err, t)
+	}
+	return content, rest, err
+}
+
+// splitInt splits an integer, which must not have leading zeros
+func splitInt(b []byte, t reflect.Type) ([]byte, []byte, error) {
+	content, rest, err := splitString(b, t)
+	if err != nil {
+		return nil, b, err
+	}
+	if len(content) > 0 && content[0] == 0 {
+		return nil, b, fmt.Errorf("%w for %v", ErrCanonInt, t)
+	}
+	return content, rest, nil
+}
+
+type field struct {
+	index    int
+	optional bool
+}
+
+// structFields returns the encoded fields of a struct: the exported
+// fields without an `rlp:"-"` tag. Fields tagged `rlp:"optional"`
+// may be missing at the end of the list, and must all come last.
+func structFields(t reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		var optional, skip bool
+		for _, tag := range strings.Split(f.Tag.Get("rlp"), ",") {
+			switch strings.TrimSpace(tag) {
+			case "":
+			case "-":
+				skip = true
+			case "optional":
+				optional = true
+			default:
+				return nil, fmt.Errorf("rlp: unknown struct tag %q on %v.%s", tag, t, f.Name)
+			}
+		}
+		if skip {
+			continue
+		}
+		if !optional && len(fields) > 0 && fields[len(fields)-1].optional {
+			return nil, fmt.Errorf(`rlp: struct field %v.%s needs "optional" tag`, t, f.Name)
+		}
+		fields = append(fields, field{i, optional})
+	}
+	return fields, nil
+}
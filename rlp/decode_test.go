@@ -0,0 +1,174 @@
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+type decoderFunc struct {
+	raw []byte
+}
+
+func (d *decoderFunc) DecodeRLP(b []byte) error {
+	if len(b) == 0 || b[0] < 0xC0 {
+		return errors.New("not a list")
+	}
+	d.raw = b
+	return nil
+}
+
+type nested struct {
+	Simple *simple
+	List   []withOptional
+	Raw    RawValue
+	Hash   [32]byte
+	Big    *big.Int
+	Word   uint256.Int
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range encTests {
+		if test.val == nil || reflect.TypeOf(test.val).Kind() == reflect.Interface {
+			continue
+		}
+		typ := reflect.TypeOf(test.val)
+		if typ == reflect.TypeOf(encoderFunc{}) || typ == reflect.TypeOf([]interface{}{}) {
+			continue
+		}
+		// nil pointers decode to the zero value they point to
+		if typ.Kind() == reflect.Ptr && reflect.ValueOf(test.val).IsNil() {
+			continue
+		}
+		ptr := reflect.New(typ)
+		err := DecodeBytes(unhex(test.output), ptr.Interface())
+		if assert.NoError(t, err, "%s into %v", test.output, typ) {
+			b, err := EncodeToBytes(ptr.Elem().Interface())
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, hex.EncodeToString(b), "%v", typ)
+		}
+	}
+}
+
+func TestRoundTripNested(t *testing.T) {
+	val := nested{
+		Simple: &simple{7, "seven"},
+		List: []withOptional{
+			{A: 1},
+			{A: 2, B: uint256.NewInt(3)},
+			{A: 4, B: uint256.NewInt(0), C: []uint64{5, 6}},
+		},
+		Raw:  RawValue(unhex("c3010203")),
+		Hash: [32]byte{31: 0xff},
+		Big:  new(big.Int).Lsh(big.NewInt(1), 300),
+		Word: *new(uint256.Int).Lsh(uint256.NewInt(1), 255),
+	}
+	b, err := EncodeToBytes(&val)
+	assert.NoError(t, err)
+
+	var dec nested
+	assert.NoError(t, DecodeBytes(b, &dec))
+	assert.Equal(t, val, dec)
+
+	// the decoder reads a single value from a stream
+	r := bytes.NewReader(append(append([]byte{}, b...), b...))
+	for i := 0; i < 2; i++ {
+		var dec nested
+		assert.NoError(t, Decode(r, &dec))
+		assert.Equal(t, val, dec)
+	}
+	assert.Equal(t, io.EOF, Decode(r, &dec))
+}
+
+func TestDecode(t *testing.T) {
+	var i interface{}
+	assert.NoError(t, DecodeBytes(unhex("c6827a77c10401"), &i))
+	assert.Equal(t, []interface{}{[]byte("zw"), []interface{}{[]byte{4}}, []byte{1}}, i)
+
+	var opt withOptional
+	assert.NoError(t, DecodeBytes(unhex("c20102"), &opt))
+	assert.Equal(t, withOptional{A: 1, B: uint256.NewInt(2)}, opt)
+
+	var skipped withSkipped
+	assert.NoError(t, DecodeBytes(unhex("c20101"), &skipped))
+	assert.Equal(t, withSkipped{A: 1, C: true}, skipped)
+
+	var d decoderFunc
+	assert.NoError(t, DecodeBytes(unhex("c20102"), &d))
+	assert.Equal(t, unhex("c20102"), d.raw)
+	assert.EqualError(t, DecodeBytes(unhex("01"), &d), "not a list")
+
+	var list []decoderFunc
+	assert.NoError(t, DecodeBytes(unhex("c3c0c101"), &list))
+	assert.Equal(t, []decoderFunc{{unhex("c0")}, {unhex("c101")}}, list)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		val   interface{}
+		err   error
+	}{
+		// non-canonical sizes and integers
+		{"8100", new([]byte), ErrCanonSize},
+		{"817f", new(uint), ErrCanonSize},
+		{"b80100", new([]byte), ErrCanonSize},
+		{"b90001" + strings.Repeat("00", 256), new([]byte), ErrCanonSize},
+		{"f80100", new([]uint), ErrCanonSize},
+		{"00", new(uint), ErrCanonInt},
+		{"820001", new(uint), ErrCanonInt},
+		{"820001", new(big.Int), ErrCanonInt},
+		{"820001", new(uint256.Int), ErrCanonInt},
+		{"00", new(bool), ErrCanonInt},
+
+		// sizes
+		{"83010203", new(uint16), ErrUintOverflow},
+		{"89010000000000000000", new(uint64), ErrUintOverflow},
+		{"a1010000000000000000000000000000000000000000000000000000000000000000", new(uint256.Int), ErrUintOverflow},
+		{"820102", new(uint8), ErrUintOverflow},
+		{"8301", new([]byte), ErrValueTooLarge},
+		{"c30102", new([]uint), ErrValueTooLarge},
+		{"b9ffff", new([]byte), ErrValueTooLarge},
+		{"0102", new(uint), ErrMoreThanOneValue},
+
+		// kinds
+		{"c0", new(uint), ErrExpectedString},
+		{"c0", new(string), ErrExpectedString},
+		{"c0", new([4]byte), ErrExpectedString},
+		{"80", new([]uint), ErrExpectedList},
+		{"01", new(simple), ErrExpectedList},
+		{"80", new([2]uint), ErrExpectedList},
+
+		// elements
+		{"c101", new(simple), ErrTooFewElements},
+		{"c3018080", new(simple), ErrTooManyElements},
+		{"c0", new(withOptional), ErrTooFewElements},
+		{"c40180c0c0", new(withOptional), ErrTooManyElements},
+		{"c101", new([2]uint), ErrTooFewElements},
+		{"c3010203", new([2]uint), ErrTooManyElements},
+	} {
+		err := DecodeBytes(unhex(test.input), test.val)
+		assert.ErrorIs(t, err, test.err, "%s into %T", test.input, test.val)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	var a [4]byte
+	assert.Error(t, DecodeBytes(unhex("83010203"), &a))
+	assert.Error(t, DecodeBytes(unhex("02"), new(bool)))
+	assert.Error(t, DecodeBytes(unhex(""), new(uint)))
+	assert.Error(t, DecodeBytes(unhex("01"), new(int)))
+	assert.Error(t, DecodeBytes(unhex("01"), a))
+	assert.Error(t, DecodeBytes(unhex("01"), (*uint)(nil)))
+
+	assert.Equal(t, io.ErrUnexpectedEOF, Decode(bytes.NewReader(unhex("8301")), new([]byte)))
+	assert.Equal(t, io.ErrUnexpectedEOF, Decode(bytes.NewReader(unhex("b9")), new([]byte)))
+}
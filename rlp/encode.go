@@ -0,0 +1,208 @@
+package rlp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+
+	"github.com/holiman/uint256"
+)
+
+// Encoder is implemented by types with a custom encoding. EncodeRLP
+// must write a single valid value.
+type Encoder interface {
+	EncodeRLP(io.Writer) error
+}
+
+var (
+	encoderType  = reflect.TypeOf((*Encoder)(nil)).Elem()
+	rawValueType = reflect.TypeOf(RawValue{})
+	bigIntType   = reflect.TypeOf(big.Int{})
+	uint256Type  = reflect.TypeOf(uint256.Int{})
+)
+
+// Encode writes the encoding of val to w. Supported values are
+// unsigned integers, bools, strings, byte slices and arrays,
+// big.Int and uint256.Int, which are strings, and slices, arrays
+// and structs, which are lists of their elements or exported fields.
+// Pointers encode the value they point to, a nil pointer encodes
+// as an empty string, or an empty list for list types.
+func Encode(w io.Writer, val interface{}) error {
+	b, err := EncodeToBytes(val)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// EncodeToBytes returns the encoding of val
+func EncodeToBytes(val interface{}) ([]byte, error) {
+	if val == nil {
+		return []byte{0xC0}, nil
+	}
+	return appendValue(nil, reflect.ValueOf(val))
+}
+
+func appendValue(b []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	switch {
+	case t == rawValueType:
+		return append(b, v.Bytes()...), nil
+	case t == bigIntType:
+		i := v.Interface().(big.Int)
+		return appendBigInt(b, &i)
+	case t == uint256Type:
+		i := v.Interface().(uint256.Int)
+		return AppendString(b, i.Bytes()), nil
+	case t.Kind() != reflect.Ptr && t.Implements(encoderType):
+		return appendEncoder(b, v.Interface().(Encoder))
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(encoderType):
+		// copy the value to call the pointer method
+		p := reflect.New(t)
+		p.Elem().Set(v)
+		return appendEncoder(b, p.Interface().(Encoder))
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(b, emptyValue(t.Elem())), nil
+		}
+		return appendValue(b, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xC0), nil
+		}
+		return appendValue(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0x01), nil
+		}
+		return append(b, 0x80), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return AppendUint64(b, v.Uint()), nil
+	case reflect.String:
+		return AppendString(b, []byte(v.String())), nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return AppendString(b, byteSlice(v)), nil
+		}
+		var content []byte
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if content, err = appendValue(content, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return appendList(b, content), nil
+	case reflect.Struct:
+		fields, err := structFields(t)
+		if err != nil {
+			return nil, err
+		}
+		// trailing optional fields are left out when they and all
+		// the fields after them are zero
+		last := len(fields) - 1
+		for ; last >= 0 && fields[last].optional; last-- {
+			if !v.Field(fields[last].index).IsZero() {
+				break
+			}
+		}
+		var content []byte
+		for _, f := range fields[:last+1] {
+			if content, err = appendValue(content, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return appendList(b, content), nil
+	}
+	return nil, fmt.Errorf("rlp: type %v is not RLP-serializable", t)
+}
+
+func appendEncoder(b []byte, e Encoder) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.EncodeRLP(&buf); err != nil {
+		return nil, err
+	}
+	return append(b, buf.Bytes()...), nil
+}
+
+func appendBigInt(b []byte, i *big.Int) ([]byte, error) {
+	if i.Sign() < 0 {
+		return nil, fmt.Errorf("rlp: cannot encode negative big.Int")
+	}
+	return AppendString(b, i.Bytes()), nil
+}
+
+// emptyValue is the encoding of a nil pointer to t
+func emptyValue(t reflect.Type) byte {
+	if t == bigIntType || t == uint256Type {
+		return 0x80
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return 0xC0
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return 0xC0
+		}
+	case reflect.Interface:
+		return 0xC0
+	}
+	return 0x80
+}
+
+// byteSlice returns the bytes of a byte slice or array, which may
+// not be addressable
+func byteSlice(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice {
+		return v.Bytes()
+	}
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
+
+// AppendUint64 appends the encoding of an integer to b
+func AppendUint64(b []byte, u uint64) []byte {
+	if u == 0 {
+		return append(b, 0x80)
+	}
+	if u < 0x80 {
+		return append(b, byte(u))
+	}
+	return AppendString(b, bigEndian(u))
+}
+
+// AppendString appends the encoding of a string to b
+func AppendString(b, s []byte) []byte {
+	if len(s) == 1 && s[0] < 0x80 {
+		return append(b, s[0])
+	}
+	return append(appendHeader(b, len(s), 0x80), s...)
+}
+
+func appendList(b, content []byte) []byte {
+	return append(appendHeader(b, len(content), 0xC0), content...)
+}
+
+func appendHeader(b []byte, size int, offset byte) []byte {
+	if size < 56 {
+		return append(b, offset+byte(size))
+	}
+	length := bigEndian(uint64(size))
+	b = append(b, offset+55+byte(len(length)))
+	return append(b, length...)
+}
+
+// bigEndian returns u without leading zeros
+func bigEndian(u uint64) []byte {
+	var b []byte
+	for ; u > 0; u >>= 8 {
+		b = append([]byte{byte(u)}, b...)
+	}
+	return b
+}
@@ -0,0 +1,153 @@
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type simple struct {
+	A uint64
+	B string
+}
+
+type withSkipped struct {
+	A      uint
+	hidden uint
+	B      []byte `rlp:"-"`
+	C      bool
+}
+
+type withOptional struct {
+	A uint64
+	B *uint256.Int `rlp:"optional"`
+	C []uint64     `rlp:"optional"`
+}
+
+type encoderFunc []byte
+
+func (e encoderFunc) EncodeRLP(w io.Writer) error {
+	_, err := w.Write(e)
+	return err
+}
+
+var encTests = []struct {
+	val    interface{}
+	output string
+}{
+	// integers
+	{uint8(0), "80"},
+	{uint32(0x7f), "7f"},
+	{uint32(0x80), "8180"},
+	{uint(1024), "820400"},
+	{uint64(100000), "830186a0"},
+	{uint64(0xffffffffffffffff), "88ffffffffffffffff"},
+	{true, "01"},
+	{false, "80"},
+
+	// big integers
+	{big.NewInt(0), "80"},
+	{big.NewInt(1), "01"},
+	{*big.NewInt(0x1000), "821000"},
+	{new(big.Int).Lsh(big.NewInt(1), 256), "a1010000000000000000000000000000000000000000000000000000000000000000"},
+	{uint256.NewInt(0), "80"},
+	{uint256.NewInt(0xffff), "82ffff"},
+	{*uint256.NewInt(127), "7f"},
+	{new(uint256.Int).SetAllOne(), "a0ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+
+	// strings
+	{"", "80"},
+	{"dog", "83646f67"},
+	{[]byte{}, "80"},
+	{[]byte{0x00}, "00"},
+	{[]byte{0x7f}, "7f"},
+	{[]byte{0x80}, "8180"},
+	{[3]byte{1, 2, 3}, "83010203"},
+	{[1]byte{0}, "00"},
+	{"Lorem ipsum dolor sit amet, consectetur adipisicing elit", "b8384c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c6974"},
+
+	// lists
+	{[]uint{}, "c0"},
+	{[]string{"cat", "dog"}, "c88363617483646f67"},
+	{[2]uint64{1, 2}, "c20102"},
+	{[]interface{}{[]interface{}{[]interface{}{}, []interface{}{}}, []interface{}{}}, "c4c2c0c0c0"},
+	{[]interface{}{[]interface{}{}, []interface{}{[]interface{}{}}, []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}}, "c7c0c1c0c3c0c1c0"},
+	{[]interface{}{"zw", []uint{4}, uint(1)}, "c6827a77c10401"},
+	{[]string{strings.Repeat("a", 60)}, "f83eb83c" + strings.Repeat("61", 60)},
+
+	// structs
+	{simple{1, "a"}, "c20161"},
+	{&simple{}, "c28080"},
+	{withSkipped{A: 1, hidden: 2, B: []byte{3}, C: true}, "c20101"},
+	{withOptional{A: 1}, "c101"},
+	{withOptional{A: 1, B: uint256.NewInt(2)}, "c20102"},
+	{withOptional{A: 1, C: []uint64{3}}, "c40180c103"},
+
+	// pointers and interfaces
+	{(*uint)(nil), "80"},
+	{(*big.Int)(nil), "80"},
+	{(*uint256.Int)(nil), "80"},
+	{(*[]byte)(nil), "80"},
+	{(*[]uint)(nil), "c0"},
+	{(*simple)(nil), "c0"},
+	{[]*simple{{1, "b"}, {}}, "c6c20162c28080"},
+	{nil, "c0"},
+
+	// raw values and custom encoders
+	{RawValue(unhex("c20102")), "c20102"},
+	{[]RawValue{unhex("01"), unhex("c0")}, "c201c0"},
+	{encoderFunc(unhex("83010203")), "83010203"},
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range encTests {
+		b, err := EncodeToBytes(test.val)
+		if assert.NoError(t, err, "%#v", test.val) {
+			assert.Equal(t, test.output, hex.EncodeToString(b), "%#v", test.val)
+		}
+
+		var buf bytes.Buffer
+		assert.NoError(t, Encode(&buf, test.val))
+		assert.Equal(t, b, buf.Bytes())
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, val := range []interface{}{
+		int(1),
+		-1.5,
+		big.NewInt(-1),
+		map[string]uint{},
+		struct {
+			A uint `rlp:"optional"`
+			B uint
+		}{},
+		struct {
+			A uint `rlp:"unknown"`
+		}{},
+	} {
+		_, err := EncodeToBytes(val)
+		assert.Error(t, err, "%#v", val)
+	}
+}
+
+func TestAppendUint64(t *testing.T) {
+	assert.Equal(t, unhex("80"), AppendUint64(nil, 0))
+	assert.Equal(t, unhex("0f"), AppendUint64(nil, 15))
+	assert.Equal(t, unhex("01820400"), AppendUint64([]byte{1}, 1024))
+	assert.Equal(t, unhex("83646f67"), AppendString(nil, []byte("dog")))
+}
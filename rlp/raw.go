@@ -0,0 +1,146 @@
+// Package rlp implements the Recursive Length Prefix encoding used
+// to serialize the Ethereum data structures, see Appendix B of the
+// Yellow Paper. The decoder only accepts canonical encodings.
+package rlp
+
+import (
+	"errors"
+)
+
+var (
+	ErrExpectedString   = errors.New("rlp: expected String or Byte")
+	ErrExpectedList     = errors.New("rlp: expected List")
+	ErrCanonInt         = errors.New("rlp: non-canonical integer format")
+	ErrCanonSize        = errors.New("rlp: non-canonical size information")
+	ErrValueTooLarge    = errors.New("rlp: value size exceeds available input length")
+	ErrMoreThanOneValue = errors.New("rlp: input contains more than one value")
+	ErrUintOverflow     = errors.New("rlp: uint overflow")
+	ErrTooFewElements   = errors.New("rlp: too few elements")
+	ErrTooManyElements  = errors.New("rlp: input list has too many elements")
+)
+
+// Kind is the type of an encoded value
+type Kind int
+
+const (
+	// Byte is a single byte below 0x80, encoded as itself
+	Byte Kind = iota
+	String
+	List
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Byte:
+		return "Byte"
+	case String:
+		return "String"
+	case List:
+		return "List"
+	}
+	return "Unknown"
+}
+
+// RawValue is an encoded value. It is written as is by the
+// encoder and receives the encoding of a value when decoding.
+type RawValue []byte
+
+// Split returns the kind and the content of the first value of b
+// and the bytes that follow it
+func Split(b []byte) (k Kind, content, rest []byte, err error) {
+	k, offset, size, err := readHeader(b)
+	if err != nil {
+		return 0, nil, b, err
+	}
+	return k, b[offset : offset+size], b[offset+size:], nil
+}
+
+// SplitString splits b into the content of a string and the rest
+func SplitString(b []byte) (content, rest []byte, err error) {
+	k, content, rest, err := Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if k == List {
+		return nil, b, ErrExpectedString
+	}
+	return content, rest, nil
+}
+
+// SplitList splits b into the content of a list and the rest
+func SplitList(b []byte) (content, rest []byte, err error) {
+	k, content, rest, err := Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if k != List {
+		return nil, b, ErrExpectedList
+	}
+	return content, rest, nil
+}
+
+// CountValues returns the number of encoded values in b
+func CountValues(b []byte) (int, error) {
+	n := 0
+	for ; len(b) > 0; n++ {
+		_, _, rest, err := Split(b)
+		if err != nil {
+			return 0, err
+		}
+		b = rest
+	}
+	return n, nil
+}
+
+// readHeader returns the kind of the value at the start of b, the
+// offset of its content and the size of its content
+func readHeader(b []byte) (k Kind, offset, size uint64, err error) {
+	if len(b) == 0 {
+		return 0, 0, 0, errors.New("rlp: unexpected end of input")
+	}
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		return Byte, 0, 1, nil
+	case prefix < 0xB8:
+		k, offset, size = String, 1, uint64(prefix-0x80)
+		// a single byte below 0x80 must be encoded as itself
+		if size == 1 && len(b) > 1 && b[1] < 0x80 {
+			return 0, 0, 0, ErrCanonSize
+		}
+	case prefix < 0xC0:
+		k, offset = String, 1+uint64(prefix-0xB7)
+		size, err = readSize(b[1:], prefix-0xB7)
+	case prefix < 0xF8:
+		k, offset, size = List, 1, uint64(prefix-0xC0)
+	default:
+		k, offset = List, 1+uint64(prefix-0xF7)
+		size, err = readSize(b[1:], prefix-0xF7)
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if size > uint64(len(b))-offset {
+		return 0, 0, 0, ErrValueTooLarge
+	}
+	return k, offset, size, nil
+}
+
+// readSize reads the big endian size of a long string or list
+func readSize(b []byte, n byte) (uint64, error) {
+	if int(n) > len(b) {
+		return 0, ErrValueTooLarge
+	}
+	if b[0] == 0 {
+		return 0, ErrCanonSize
+	}
+	var size uint64
+	for _, x := range b[:n] {
+		size = size<<8 | uint64(x)
+	}
+	// sizes below 56 must use the short form
+	if size < 56 {
+		return 0, ErrCanonSize
+	}
+	return size, nil
+}
@@ -0,0 +1,86 @@
+package rlp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	for _, test := range []struct {
+		input         string
+		kind          Kind
+		content, rest string
+	}{
+		{"00", Byte, "00", ""},
+		{"7f01", Byte, "7f", "01"},
+		{"80", String, "", ""},
+		{"8180", String, "80", ""},
+		{"83646f6701", String, "646f67", "01"},
+		{"c0", List, "", ""},
+		{"c88363617483646f67", List, "8363617483646f67", ""},
+		{"b838" + strings.Repeat("61", 56), String, strings.Repeat("61", 56), ""},
+		{"f838" + strings.Repeat("80", 56) + "c0", List, strings.Repeat("80", 56), "c0"},
+	} {
+		kind, content, rest, err := Split(unhex(test.input))
+		if assert.NoError(t, err, test.input) {
+			assert.Equal(t, test.kind, kind, test.input)
+			assert.Equal(t, unhex(test.content), content, test.input)
+			assert.Equal(t, unhex(test.rest), rest, test.input)
+		}
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   error
+	}{
+		{"8100", ErrCanonSize},
+		{"b800", ErrCanonSize},
+		{"b837" + strings.Repeat("61", 55), ErrCanonSize},
+		{"b90038" + strings.Repeat("61", 56), ErrCanonSize},
+		{"f837" + strings.Repeat("80", 55), ErrCanonSize},
+		{"82", ErrValueTooLarge},
+		{"b8", ErrValueTooLarge},
+		{"b838", ErrValueTooLarge},
+		{"c1", ErrValueTooLarge},
+		{"ffffffffffffffffff00", ErrValueTooLarge},
+	} {
+		_, _, _, err := Split(unhex(test.input))
+		assert.ErrorIs(t, err, test.err, test.input)
+	}
+	_, _, _, err := Split(nil)
+	assert.Error(t, err)
+}
+
+func TestSplitKind(t *testing.T) {
+	content, rest, err := SplitString(unhex("820102c0"))
+	assert.NoError(t, err)
+	assert.Equal(t, unhex("0102"), content)
+	assert.Equal(t, unhex("c0"), rest)
+
+	content, rest, err = SplitList(unhex("c2010280"))
+	assert.NoError(t, err)
+	assert.Equal(t, unhex("0102"), content)
+	assert.Equal(t, unhex("80"), rest)
+
+	_, _, err = SplitString(unhex("c0"))
+	assert.ErrorIs(t, err, ErrExpectedString)
+	_, _, err = SplitList(unhex("01"))
+	assert.ErrorIs(t, err, ErrExpectedList)
+}
+
+func TestCountValues(t *testing.T) {
+	n, err := CountValues(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = CountValues(unhex("0180c0c20102"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	_, err = CountValues(unhex("0182"))
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+}
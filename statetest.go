@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/tests"
+)
+
+// statetest runs the GeneralStateTests fixtures in the files
+// or directories given as arguments and prints a line per
+// fork and variant, followed by a summary. The forks the runner
+// doesn't implement are skipped.
+func statetest(args []string) {
+	var (
+		fork  string
+		match string
+		trace bool
+	)
+	flags := flag.NewFlagSet("statetest", flag.ExitOnError)
+	flags.StringVar(&fork, "fork", "", "only run the expectations of this fork")
+	flags.StringVar(&match, "run", "", "only run the tests whose name matches this regular expression")
+	flags.BoolVar(&trace, "trace", false, "write an EIP-3155 JSON trace of the failing tests to stderr")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: toy-evm statetest [-fork name] [-run regexp] [-trace] <file|dir>...")
+		os.Exit(2)
+	}
+	if fork != "" && !tests.Forks[fork] {
+		fmt.Fprintf(os.Stderr, "unsupported fork %s\n", fork)
+		os.Exit(2)
+	}
+	re, err := regexp.Compile(match)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	evm.Init()
+	evm.DebugOutput = io.Discard
+
+	files, err := fixtureFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	passed, failed, skipped := 0, 0, 0
+	for _, file := range files {
+		fixtures, err := tests.LoadStateTests(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		names := make([]string, 0, len(fixtures))
+		for name := range fixtures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if !re.MatchString(name) {
+				continue
+			}
+			test := fixtures[name]
+			for _, subtest := range test.Subtests() {
+				if fork != "" && subtest.Fork != fork {
+					continue
+				}
+				if !tests.Forks[subtest.Fork] {
+					skipped++
+					continue
+				}
+				id := fmt.Sprintf("%s/%s/%d", name, subtest.Fork, subtest.Index)
+				if _, err := test.Run(subtest, nil); err != nil {
+					fmt.Printf("FAIL %s: %v\n", id, err)
+					failed++
+					if trace {
+						fmt.Fprintf(os.Stderr, "trace of %s\n", id)
+						test.Run(subtest, evm.NewJSONLogger(os.Stderr))
+					}
+					continue
+				}
+				fmt.Printf("PASS %s\n", id)
+				passed++
+			}
+		}
+	}
+	fmt.Printf("\n%d tests: %d passed, %d failed, %d skipped\n", passed+failed, passed, failed, skipped)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// fixtureFiles returns the paths, with the directories replaced
+// by the .json files they contain
+func fixtureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (p == path || strings.HasSuffix(p, ".json")) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
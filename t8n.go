@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/tests"
+)
+
+// exit codes of geth's t8n tool
+const (
+	t8nErrorConfig = 3
+	t8nErrorJSON   = 10
+	t8nErrorIO     = 11
+	t8nErrorRLP    = 12
+)
+
+// t8nInput is the combined input read from stdin
+type t8nInput struct {
+	Alloc evm.GenesisAlloc        `json:"alloc"`
+	Env   *tests.T8nEnv           `json:"env"`
+	Txs   []*tests.T8nTransaction `json:"txs"`
+}
+
+// t8n implements the command line interface of the state transition
+// tool of geth (evm t8n) used by the execution-spec-tests and the
+// fuzzers: it reads a pre-state, a block env and transactions and
+// writes the result, the post-state and the block body
+func t8n(args []string) {
+	var (
+		inputAlloc, inputEnv, inputTxs                       string
+		outputBasedir, outputResult, outputAlloc, outputBody string
+		fork                                                 string
+		reward                                               int64
+		chainID                                              uint64
+	)
+	flags := flag.NewFlagSet("t8n", flag.ExitOnError)
+	flags.StringVar(&inputAlloc, "input.alloc", "alloc.json", "pre-state file, or stdin")
+	flags.StringVar(&inputEnv, "input.env", "env.json", "block env file, or stdin")
+	flags.StringVar(&inputTxs, "input.txs", "txs.json", "transactions file, or stdin")
+	flags.StringVar(&outputBasedir, "output.basedir", "", "directory of the output files")
+	flags.StringVar(&outputResult, "output.result", "result.json", "result file, stdout or stderr")
+	flags.StringVar(&outputAlloc, "output.alloc", "alloc.json", "post-state file, stdout or stderr")
+	flags.StringVar(&outputBody, "output.body", "", "file of the RLP list of the included transactions")
+	flags.StringVar(&fork, "state.fork", "", "fork rules, ignored as the interpreter has none")
+	flags.Int64Var(&reward, "state.reward", 0, "block reward in wei, negative to disable it")
+	flags.Uint64Var(&chainID, "state.chainid", 1, "chain id the transactions are signed for")
+	flags.Parse(args)
+
+	evm.Init()
+	evm.DebugOutput = io.Discard
+
+	var input t8nInput
+	if inputAlloc == "stdin" || inputEnv == "stdin" || inputTxs == "stdin" {
+		if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+			t8nExit(t8nErrorJSON, fmt.Errorf("stdin: %w", err))
+		}
+	}
+	if inputAlloc != "stdin" {
+		readT8nFile(inputAlloc, &input.Alloc)
+	}
+	if inputEnv != "stdin" {
+		readT8nFile(inputEnv, &input.Env)
+	}
+	if inputTxs != "stdin" {
+		if strings.HasSuffix(inputTxs, ".rlp") {
+			input.Txs = readT8nRLP(inputTxs)
+		} else {
+			readT8nFile(inputTxs, &input.Txs)
+		}
+	}
+	if input.Env == nil {
+		t8nExit(t8nErrorConfig, fmt.Errorf("missing env"))
+	}
+
+	state, result, err := tests.Transition(input.Alloc, input.Env, input.Txs, reward, chainID)
+	if err != nil {
+		t8nExit(t8nErrorConfig, err)
+	}
+	body, err := result.Body()
+	if err != nil {
+		t8nExit(t8nErrorRLP, err)
+	}
+
+	// outputs going to stdout are combined in a single object
+	stdout := make(map[string]interface{})
+	for _, out := range []struct {
+		name  string
+		path  string
+		value interface{}
+	}{
+		{"result", outputResult, result},
+		{"alloc", outputAlloc, state.Dump()},
+		{"body", outputBody, fmt.Sprintf("0x%x", body)},
+	} {
+		switch out.path {
+		case "":
+			continue
+		case "stdout":
+			stdout[out.name] = out.value
+		case "stderr":
+			writeT8nJSON(os.Stderr, out.value)
+		default:
+			f, err := os.Create(filepath.Join(outputBasedir, out.path))
+			if err != nil {
+				t8nExit(t8nErrorIO, err)
+			}
+			writeT8nJSON(f, out.value)
+			f.Close()
+		}
+	}
+	if len(stdout) > 0 {
+		writeT8nJSON(os.Stdout, stdout)
+	}
+}
+
+func readT8nFile(path string, v interface{}) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t8nExit(t8nErrorIO, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t8nExit(t8nErrorJSON, fmt.Errorf("%s: %w", path, err))
+	}
+}
+
+// readT8nRLP reads the hex encoded RLP list of signed transactions
+// of a txs.rlp file, a JSON string
+func readT8nRLP(path string) []*tests.T8nTransaction {
+	var hex string
+	readT8nFile(path, &hex)
+	b, err := evm.ParseBytes(hex)
+	if err != nil {
+		t8nExit(t8nErrorRLP, fmt.Errorf("%s: %w", path, err))
+	}
+	txs, err := tests.T8nTransactionsFromRLP(b)
+	if err != nil {
+		t8nExit(t8nErrorRLP, fmt.Errorf("%s: %w", path, err))
+	}
+	return txs
+}
+
+func writeT8nJSON(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		t8nExit(t8nErrorIO, err)
+	}
+}
+
+func t8nExit(code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
@@ -0,0 +1,430 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// BlockTest is a BlockchainTests fixture: a genesis block and its
+// pre-state followed by blocks, some of which are invalid, and the
+// expected state and hash of the last valid block.
+type BlockTest struct {
+	Network       string           `json:"network"`
+	Genesis       btHeader         `json:"genesisBlockHeader"`
+	Pre           evm.GenesisAlloc `json:"pre"`
+	Blocks        []btBlock        `json:"blocks"`
+	PostState     evm.GenesisAlloc `json:"postState"`
+	LastBlockHash evm.Hash         `json:"lastblockhash"`
+}
+
+type btBlock struct {
+	Header          *btHeader      `json:"blockHeader"`
+	Transactions    []txFields     `json:"transactions"`
+	UncleHeaders    []*btHeader    `json:"uncleHeaders"`
+	Withdrawals     []btWithdrawal `json:"withdrawals"`
+	ExpectException string         `json:"expectException"`
+	RLP             string         `json:"rlp"`
+}
+
+// btHeader holds the hex encoded fields of a block header
+type btHeader struct {
+	ParentHash            string   `json:"parentHash"`
+	UncleHash             string   `json:"uncleHash"`
+	Coinbase              string   `json:"coinbase"`
+	StateRoot             string   `json:"stateRoot"`
+	TransactionsTrie      string   `json:"transactionsTrie"`
+	ReceiptTrie           string   `json:"receiptTrie"`
+	Bloom                 string   `json:"bloom"`
+	Difficulty            string   `json:"difficulty"`
+	Number                string   `json:"number"`
+	GasLimit              string   `json:"gasLimit"`
+	GasUsed               string   `json:"gasUsed"`
+	Timestamp             string   `json:"timestamp"`
+	ExtraData             string   `json:"extraData"`
+	MixHash               string   `json:"mixHash"`
+	Nonce                 string   `json:"nonce"`
+	BaseFeePerGas         string   `json:"baseFeePerGas"`
+	WithdrawalsRoot       string   `json:"withdrawalsRoot"`
+	BlobGasUsed           string   `json:"blobGasUsed"`
+	ExcessBlobGas         string   `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string   `json:"parentBeaconBlockRoot"`
+	RequestsHash          string   `json:"requestsHash"`
+	Hash                  evm.Hash `json:"hash"`
+}
+
+type btWithdrawal struct {
+	Index          string      `json:"index"`
+	ValidatorIndex string      `json:"validatorIndex"`
+	Address        evm.Address `json:"address"`
+	// Amount is in gwei
+	Amount string `json:"amount"`
+}
+
+// blockRewards is the reward of the miner in wei per fork,
+// there is none after the merge
+var blockRewards = map[string]uint64{
+	"Frontier":          5e18,
+	"Homestead":         5e18,
+	"EIP150":            5e18,
+	"EIP158":            5e18,
+	"Byzantium":         3e18,
+	"Constantinople":    2e18,
+	"ConstantinopleFix": 2e18,
+	"Petersburg":        2e18,
+	"Istanbul":          2e18,
+	"Berlin":            2e18,
+	"London":            2e18,
+	"ArrowGlacier":      2e18,
+	"GrayGlacier":       2e18,
+	"Merge":             0,
+	"Paris":             0,
+	"Shanghai":          0,
+	"Cancun":            0,
+	"Prague":            0,
+}
+
+var errInvalidBlock = errors.New("invalid block")
+
+// LoadBlockTests reads the tests of a fixture file by name
+func LoadBlockTests(path string) (map[string]*BlockTest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*BlockTest
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tests, nil
+}
+
+// Run imports the blocks on top of the genesis, the invalid ones
+// must be rejected, and checks the hash of the last block and, if
+// the fixture has it, the post-state. The blocks are decoded from
+// their RLP, which is invalid for some of the rejected ones, and
+// must match their JSON form.
+func (t *BlockTest) Run() (*evm.State, error) {
+	reward, ok := blockRewards[t.Network]
+	if !ok {
+		return nil, fmt.Errorf("unsupported network %s", t.Network)
+	}
+	genesis, err := t.Genesis.toHeader()
+	if err != nil {
+		return nil, fmt.Errorf("genesis: %w", err)
+	}
+	if hash := genesis.Hash(); hash != t.Genesis.Hash {
+		return nil, fmt.Errorf("genesis hash mismatch: got %s, want %s", hash, t.Genesis.Hash)
+	}
+
+	state := t.Pre.ToState()
+	if err := checkRoot(state, evm.HexToHash(t.Genesis.StateRoot)); err != nil {
+		return nil, fmt.Errorf("genesis: %w", err)
+	}
+	processor := &core.Processor{Signer: mainnetSigner, BlockReward: reward}
+	head := genesis
+	for i, block := range t.Blocks {
+		decoded, post, err := block.apply(processor, state, head)
+		switch {
+		case err != nil && block.ExpectException == "":
+			return state, fmt.Errorf("block %d: %w", i, err)
+		case err == nil && block.ExpectException != "":
+			return state, fmt.Errorf("block %d: expected exception %s, the block is valid", i, block.ExpectException)
+		case err != nil:
+			// the block is rejected as expected
+			continue
+		}
+		state, head = post, decoded.Header
+	}
+
+	if hash := head.Hash(); hash != t.LastBlockHash {
+		return state, fmt.Errorf("last block hash mismatch: got %s, want %s", hash, t.LastBlockHash)
+	}
+	if t.PostState != nil {
+		if err := compareState(t.PostState, state); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// apply decodes the block from its RLP and checks its JSON form,
+// validates the header against its parent and the body against the
+// header, then processes the block on state and checks the result.
+// It returns the block and the post-state.
+func (b *btBlock) apply(processor *core.Processor, state *evm.State, parent *types.Header) (*types.Block, *evm.State, error) {
+	block, err := b.decode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateHeader(block.Header, parent); err != nil {
+		return nil, nil, err
+	}
+	if err := core.ValidateBody(block); err != nil {
+		return nil, nil, err
+	}
+	result, err := processor.Process(block, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, result.State, core.ValidateState(block.Header, result)
+}
+
+// decode decodes the RLP of the block. The fixture may also have
+// the JSON form: the RLP must be the block of its hash, and the JSON
+// form must be valid and have the same hash and body roots.
+func (b *btBlock) decode() (*types.Block, error) {
+	rlpBytes, err := evm.ParseBytes(b.RLP)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidBlock, err)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(rlpBytes, block); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidBlock, err)
+	}
+	if b.Header == nil {
+		return block, nil
+	}
+	if hash := block.Hash(); hash != b.Header.Hash {
+		return nil, fmt.Errorf("rlp block hash mismatch: got %s, want %s", hash, b.Header.Hash)
+	}
+	fromJSON, err := b.toBlock()
+	if err != nil {
+		return nil, err
+	}
+	if hash := fromJSON.Hash(); hash != b.Header.Hash {
+		return nil, fmt.Errorf("block hash mismatch: got %s, want %s", hash, b.Header.Hash)
+	}
+	if err := core.ValidateBody(fromJSON); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// toBlock decodes the JSON form of the block. Its transactions must
+// be signed, or have the secret key to sign them.
+func (b *btBlock) toBlock() (*types.Block, error) {
+	header, err := b.Header.toHeader()
+	if err != nil {
+		return nil, err
+	}
+	block := &types.Block{Header: header}
+	for i, tx := range b.Transactions {
+		// the sender of the fixture must be the one of the signature
+		sender := tx.Sender
+		tx.Sender = ""
+		msg, signed, err := tx.toMessage(mainnetSigner)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if sender != "" && msg.From != evm.HexToAddress(sender) {
+			return nil, fmt.Errorf("transaction %d: sender %s, want %s", i, msg.From, sender)
+		}
+		block.Transactions = append(block.Transactions, signed)
+	}
+	for _, uncle := range b.UncleHeaders {
+		h, err := uncle.toHeader()
+		if err != nil {
+			return nil, fmt.Errorf("uncle: %w", err)
+		}
+		block.Uncles = append(block.Uncles, h)
+	}
+	if block.Withdrawals, err = toWithdrawals(b.Withdrawals); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// toWithdrawals decodes the withdrawals, an empty list is not nil
+// as the body of a Shanghai block has one
+func toWithdrawals(withdrawals []btWithdrawal) (types.Withdrawals, error) {
+	if withdrawals == nil {
+		return nil, nil
+	}
+	ws := make(types.Withdrawals, 0, len(withdrawals))
+	for _, w := range withdrawals {
+		fields := make([]uint64, 3)
+		for i, input := range []string{w.Index, w.ValidatorIndex, w.Amount} {
+			value, err := evm.ParseWord(input)
+			if err != nil || !value.IsUint64() {
+				return nil, fmt.Errorf("invalid withdrawal %+v", w)
+			}
+			fields[i] = value.Uint64()
+		}
+		ws = append(ws, &types.Withdrawal{Index: fields[0], Validator: fields[1], Address: w.Address, Amount: fields[2]})
+	}
+	return ws, nil
+}
+
+// headerWords are the numeric fields of a header
+type headerWords struct {
+	number    uint64
+	gasLimit  uint64
+	gasUsed   uint64
+	timestamp uint64
+	baseFee   *uint256.Int
+}
+
+func (h *btHeader) words() (*headerWords, error) {
+	w := &headerWords{}
+	for _, f := range []struct {
+		name  string
+		input string
+		dst   *uint64
+	}{
+		{"number", h.Number, &w.number},
+		{"gas limit", h.GasLimit, &w.gasLimit},
+		{"gas used", h.GasUsed, &w.gasUsed},
+		{"timestamp", h.Timestamp, &w.timestamp},
+	} {
+		value, err := evm.ParseWord(f.input)
+		if err != nil || !value.IsUint64() {
+			return nil, fmt.Errorf("invalid header %s %q", f.name, f.input)
+		}
+		*f.dst = value.Uint64()
+	}
+	baseFee, err := evm.ParseWord(h.BaseFeePerGas)
+	if err != nil {
+		return nil, fmt.Errorf("header base fee: %w", err)
+	}
+	w.baseFee = baseFee
+	return w, nil
+}
+
+// validateHeader checks the header against its parent
+func validateHeader(h, parent *types.Header) error {
+	limit := parent.GasLimit / 1024
+	switch {
+	case h.ParentHash != parent.Hash():
+		return fmt.Errorf("unknown parent %s", h.ParentHash)
+	case h.Number != parent.Number+1:
+		return fmt.Errorf("invalid number %d, parent is %d", h.Number, parent.Number)
+	case h.Time <= parent.Time:
+		return fmt.Errorf("timestamp %d is not after the parent's %d", h.Time, parent.Time)
+	case h.GasUsed > h.GasLimit:
+		return fmt.Errorf("gas used %d is above the gas limit %d", h.GasUsed, h.GasLimit)
+	case h.GasLimit < 5000:
+		return fmt.Errorf("gas limit %d is below 5000", h.GasLimit)
+	case h.GasLimit >= parent.GasLimit+limit || h.GasLimit+limit <= parent.GasLimit:
+		return fmt.Errorf("gas limit %d changed too much from the parent's %d", h.GasLimit, parent.GasLimit)
+	case len(h.Extra) > 32:
+		return fmt.Errorf("extra data is %d bytes, the maximum is 32", len(h.Extra))
+	}
+	if parent.BaseFee != nil {
+		want := calcBaseFee(&headerWords{gasLimit: parent.GasLimit, gasUsed: parent.GasUsed, baseFee: parent.BaseFee})
+		if h.BaseFee == nil {
+			return fmt.Errorf("missing base fee, want %s", want.Hex())
+		}
+		if !h.BaseFee.Eq(want) {
+			return fmt.Errorf("invalid base fee %s, want %s", h.BaseFee.Hex(), want.Hex())
+		}
+	}
+	return nil
+}
+
+// calcBaseFee returns the base fee of the child of the block (EIP-1559)
+func calcBaseFee(parent *headerWords) *uint256.Int {
+	target := parent.gasLimit / 2
+	baseFee := parent.baseFee.Clone()
+	switch {
+	case parent.gasUsed == target:
+		return baseFee
+	case parent.gasUsed > target:
+		delta := new(uint256.Int).Mul(baseFee, uint256.NewInt(parent.gasUsed-target))
+		delta.Div(delta, uint256.NewInt(target))
+		delta.Div(delta, uint256.NewInt(8))
+		if delta.IsZero() {
+			delta.SetOne()
+		}
+		return baseFee.Add(baseFee, delta)
+	default:
+		delta := new(uint256.Int).Mul(baseFee, uint256.NewInt(target-parent.gasUsed))
+		delta.Div(delta, uint256.NewInt(target))
+		delta.Div(delta, uint256.NewInt(8))
+		return baseFee.Sub(baseFee, delta)
+	}
+}
+
+// toHeader decodes the hex fields of the header, the fields added by
+// later forks are nil when missing
+func (h *btHeader) toHeader() (*types.Header, error) {
+	header := &types.Header{
+		ParentHash:  evm.HexToHash(h.ParentHash),
+		UncleHash:   evm.HexToHash(h.UncleHash),
+		Coinbase:    evm.HexToAddress(h.Coinbase),
+		Root:        evm.HexToHash(h.StateRoot),
+		TxHash:      evm.HexToHash(h.TransactionsTrie),
+		ReceiptHash: evm.HexToHash(h.ReceiptTrie),
+		MixDigest:   evm.HexToHash(h.MixHash),
+	}
+	for _, f := range []struct {
+		name  string
+		input string
+		dst   []byte
+	}{
+		{"bloom", h.Bloom, header.Bloom[:]},
+		{"nonce", h.Nonce, header.Nonce[:]},
+	} {
+		b, err := evm.ParseBytes(f.input)
+		if err != nil || len(b) != len(f.dst) {
+			return nil, fmt.Errorf("invalid header %s %q", f.name, f.input)
+		}
+		copy(f.dst, b)
+	}
+	extra, err := evm.ParseBytes(h.ExtraData)
+	if err != nil {
+		return nil, fmt.Errorf("header extra data: %w", err)
+	}
+	header.Extra = extra
+	if header.Difficulty, err = evm.ParseWord(h.Difficulty); err != nil {
+		return nil, fmt.Errorf("header difficulty: %w", err)
+	}
+	words, err := h.words()
+	if err != nil {
+		return nil, err
+	}
+	header.Number, header.GasLimit, header.GasUsed, header.Time = words.number, words.gasLimit, words.gasUsed, words.timestamp
+
+	if h.BaseFeePerGas != "" {
+		header.BaseFee = words.baseFee
+	}
+	for _, f := range []struct {
+		input string
+		dst   **evm.Hash
+	}{
+		{h.WithdrawalsRoot, &header.WithdrawalsHash},
+		{h.ParentBeaconBlockRoot, &header.ParentBeaconRoot},
+		{h.RequestsHash, &header.RequestsHash},
+	} {
+		if f.input != "" {
+			hash := evm.HexToHash(f.input)
+			*f.dst = &hash
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		input string
+		dst   **uint64
+	}{
+		{"blob gas used", h.BlobGasUsed, &header.BlobGasUsed},
+		{"excess blob gas", h.ExcessBlobGas, &header.ExcessBlobGas},
+	} {
+		if f.input == "" {
+			continue
+		}
+		value, err := evm.ParseWord(f.input)
+		if err != nil || !value.IsUint64() {
+			return nil, fmt.Errorf("invalid header %s %q", f.name, f.input)
+		}
+		n := value.Uint64()
+		*f.dst = &n
+	}
+	return header, nil
+}
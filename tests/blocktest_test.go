@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadBlockTest(t *testing.T) *BlockTest {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	tests, err := LoadBlockTests("testdata/blocktest.json")
+	assert.NoError(t, err)
+	return tests["withdrawalAndTransaction_Shanghai"]
+}
+
+func TestBlockTest(t *testing.T) {
+	_, err := loadBlockTest(t).Run()
+	assert.NoError(t, err)
+}
+
+func TestBlockTestFailures(t *testing.T) {
+	test := loadBlockTest(t)
+	test.Blocks[1].ExpectException = ""
+	_, err := test.Run()
+	assert.EqualError(t, err, "block 1: timestamp 12 is not after the parent's 12")
+
+	test = loadBlockTest(t)
+	test.Blocks[3].ExpectException = "BlockException.INVALID_BASEFEE_PER_GAS"
+	_, err = test.Run()
+	assert.EqualError(t, err, "block 3: expected exception BlockException.INVALID_BASEFEE_PER_GAS, the block is valid")
+
+	test = loadBlockTest(t)
+	test.Blocks[0].Header.GasUsed = "0x5000"
+	_, err = test.Run()
+	assert.ErrorContains(t, err, "block 0: block hash mismatch")
+
+	test = loadBlockTest(t)
+	test.Blocks[0].Withdrawals[0].Amount = "0x02"
+	_, err = test.Run()
+	assert.ErrorContains(t, err, "block 0: withdrawals root hash mismatch")
+
+	test = loadBlockTest(t)
+	test.Blocks[0].Transactions[0].Sender = "0x1000"
+	_, err = test.Run()
+	assert.EqualError(t, err, "block 0: transaction 0: sender 0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b, want 0x1000")
+
+	// a transaction without a signature
+	test = loadBlockTest(t)
+	test.Blocks[0].Transactions[0].V = ""
+	_, err = test.Run()
+	assert.EqualError(t, err, "block 0: transaction 0: the transaction has no sender or signature")
+
+	test = loadBlockTest(t)
+	delete(test.Pre, evm.HexToAddress("0x1000"))
+	_, err = test.Run()
+	assert.ErrorContains(t, err, "genesis: state root mismatch")
+
+	test = loadBlockTest(t)
+	test.PostState[evm.HexToAddress("0xc0ffee")] = evm.GenesisAccount{Balance: uint256.NewInt(1)}
+	_, err = test.Run()
+	assert.EqualError(t, err, "account 0x0000000000000000000000000000000000c0ffee: balance 0x3b9aca00, want 0x1")
+
+	// the block is the one of the RLP
+	test = loadBlockTest(t)
+	test.Blocks[0].RLP = test.Blocks[0].RLP[:len(test.Blocks[0].RLP)-2]
+	_, err = test.Run()
+	assert.ErrorIs(t, err, errInvalidBlock)
+	assert.ErrorContains(t, err, "block 0: invalid block: rlp:")
+
+	test = loadBlockTest(t)
+	test.Blocks[0].RLP = test.Blocks[3].RLP
+	_, err = test.Run()
+	assert.ErrorContains(t, err, "block 0: rlp block hash mismatch")
+
+	test = loadBlockTest(t)
+	test.Blocks[1].RLP = ""
+	test.Blocks[1].ExpectException = ""
+	_, err = test.Run()
+	assert.EqualError(t, err, "block 1: invalid block: rlp: unexpected end of input")
+
+	// a block without its JSON form
+	test = loadBlockTest(t)
+	test.Blocks[3].Header = nil
+	_, err = test.Run()
+	assert.NoError(t, err)
+
+	test = loadBlockTest(t)
+	test.Network = "FrontierToHomesteadAt5"
+	_, err = test.Run()
+	assert.EqualError(t, err, "unsupported network FrontierToHomesteadAt5")
+}
+
+func TestHeaderHash(t *testing.T) {
+	// the genesis of the mainnet
+	genesis := &btHeader{
+		ParentHash:       "0x0000000000000000000000000000000000000000000000000000000000000000",
+		UncleHash:        "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347",
+		Coinbase:         "0x0000000000000000000000000000000000000000",
+		StateRoot:        "0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544",
+		TransactionsTrie: "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		ReceiptTrie:      "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		Bloom:            "0x" + strings.Repeat("00", 256),
+		Difficulty:       "0x0400000000",
+		Number:           "0x00",
+		GasLimit:         "0x1388",
+		GasUsed:          "0x00",
+		Timestamp:        "0x00",
+		ExtraData:        "0x11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa",
+		MixHash:          "0x0000000000000000000000000000000000000000000000000000000000000000",
+		Nonce:            "0x0000000000000042",
+	}
+	header, err := genesis.toHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"), header.Hash())
+}
+
+func TestCalcBaseFee(t *testing.T) {
+	for _, tc := range []struct {
+		gasUsed uint64
+		want    uint64
+	}{
+		{15000000, 1000000000},
+		{30000000, 1125000000},
+		{0, 875000000},
+	} {
+		parent := &headerWords{gasLimit: 30000000, gasUsed: tc.gasUsed, baseFee: uint256.NewInt(1000000000)}
+		assert.Equal(t, uint256.NewInt(tc.want), calcBaseFee(parent))
+	}
+}
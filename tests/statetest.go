@@ -0,0 +1,255 @@
+// Package tests runs the JSON fixtures of the Ethereum tests
+// (https://github.com/ethereum/tests) against the interpreter.
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// Forks are the forks whose expectations the runner checks. The
+// interpreter implements the rules of Shanghai: the warm coinbase
+// (EIP-3651) and the refunds of EIP-3529, without the opcodes and
+// the blob transactions of Cancun.
+var Forks = map[string]bool{"Shanghai": true}
+
+// ErrUnsupportedFork is returned for the subtests of the other forks
+var ErrUnsupportedFork = errors.New("unsupported fork")
+
+// StateTest is a GeneralStateTests fixture: a transaction with
+// several data, gas and value variants, run on a pre-state,
+// and the expected outcome per fork and variant.
+type StateTest struct {
+	Env         stEnv                    `json:"env"`
+	Pre         evm.GenesisAlloc         `json:"pre"`
+	Transaction stTransaction            `json:"transaction"`
+	Post        map[string][]stPostState `json:"post"`
+}
+
+type stEnv struct {
+	Coinbase  evm.Address `json:"currentCoinbase"`
+	GasLimit  string      `json:"currentGasLimit"`
+	Number    string      `json:"currentNumber"`
+	Timestamp string      `json:"currentTimestamp"`
+	BaseFee   string      `json:"currentBaseFee"`
+}
+
+type stTransaction struct {
+	Data                 []string `json:"data"`
+	GasLimit             []string `json:"gasLimit"`
+	Value                []string `json:"value"`
+	To                   string   `json:"to"`
+	Nonce                string   `json:"nonce"`
+	GasPrice             string   `json:"gasPrice"`
+	MaxFeePerGas         string   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string   `json:"maxPriorityFeePerGas"`
+	// AccessLists are the access lists of the data variants
+	AccessLists []types.AccessList `json:"accessLists"`
+	SecretKey   string             `json:"secretKey"`
+	Sender      string             `json:"sender"`
+}
+
+type stPostState struct {
+	Root    evm.Hash `json:"hash"`
+	Logs    evm.Hash `json:"logs"`
+	Indexes struct {
+		Data  int `json:"data"`
+		Gas   int `json:"gas"`
+		Value int `json:"value"`
+	} `json:"indexes"`
+	ExpectException string `json:"expectException"`
+	// State is the expected post-state, only some fixtures have it
+	State evm.GenesisAlloc `json:"state"`
+}
+
+// StateSubtest selects one of the expected outcomes of a test
+type StateSubtest struct {
+	Fork  string
+	Index int
+}
+
+// LoadStateTests reads the tests of a fixture file by name
+func LoadStateTests(path string) (map[string]*StateTest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*StateTest
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tests, nil
+}
+
+// Subtests returns the forks and variants of the test, sorted by fork
+func (t *StateTest) Subtests() []StateSubtest {
+	var subtests []StateSubtest
+	for fork, posts := range t.Post {
+		for i := range posts {
+			subtests = append(subtests, StateSubtest{fork, i})
+		}
+	}
+	sort.Slice(subtests, func(i, j int) bool {
+		if subtests[i].Fork != subtests[j].Fork {
+			return subtests[i].Fork < subtests[j].Fork
+		}
+		return subtests[i].Index < subtests[j].Index
+	})
+	return subtests
+}
+
+// Run executes the subtest and checks the state root, the logs
+// hash and, if the fixture has one, the post-state. The subtests
+// of the forks missing from Forks are rejected.
+func (t *StateTest) Run(subtest StateSubtest, tracer evm.Tracer) (*evm.State, error) {
+	if !Forks[subtest.Fork] {
+		return nil, fmt.Errorf("%w %s", ErrUnsupportedFork, subtest.Fork)
+	}
+	posts, ok := t.Post[subtest.Fork]
+	if !ok || subtest.Index >= len(posts) {
+		return nil, fmt.Errorf("no subtest %s/%d", subtest.Fork, subtest.Index)
+	}
+	post := posts[subtest.Index]
+
+	env, err := t.Env.toBlockContext()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := t.Transaction.toMessage(post)
+	if err != nil {
+		return nil, err
+	}
+
+	state := t.Pre.ToState()
+	env.Tracer = tracer
+	receipt, err := core.ApplyMessage(state, msg, env)
+	switch {
+	case err != nil && post.ExpectException == "":
+		return state, fmt.Errorf("unexpected invalid transaction: %w", err)
+	case err == nil && post.ExpectException != "":
+		return state, fmt.Errorf("expected exception %s, the transaction is valid", post.ExpectException)
+	case err != nil:
+		// the transaction is rejected as expected, the state
+		// is unchanged
+		return state, checkRoot(state, post.Root)
+	}
+
+	if err := checkRoot(state, post.Root); err != nil {
+		return state, err
+	}
+	if logs := rlpLogsHash(receipt.Logs); logs != post.Logs {
+		return state, fmt.Errorf("logs hash mismatch: got %s, want %s", logs, post.Logs)
+	}
+	if post.State != nil {
+		if err := compareState(post.State, state); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+func checkRoot(state *evm.State, want evm.Hash) error {
+	if root := state.Root(); root != want {
+		return fmt.Errorf("state root mismatch: got %s, want %s", root, want)
+	}
+	return nil
+}
+
+func (env *stEnv) toBlockContext() (*core.BlockContext, error) {
+	gasLimit, err := evm.ParseWord(env.GasLimit)
+	if err != nil {
+		return nil, fmt.Errorf("env gas limit: %w", err)
+	}
+	baseFee, err := evm.ParseWord(env.BaseFee)
+	if err != nil {
+		return nil, fmt.Errorf("env base fee: %w", err)
+	}
+	return &core.BlockContext{Coinbase: env.Coinbase, GasLimit: gasLimit.Uint64(), BaseFee: baseFee}, nil
+}
+
+// toMessage returns the variant of the transaction selected by
+// the indexes of post
+func (tx *stTransaction) toMessage(post stPostState) (*types.Message, error) {
+	idx := post.Indexes
+	if idx.Data >= len(tx.Data) || idx.Gas >= len(tx.GasLimit) || idx.Value >= len(tx.Value) {
+		return nil, fmt.Errorf("transaction index out of range: %+v", idx)
+	}
+	fields := txFields{
+		Nonce:                tx.Nonce,
+		GasPrice:             tx.GasPrice,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		GasLimit:             tx.GasLimit[idx.Gas],
+		To:                   tx.To,
+		Value:                tx.Value[idx.Value],
+		Data:                 tx.Data[idx.Data],
+		SecretKey:            tx.SecretKey,
+		Sender:               tx.Sender,
+	}
+	if idx.Data < len(tx.AccessLists) {
+		fields.AccessList = tx.AccessLists[idx.Data]
+	}
+	msg, _, err := fields.toMessage(mainnetSigner)
+	return msg, err
+}
+
+// rlpLogsHash returns the Keccak-256 hash of the RLP encoded logs
+func rlpLogsHash(logs []*evm.Log) evm.Hash {
+	// a log is a list of its address, topics and data, which
+	// always encode
+	b, _ := rlp.EncodeToBytes(logs)
+	return evm.BytesToHash(crypto.Keccak256(b))
+}
+
+// compareState checks that state holds exactly the accounts of want
+func compareState(want evm.GenesisAlloc, state *evm.State) error {
+	for _, addr := range state.Addresses() {
+		if _, ok := want[addr]; !ok {
+			return fmt.Errorf("unexpected account %s", addr)
+		}
+	}
+	for addr, account := range want {
+		got := state.GetAccount(addr)
+		if got == nil {
+			return fmt.Errorf("account %s is missing", addr)
+		}
+		balance := account.Balance
+		if balance == nil {
+			balance = uint256.NewInt(0)
+		}
+		switch {
+		case !got.Balance.Eq(balance):
+			return fmt.Errorf("account %s: balance %s, want %s", addr, got.Balance.Hex(), balance.Hex())
+		case got.Nonce != account.Nonce:
+			return fmt.Errorf("account %s: nonce %d, want %d", addr, got.Nonce, account.Nonce)
+		case !bytes.Equal(got.Code, account.Code):
+			return fmt.Errorf("account %s: code 0x%x, want 0x%x", addr, got.Code, account.Code)
+		}
+
+		// zero values are the same as unset slots
+		for _, slot := range got.Storage.Slots() {
+			value := account.Storage[slot]
+			if !got.Storage.Get(slot).Eq(&value) {
+				return fmt.Errorf("account %s: slot %s is %s, want %s", addr, slot.Hex(), got.Storage.Get(slot).Hex(), value.Hex())
+			}
+		}
+		for slot, value := range account.Storage {
+			value := value
+			if !got.Storage.Get(slot).Eq(&value) {
+				return fmt.Errorf("account %s: slot %s is %s, want %s", addr, slot.Hex(), got.Storage.Get(slot).Hex(), value.Hex())
+			}
+		}
+	}
+	return nil
+}
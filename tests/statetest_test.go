@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"io"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateTest(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	tests, err := LoadStateTests("testdata/statetest.json")
+	assert.NoError(t, err)
+	test := tests["sstoreAndLog"]
+	for _, subtest := range test.Subtests() {
+		_, err := test.Run(subtest, nil)
+		assert.NoError(t, err, "%+v", subtest)
+	}
+}
+
+func TestStateTestFailure(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	tests, err := LoadStateTests("testdata/statetest.json")
+	assert.NoError(t, err)
+	test := tests["sstoreAndLog"]
+
+	// the transaction is valid with the first gas limit
+	test.Post["Shanghai"][0].ExpectException = "TransactionException.INTRINSIC_GAS_TOO_LOW"
+	_, err = test.Run(StateSubtest{"Shanghai", 0}, nil)
+	assert.EqualError(t, err, "expected exception TransactionException.INTRINSIC_GAS_TOO_LOW, the transaction is valid")
+
+	test.Post["Shanghai"][1].State[evm.HexToAddress("0x1000")].Storage[*uint256.NewInt(1)] = *uint256.NewInt(3)
+	_, err = test.Run(StateSubtest{"Shanghai", 1}, nil)
+	assert.EqualError(t, err, "account 0x0000000000000000000000000000000000001000: slot 0x1 is 0x2, want 0x3")
+
+	test.Post["Shanghai"][2].ExpectException = ""
+	_, err = test.Run(StateSubtest{"Shanghai", 2}, nil)
+	assert.EqualError(t, err, "unexpected invalid transaction: intrinsic gas too low: have 21000, want 21140")
+
+	test.Post["Shanghai"][0].ExpectException = ""
+	test.Post["Shanghai"][0].Root = evm.Hash{}
+	_, err = test.Run(StateSubtest{"Shanghai", 0}, nil)
+	assert.EqualError(t, err, "state root mismatch: got 0x6d09a8d562dc9868c67f97423d49c165cb22341ae9738d5496acc4d18ebfa3a3, want 0x0000000000000000000000000000000000000000000000000000000000000000")
+
+	// the root of the pre-state left by a rejected transaction too
+	test.Post["Shanghai"][2].ExpectException = "TransactionException.INTRINSIC_GAS_TOO_LOW"
+	test.Post["Shanghai"][2].Root = evm.Hash{}
+	_, err = test.Run(StateSubtest{"Shanghai", 2}, nil)
+	assert.ErrorContains(t, err, "state root mismatch")
+
+	_, err = test.Run(StateSubtest{"Shanghai", 5}, nil)
+	assert.EqualError(t, err, "no subtest Shanghai/5")
+
+	// the forks the runner doesn't implement are rejected
+	test.Post["London"] = test.Post["Shanghai"]
+	_, err = test.Run(StateSubtest{"London", 0}, nil)
+	assert.ErrorIs(t, err, ErrUnsupportedFork)
+	assert.EqualError(t, err, "unsupported fork London")
+}
+
+// TestUpstreamStateTest runs add11 of ethereum/tests, it only uses
+// the supported instructions
+func TestUpstreamStateTest(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	tests, err := LoadStateTests("testdata/add11.json")
+	assert.NoError(t, err)
+	test := tests["add11"]
+	assert.Equal(t, []StateSubtest{{"Shanghai", 0}}, test.Subtests())
+	state, err := test.Run(StateSubtest{"Shanghai", 0}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), state.GetStorage(evm.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87"), *uint256.NewInt(0)).Uint64())
+}
+
+func TestLogsHash(t *testing.T) {
+	assert.Equal(t, evm.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"), rlpLogsHash(nil))
+}
@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/avichalp/toy-evm/core"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// T8nEnv is the env.json input of the state transition tool: the
+// block the transactions are executed in
+type T8nEnv struct {
+	Coinbase       evm.Address    `json:"currentCoinbase"`
+	GasLimit       string         `json:"currentGasLimit"`
+	Number         string         `json:"currentNumber"`
+	Timestamp      string         `json:"currentTimestamp"`
+	Difficulty     string         `json:"currentDifficulty"`
+	BaseFee        string         `json:"currentBaseFee"`
+	ParentBaseFee  string         `json:"parentBaseFee"`
+	ParentGasUsed  string         `json:"parentGasUsed"`
+	ParentGasLimit string         `json:"parentGasLimit"`
+	Withdrawals    []btWithdrawal `json:"withdrawals"`
+}
+
+// T8nTransaction is a transaction of the txs.json input, in the
+// format of the JSON-RPC API
+type T8nTransaction struct {
+	Type                 string           `json:"type"`
+	ChainID              string           `json:"chainId"`
+	Nonce                string           `json:"nonce"`
+	GasPrice             string           `json:"gasPrice"`
+	MaxFeePerGas         string           `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string           `json:"maxPriorityFeePerGas"`
+	Gas                  string           `json:"gas"`
+	To                   string           `json:"to"`
+	Value                string           `json:"value"`
+	Input                string           `json:"input"`
+	AccessList           types.AccessList `json:"accessList"`
+	MaxFeePerBlobGas     string           `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []evm.Hash       `json:"blobVersionedHashes"`
+	V                    string           `json:"v"`
+	R                    string           `json:"r"`
+	S                    string           `json:"s"`
+	// SecretKey signs the transaction, replacing its signature
+	SecretKey string `json:"secretKey"`
+	// Sender replaces the signature, the transaction is executed
+	// without it
+	Sender string `json:"sender"`
+}
+
+// T8nTransactionsFromRLP decodes the RLP list of signed transactions
+// of a txs.rlp input
+func T8nTransactionsFromRLP(b []byte) ([]*T8nTransaction, error) {
+	var decoded []*types.Transaction
+	if err := rlp.DecodeBytes(b, &decoded); err != nil {
+		return nil, err
+	}
+	txs := make([]*T8nTransaction, len(decoded))
+	for i, tx := range decoded {
+		txs[i] = &T8nTransaction{
+			Type:                 hexUint(uint64(tx.Type)),
+			ChainID:              hexOptional(tx.ChainID),
+			Nonce:                hexUint(tx.Nonce),
+			GasPrice:             hexOptional(tx.GasPrice),
+			MaxFeePerGas:         hexOptional(tx.GasFeeCap),
+			MaxPriorityFeePerGas: hexOptional(tx.GasTipCap),
+			Gas:                  hexUint(tx.Gas),
+			Value:                tx.Value.Hex(),
+			Input:                fmt.Sprintf("0x%x", tx.Data),
+			AccessList:           tx.AccessList,
+			MaxFeePerBlobGas:     hexOptional(tx.BlobFeeCap),
+			BlobVersionedHashes:  tx.BlobHashes,
+			V:                    tx.V.Hex(),
+			R:                    tx.R.Hex(),
+			S:                    tx.S.Hex(),
+		}
+		if tx.To != nil {
+			txs[i].To = tx.To.Hex()
+		}
+	}
+	return txs, nil
+}
+
+// T8nResult is the result.json output of the state transition tool
+type T8nResult struct {
+	StateRoot         evm.Hash       `json:"stateRoot"`
+	TxRoot            evm.Hash       `json:"txRoot"`
+	ReceiptsRoot      evm.Hash       `json:"receiptsRoot"`
+	LogsHash          evm.Hash       `json:"logsHash"`
+	LogsBloom         types.Bloom    `json:"logsBloom"`
+	Receipts          []*T8nReceipt  `json:"receipts"`
+	Rejected          []*T8nRejected `json:"rejected,omitempty"`
+	CurrentDifficulty string         `json:"currentDifficulty"`
+	GasUsed           string         `json:"gasUsed"`
+	CurrentBaseFee    string         `json:"currentBaseFee,omitempty"`
+
+	// included are the transactions of the block body
+	included []*types.Transaction
+}
+
+// Body returns the RLP list of the transactions included in the
+// block. Transactions given with a sender have no signature.
+func (r *T8nResult) Body() ([]byte, error) {
+	return rlp.EncodeToBytes(r.included)
+}
+
+// T8nReceipt is the receipt of an included transaction
+type T8nReceipt struct {
+	Type              string      `json:"type"`
+	Status            string      `json:"status"`
+	CumulativeGasUsed string      `json:"cumulativeGasUsed"`
+	LogsBloom         types.Bloom `json:"logsBloom"`
+	Logs              []*T8nLog   `json:"logs"`
+	ContractAddress   evm.Address `json:"contractAddress"`
+	GasUsed           string      `json:"gasUsed"`
+	TransactionIndex  string      `json:"transactionIndex"`
+}
+
+type T8nLog struct {
+	Address          evm.Address `json:"address"`
+	Topics           []evm.Hash  `json:"topics"`
+	Data             string      `json:"data"`
+	BlockNumber      string      `json:"blockNumber"`
+	TransactionIndex string      `json:"transactionIndex"`
+	LogIndex         string      `json:"logIndex"`
+}
+
+// T8nRejected reports a transaction left out of the block
+type T8nRejected struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// Transition executes the transactions on the pre-state in the
+// block described by env, then pays the block reward, if not
+// negative, and the withdrawals. Senders are recovered for chainID.
+// Invalid transactions are reported in the result and left out. It
+// returns the post-state.
+func Transition(alloc evm.GenesisAlloc, env *T8nEnv, txs []*T8nTransaction, reward int64, chainID uint64) (*evm.State, *T8nResult, error) {
+	block, number, err := env.toBlockContext()
+	if err != nil {
+		return nil, nil, err
+	}
+	state := alloc.ToState()
+	result := &T8nResult{
+		Receipts:          []*T8nReceipt{},
+		CurrentDifficulty: env.Difficulty,
+		CurrentBaseFee:    hexWord(block.BaseFee),
+	}
+
+	var (
+		gasUsed       uint64
+		logs          []*evm.Log
+		receipts      types.Receipts
+		blockGasLimit = block.GasLimit
+		signer        = types.NewSigner(chainID)
+	)
+	for i, tx := range txs {
+		msg, signed, err := tx.toMessage(signer)
+		if err != nil {
+			result.Rejected = append(result.Rejected, &T8nRejected{i, err.Error()})
+			continue
+		}
+		// the gas left in the block
+		block.GasLimit = blockGasLimit - gasUsed
+		applied, err := core.ApplyMessage(state, msg, block)
+		if err != nil {
+			result.Rejected = append(result.Rejected, &T8nRejected{i, err.Error()})
+			continue
+		}
+		gasUsed += applied.GasUsed
+		applied.Type, applied.CumulativeGasUsed = signed.Type, gasUsed
+		receipts = append(receipts, applied)
+
+		txIndex := hexUint(uint64(len(result.Receipts)))
+		receipt := &T8nReceipt{
+			Type:              hexUint(uint64(applied.Type)),
+			Status:            "0x1",
+			CumulativeGasUsed: hexUint(gasUsed),
+			LogsBloom:         applied.Bloom,
+			Logs:              []*T8nLog{},
+			GasUsed:           hexUint(applied.GasUsed),
+			TransactionIndex:  txIndex,
+		}
+		if applied.Status == types.ReceiptStatusFailed {
+			receipt.Status = "0x0"
+		}
+		receipt.ContractAddress = applied.ContractAddress
+		for _, log := range applied.Logs {
+			receipt.Logs = append(receipt.Logs, &T8nLog{
+				Address:          log.Address,
+				Topics:           log.Topics,
+				Data:             fmt.Sprintf("0x%x", log.Data),
+				BlockNumber:      hexUint(number),
+				TransactionIndex: txIndex,
+				LogIndex:         hexUint(uint64(len(logs))),
+			})
+			logs = append(logs, log)
+		}
+		result.Receipts = append(result.Receipts, receipt)
+		result.included = append(result.included, signed)
+	}
+
+	if reward > 0 {
+		state.AddBalance(env.Coinbase, uint256.NewInt(uint64(reward)))
+	}
+	withdrawals, err := toWithdrawals(env.Withdrawals)
+	if err != nil {
+		return nil, nil, err
+	}
+	core.ProcessWithdrawals(state, withdrawals)
+
+	result.StateRoot = state.Root()
+	result.LogsHash = rlpLogsHash(logs)
+	result.LogsBloom = types.CreateBloom(receipts)
+	if result.ReceiptsRoot, err = types.DeriveSha(receipts); err != nil {
+		return nil, nil, err
+	}
+	if result.TxRoot, err = types.DeriveSha(types.Transactions(result.included)); err != nil {
+		return nil, nil, err
+	}
+	result.GasUsed = hexUint(gasUsed)
+	return state, result, nil
+}
+
+// toBlockContext returns the block and its number. Without a base fee
+// it is derived from the parent, if given.
+func (env *T8nEnv) toBlockContext() (*core.BlockContext, uint64, error) {
+	words := make(map[string]*uint256.Int)
+	for name, input := range map[string]string{
+		"currentGasLimit": env.GasLimit,
+		"currentNumber":   env.Number,
+		"currentBaseFee":  env.BaseFee,
+		"parentBaseFee":   env.ParentBaseFee,
+		"parentGasUsed":   env.ParentGasUsed,
+		"parentGasLimit":  env.ParentGasLimit,
+	} {
+		value, err := evm.ParseWord(input)
+		if err != nil {
+			return nil, 0, fmt.Errorf("env %s: %w", name, err)
+		}
+		words[name] = value
+	}
+	if !words["currentGasLimit"].IsUint64() || !words["currentNumber"].IsUint64() {
+		return nil, 0, fmt.Errorf("env gas limit or number is too large")
+	}
+
+	baseFee := words["currentBaseFee"]
+	if env.BaseFee == "" && env.ParentBaseFee != "" {
+		baseFee = calcBaseFee(&headerWords{
+			gasLimit: words["parentGasLimit"].Uint64(),
+			gasUsed:  words["parentGasUsed"].Uint64(),
+			baseFee:  words["parentBaseFee"],
+		})
+	}
+	block := &core.BlockContext{Coinbase: env.Coinbase, GasLimit: words["currentGasLimit"].Uint64(), BaseFee: baseFee}
+	return block, words["currentNumber"].Uint64(), nil
+}
+
+func (tx *T8nTransaction) toMessage(signer types.Signer) (*types.Message, *types.Transaction, error) {
+	fields := txFields{
+		Type:                 tx.Type,
+		ChainID:              tx.ChainID,
+		Nonce:                tx.Nonce,
+		GasPrice:             tx.GasPrice,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		GasLimit:             tx.Gas,
+		To:                   tx.To,
+		Value:                tx.Value,
+		Data:                 tx.Input,
+		AccessList:           tx.AccessList,
+		MaxFeePerBlobGas:     tx.MaxFeePerBlobGas,
+		BlobVersionedHashes:  tx.BlobVersionedHashes,
+		V:                    tx.V,
+		R:                    tx.R,
+		S:                    tx.S,
+		SecretKey:            tx.SecretKey,
+		Sender:               tx.Sender,
+	}
+	return fields.toMessage(signer)
+}
+
+func hexUint(u uint64) string {
+	return fmt.Sprintf("0x%x", u)
+}
+
+func hexWord(w *uint256.Int) string {
+	if w.IsZero() {
+		return ""
+	}
+	return w.Hex()
+}
+
+// hexOptional encodes a field that is missing in some transaction
+// types
+func hexOptional(w *uint256.Int) string {
+	if w == nil {
+		return ""
+	}
+	return w.Hex()
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func readT8nInput(t *testing.T, name string, v interface{}) {
+	data, err := os.ReadFile("testdata/t8n/" + name)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, v))
+}
+
+func TestTransition(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	var (
+		alloc evm.GenesisAlloc
+		env   T8nEnv
+		txs   []*T8nTransaction
+	)
+	readT8nInput(t, "alloc.json", &alloc)
+	readT8nInput(t, "env.json", &env)
+	readT8nInput(t, "txs.json", &txs)
+
+	state, result, err := Transition(alloc, &env, txs, 5, 1)
+	assert.NoError(t, err)
+
+	// the base fee is derived from the parent
+	assert.Equal(t, "0x9", result.CurrentBaseFee)
+	assert.Equal(t, evm.HexToHash("0x735d9a20499b246c4cc69577c75fd22b7bd74916ef6f106ee358bb688e5c155a"), result.LogsHash)
+	assert.Equal(t, []*T8nRejected{{1, "nonce too low"}}, result.Rejected)
+	assert.Len(t, result.Receipts, 2)
+	assert.Equal(t, "0xaa6e", result.Receipts[0].GasUsed)
+	assert.Len(t, result.Receipts[0].Logs, 1)
+	assert.Equal(t, "0x17976", result.Receipts[1].CumulativeGasUsed)
+	assert.Equal(t, evm.HexToAddress("0xec0e71ad0a90ffe1909d27dac207f7680abba42d"), result.Receipts[1].ContractAddress)
+	assert.Equal(t, "0x17976", result.GasUsed)
+	assert.Equal(t, state.Root(), result.StateRoot)
+	logger := evm.HexToAddress("0x1000")
+	assert.True(t, result.LogsBloom.Test(logger[:]))
+	assert.Equal(t, result.Receipts[0].LogsBloom, result.LogsBloom)
+	assert.Equal(t, "0x2", result.Receipts[1].Type)
+	assert.NotEqual(t, evm.Hash(trie.EmptyRoot), result.ReceiptsRoot)
+
+	sender := evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	assert.Equal(t, uint256.NewInt(1e18-10*43630-10*53000), state.GetBalance(sender))
+	// the tips and the reward
+	assert.Equal(t, uint256.NewInt(43630+53000+5), state.GetBalance(env.Coinbase))
+	assert.Equal(t, uint256.NewInt(1e9), state.GetBalance(evm.HexToAddress("0xc0ffee")))
+	assert.Equal(t, uint256.NewInt(5), state.GetStorage(evm.HexToAddress("0x1000"), *uint256.NewInt(0)))
+
+	// the body holds the signed transactions, which replay to the
+	// same result
+	body, err := result.Body()
+	assert.NoError(t, err)
+	signed, err := T8nTransactionsFromRLP(body)
+	assert.NoError(t, err)
+	assert.Len(t, signed, 2)
+	_, replayed, err := Transition(alloc, &env, signed, 5, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, result.StateRoot, replayed.StateRoot)
+	assert.Equal(t, result.ReceiptsRoot, replayed.ReceiptsRoot)
+	assert.Equal(t, result.TxRoot, replayed.TxRoot)
+	assert.Empty(t, replayed.Rejected)
+
+	// on another chain the senders don't match
+	_, replayed, err = Transition(alloc, &env, signed, 5, 5)
+	assert.NoError(t, err)
+	assert.Len(t, replayed.Rejected, 2)
+	assert.Contains(t, replayed.Rejected[0].Error, "invalid chain id")
+}
+
+func TestTransitionRejected(t *testing.T) {
+	evm.Init()
+	evm.DebugOutput = io.Discard
+	env := &T8nEnv{GasLimit: "0x5208", BaseFee: "0x1"}
+	txs := []*T8nTransaction{
+		{Nonce: "0x0", GasPrice: "0x1", Gas: "0x5208", Value: "0x0"},
+		{Nonce: "0x0", GasPrice: "0x1", Gas: "0x5209", Value: "0x0", Sender: "0xaa"},
+		{Nonce: "0x0", GasPrice: "0x1", Gas: "0x5208", Value: "0x0", Sender: "0xaa"},
+	}
+	_, result, err := Transition(evm.GenesisAlloc{}, env, txs, -1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*T8nRejected{
+		{0, "the transaction has no sender or signature"},
+		{1, "gas limit reached"},
+		{2, "insufficient funds for gas * price + value"},
+	}, result.Rejected)
+	assert.Empty(t, result.Receipts)
+}
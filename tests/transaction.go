@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+)
+
+// mainnetSigner recovers the senders of the state and block tests,
+// which are signed for chain id 1
+var mainnetSigner = types.NewSigner(1)
+
+// txFields are the hex encoded fields of a transaction in the fixtures
+type txFields struct {
+	Type                 string           `json:"type"`
+	ChainID              string           `json:"chainId"`
+	Nonce                string           `json:"nonce"`
+	GasPrice             string           `json:"gasPrice"`
+	MaxFeePerGas         string           `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string           `json:"maxPriorityFeePerGas"`
+	GasLimit             string           `json:"gasLimit"`
+	To                   string           `json:"to"`
+	Value                string           `json:"value"`
+	Data                 string           `json:"data"`
+	AccessList           types.AccessList `json:"accessList"`
+	MaxFeePerBlobGas     string           `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []evm.Hash       `json:"blobVersionedHashes"`
+	V                    string           `json:"v"`
+	R                    string           `json:"r"`
+	S                    string           `json:"s"`
+	SecretKey            string           `json:"secretKey"`
+	Sender               string           `json:"sender"`
+}
+
+// toMessage returns the transaction as a message. The sender is
+// the given one, or the signer of the transaction: it is signed
+// with the secret key, if any, else the sender is recovered from
+// its signature.
+func (tx *txFields) toMessage(signer types.Signer) (*types.Message, *types.Transaction, error) {
+	signed, err := tx.toTransaction()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case tx.Sender != "":
+		return signed.ToMessage(evm.HexToAddress(tx.Sender)), signed, nil
+	case tx.SecretKey != "":
+		key, err := evm.ParseBytes(tx.SecretKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("transaction secret key: %w", err)
+		}
+		if err := signer.SignTx(signed, key); err != nil {
+			return nil, nil, err
+		}
+	case signed.V == nil || signed.R == nil || signed.S == nil:
+		return nil, nil, errors.New("the transaction has no sender or signature")
+	}
+	msg, err := signed.AsMessage(signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, signed, nil
+}
+
+// toTransaction parses the fields. Fixtures without a type have
+// the one of their fee fields.
+func (tx *txFields) toTransaction() (*types.Transaction, error) {
+	signed := &types.Transaction{AccessList: tx.AccessList, BlobHashes: tx.BlobVersionedHashes}
+	if tx.To != "" {
+		to := evm.HexToAddress(tx.To)
+		signed.To = &to
+	}
+	data, err := evm.ParseBytes(tx.Data)
+	if err != nil {
+		return nil, fmt.Errorf("transaction data: %w", err)
+	}
+	signed.Data = data
+
+	words := []struct {
+		name  string
+		input string
+		dst   **uint256.Int
+	}{
+		{"value", tx.Value, &signed.Value},
+		{"gas price", tx.GasPrice, &signed.GasPrice},
+		{"max fee per gas", tx.MaxFeePerGas, &signed.GasFeeCap},
+		{"max priority fee per gas", tx.MaxPriorityFeePerGas, &signed.GasTipCap},
+		{"max fee per blob gas", tx.MaxFeePerBlobGas, &signed.BlobFeeCap},
+		{"chain id", tx.ChainID, &signed.ChainID},
+		{"v", tx.V, &signed.V},
+		{"r", tx.R, &signed.R},
+		{"s", tx.S, &signed.S},
+	}
+	for _, w := range words {
+		// the fees are only set for the type of the transaction
+		if w.input == "" && w.name != "value" {
+			continue
+		}
+		value, err := evm.ParseWord(w.input)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %s: %w", w.name, err)
+		}
+		*w.dst = value
+	}
+	if signed.GasPrice == nil && (signed.GasFeeCap == nil || signed.GasTipCap == nil) {
+		return nil, fmt.Errorf("transaction has no gas price")
+	}
+
+	for _, n := range []struct {
+		name  string
+		input string
+		dst   *uint64
+	}{
+		{"nonce", tx.Nonce, &signed.Nonce},
+		{"gas limit", tx.GasLimit, &signed.Gas},
+	} {
+		value, err := evm.ParseWord(n.input)
+		if err != nil || !value.IsUint64() {
+			return nil, fmt.Errorf("invalid transaction %s %q", n.name, n.input)
+		}
+		*n.dst = value.Uint64()
+	}
+
+	switch {
+	case tx.Type != "":
+		txType, err := evm.ParseWord(tx.Type)
+		if err != nil || !txType.IsUint64() || txType.Uint64() > types.BlobTxType {
+			return nil, fmt.Errorf("invalid transaction type %q", tx.Type)
+		}
+		signed.Type = byte(txType.Uint64())
+	case signed.BlobHashes != nil:
+		signed.Type = types.BlobTxType
+	case signed.GasFeeCap != nil:
+		signed.Type = types.DynamicFeeTxType
+	case signed.AccessList != nil:
+		signed.Type = types.AccessListTxType
+	}
+	return signed, nil
+}
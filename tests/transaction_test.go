@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxFieldsSender(t *testing.T) {
+	tx := txFields{
+		Nonce:     "0x0",
+		GasPrice:  "0x1",
+		GasLimit:  "0x5208",
+		To:        "0x1000",
+		Value:     "0x5",
+		SecretKey: "0x45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8",
+	}
+	msg, signed, err := tx.toMessage(mainnetSigner)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"), msg.From)
+	assert.Equal(t, uint256.NewInt(37), signed.V)
+
+	// the signature recovers the same sender
+	tx.SecretKey, tx.V, tx.R, tx.S = "", signed.V.Hex(), signed.R.Hex(), signed.S.Hex()
+	msg, _, err = tx.toMessage(mainnetSigner)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"), msg.From)
+
+	// an access list selects an EIP-2930 transaction
+	tx.AccessList = types.AccessList{{Address: evm.HexToAddress("0x1000")}}
+	_, _, err = tx.toMessage(mainnetSigner)
+	assert.ErrorIs(t, err, types.ErrInvalidChainID)
+
+	tx.V, tx.R, tx.S = "", "", ""
+	_, _, err = tx.toMessage(mainnetSigner)
+	assert.EqualError(t, err, "the transaction has no sender or signature")
+}
@@ -0,0 +1,159 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/rlp"
+)
+
+var ErrInvalidProof = errors.New("trie: invalid proof")
+
+// Prove returns the proof of the value of key, which may be
+// missing: the encoded nodes on the path from the root to the key,
+// root first. Nodes shorter than 32 bytes are part of their parent
+// and left out, except for the root.
+func (t *Trie) Prove(key []byte) [][]byte {
+	var proof [][]byte
+	n, k := t.root, keyNibbles(key)
+	for n != nil {
+		if _, ok := n.(valueNode); ok {
+			break
+		}
+		if enc := encodeNode(n); len(proof) == 0 || len(enc) >= 32 {
+			proof = append(proof, enc)
+		}
+		switch current := n.(type) {
+		case *shortNode:
+			if !bytes.HasPrefix(k, current.Key) {
+				return proof
+			}
+			n, k = current.Val, k[len(current.Key):]
+		case *fullNode:
+			if len(k) == 0 {
+				return proof
+			}
+			n, k = current[k[0]], k[1:]
+		}
+	}
+	return proof
+}
+
+// VerifyProof checks the proof of key against the root hash and
+// returns the value of key, or nil if the proof shows the key is
+// not in the trie
+func VerifyProof(root [32]byte, key []byte, proof [][]byte) ([]byte, error) {
+	if root == EmptyRoot {
+		return nil, nil
+	}
+	nodes := make(map[[32]byte][]byte, len(proof))
+	for _, enc := range proof {
+		var h [32]byte
+		copy(h[:], crypto.Keccak256(enc))
+		nodes[h] = enc
+	}
+
+	enc, ok := nodes[root]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing root node %x", ErrInvalidProof, root)
+	}
+	k := keyNibbles(key)
+	for {
+		items, err := decodeItems(enc)
+		if err != nil {
+			return nil, err
+		}
+		var ref []byte
+		switch len(items) {
+		case 2:
+			nibbles, leaf, err := decodeHexPrefix(items[0])
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.HasPrefix(k, nibbles) {
+				return nil, nil
+			}
+			k = k[len(nibbles):]
+			if leaf {
+				if len(k) > 0 {
+					return nil, nil
+				}
+				return stringContent(items[1])
+			}
+			ref = items[1]
+		case 17:
+			if len(k) == 0 {
+				return stringContent(items[16])
+			}
+			ref, k = items[k[0]], k[1:]
+		default:
+			return nil, fmt.Errorf("%w: node with %d items", ErrInvalidProof, len(items))
+		}
+
+		// the child is embedded, referenced by its hash or missing
+		kind, content, _, err := rlp.Split(ref)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+		case kind == rlp.List:
+			enc = ref
+		case len(content) == 0:
+			return nil, nil
+		case len(content) == 32:
+			var h [32]byte
+			copy(h[:], content)
+			if enc, ok = nodes[h]; !ok {
+				return nil, fmt.Errorf("%w: missing node %x", ErrInvalidProof, h)
+			}
+		default:
+			return nil, fmt.Errorf("%w: invalid reference %x", ErrInvalidProof, ref)
+		}
+	}
+}
+
+// decodeItems returns the encoded items of a node
+func decodeItems(enc []byte) ([][]byte, error) {
+	content, rest, err := rlp.SplitList(enc)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid node %x", ErrInvalidProof, enc)
+	}
+	var items [][]byte
+	for len(content) > 0 {
+		_, _, tail, err := rlp.Split(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid node %x", ErrInvalidProof, enc)
+		}
+		items = append(items, content[:len(content)-len(tail)])
+		content = tail
+	}
+	return items, nil
+}
+
+func stringContent(item []byte) ([]byte, error) {
+	content, _, err := rlp.SplitString(item)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %x", ErrInvalidProof, item)
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return content, nil
+}
+
+// decodeHexPrefix is the inverse of hexPrefix
+func decodeHexPrefix(item []byte) (nibbles []byte, leaf bool, err error) {
+	b, _, err := rlp.SplitString(item)
+	if err != nil || len(b) == 0 || b[0]>>4 > 3 {
+		return nil, false, fmt.Errorf("%w: invalid key %x", ErrInvalidProof, item)
+	}
+	nibbles = keyNibbles(b)
+	flag := nibbles[0]
+	if flag&1 == 1 {
+		nibbles = nibbles[1:]
+	} else {
+		nibbles = nibbles[2:]
+	}
+	return nibbles, flag&2 == 2, nil
+}
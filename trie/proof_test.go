@@ -0,0 +1,102 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func proofTrie() *Trie {
+	trie := New()
+	for i := 0; i < 100; i++ {
+		key := crypto.Keccak256([]byte{byte(i)})
+		trie.Put(key, []byte(fmt.Sprintf("value %d", i)))
+	}
+	// short keys and values give embedded nodes
+	trie.Put([]byte("do"), []byte("verb"))
+	trie.Put([]byte("dog"), []byte("puppy"))
+	trie.Put([]byte("doge"), []byte("coin"))
+	return trie
+}
+
+func TestProof(t *testing.T) {
+	trie := proofTrie()
+	root := trie.Hash()
+	keys := [][]byte{[]byte("do"), []byte("dog"), []byte("doge")}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, crypto.Keccak256([]byte{byte(i)}))
+	}
+	for _, key := range keys {
+		proof := trie.Prove(key)
+		value, err := VerifyProof(root, key, proof)
+		assert.NoError(t, err, "%x", key)
+		assert.Equal(t, trie.Get(key), value, "%x", key)
+	}
+}
+
+func TestProofOfAbsence(t *testing.T) {
+	trie := proofTrie()
+	root := trie.Hash()
+	for _, key := range [][]byte{[]byte("d"), []byte("dogs"), []byte("cat"), crypto.Keccak256([]byte("missing")), nil} {
+		proof := trie.Prove(key)
+		assert.NotEmpty(t, proof)
+		value, err := VerifyProof(root, key, proof)
+		assert.NoError(t, err, "%x", key)
+		assert.Nil(t, value, "%x", key)
+	}
+
+	value, err := VerifyProof(EmptyRoot, []byte("dog"), New().Prove([]byte("dog")))
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestSmallTrieProof(t *testing.T) {
+	// the root is shorter than 32 bytes and still part of the proof
+	trie := New()
+	trie.Put([]byte("a"), []byte("b"))
+	proof := trie.Prove([]byte("a"))
+	assert.Len(t, proof, 1)
+	value, err := VerifyProof(trie.Hash(), []byte("a"), proof)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), value)
+}
+
+func TestTamperedProof(t *testing.T) {
+	trie := proofTrie()
+	root := trie.Hash()
+	key := crypto.Keccak256([]byte{7})
+	proof := trie.Prove(key)
+	assert.Greater(t, len(proof), 1)
+
+	// any changed byte changes a hash along the path
+	for i := range proof {
+		for pos := range proof[i] {
+			tampered := copyProof(proof)
+			tampered[i][pos] ^= 0x01
+			_, err := VerifyProof(root, key, tampered)
+			assert.ErrorIs(t, err, ErrInvalidProof, "node %d byte %d", i, pos)
+		}
+	}
+
+	// a missing node
+	_, err := VerifyProof(root, key, proof[:len(proof)-1])
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	// a proof for another root
+	other := proofTrie()
+	other.Put(key, []byte("forged"))
+	_, err = VerifyProof(root, key, other.Prove(key))
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	value, err := VerifyProof(other.Hash(), key, other.Prove(key))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("forged"), value)
+}
+
+func copyProof(proof [][]byte) [][]byte {
+	cpy := make([][]byte, len(proof))
+	for i := range proof {
+		cpy[i] = append([]byte{}, proof[i]...)
+	}
+	return cpy
+}
@@ -0,0 +1,265 @@
+// Package trie implements the hexary Merkle Patricia Trie that
+// commits to the world state and the account storage, see Appendix D
+// of the Yellow Paper. The trie lives in memory.
+package trie
+
+import (
+	"bytes"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/rlp"
+)
+
+// EmptyRoot is the hash of the empty trie, Keccak-256 of RLP("")
+var EmptyRoot = [32]byte{
+	0x56, 0xe8, 0x1f, 0x17, 0x1b, 0xcc, 0x55, 0xa6, 0xff, 0x83, 0x45, 0xe6, 0x92, 0xc0, 0xf8, 0x6e,
+	0x5b, 0x48, 0xe0, 0x1b, 0x99, 0x6c, 0xad, 0xc0, 0x01, 0x62, 0x2f, 0xb5, 0xe3, 0x63, 0xb4, 0x21,
+}
+
+type (
+	node interface{}
+
+	// fullNode is a branch: a child per nibble and a value for the
+	// key ending at the branch
+	fullNode [17]node
+
+	// shortNode is a leaf when Val is a valueNode and an extension
+	// otherwise, in which case Val is a fullNode
+	shortNode struct {
+		Key []byte // nibbles
+		Val node
+	}
+
+	valueNode []byte
+)
+
+// Trie maps byte keys to non-empty values. Nodes are never modified
+// in place, so a copy of a Trie is independent of the original.
+type Trie struct {
+	root node
+}
+
+func New() *Trie {
+	return &Trie{}
+}
+
+// Get returns the value of key, or nil if it isn't set
+func (t *Trie) Get(key []byte) []byte {
+	n, k := t.root, keyNibbles(key)
+	for {
+		switch current := n.(type) {
+		case nil:
+			return nil
+		case valueNode:
+			if len(k) == 0 {
+				return current
+			}
+			return nil
+		case *shortNode:
+			if !bytes.HasPrefix(k, current.Key) {
+				return nil
+			}
+			n, k = current.Val, k[len(current.Key):]
+		case *fullNode:
+			if len(k) == 0 {
+				n = current[16]
+			} else {
+				n, k = current[k[0]], k[1:]
+			}
+		}
+	}
+}
+
+// Put sets the value of key, an empty value deletes the key
+func (t *Trie) Put(key, value []byte) {
+	if len(value) == 0 {
+		t.Delete(key)
+		return
+	}
+	t.root = insert(t.root, keyNibbles(key), valueNode(append([]byte{}, value...)))
+}
+
+// Delete removes key from the trie
+func (t *Trie) Delete(key []byte) {
+	t.root = remove(t.root, keyNibbles(key))
+}
+
+// Hash returns the root hash, which commits to all the keys and values
+func (t *Trie) Hash() [32]byte {
+	if t.root == nil {
+		return EmptyRoot
+	}
+	var h [32]byte
+	copy(h[:], crypto.Keccak256(encodeNode(t.root)))
+	return h
+}
+
+func insert(n node, key []byte, value valueNode) node {
+	switch n := n.(type) {
+	case nil:
+		return &shortNode{key, value}
+	case valueNode:
+		if len(key) == 0 {
+			return value
+		}
+		// the old value ends at a new branch
+		branch := &fullNode{}
+		branch[16] = n
+		return insert(branch, key, value)
+	case *shortNode:
+		m := prefixLen(key, n.Key)
+		if m == len(n.Key) {
+			return shorten(n.Key, insert(n.Val, key[m:], value))
+		}
+		// split the node at the first differing nibble
+		branch := &fullNode{}
+		branch[n.Key[m]] = shorten(n.Key[m+1:], n.Val)
+		child := insert(branch, key[m:], value)
+		if m == 0 {
+			return child
+		}
+		return &shortNode{key[:m], child}
+	case *fullNode:
+		cpy := *n
+		if len(key) == 0 {
+			cpy[16] = value
+		} else {
+			cpy[key[0]] = insert(cpy[key[0]], key[1:], value)
+		}
+		return &cpy
+	}
+	panic("trie: invalid node")
+}
+
+func remove(n node, key []byte) node {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case valueNode:
+		if len(key) == 0 {
+			return nil
+		}
+		return n
+	case *shortNode:
+		if !bytes.HasPrefix(key, n.Key) {
+			return n
+		}
+		child := remove(n.Val, key[len(n.Key):])
+		if child == nil {
+			return nil
+		}
+		return shorten(n.Key, child)
+	case *fullNode:
+		cpy := *n
+		if len(key) == 0 {
+			cpy[16] = nil
+		} else {
+			cpy[key[0]] = remove(cpy[key[0]], key[1:])
+		}
+		// a branch with a single entry left is replaced
+		pos := -1
+		for i, child := range cpy {
+			if child != nil {
+				if pos >= 0 {
+					return &cpy
+				}
+				pos = i
+			}
+		}
+		switch pos {
+		case -1:
+			return nil
+		case 16:
+			return &shortNode{[]byte{}, cpy[16]}
+		}
+		return shorten([]byte{byte(pos)}, cpy[pos])
+	}
+	panic("trie: invalid node")
+}
+
+// shorten returns a node for child below the nibbles of key,
+// merging short nodes
+func shorten(key []byte, child node) node {
+	if short, ok := child.(*shortNode); ok {
+		return &shortNode{concat(key, short.Key), short.Val}
+	}
+	if _, ok := child.(*fullNode); ok && len(key) == 0 {
+		return child
+	}
+	return &shortNode{key, child}
+}
+
+// encodeNode returns the RLP encoding of n
+func encodeNode(n node) []byte {
+	var items []rlp.RawValue
+	switch n := n.(type) {
+	case *shortNode:
+		_, leaf := n.Val.(valueNode)
+		items = []rlp.RawValue{rlp.AppendString(nil, hexPrefix(n.Key, leaf)), reference(n.Val)}
+	case *fullNode:
+		for _, child := range n {
+			items = append(items, reference(child))
+		}
+	default:
+		panic("trie: invalid node")
+	}
+	// a list of raw values always encodes
+	b, _ := rlp.EncodeToBytes(items)
+	return b
+}
+
+// reference returns the encoding of n in its parent: the node
+// itself if its encoding is shorter than 32 bytes, its hash otherwise
+func reference(n node) rlp.RawValue {
+	switch n := n.(type) {
+	case nil:
+		return rlp.AppendString(nil, nil)
+	case valueNode:
+		return rlp.AppendString(nil, n)
+	}
+	b := encodeNode(n)
+	if len(b) < 32 {
+		return b
+	}
+	return rlp.AppendString(nil, crypto.Keccak256(b))
+}
+
+// hexPrefix encodes nibbles to bytes, the first nibble flags a leaf
+// and an odd number of nibbles
+func hexPrefix(nibbles []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+	if len(nibbles)%2 == 1 {
+		flag++
+		nibbles = concat([]byte{flag}, nibbles)
+	} else {
+		nibbles = concat([]byte{flag, 0}, nibbles)
+	}
+	b := make([]byte, len(nibbles)/2)
+	for i := range b {
+		b[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return b
+}
+
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, 2*len(key))
+	for i, b := range key {
+		nibbles[2*i], nibbles[2*i+1] = b>>4, b&0x0f
+	}
+	return nibbles
+}
+
+func prefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
@@ -0,0 +1,159 @@
+package trie
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeInput decodes the keys and values of the trie tests,
+// which are strings or 0x prefixed hex
+func decodeInput(s string) []byte {
+	if strings.HasPrefix(s, "0x") {
+		b, err := hex.DecodeString(s[2:])
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+	return []byte(s)
+}
+
+func decodeRoot(t *testing.T, s string) [32]byte {
+	var root [32]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	assert.NoError(t, err)
+	copy(root[:], b)
+	return root
+}
+
+func TestAnyOrder(t *testing.T) {
+	data, err := os.ReadFile("testdata/trieanyorder.json")
+	assert.NoError(t, err)
+	var tests map[string]struct {
+		In   map[string]string
+		Root string
+	}
+	assert.NoError(t, json.Unmarshal(data, &tests))
+
+	for name, test := range tests {
+		var keys []string
+		for k := range test.In {
+			keys = append(keys, k)
+		}
+		// the root doesn't depend on the order of the inserts
+		permutations(keys, func(keys []string) {
+			trie := New()
+			for _, k := range keys {
+				trie.Put(decodeInput(k), decodeInput(test.In[k]))
+			}
+			assert.Equal(t, decodeRoot(t, test.Root), trie.Hash(), "%s %v", name, keys)
+			for _, k := range keys {
+				assert.Equal(t, decodeInput(test.In[k]), trie.Get(decodeInput(k)), "%s %s", name, k)
+			}
+		})
+	}
+}
+
+func TestTrieTests(t *testing.T) {
+	data, err := os.ReadFile("testdata/trietest.json")
+	assert.NoError(t, err)
+	var tests map[string]struct {
+		In   [][2]*string
+		Root string
+	}
+	assert.NoError(t, json.Unmarshal(data, &tests))
+
+	for name, test := range tests {
+		trie := New()
+		for _, kv := range test.In {
+			if kv[1] == nil {
+				trie.Delete(decodeInput(*kv[0]))
+			} else {
+				trie.Put(decodeInput(*kv[0]), decodeInput(*kv[1]))
+			}
+		}
+		assert.Equal(t, decodeRoot(t, test.Root), trie.Hash(), name)
+	}
+}
+
+func TestTrie(t *testing.T) {
+	trie := New()
+	assert.Equal(t, EmptyRoot, trie.Hash())
+	assert.Nil(t, trie.Get([]byte("dog")))
+
+	trie.Put([]byte("dog"), []byte("puppy"))
+	trie.Put([]byte("doge"), []byte("coin"))
+	trie.Put([]byte("do"), []byte("verb"))
+	assert.Equal(t, []byte("puppy"), trie.Get([]byte("dog")))
+	assert.Equal(t, []byte("verb"), trie.Get([]byte("do")))
+	assert.Nil(t, trie.Get([]byte("d")))
+	assert.Nil(t, trie.Get([]byte("dogs")))
+	assert.Nil(t, trie.Get([]byte("cat")))
+
+	// copies are independent
+	cpy := *trie
+	cpy.Put([]byte("dog"), []byte("wolf"))
+	assert.Equal(t, []byte("puppy"), trie.Get([]byte("dog")))
+	assert.Equal(t, []byte("wolf"), cpy.Get([]byte("dog")))
+
+	// an empty value deletes the key
+	trie.Put([]byte("doge"), nil)
+	assert.Nil(t, trie.Get([]byte("doge")))
+	trie.Delete([]byte("missing"))
+	trie.Delete([]byte("dog"))
+	trie.Delete([]byte("do"))
+	assert.Equal(t, EmptyRoot, trie.Hash())
+}
+
+func TestDeleteRestoresRoot(t *testing.T) {
+	trie := New()
+	var keys [][]byte
+	for i := 0; i < 200; i++ {
+		key := []byte{byte(i), byte(i * 7), byte(i % 3)}
+		if i%5 == 0 {
+			key = key[:1+i%3]
+		}
+		keys = append(keys, key)
+	}
+	roots := make([][32]byte, len(keys))
+	for i, key := range keys {
+		roots[i] = trie.Hash()
+		trie.Put(key, append([]byte("value"), key...))
+	}
+	// deleting the keys in reverse order goes back through the roots
+	for i := len(keys) - 1; i >= 0; i-- {
+		assert.Equal(t, append([]byte("value"), keys[i]...), trie.Get(keys[i]))
+		trie.Delete(keys[i])
+		assert.Equal(t, roots[i], trie.Hash(), "%d", i)
+	}
+}
+
+func TestHexPrefix(t *testing.T) {
+	assert.Equal(t, []byte{0x11, 0x23, 0x45}, hexPrefix([]byte{1, 2, 3, 4, 5}, false))
+	assert.Equal(t, []byte{0x00, 0x01, 0x23, 0x45}, hexPrefix([]byte{0, 1, 2, 3, 4, 5}, false))
+	assert.Equal(t, []byte{0x20, 0x0f, 0x1c, 0xb8}, hexPrefix([]byte{0, 15, 1, 12, 11, 8}, true))
+	assert.Equal(t, []byte{0x3f, 0x1c, 0xb8}, hexPrefix([]byte{15, 1, 12, 11, 8}, true))
+	assert.Equal(t, []byte{0x20}, hexPrefix(nil, true))
+}
+
+// permutations calls f with every order of keys
+func permutations(keys []string, f func([]string)) {
+	var permute func(int)
+	permute = func(i int) {
+		if i == len(keys) {
+			f(keys)
+			return
+		}
+		for j := i; j < len(keys); j++ {
+			keys[i], keys[j] = keys[j], keys[i]
+			permute(i + 1)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	permute(0)
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/holiman/uint256"
+)
+
+// EmptyUncleHash is the hash of an empty list of uncles
+var EmptyUncleHash = evm.BytesToHash(crypto.Keccak256([]byte{0xc0}))
+
+// Header is a block header. The fields added by later forks are nil
+// before them and only encoded when set.
+type Header struct {
+	ParentHash  evm.Hash
+	UncleHash   evm.Hash
+	Coinbase    evm.Address
+	Root        evm.Hash
+	TxHash      evm.Hash
+	ReceiptHash evm.Hash
+	Bloom       Bloom
+	Difficulty  *uint256.Int
+	Number      uint64
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   evm.Hash
+	Nonce       [8]byte
+
+	BaseFee          *uint256.Int `rlp:"optional"` // EIP-1559
+	WithdrawalsHash  *evm.Hash    `rlp:"optional"` // EIP-4895
+	BlobGasUsed      *uint64      `rlp:"optional"` // EIP-4844
+	ExcessBlobGas    *uint64      `rlp:"optional"` // EIP-4844
+	ParentBeaconRoot *evm.Hash    `rlp:"optional"` // EIP-4788
+	RequestsHash     *evm.Hash    `rlp:"optional"` // EIP-7685
+}
+
+// Hash returns the Keccak-256 hash of the RLP encoded header
+func (h *Header) Hash() evm.Hash {
+	// the fields of a header always encode
+	b, _ := rlp.EncodeToBytes(h)
+	return evm.BytesToHash(crypto.Keccak256(b))
+}
+
+// Withdrawal is a withdrawal from the beacon chain (EIP-4895)
+type Withdrawal struct {
+	Index     uint64
+	Validator uint64
+	Address   evm.Address
+	// Amount is in gwei
+	Amount uint64
+}
+
+// Withdrawals are the withdrawals of a block
+type Withdrawals []*Withdrawal
+
+func (ws Withdrawals) Len() int { return len(ws) }
+
+func (ws Withdrawals) EncodeIndex(i int) ([]byte, error) { return rlp.EncodeToBytes(ws[i]) }
+
+// Block is a header and its body. It is RLP encoded as the list of
+// its fields, the withdrawals are left out before Shanghai.
+type Block struct {
+	Header       *Header
+	Transactions Transactions
+	Uncles       []*Header
+	Withdrawals  Withdrawals `rlp:"optional"` // nil before Shanghai
+}
+
+// extblock is the RLP form of a block, without its methods
+type extblock Block
+
+// DecodeRLP decodes a block as encoded in the test fixtures and the
+// network messages
+func (b *Block) DecodeRLP(input []byte) error {
+	var eb extblock
+	if err := rlp.DecodeBytes(input, &eb); err != nil {
+		return err
+	}
+	*b = Block(eb)
+	return nil
+}
+
+// Hash returns the hash of the header of the block
+func (b *Block) Hash() evm.Hash {
+	return b.Header.Hash()
+}
+
+// CalcUncleHash returns the hash of the RLP list of the uncles
+func CalcUncleHash(uncles []*Header) evm.Hash {
+	if len(uncles) == 0 {
+		return EmptyUncleHash
+	}
+	b, _ := rlp.EncodeToBytes(uncles)
+	return evm.BytesToHash(crypto.Keccak256(b))
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderHash(t *testing.T) {
+	// the genesis of the mainnet
+	genesis := &Header{
+		UncleHash:   EmptyUncleHash,
+		Root:        evm.HexToHash("0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544"),
+		TxHash:      evm.Hash(trie.EmptyRoot),
+		ReceiptHash: evm.Hash(trie.EmptyRoot),
+		Difficulty:  uint256.NewInt(0x400000000),
+		GasLimit:    5000,
+		Extra:       evm.HexToBytes("11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa"),
+		Nonce:       [8]byte{7: 0x42},
+	}
+	assert.Equal(t, evm.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"), genesis.Hash())
+	assert.Equal(t, genesis.Hash(), (&Block{Header: genesis}).Hash())
+}
+
+func TestHeaderOptionalFields(t *testing.T) {
+	header := &Header{Difficulty: uint256.NewInt(0), BaseFee: uint256.NewInt(7)}
+	b, err := rlp.EncodeToBytes(header)
+	assert.NoError(t, err)
+	var decoded Header
+	assert.NoError(t, rlp.DecodeBytes(b, &decoded))
+	assert.Equal(t, uint256.NewInt(7), decoded.BaseFee)
+	assert.Nil(t, decoded.WithdrawalsHash)
+	assert.Nil(t, decoded.ParentBeaconRoot)
+
+	// a later field is encoded with the ones before it
+	root := evm.HexToHash("0x01")
+	blobGas := uint64(0)
+	withBeaconRoot := *header
+	withBeaconRoot.WithdrawalsHash = &root
+	withBeaconRoot.BlobGasUsed, withBeaconRoot.ExcessBlobGas = &blobGas, &blobGas
+	withBeaconRoot.ParentBeaconRoot = &root
+	assert.NotEqual(t, header.Hash(), withBeaconRoot.Hash())
+
+	b, err = rlp.EncodeToBytes(&withBeaconRoot)
+	assert.NoError(t, err)
+	decoded = Header{}
+	assert.NoError(t, rlp.DecodeBytes(b, &decoded))
+	assert.Equal(t, &root, decoded.ParentBeaconRoot)
+	assert.Equal(t, withBeaconRoot.Hash(), decoded.Hash())
+}
+
+func TestBlockRLP(t *testing.T) {
+	// the genesis block of the mainnet has no body
+	genesis := &Header{
+		UncleHash:   EmptyUncleHash,
+		Root:        evm.HexToHash("0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544"),
+		TxHash:      evm.Hash(trie.EmptyRoot),
+		ReceiptHash: evm.Hash(trie.EmptyRoot),
+		Difficulty:  uint256.NewInt(0x400000000),
+		GasLimit:    5000,
+		Extra:       evm.HexToBytes("11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa"),
+		Nonce:       [8]byte{7: 0x42},
+	}
+	header, err := rlp.EncodeToBytes(genesis)
+	assert.NoError(t, err)
+	enc, err := rlp.EncodeToBytes([]rlp.RawValue{header, {0xc0}, {0xc0}})
+	assert.NoError(t, err)
+	var block Block
+	assert.NoError(t, rlp.DecodeBytes(enc, &block))
+	assert.Equal(t, evm.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"), block.Hash())
+	assert.Empty(t, block.Transactions)
+	assert.Nil(t, block.Withdrawals)
+
+	// a Shanghai block with a body
+	signer := NewSigner(1)
+	key := evm.HexToBytes("4646464646464646464646464646464646464646464646464646464646464646")
+	txs := testTransactions()
+	for _, tx := range txs {
+		assert.NoError(t, signer.SignTx(tx, key))
+	}
+	root := evm.HexToHash("0x01")
+	uncle := &Header{Difficulty: uint256.NewInt(1), Number: 1}
+	shanghai := &Block{
+		Header:       &Header{Difficulty: uint256.NewInt(0), Number: 2, BaseFee: uint256.NewInt(7), WithdrawalsHash: &root},
+		Transactions: txs,
+		Uncles:       []*Header{uncle},
+		Withdrawals:  Withdrawals{{Index: 1, Validator: 2, Address: evm.HexToAddress("0xc0ffee"), Amount: 3}},
+	}
+	enc, err = rlp.EncodeToBytes(shanghai)
+	assert.NoError(t, err)
+	block = Block{}
+	assert.NoError(t, rlp.DecodeBytes(enc, &block))
+	assert.Equal(t, shanghai.Hash(), block.Hash())
+	assert.Len(t, block.Transactions, len(txs))
+	for i, tx := range block.Transactions {
+		assert.Equal(t, txs[i].Hash(), tx.Hash())
+	}
+	assert.Equal(t, CalcUncleHash(shanghai.Uncles), CalcUncleHash(block.Uncles))
+	assert.Equal(t, shanghai.Withdrawals, block.Withdrawals)
+
+	// an empty list of withdrawals is kept
+	shanghai.Withdrawals = Withdrawals{}
+	enc, err = rlp.EncodeToBytes(shanghai)
+	assert.NoError(t, err)
+	assert.NoError(t, rlp.DecodeBytes(enc, &block))
+	assert.NotNil(t, block.Withdrawals)
+	assert.Empty(t, block.Withdrawals)
+
+	assert.Error(t, rlp.DecodeBytes(enc[:len(enc)-1], &block))
+	assert.ErrorIs(t, rlp.DecodeBytes(evm.HexToBytes("c0"), &block), rlp.ErrTooFewElements)
+	extra, err := rlp.EncodeToBytes([]rlp.RawValue{header, {0xc0}, {0xc0}, {0xc0}, {0xc0}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, rlp.DecodeBytes(extra, &block), rlp.ErrTooManyElements)
+}
+
+func TestCalcUncleHash(t *testing.T) {
+	assert.Equal(t, evm.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"), CalcUncleHash(nil))
+
+	uncle := &Header{Difficulty: uint256.NewInt(1), Number: 1}
+	b, err := rlp.EncodeToBytes([]*Header{uncle})
+	assert.NoError(t, err)
+	assert.Equal(t, evm.BytesToHash(crypto.Keccak256(b)), CalcUncleHash([]*Header{uncle}))
+}
+
+func TestWithdrawalsRoot(t *testing.T) {
+	root, err := DeriveSha(Withdrawals{})
+	assert.NoError(t, err)
+	assert.Equal(t, evm.Hash(trie.EmptyRoot), root)
+
+	withdrawals := Withdrawals{
+		{Index: 0, Validator: 1, Address: evm.HexToAddress("0xc0ffee"), Amount: 1},
+		{Index: 1, Validator: 2, Address: evm.HexToAddress("0xbeef"), Amount: 32e9},
+	}
+	want := trie.New()
+	for i, w := range withdrawals {
+		b, err := rlp.EncodeToBytes([]interface{}{w.Index, w.Validator, w.Address, w.Amount})
+		assert.NoError(t, err)
+		want.Put(rlp.AppendUint64(nil, uint64(i)), b)
+	}
+	root, err = DeriveSha(withdrawals)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.Hash(want.Hash()), root)
+}
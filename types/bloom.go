@@ -0,0 +1,91 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+)
+
+// BloomByteLength is the size of a bloom filter, 2048 bits
+const BloomByteLength = 256
+
+// Bloom is the 2048-bit bloom filter of the addresses and topics of
+// logs (Yellow Paper 4.3.1). It may tell that a log is missing from
+// a receipt or block without reading the logs.
+type Bloom [BloomByteLength]byte
+
+// Add sets the three bits of data in the filter
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range bloomBits(data) {
+		b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether data may have been added to the filter. A
+// false result means it was not.
+func (b Bloom) Test(data []byte) bool {
+	for _, bit := range bloomBits(data) {
+		if b[BloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Or sets the bits of other in the filter
+func (b *Bloom) Or(other Bloom) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+func (b Bloom) MarshalText() ([]byte, error) {
+	return []byte("0x" + hex.EncodeToString(b[:])), nil
+}
+
+func (b *Bloom) UnmarshalText(input []byte) error {
+	data, err := evm.ParseBytes(string(input))
+	if err != nil {
+		return err
+	}
+	if len(data) != BloomByteLength {
+		return fmt.Errorf("bloom must be %d bytes, got %d", BloomByteLength, len(data))
+	}
+	copy(b[:], data)
+	return nil
+}
+
+// LogsBloom returns the filter of the addresses and topics of logs
+func LogsBloom(logs []*evm.Log) Bloom {
+	var b Bloom
+	for _, log := range logs {
+		b.Add(log.Address[:])
+		for _, topic := range log.Topics {
+			b.Add(topic[:])
+		}
+	}
+	return b
+}
+
+// CreateBloom returns the filter of a block, the union of the
+// filters of its receipts
+func CreateBloom(receipts []*Receipt) Bloom {
+	var b Bloom
+	for _, r := range receipts {
+		b.Or(r.Bloom)
+	}
+	return b
+}
+
+// bloomBits returns the indexes of the bits of data: the low 11 bits
+// of each of the first three pairs of bytes of its hash
+func bloomBits(data []byte) [3]uint {
+	h := crypto.Keccak256(data)
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(h[2*i])<<8 | uint(h[2*i+1])) & 2047
+	}
+	return bits
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloom(t *testing.T) {
+	var b Bloom
+	for _, data := range []string{"testtest", "test", "hallo", "other"} {
+		b.Add([]byte(data))
+	}
+	for _, data := range []string{"testtest", "test", "hallo", "other"} {
+		assert.True(t, b.Test([]byte(data)), data)
+	}
+	for _, data := range []string{"tes", "lo"} {
+		assert.False(t, b.Test([]byte(data)), data)
+	}
+}
+
+// the vector of go-ethereum's TestBloomExtensively
+func TestBloomExtensively(t *testing.T) {
+	var b Bloom
+	for i := 0; i < 100; i++ {
+		b.Add([]byte(fmt.Sprintf("xxxxxxxxxx data %d yyyyyyyyyyyyyy", i)))
+	}
+	assert.Equal(t, "c8d3ca65cdb4874300a9e39475508f23ed6da09fdbc487f89a2dcf50b09eb263", fmt.Sprintf("%x", crypto.Keccak256(b[:])))
+}
+
+func TestLogsBloom(t *testing.T) {
+	topic := evm.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	logs := []*evm.Log{{Address: evm.HexToAddress("0x1000"), Topics: []evm.Hash{topic}}}
+	b := LogsBloom(logs)
+	assert.True(t, b.Test(logs[0].Address[:]))
+	assert.True(t, b.Test(topic[:]))
+	other := evm.HexToAddress("0x2000")
+	assert.False(t, b.Test(other[:]))
+
+	// the block filter is the union of the receipts
+	block := CreateBloom([]*Receipt{{Bloom: b}, {Bloom: LogsBloom([]*evm.Log{{Address: other}})}})
+	assert.True(t, block.Test(topic[:]))
+	assert.True(t, block.Test(other[:]))
+}
+
+func TestBloomJSON(t *testing.T) {
+	var b Bloom
+	b.Add([]byte("test"))
+	data, err := json.Marshal(b)
+	assert.NoError(t, err)
+	assert.Len(t, data, 2+2+2*BloomByteLength)
+
+	var decoded Bloom
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, b, decoded)
+	assert.Error(t, json.Unmarshal([]byte(`"0x00"`), &decoded))
+}
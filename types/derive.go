@@ -0,0 +1,36 @@
+package types
+
+import (
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
+)
+
+// DerivableList is a list of a block committed to by the root of a
+// trie, the transactions or the receipts
+type DerivableList interface {
+	Len() int
+	// EncodeIndex returns the canonical encoding of item i
+	EncodeIndex(i int) ([]byte, error)
+}
+
+// DeriveSha returns the root of the trie mapping the RLP encoded
+// index of each item to its encoding
+func DeriveSha(list DerivableList) (evm.Hash, error) {
+	t := trie.New()
+	for i := 0; i < list.Len(); i++ {
+		value, err := list.EncodeIndex(i)
+		if err != nil {
+			return evm.Hash{}, err
+		}
+		t.Put(rlp.AppendUint64(nil, uint64(i)), value)
+	}
+	return t.Hash(), nil
+}
+
+// Transactions are the transactions of a block
+type Transactions []*Transaction
+
+func (txs Transactions) Len() int { return len(txs) }
+
+func (txs Transactions) EncodeIndex(i int) ([]byte, error) { return txs[i].MarshalBinary() }
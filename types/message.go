@@ -0,0 +1,65 @@
+package types
+
+import (
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+)
+
+// Message is a transaction with its sender, ready to be executed.
+// GasPrice is set for legacy and access list transactions, GasFeeCap
+// and GasTipCap for the later types.
+type Message struct {
+	From       evm.Address
+	To         *evm.Address
+	Nonce      uint64
+	GasLimit   uint64
+	GasPrice   *uint256.Int
+	GasFeeCap  *uint256.Int
+	GasTipCap  *uint256.Int
+	Value      *uint256.Int
+	Data       []byte
+	AccessList AccessList
+	BlobFeeCap *uint256.Int
+	BlobHashes []evm.Hash
+}
+
+// AsMessage recovers the sender of the transaction and returns it
+// as a message
+func (tx *Transaction) AsMessage(s Signer) (*Message, error) {
+	from, err := s.Sender(tx)
+	if err != nil {
+		return nil, err
+	}
+	return tx.ToMessage(from), nil
+}
+
+// ToMessage returns the transaction as a message sent by from,
+// without checking the signature
+func (tx *Transaction) ToMessage(from evm.Address) *Message {
+	msg := &Message{
+		From:       from,
+		To:         tx.To,
+		Nonce:      tx.Nonce,
+		GasLimit:   tx.Gas,
+		Value:      orZero(tx.Value),
+		Data:       tx.Data,
+		AccessList: tx.AccessList,
+	}
+	switch tx.Type {
+	case LegacyTxType, AccessListTxType:
+		msg.GasPrice = orZero(tx.GasPrice)
+	default:
+		msg.GasFeeCap, msg.GasTipCap = orZero(tx.GasFeeCap), orZero(tx.GasTipCap)
+	}
+	if tx.Type == BlobTxType {
+		msg.BlobFeeCap, msg.BlobHashes = orZero(tx.BlobFeeCap), tx.BlobHashes
+	}
+	return msg
+}
+
+func orZero(w *uint256.Int) *uint256.Int {
+	if w == nil {
+		return uint256.NewInt(0)
+	}
+	return w.Clone()
+}
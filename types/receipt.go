@@ -0,0 +1,118 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+)
+
+// The status of a receipt, whether the execution succeeded
+const (
+	ReceiptStatusFailed     = uint64(0)
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Receipt is the outcome of a transaction included in a block. Its
+// type is the one of the transaction.
+type Receipt struct {
+	Type              byte
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*evm.Log
+
+	// the fields below are derived from the block and not encoded
+
+	GasUsed uint64
+	// ContractAddress is the address of the created contract,
+	// for a contract creation
+	ContractAddress evm.Address
+}
+
+// receiptRLP is the consensus encoding of a receipt
+type receiptRLP struct {
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*evm.Log
+}
+
+// MarshalBinary returns the canonical encoding of the receipt: the
+// RLP list of its fields, preceded by the type byte for a typed
+// transaction (EIP-2718)
+func (r *Receipt) MarshalBinary() ([]byte, error) {
+	if r.Type > BlobTxType {
+		return nil, fmt.Errorf("%w: %d", ErrTxTypeNotSupported, r.Type)
+	}
+	logs := r.Logs
+	if logs == nil {
+		logs = []*evm.Log{}
+	}
+	b, err := rlp.EncodeToBytes(&receiptRLP{r.Status, r.CumulativeGasUsed, r.Bloom, logs})
+	if err != nil {
+		return nil, err
+	}
+	if r.Type == LegacyTxType {
+		return b, nil
+	}
+	return append([]byte{r.Type}, b...), nil
+}
+
+// UnmarshalBinary decodes the canonical encoding of a receipt
+func (r *Receipt) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return errors.New("empty receipt")
+	}
+	*r = Receipt{}
+	if b[0] < 0xc0 {
+		if b[0] == LegacyTxType || b[0] > BlobTxType {
+			return fmt.Errorf("%w: %d", ErrTxTypeNotSupported, b[0])
+		}
+		r.Type, b = b[0], b[1:]
+	}
+	var dec receiptRLP
+	if err := rlp.DecodeBytes(b, &dec); err != nil {
+		return err
+	}
+	r.Status, r.CumulativeGasUsed, r.Bloom, r.Logs = dec.Status, dec.CumulativeGasUsed, dec.Bloom, dec.Logs
+	return nil
+}
+
+// EncodeRLP writes the receipt as an element of a list: receipts of
+// typed transactions are wrapped in an RLP string
+func (r *Receipt) EncodeRLP(w io.Writer) error {
+	b, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if r.Type != LegacyTxType {
+		b = rlp.AppendString(nil, b)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// DecodeRLP decodes a receipt written by EncodeRLP
+func (r *Receipt) DecodeRLP(b []byte) error {
+	kind, content, _, err := rlp.Split(b)
+	if err != nil {
+		return err
+	}
+	if kind == rlp.List {
+		return r.UnmarshalBinary(b)
+	}
+	if len(content) == 0 || content[0] >= 0xc0 {
+		return errors.New("invalid typed receipt")
+	}
+	return r.UnmarshalBinary(content)
+}
+
+// Receipts are the receipts of a block
+type Receipts []*Receipt
+
+func (rs Receipts) Len() int { return len(rs) }
+
+func (rs Receipts) EncodeIndex(i int) ([]byte, error) { return rs[i].MarshalBinary() }
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/avichalp/toy-evm/trie"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReceipts() Receipts {
+	logs := []*evm.Log{{Address: evm.HexToAddress("0x1000"), Topics: []evm.Hash{evm.HexToHash("0x01")}, Data: []byte{1, 2}}}
+	return Receipts{
+		{Type: LegacyTxType, Status: ReceiptStatusSuccessful, CumulativeGasUsed: 21000},
+		{Type: DynamicFeeTxType, Status: ReceiptStatusFailed, CumulativeGasUsed: 50000},
+		{Type: AccessListTxType, Status: ReceiptStatusSuccessful, CumulativeGasUsed: 80000, Logs: logs, Bloom: LogsBloom(logs)},
+	}
+}
+
+func TestReceiptEncoding(t *testing.T) {
+	for _, r := range testReceipts() {
+		b, err := r.MarshalBinary()
+		assert.NoError(t, err)
+		if r.Type != LegacyTxType {
+			assert.Equal(t, r.Type, b[0])
+		}
+
+		var decoded Receipt
+		assert.NoError(t, decoded.UnmarshalBinary(b))
+		assert.Equal(t, r.Type, decoded.Type)
+		assert.Equal(t, r.Status, decoded.Status)
+		assert.Equal(t, r.CumulativeGasUsed, decoded.CumulativeGasUsed)
+		assert.Equal(t, r.Bloom, decoded.Bloom)
+		assert.Len(t, decoded.Logs, len(r.Logs))
+	}
+
+	// a legacy receipt is the list of its fields
+	r := testReceipts()[0]
+	b, err := r.MarshalBinary()
+	assert.NoError(t, err)
+	want, err := rlp.EncodeToBytes([]interface{}{uint64(1), uint64(21000), Bloom{}, []interface{}{}})
+	assert.NoError(t, err)
+	assert.Equal(t, want, b)
+
+	var decoded Receipt
+	assert.ErrorIs(t, decoded.UnmarshalBinary([]byte{0x07, 0xc0}), ErrTxTypeNotSupported)
+}
+
+func TestReceiptsRLP(t *testing.T) {
+	receipts := testReceipts()
+	b, err := rlp.EncodeToBytes(receipts)
+	assert.NoError(t, err)
+	var decoded Receipts
+	assert.NoError(t, rlp.DecodeBytes(b, &decoded))
+	assert.Len(t, decoded, len(receipts))
+	assert.Equal(t, receipts[2].Logs, decoded[2].Logs)
+}
+
+func TestDeriveSha(t *testing.T) {
+	root, err := DeriveSha(Receipts{})
+	assert.NoError(t, err)
+	assert.Equal(t, evm.Hash(trie.EmptyRoot), root)
+
+	// the trie maps the encoded indexes to the receipts
+	receipts := testReceipts()
+	want := trie.New()
+	for i, r := range receipts {
+		b, err := r.MarshalBinary()
+		assert.NoError(t, err)
+		want.Put(rlp.AppendUint64(nil, uint64(i)), b)
+	}
+	root, err = DeriveSha(receipts)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.Hash(want.Hash()), root)
+
+	// a different order is a different root
+	receipts[0], receipts[1] = receipts[1], receipts[0]
+	swapped, err := DeriveSha(receipts)
+	assert.NoError(t, err)
+	assert.NotEqual(t, root, swapped)
+}
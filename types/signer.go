@@ -0,0 +1,132 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/holiman/uint256"
+)
+
+var (
+	ErrInvalidSig     = errors.New("invalid transaction v, r, s values")
+	ErrInvalidChainID = errors.New("invalid chain id for signer")
+)
+
+// Signer signs transactions and recovers their sender for a chain.
+// It accepts all transaction types, and legacy transactions with
+// and without EIP-155 replay protection.
+type Signer struct {
+	chainID *uint256.Int
+}
+
+func NewSigner(chainID uint64) Signer {
+	return Signer{uint256.NewInt(chainID)}
+}
+
+// ChainID returns the id of the chain of the signer
+func (s Signer) ChainID() *uint256.Int {
+	return s.chainID.Clone()
+}
+
+// Hash returns the hash signed by the sender of the transaction
+func (s Signer) Hash(tx *Transaction) (evm.Hash, error) {
+	fields, err := tx.fields()
+	if err != nil {
+		return evm.Hash{}, err
+	}
+	if tx.Type != LegacyTxType {
+		b, err := rlp.EncodeToBytes(fields)
+		if err != nil {
+			return evm.Hash{}, err
+		}
+		return evm.BytesToHash(crypto.Keccak256([]byte{tx.Type}, b)), nil
+	}
+	// EIP-155 appends the chain id and two zeros, transactions
+	// signed before it have a V of 27 or 28
+	if !isPreEIP155(tx.V) {
+		fields = append(fields, s.chainID, uint(0), uint(0))
+	}
+	b, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return evm.Hash{}, err
+	}
+	return evm.BytesToHash(crypto.Keccak256(b)), nil
+}
+
+// Sender recovers the address that signed the transaction
+func (s Signer) Sender(tx *Transaction) (evm.Address, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return evm.Address{}, ErrInvalidSig
+	}
+	var recoveryID *uint256.Int
+	switch {
+	case tx.Type != LegacyTxType:
+		if tx.ChainID == nil || !tx.ChainID.Eq(s.chainID) {
+			return evm.Address{}, fmt.Errorf("%w: have %v want %v", ErrInvalidChainID, tx.ChainID, s.chainID)
+		}
+		recoveryID = tx.V
+	case isPreEIP155(tx.V):
+		recoveryID = new(uint256.Int).Sub(tx.V, uint256.NewInt(27))
+	default:
+		// V is 35 + 2 * chain id + recovery id
+		if tx.V.Lt(uint256.NewInt(35)) {
+			return evm.Address{}, ErrInvalidSig
+		}
+		v := new(uint256.Int).Sub(tx.V, uint256.NewInt(35))
+		chainID := new(uint256.Int).Rsh(v, 1)
+		if !chainID.Eq(s.chainID) {
+			return evm.Address{}, fmt.Errorf("%w: have %v want %v", ErrInvalidChainID, chainID, s.chainID)
+		}
+		recoveryID = new(uint256.Int).And(v, uint256.NewInt(1))
+	}
+	if !recoveryID.IsUint64() || recoveryID.Uint64() > 1 || !crypto.ValidateSignatureValues(tx.R, tx.S, true) {
+		return evm.Address{}, ErrInvalidSig
+	}
+
+	hash, err := s.Hash(tx)
+	if err != nil {
+		return evm.Address{}, err
+	}
+	r, sv := tx.R.Bytes32(), tx.S.Bytes32()
+	sig := append(append(r[:], sv[:]...), byte(recoveryID.Uint64()))
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return evm.Address{}, ErrInvalidSig
+	}
+	return evm.BytesToAddress(crypto.PublicKeyToAddress(pub)), nil
+}
+
+// SignTx signs the transaction with the private key, setting its
+// chain id and signature values. Legacy transactions are signed
+// with EIP-155 replay protection.
+func (s Signer) SignTx(tx *Transaction, key []byte) error {
+	if tx.Type == LegacyTxType {
+		// any V but 27 and 28 selects the EIP-155 hash
+		tx.V = uint256.NewInt(35)
+	} else {
+		tx.ChainID = s.ChainID()
+	}
+	hash, err := s.Hash(tx)
+	if err != nil {
+		return err
+	}
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return err
+	}
+	tx.R = new(uint256.Int).SetBytes(sig[:32])
+	tx.S = new(uint256.Int).SetBytes(sig[32:64])
+	tx.V = uint256.NewInt(uint64(sig[64]))
+	if tx.Type == LegacyTxType {
+		v := new(uint256.Int).Lsh(s.chainID, 1)
+		tx.V.Add(tx.V, v.Add(v, uint256.NewInt(35)))
+	}
+	return nil
+}
+
+func isPreEIP155(v *uint256.Int) bool {
+	return v != nil && v.IsUint64() && (v.Uint64() == 27 || v.Uint64() == 28)
+}
@@ -0,0 +1,123 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+var secp256k1N, _ = uint256.FromHex("0xfffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+
+func TestSenderEIP155Example(t *testing.T) {
+	var tx Transaction
+	assert.NoError(t, tx.UnmarshalBinary(evm.HexToBytes(eip155Tx)))
+
+	signer := NewSigner(1)
+	hash, err := signer.Hash(&tx)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToHash("0xdaf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53"), hash)
+
+	from, err := signer.Sender(&tx)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToAddress("0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"), from)
+
+	// replayed on another chain
+	_, err = NewSigner(5).Sender(&tx)
+	assert.ErrorIs(t, err, ErrInvalidChainID)
+}
+
+func TestSignTx(t *testing.T) {
+	key := evm.HexToBytes("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+	want := evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	signer := NewSigner(1337)
+	for _, tx := range testTransactions() {
+		assert.NoError(t, signer.SignTx(tx, key))
+		from, err := signer.Sender(tx)
+		assert.NoError(t, err)
+		assert.Equal(t, want, from, "type %d", tx.Type)
+
+		if tx.Type == LegacyTxType {
+			assert.True(t, tx.V.Uint64() == 2709 || tx.V.Uint64() == 2710)
+		} else {
+			assert.Equal(t, uint256.NewInt(1337), tx.ChainID)
+			_, err := NewSigner(1).Sender(tx)
+			assert.ErrorIs(t, err, ErrInvalidChainID)
+		}
+
+		// a changed field recovers another sender
+		tx.Nonce++
+		from, err = signer.Sender(tx)
+		assert.NoError(t, err)
+		assert.NotEqual(t, want, from)
+	}
+}
+
+func TestSenderPreEIP155(t *testing.T) {
+	key := evm.HexToBytes("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+	tx := testTransactions()[0]
+	// a V of 27 selects the hash without the chain id
+	tx.V = uint256.NewInt(27)
+	hash, err := NewSigner(1).Hash(tx)
+	assert.NoError(t, err)
+	sig, err := crypto.Sign(hash[:], key)
+	assert.NoError(t, err)
+	tx.R = new(uint256.Int).SetBytes(sig[:32])
+	tx.S = new(uint256.Int).SetBytes(sig[32:64])
+	tx.V = uint256.NewInt(27 + uint64(sig[64]))
+
+	// it is valid on any chain
+	for _, chainID := range []uint64{1, 5} {
+		from, err := NewSigner(chainID).Sender(tx)
+		assert.NoError(t, err)
+		assert.Equal(t, evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"), from)
+	}
+}
+
+func TestSenderInvalidSignature(t *testing.T) {
+	var tx Transaction
+	assert.NoError(t, tx.UnmarshalBinary(evm.HexToBytes(eip155Tx)))
+	signer := NewSigner(1)
+
+	missing := tx
+	missing.R = nil
+	_, err := signer.Sender(&missing)
+	assert.ErrorIs(t, err, ErrInvalidSig)
+
+	// s in the upper half of the curve order (EIP-2)
+	high := tx
+	high.S = new(uint256.Int).Sub(secp256k1N, tx.S)
+	_, err = signer.Sender(&high)
+	assert.ErrorIs(t, err, ErrInvalidSig)
+
+	lowV := tx
+	lowV.V = uint256.NewInt(30)
+	_, err = signer.Sender(&lowV)
+	assert.ErrorIs(t, err, ErrInvalidSig)
+}
+
+func TestAsMessage(t *testing.T) {
+	key := evm.HexToBytes("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+	signer := NewSigner(1)
+	txs := testTransactions()
+	for _, tx := range txs {
+		assert.NoError(t, signer.SignTx(tx, key))
+	}
+
+	legacy, err := txs[2].AsMessage(signer)
+	assert.NoError(t, err)
+	assert.Equal(t, uint256.NewInt(1), legacy.GasPrice)
+	assert.Nil(t, legacy.GasFeeCap)
+	assert.Equal(t, txs[2].AccessList, legacy.AccessList)
+
+	blob, err := txs[4].AsMessage(signer)
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"), blob.From)
+	assert.Nil(t, blob.GasPrice)
+	assert.Equal(t, uint256.NewInt(10), blob.GasFeeCap)
+	assert.Equal(t, uint256.NewInt(1), blob.GasTipCap)
+	assert.Equal(t, uint256.NewInt(7), blob.BlobFeeCap)
+	assert.Equal(t, uint64(30000), blob.GasLimit)
+}
@@ -0,0 +1,233 @@
+// Package types holds the Ethereum transactions and their
+// encodings, signatures and senders
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/avichalp/toy-evm/crypto"
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/holiman/uint256"
+)
+
+// The transaction types, legacy transactions have no type byte
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01 // EIP-2930
+	DynamicFeeTxType = 0x02 // EIP-1559
+	BlobTxType       = 0x03 // EIP-4844
+)
+
+var (
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrBlobTxCreate       = errors.New("blob transaction of type create")
+)
+
+// AccessTuple is an address and the storage keys of it that a
+// transaction accesses (EIP-2930)
+type AccessTuple struct {
+	Address     evm.Address `json:"address"`
+	StorageKeys []evm.Hash  `json:"storageKeys"`
+}
+
+type AccessList []AccessTuple
+
+// StorageKeys returns the number of storage keys in the list
+func (al AccessList) StorageKeys() int {
+	n := 0
+	for _, tuple := range al {
+		n += len(tuple.StorageKeys)
+	}
+	return n
+}
+
+// Transaction is a transaction of any type. The fields that don't
+// belong to its type are ignored: GasPrice is the price of legacy
+// and access list transactions, GasTipCap and GasFeeCap the fees of
+// the later types. ChainID is only encoded in typed transactions,
+// legacy ones carry it in V (EIP-155).
+type Transaction struct {
+	Type       byte
+	ChainID    *uint256.Int
+	Nonce      uint64
+	GasPrice   *uint256.Int
+	GasTipCap  *uint256.Int // max priority fee per gas
+	GasFeeCap  *uint256.Int // max fee per gas
+	Gas        uint64
+	To         *evm.Address // nil for a contract creation
+	Value      *uint256.Int
+	Data       []byte
+	AccessList AccessList
+	BlobFeeCap *uint256.Int // max fee per blob gas
+	BlobHashes []evm.Hash
+	// V is the recovery id, plus 27 or 35 + 2 * chain id for legacy
+	// transactions, and R and S the signature values
+	V, R, S *uint256.Int
+}
+
+// fields returns pointers to the fields encoded for the type of the
+// transaction, in order, without the signature values
+func (tx *Transaction) fields() ([]interface{}, error) {
+	to := &recipient{&tx.To}
+	switch tx.Type {
+	case LegacyTxType:
+		return []interface{}{&tx.Nonce, &tx.GasPrice, &tx.Gas, to, &tx.Value, &tx.Data}, nil
+	case AccessListTxType:
+		return []interface{}{&tx.ChainID, &tx.Nonce, &tx.GasPrice, &tx.Gas, to, &tx.Value, &tx.Data, &tx.AccessList}, nil
+	case DynamicFeeTxType:
+		return []interface{}{&tx.ChainID, &tx.Nonce, &tx.GasTipCap, &tx.GasFeeCap, &tx.Gas, to, &tx.Value, &tx.Data, &tx.AccessList}, nil
+	case BlobTxType:
+		return []interface{}{&tx.ChainID, &tx.Nonce, &tx.GasTipCap, &tx.GasFeeCap, &tx.Gas, to, &tx.Value, &tx.Data, &tx.AccessList, &tx.BlobFeeCap, &tx.BlobHashes}, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrTxTypeNotSupported, tx.Type)
+}
+
+// MarshalBinary returns the canonical encoding of the transaction:
+// the RLP list of a legacy transaction, or the type byte followed by
+// the RLP list of a typed one
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	fields, err := tx.fields()
+	if err != nil {
+		return nil, err
+	}
+	if tx.Type == BlobTxType && tx.To == nil {
+		return nil, ErrBlobTxCreate
+	}
+	b, err := rlp.EncodeToBytes(append(fields, tx.V, tx.R, tx.S))
+	if err != nil {
+		return nil, err
+	}
+	if tx.Type == LegacyTxType {
+		return b, nil
+	}
+	return append([]byte{tx.Type}, b...), nil
+}
+
+// UnmarshalBinary decodes the canonical encoding of a transaction
+func (tx *Transaction) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return errors.New("empty transaction")
+	}
+	*tx = Transaction{}
+	if b[0] >= 0xc0 {
+		tx.Type = LegacyTxType
+	} else if b[0] <= 0x7f {
+		tx.Type, b = b[0], b[1:]
+		if tx.Type == LegacyTxType {
+			return fmt.Errorf("%w: %d", ErrTxTypeNotSupported, tx.Type)
+		}
+	} else {
+		return errors.New("invalid transaction encoding")
+	}
+	fields, err := tx.fields()
+	if err != nil {
+		return err
+	}
+	if err := decodeList(b, append(fields, &tx.V, &tx.R, &tx.S)); err != nil {
+		return err
+	}
+	if tx.Type == BlobTxType && tx.To == nil {
+		return ErrBlobTxCreate
+	}
+	return nil
+}
+
+// EncodeRLP writes the transaction as an element of a block body:
+// typed transactions are wrapped in an RLP string (EIP-2718)
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	b, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if tx.Type != LegacyTxType {
+		b = rlp.AppendString(nil, b)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// DecodeRLP decodes a transaction of a block body
+func (tx *Transaction) DecodeRLP(b []byte) error {
+	kind, content, _, err := rlp.Split(b)
+	if err != nil {
+		return err
+	}
+	if kind == rlp.List {
+		return tx.UnmarshalBinary(b)
+	}
+	if len(content) == 0 || content[0] >= 0xc0 {
+		return errors.New("invalid typed transaction")
+	}
+	return tx.UnmarshalBinary(content)
+}
+
+// Hash returns the hash of the canonical encoding
+func (tx *Transaction) Hash() evm.Hash {
+	b, err := tx.MarshalBinary()
+	if err != nil {
+		return evm.Hash{}
+	}
+	return evm.BytesToHash(crypto.Keccak256(b))
+}
+
+// decodeList decodes the items of the RLP list b into fields
+func decodeList(b []byte, fields []interface{}) error {
+	content, rest, err := rlp.SplitList(b)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return rlp.ErrMoreThanOneValue
+	}
+	for _, field := range fields {
+		if len(content) == 0 {
+			return rlp.ErrTooFewElements
+		}
+		_, _, tail, err := rlp.Split(content)
+		if err != nil {
+			return err
+		}
+		if err := rlp.DecodeBytes(content[:len(content)-len(tail)], field); err != nil {
+			return err
+		}
+		content = tail
+	}
+	if len(content) > 0 {
+		return rlp.ErrTooManyElements
+	}
+	return nil
+}
+
+// recipient encodes the to field, which is empty for a contract
+// creation
+type recipient struct {
+	to **evm.Address
+}
+
+func (r recipient) EncodeRLP(w io.Writer) error {
+	var b []byte
+	if *r.to == nil {
+		b = rlp.AppendString(nil, nil)
+	} else {
+		b = rlp.AppendString(nil, (*r.to)[:])
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func (r *recipient) DecodeRLP(b []byte) error {
+	if bytes.Equal(b, []byte{0x80}) {
+		*r.to = nil
+		return nil
+	}
+	var addr evm.Address
+	if err := rlp.DecodeBytes(b, &addr); err != nil {
+		return err
+	}
+	*r.to = &addr
+	return nil
+}
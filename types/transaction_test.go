@@ -0,0 +1,109 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/avichalp/toy-evm/evm"
+	"github.com/avichalp/toy-evm/rlp"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// the signed example transaction of EIP-155
+const eip155Tx = "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+
+func testTransactions() []*Transaction {
+	to := evm.HexToAddress("0x3535353535353535353535353535353535353535")
+	accessList := AccessList{{Address: to, StorageKeys: []evm.Hash{evm.HexToHash("0x01")}}}
+	return []*Transaction{
+		{Type: LegacyTxType, Nonce: 9, GasPrice: uint256.NewInt(20e9), Gas: 21000, To: &to, Value: uint256.NewInt(1e18)},
+		{Type: LegacyTxType, GasPrice: uint256.NewInt(1), Gas: 60000, Value: uint256.NewInt(0), Data: []byte{0x60, 0x00}},
+		{Type: AccessListTxType, Nonce: 1, GasPrice: uint256.NewInt(1), Gas: 30000, To: &to, Value: uint256.NewInt(0), AccessList: accessList},
+		{Type: DynamicFeeTxType, Nonce: 2, GasTipCap: uint256.NewInt(1), GasFeeCap: uint256.NewInt(10), Gas: 30000, To: &to, Value: uint256.NewInt(5), Data: []byte{1, 2}},
+		{Type: BlobTxType, Nonce: 3, GasTipCap: uint256.NewInt(1), GasFeeCap: uint256.NewInt(10), Gas: 30000, To: &to, Value: uint256.NewInt(0),
+			AccessList: AccessList{}, BlobFeeCap: uint256.NewInt(7), BlobHashes: []evm.Hash{evm.HexToHash("0x0100")}},
+	}
+}
+
+func TestDecodeEIP155Example(t *testing.T) {
+	var tx Transaction
+	assert.NoError(t, tx.UnmarshalBinary(evm.HexToBytes(eip155Tx)))
+	assert.Equal(t, byte(LegacyTxType), tx.Type)
+	assert.Equal(t, uint64(9), tx.Nonce)
+	assert.Equal(t, uint256.NewInt(20e9), tx.GasPrice)
+	assert.Equal(t, evm.HexToAddress("0x3535353535353535353535353535353535353535"), *tx.To)
+	assert.Equal(t, uint256.NewInt(37), tx.V)
+	assert.Equal(t, evm.HexToHash("0x33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788"), tx.Hash())
+
+	b, err := tx.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, evm.HexToBytes(eip155Tx), b)
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	signer := NewSigner(1)
+	key := evm.HexToBytes("4646464646464646464646464646464646464646464646464646464646464646")
+	for _, tx := range testTransactions() {
+		assert.NoError(t, signer.SignTx(tx, key))
+		b, err := tx.MarshalBinary()
+		assert.NoError(t, err)
+		if tx.Type != LegacyTxType {
+			assert.Equal(t, tx.Type, b[0])
+		}
+
+		var decoded Transaction
+		assert.NoError(t, decoded.UnmarshalBinary(b))
+		assert.Equal(t, tx.Hash(), decoded.Hash())
+		assert.Equal(t, tx.To, decoded.To)
+		assert.Equal(t, tx.V, decoded.V)
+		assert.Len(t, decoded.AccessList, len(tx.AccessList))
+	}
+}
+
+func TestTransactionBody(t *testing.T) {
+	signer := NewSigner(1)
+	key := evm.HexToBytes("4646464646464646464646464646464646464646464646464646464646464646")
+	txs := testTransactions()
+	for _, tx := range txs {
+		assert.NoError(t, signer.SignTx(tx, key))
+	}
+	b, err := rlp.EncodeToBytes(txs)
+	assert.NoError(t, err)
+
+	// typed transactions are strings in the list
+	var raw []rlp.RawValue
+	assert.NoError(t, rlp.DecodeBytes(b, &raw))
+	assert.Equal(t, byte(0xf8), raw[0][0])
+	assert.Equal(t, byte(0xb8), raw[2][0])
+
+	var decoded []*Transaction
+	assert.NoError(t, rlp.DecodeBytes(b, &decoded))
+	assert.Len(t, decoded, len(txs))
+	for i, tx := range decoded {
+		assert.Equal(t, txs[i].Hash(), tx.Hash())
+	}
+}
+
+func TestTransactionDecodeErrors(t *testing.T) {
+	var tx Transaction
+	assert.Error(t, tx.UnmarshalBinary(nil))
+	assert.ErrorIs(t, tx.UnmarshalBinary([]byte{0x05, 0xc0}), ErrTxTypeNotSupported)
+	assert.ErrorIs(t, tx.UnmarshalBinary([]byte{0x00, 0xc0}), ErrTxTypeNotSupported)
+	assert.ErrorIs(t, tx.UnmarshalBinary([]byte{0x02, 0xc0}), rlp.ErrTooFewElements)
+	// a trailing byte after the list
+	assert.ErrorIs(t, tx.UnmarshalBinary(append(evm.HexToBytes(eip155Tx), 0x00)), rlp.ErrMoreThanOneValue)
+
+	blob := testTransactions()[4]
+	blob.To = nil
+	_, err := blob.MarshalBinary()
+	assert.ErrorIs(t, err, ErrBlobTxCreate)
+}
+
+func TestAccessListStorageKeys(t *testing.T) {
+	al := AccessList{
+		{StorageKeys: []evm.Hash{{}, {}}},
+		{},
+		{StorageKeys: []evm.Hash{{}}},
+	}
+	assert.Equal(t, 3, al.StorageKeys())
+}